@@ -0,0 +1,92 @@
+package zipfs
+
+import (
+	"fmt"
+	"hash/fnv"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"time"
+)
+
+// archiveETag returns the ETag of the ZIP file, which is calculated from
+// its size and central directory, so that it changes when any of the
+// files in it change.
+func archiveETag(fs *FileSystem) string {
+	hash := fnv.New64a()
+	fmt.Fprintf(hash, "%d\n", fs.size)
+	for _, zf := range fs.reader.File {
+		fmt.Fprintf(hash, "%q %08x %d %d %d\n", zf.Name, zf.CRC32,
+			zf.CompressedSize64, zf.UncompressedSize64, zf.Modified.Unix())
+	}
+	return fmt.Sprintf(`"zip-%x"`, hash.Sum64())
+}
+
+// archiveInfo describes the ZIP file served at the path set by
+// WithArchiveDownload, for the access check.
+type archiveInfo struct {
+	name string
+	fs   *FileSystem
+}
+
+func (ai archiveInfo) Name() string      { return path.Base(ai.name) }
+func (ai archiveInfo) Size() int64       { return ai.fs.size }
+func (ai archiveInfo) Mode() os.FileMode { return 0444 }
+func (ai archiveInfo) IsDir() bool       { return false }
+func (ai archiveInfo) Sys() interface{}  { return nil }
+func (ai archiveInfo) ModTime() time.Time {
+	if ai.fs.handleStat != nil {
+		return ai.fs.handleStat.ModTime()
+	}
+	return time.Time{}
+}
+
+// serveArchive responds to a request for the path set by
+// WithArchiveDownload with the contents of the ZIP file itself.
+func (h *fileHandler) serveArchive(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		w.Header().Set("Allow", "GET, HEAD")
+		h.error(w, r, http.StatusMethodNotAllowed, errMethodNotAllowed)
+		return
+	}
+	fs := h.fs
+	if fs.readerAt == nil {
+		h.error(w, r, http.StatusInternalServerError, ErrClosed)
+		return
+	}
+	if !h.checkAccess(w, r, h.archivePath, archiveInfo{h.archivePath, fs}) {
+		return
+	}
+
+	w.Header().Set("Etag", h.archiveETag)
+	h.setCacheControl(w, h.archivePath)
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", contentDisposition(path.Base(h.archivePath)))
+	w.Header().Set("Accept-Ranges", "bytes")
+	if h.checkPreconditions(w, r, time.Time{}) {
+		return
+	}
+	ranges, err := effectiveRanges(checkIfRange(r, h.archiveETag, time.Time{}), fs.size)
+	if err != nil {
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", fs.size))
+		h.error(w, r, http.StatusRequestedRangeNotSatisfiable, err)
+		return
+	}
+	content := io.NewSectionReader(fs.readerAt, 0, fs.size)
+	if len(ranges) > 0 {
+		h.serveRanges(w, r, h.archivePath, content, fs.size, ranges)
+		return
+	}
+
+	w.Header().Set("Content-Length", strconv.FormatInt(fs.size, 10))
+	w.WriteHeader(http.StatusOK)
+	if r.Method == "HEAD" {
+		return
+	}
+	tw := h.bodyWriter(w, r)
+	if _, err := io.Copy(tw, content); err != nil {
+		h.logError(r, newBodyError(r, h.archivePath, tw.written, tw.err, err))
+	}
+}
@@ -0,0 +1,110 @@
+package zipfs
+
+import (
+	"archive/zip"
+	"bytes"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestArchiveDownload(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	data, err := os.ReadFile("testdata/testdata.zip")
+	require.NoError(err)
+	fs, err := New("testdata/testdata.zip")
+	require.NoError(err)
+	defer fs.Close()
+	handler := FileServer(fs, WithArchiveDownload("site.zip"))
+
+	w := serveTestRequest(handler, "GET", "/site.zip")
+	require.Equal(200, w.status)
+	assert.Equal("application/zip", w.Header().Get("Content-Type"))
+	assert.Equal(`attachment; filename="site.zip"`, w.Header().Get("Content-Disposition"))
+	assert.Equal(len(data), w.buf.Len())
+	assert.Equal(data, w.buf.Bytes())
+	etag := w.Header().Get("Etag")
+	assert.Regexp(`^"zip-[0-9a-f]+"$`, etag)
+
+	zr, err := zip.NewReader(bytes.NewReader(w.buf.Bytes()), int64(w.buf.Len()))
+	require.NoError(err)
+	assert.Equal(len(fs.reader.File), len(zr.File))
+	for _, zf := range zr.File {
+		if zf.FileInfo().IsDir() {
+			continue
+		}
+		_, err := readZipFile(zf)
+		assert.NoError(err, zf.Name)
+	}
+
+	w = serveTestRequest(handler, "HEAD", "/site.zip")
+	assert.Equal(200, w.status)
+	assert.Equal(0, w.buf.Len())
+
+	w = serveTestRequest(handler, "GET", "/site.zip", "If-None-Match: "+etag)
+	assert.Equal(304, w.status)
+
+	w = serveTestRequest(handler, "GET", "/site.zip", "Range: bytes=0-3")
+	assert.Equal(206, w.status)
+	assert.Equal("PK\x03\x04", w.buf.String())
+	assert.Equal("bytes 0-3/"+strconv.Itoa(len(data)), w.Header().Get("Content-Range"))
+
+	w = serveTestRequest(handler, "POST", "/site.zip")
+	assert.Equal(405, w.status)
+
+	// the ETag depends on the contents
+	fs2 := newTestFileSystem(t, map[string]string{"a.txt": "a"})
+	fs3 := newTestFileSystem(t, map[string]string{"a.txt": "b"})
+	assert.NotEqual(archiveETag(fs2), archiveETag(fs3))
+
+	// a file in the archive takes precedence
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+	fs4 := newTestFileSystem(t, map[string]string{"site.zip": "file"})
+	w = serveTestRequest(FileServer(fs4, WithArchiveDownload("/site.zip")), "GET", "/site.zip")
+	assert.Equal(200, w.status)
+	assert.Equal("file", w.buf.String())
+	assert.Contains(logged.String(), "/site.zip is in the archive")
+}
+
+func TestArchiveDownloadAccessCheck(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	fs, err := New("testdata/testdata.zip")
+	require.NoError(err)
+	defer fs.Close()
+	var checked os.FileInfo
+	handler := FileServer(fs, WithArchiveDownload("/site.zip"),
+		WithAccessCheck(func(r *http.Request, name string, fi os.FileInfo) error {
+			if name != "/site.zip" {
+				return nil
+			}
+			checked = fi
+			if r.Header.Get("Authorization") == "" {
+				return ErrUnauthorized
+			}
+			return nil
+		}))
+
+	w := serveTestRequest(handler, "GET", "/site.zip")
+	assert.Equal(401, w.status)
+	assert.NotEqual("application/zip", w.Header().Get("Content-Type"))
+	assert.Empty(w.Header().Get("Etag"))
+	require.NotNil(checked)
+	assert.Equal("site.zip", checked.Name())
+	assert.Equal(fs.size, checked.Size())
+	assert.False(checked.IsDir())
+
+	w = serveTestRequest(handler, "GET", "/site.zip", "Authorization: Basic eDp5")
+	assert.Equal(200, w.status)
+	assert.Equal(int(fs.size), w.buf.Len())
+}
@@ -0,0 +1,89 @@
+package zipfs
+
+import (
+	"net/http"
+	"path"
+	"strings"
+)
+
+// isAttachment reports whether the file at name is to be downloaded
+// by the client, rather than displayed, in response to the request.
+func (h *fileHandler) isAttachment(r *http.Request, name string) bool {
+	attachment := false
+	for _, pattern := range h.attachments {
+		if matchPath(pattern, name) {
+			attachment = true
+			break
+		}
+	}
+	if h.attachmentFunc != nil {
+		attachment = h.attachmentFunc(r, name, attachment)
+	}
+	return attachment
+}
+
+// contentDisposition returns the value of a Content-Disposition header
+// for downloading a file with the name filename. Names that are not
+// ASCII are given with the filename* parameter of RFC 6266, along with
+// an ASCII approximation for clients that do not support it.
+func contentDisposition(filename string) string {
+	var b strings.Builder
+	b.WriteString(`attachment; filename="`)
+	ascii := true
+	for _, c := range filename {
+		switch {
+		case c >= 0x80:
+			ascii = false
+			b.WriteByte('_')
+		case c < 0x20 || c == 0x7f:
+			b.WriteByte('_')
+		case c == '"' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(c)
+		default:
+			b.WriteRune(c)
+		}
+	}
+	b.WriteByte('"')
+	if !ascii {
+		b.WriteString("; filename*=UTF-8''")
+		b.WriteString(encodeExtValue(filename))
+	}
+	return b.String()
+}
+
+// encodeExtValue percent-encodes s for use as the value of an
+// extended parameter, as described by RFC 5987.
+func encodeExtValue(s string) string {
+	const hex = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if isAttrChar(c) {
+			b.WriteByte(c)
+		} else {
+			b.WriteByte('%')
+			b.WriteByte(hex[c>>4])
+			b.WriteByte(hex[c&15])
+		}
+	}
+	return b.String()
+}
+
+// isAttrChar reports whether c can appear unencoded in the
+// value of an extended parameter.
+func isAttrChar(c byte) bool {
+	switch {
+	case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		return true
+	}
+	return strings.IndexByte("!#$&+-.^_`|~", c) >= 0
+}
+
+// setContentDisposition sets the Content-Disposition header if the
+// file at name is to be downloaded as an attachment.
+func (h *fileHandler) setContentDisposition(w http.ResponseWriter, r *http.Request, name string) {
+	if (h.attachments != nil || h.attachmentFunc != nil) && h.isAttachment(r, name) {
+		w.Header().Set("Content-Disposition", contentDisposition(path.Base(name)))
+	}
+}
@@ -0,0 +1,63 @@
+package zipfs
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContentDisposition(t *testing.T) {
+	testCases := []struct {
+		Filename string
+		Value    string
+	}{
+		{"report.pdf", `attachment; filename="report.pdf"`},
+		{"annual report 2024.pdf", `attachment; filename="annual report 2024.pdf"`},
+		{`say "hi".txt`, `attachment; filename="say \"hi\".txt"`},
+		{"Übersicht März.pdf", `attachment; filename="_bersicht M_rz.pdf"; filename*=UTF-8''%C3%9Cbersicht%20M%C3%A4rz.pdf`},
+		{"日本.txt", `attachment; filename="__.txt"; filename*=UTF-8''%E6%97%A5%E6%9C%AC.txt`},
+	}
+	for _, tc := range testCases {
+		assert.Equal(t, tc.Value, contentDisposition(tc.Filename), tc.Filename)
+	}
+}
+
+func TestAttachment(t *testing.T) {
+	assert := assert.New(t)
+
+	fs := newTestFileSystem(t, map[string]string{
+		"downloads/annual report.pdf":  "pdf",
+		"downloads/Übersicht März.csv": "csv",
+		"assets.zip":                   "zip",
+		"index.html":                   "<html></html>",
+		"image.png":                    "png",
+	})
+	handler := FileServer(fs,
+		WithAttachment("/downloads/**", "*.zip"),
+		WithAttachmentFunc(func(r *http.Request, name string, attachment bool) bool {
+			return attachment || r.URL.Query().Get("download") == "1"
+		}))
+
+	testCases := []struct {
+		Path        string
+		Disposition string
+	}{
+		{"/downloads/annual report.pdf", `attachment; filename="annual report.pdf"`},
+		{"/downloads/Übersicht März.csv", `attachment; filename="_bersicht M_rz.csv"; filename*=UTF-8''%C3%9Cbersicht%20M%C3%A4rz.csv`},
+		{"/assets.zip", `attachment; filename="assets.zip"`},
+		{"/image.png", ""},
+		{"/image.png?download=1", `attachment; filename="image.png"`},
+		{"/", ""},
+	}
+	for _, tc := range testCases {
+		w := serveTestRequest(handler, "GET", tc.Path)
+		assert.Equal(200, w.status, tc.Path)
+		assert.Equal(tc.Disposition, w.Header().Get("Content-Disposition"), tc.Path)
+	}
+
+	// inline by default
+	w := serveTestRequest(FileServer(fs), "GET", "/assets.zip")
+	assert.Equal(200, w.status)
+	assert.Empty(w.Header().Get("Content-Disposition"))
+}
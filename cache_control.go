@@ -0,0 +1,79 @@
+package zipfs
+
+import (
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// CacheRule specifies the Cache-Control header value for
+// files whose path matches a pattern.
+type CacheRule struct {
+	// Pattern is matched against the path of the file being served,
+	// which always starts with a slash. A pattern that ends with a slash
+	// matches all files with that prefix, as does one that ends with
+	// "/**" instead of the slash. A pattern that does not contain
+	// a slash is matched against the base name of the file. Otherwise the
+	// pattern is matched against the whole path. Patterns use the syntax
+	// of path.Match, and a malformed pattern matches nothing.
+	Pattern string
+
+	// Value is the value of the Cache-Control header.
+	Value string
+}
+
+// matches reports whether the rule applies to the file at name.
+func (rule CacheRule) matches(name string) bool {
+	return matchPath(rule.Pattern, name)
+}
+
+// matchPath reports whether name matches pattern. See CacheRule
+// for a description of the pattern syntax.
+func matchPath(pattern, name string) bool {
+	if dir, ok := strings.CutSuffix(pattern, "/**"); ok {
+		pattern = dir + "/"
+	}
+	if strings.HasSuffix(pattern, "/") {
+		return strings.HasPrefix(name, pattern)
+	}
+	if !strings.Contains(pattern, "/") {
+		name = path.Base(name)
+	}
+	matched, err := path.Match(pattern, name)
+	return err == nil && matched
+}
+
+// immutableCacheControl is the Cache-Control header value
+// for files with fingerprinted names.
+const immutableCacheControl = "public, max-age=31536000, immutable"
+
+// defaultFingerprint matches file names that contain a fingerprint of
+// at least eight hexadecimal digits before the extension, such as
+// "app.3f9ab2c1.js" and "app-3f9ab2c1.js".
+var defaultFingerprint = regexp.MustCompile(`[.-][0-9a-fA-F]{8,}\.[^.]+$`)
+
+// cacheControlFor returns the Cache-Control header value for the
+// file found at name, or an empty string if there is none.
+func (h *fileHandler) cacheControlFor(name string) string {
+	if h.fingerprint != nil && h.fingerprint.MatchString(path.Base(name)) {
+		return immutableCacheControl
+	}
+	for _, rule := range h.cacheRules {
+		if rule.matches(name) {
+			return rule.Value
+		}
+	}
+	return h.cacheControl
+}
+
+// setCacheControl sets the Cache-Control header for the file found
+// at name, unless the header has already been set.
+func (h *fileHandler) setCacheControl(w http.ResponseWriter, name string) {
+	if _, haveCacheControl := w.Header()["Cache-Control"]; haveCacheControl {
+		return
+	}
+	if value := h.cacheControlFor(name); value != "" {
+		w.Header().Set("Cache-Control", value)
+	}
+}
@@ -0,0 +1,124 @@
+package zipfs
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatchPath(t *testing.T) {
+	assert := assert.New(t)
+	testCases := []struct {
+		Pattern string
+		Name    string
+		Match   bool
+	}{
+		{"/img/", "/img/circle.png", true},
+		{"/img/", "/img", false},
+		{"/img/", "/images/circle.png", false},
+		{"/img/**", "/img/icons/circle.png", true},
+		{"/img/**", "/img", false},
+		{"/img/**", "/images/circle.png", false},
+		{"*.png", "/img/circle.png", true},
+		{"*.png", "/circle.png", true},
+		{"*.png", "/img/circle.png.txt", false},
+		{"/*.html", "/index.html", true},
+		{"/*.html", "/docs/index.html", false},
+		{"/img/*.png", "/img/circle.png", true},
+		{"/img/c*", "/img/circle.png", true},
+		{"/img/[", "/img/[", false},
+		{"[", "/[", false},
+	}
+
+	for _, tc := range testCases {
+		assert.Equal(tc.Match, matchPath(tc.Pattern, tc.Name), tc.Pattern+" "+tc.Name)
+	}
+}
+
+func TestCacheRules(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	fs, err := New("testdata/testdata.zip")
+	require.NoError(err)
+	defer fs.Close()
+
+	handler := FileServer(fs,
+		WithCacheControl("public, max-age=60"),
+		WithCacheRules([]CacheRule{
+			{Pattern: "*.html", Value: "no-cache"},
+			{Pattern: "/img/another-*", Value: "no-store"},
+			{Pattern: "/img/", Value: "public, max-age=86400"},
+			{Pattern: "/js/*.js", Value: "public, max-age=31536000, immutable"},
+			{Pattern: "/img/circle.png", Value: "never used"},
+		}),
+	)
+
+	testCases := []struct {
+		Path         string
+		Status       int
+		CacheControl string
+	}{
+		{"/", 200, "no-cache"},
+		{"/test.html", 200, "no-cache"},
+		{"/img/another-circle.png", 200, "no-store"},
+		{"/img/circle.png", 200, "public, max-age=86400"},
+		{"/js/application-23a0..js", 200, "public, max-age=31536000, immutable"},
+		{"/random.dat", 200, "public, max-age=60"},
+		{"/img/does-not-exist.png", 404, ""},
+	}
+
+	for _, tc := range testCases {
+		w := serveTestRequest(handler, "GET", tc.Path)
+		assert.Equal(tc.Status, w.status, tc.Path)
+		assert.Equal(tc.CacheControl, w.Header().Get("Cache-Control"), tc.Path)
+	}
+}
+
+func TestImmutableFingerprints(t *testing.T) {
+	assert := assert.New(t)
+
+	fs := newTestFileSystem(t, map[string]string{
+		"app.3f9ab2c1.js":        "console.log('app')",
+		"app-3F9AB2C1D4.css":     "body {}",
+		"img/logo.0123abcd.png":  "png",
+		"app.3f9ab2c.js":         "seven digits",
+		"app.3f9ab2cg.js":        "not hex",
+		"3f9ab2c1.js":            "no name",
+		"app.js":                 "no fingerprint",
+		"vendor/lib.v1234567.js": "version",
+	})
+
+	rules := WithCacheRules([]CacheRule{
+		{Pattern: "*.js", Value: "no-cache"},
+	})
+	defaultHandler := FileServer(fs, WithCacheControl("public, max-age=60"), rules, WithImmutableFingerprints(nil))
+	customHandler := FileServer(fs, WithImmutableFingerprints(regexp.MustCompile(`\.v[0-9]+\.js$`)))
+
+	testCases := []struct {
+		Path         string
+		Default      string
+		CustomResult string
+	}{
+		{"/app.3f9ab2c1.js", immutableCacheControl, ""},
+		{"/app-3F9AB2C1D4.css", immutableCacheControl, ""},
+		{"/img/logo.0123abcd.png", immutableCacheControl, ""},
+		{"/app.3f9ab2c.js", "no-cache", ""},
+		{"/app.3f9ab2cg.js", "no-cache", ""},
+		{"/3f9ab2c1.js", "no-cache", ""},
+		{"/app.js", "no-cache", ""},
+		{"/vendor/lib.v1234567.js", "no-cache", immutableCacheControl},
+	}
+
+	for _, tc := range testCases {
+		w := serveTestRequest(defaultHandler, "GET", tc.Path)
+		assert.Equal(200, w.status, tc.Path)
+		assert.Equal(tc.Default, w.Header().Get("Cache-Control"), tc.Path)
+
+		w = serveTestRequest(customHandler, "GET", tc.Path)
+		assert.Equal(200, w.status, tc.Path)
+		assert.Equal(tc.CustomResult, w.Header().Get("Cache-Control"), tc.Path)
+	}
+}
@@ -0,0 +1,175 @@
+package zipfs
+
+import (
+	"container/list"
+	"math"
+	"sync"
+)
+
+// ContentCacheStats are counters for the cache of decompressed
+// contents enabled by WithContentCache.
+type ContentCacheStats struct {
+	// Hits is the number of times that the contents of a file
+	// were found in the cache, or were already being decompressed.
+	Hits int64
+
+	// Misses is the number of times that the contents of a file
+	// were not found in the cache, and so were decompressed.
+	Misses int64
+
+	// Evictions is the number of files removed from the
+	// cache to make room for others.
+	Evictions int64
+
+	// Entries is the number of files in the cache,
+	// and Bytes is the total size of their contents.
+	Entries int
+	Bytes   int64
+}
+
+// contentCache holds the decompressed contents of the most recently
+// used files, up to a total size of maxBytes.
+type contentCache struct {
+	maxBytes int64
+	maxItem  int64 // size of the largest file cached
+
+	mutex     sync.Mutex
+	items     map[string]*list.Element
+	loading   map[string]*contentLoad // files being decompressed
+	lru       list.List               // of *contentCacheItem, most recently used first
+	bytes     int64
+	hits      int64
+	misses    int64
+	evictions int64
+}
+
+type contentCacheItem struct {
+	name string
+	data []byte
+}
+
+// contentLoad is the decompression of a file by load,
+// which other calls to load for the file wait for.
+type contentLoad struct {
+	done chan struct{} // closed when the file has been decompressed
+	data []byte
+	err  error
+}
+
+// newContentCache returns a cache of up to maxBytes. Files larger than
+// an eighth of that are not cached, so that one large file does not
+// evict many small ones.
+func newContentCache(maxBytes int64) *contentCache {
+	return &contentCache{
+		maxBytes: maxBytes,
+		maxItem:  maxBytes / 8,
+		items:    make(map[string]*list.Element),
+		loading:  make(map[string]*contentLoad),
+	}
+}
+
+// seekCacheFiles is the number of files of the size set by
+// WithMemorySeekLimit that the cache for seeking can hold.
+const seekCacheFiles = 8
+
+// newSeekCache returns the cache that holds the contents decompressed
+// in order to seek within files of up to limit bytes.
+func newSeekCache(limit int64) *contentCache {
+	maxBytes := int64(math.MaxInt64)
+	if limit <= maxBytes/seekCacheFiles {
+		maxBytes = limit * seekCacheFiles
+	}
+	return newContentCache(maxBytes)
+}
+
+// cacheable reports whether a file of size bytes can be cached.
+func (c *contentCache) cacheable(size int64) bool {
+	return size <= c.maxItem
+}
+
+// load returns the contents of the file fi from the cache, or
+// decompresses them and adds them to the cache if they are not found.
+// Concurrent calls for the same file share one decompression. The
+// contents are shared, so they must not be modified.
+func (c *contentCache) load(fi *fileInfo) ([]byte, error) {
+	c.mutex.Lock()
+	if elem := c.items[fi.name]; elem != nil {
+		c.hits++
+		c.lru.MoveToFront(elem)
+		c.mutex.Unlock()
+		return elem.Value.(*contentCacheItem).data, nil
+	}
+	if l := c.loading[fi.name]; l != nil {
+		c.hits++
+		c.mutex.Unlock()
+		<-l.done
+		return l.data, l.err
+	}
+	c.misses++
+	l := &contentLoad{done: make(chan struct{})}
+	c.loading[fi.name] = l
+	c.mutex.Unlock()
+
+	l.data, l.err = readZipFile(fi.zipFile)
+	if l.err == nil {
+		c.add(fi.name, l.data)
+	}
+	c.mutex.Lock()
+	delete(c.loading, fi.name)
+	c.mutex.Unlock()
+	close(l.done)
+	return l.data, l.err
+}
+
+// add adds the contents of the file at name to the cache, removing
+// the least recently used files as necessary to make room for them.
+func (c *contentCache) add(name string, data []byte) {
+	size := int64(len(data))
+	if !c.cacheable(size) {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if elem := c.items[name]; elem != nil {
+		// Already cached, which load normally prevents.
+		c.lru.MoveToFront(elem)
+		return
+	}
+	for c.bytes+size > c.maxBytes {
+		c.remove(c.lru.Back())
+		c.evictions++
+	}
+	c.items[name] = c.lru.PushFront(&contentCacheItem{name: name, data: data})
+	c.bytes += size
+}
+
+// remove removes an element from the cache.
+// The mutex must be held.
+func (c *contentCache) remove(elem *list.Element) {
+	item := c.lru.Remove(elem).(*contentCacheItem)
+	delete(c.items, item.name)
+	c.bytes -= int64(len(item.data))
+}
+
+// stats returns the counters for the cache.
+func (c *contentCache) stats() ContentCacheStats {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return ContentCacheStats{
+		Hits:      c.hits,
+		Misses:    c.misses,
+		Evictions: c.evictions,
+		Entries:   len(c.items),
+		Bytes:     c.bytes,
+	}
+}
+
+// ContentCacheStats returns the counters for the cache of decompressed
+// contents enabled by WithContentCache, which are all zero if there
+// is no cache.
+func (fs *FileSystem) ContentCacheStats() ContentCacheStats {
+	if fs.contentCache == nil {
+		return ContentCacheStats{}
+	}
+	return fs.contentCache.stats()
+}
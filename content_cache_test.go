@@ -0,0 +1,174 @@
+package zipfs
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContentCache(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	files := map[string]string{
+		"a.txt":     strings.Repeat("a", 100),
+		"b.txt":     strings.Repeat("b", 100),
+		"c.txt":     strings.Repeat("c", 100),
+		"large.txt": strings.Repeat("l", 200),
+	}
+	fs := newTestFileSystem(t, files, WithContentCache(1000))
+	cache := fs.contentCache
+	require.NotNil(cache)
+	assert.Equal(int64(125), cache.maxItem)
+
+	read := func(name string) {
+		t.Helper()
+		data, err := fs.ReadFile(name)
+		require.NoError(err)
+		assert.Equal(files[name], string(data))
+	}
+	read("a.txt")
+	read("a.txt")
+	read("b.txt")
+	assert.Equal(ContentCacheStats{Hits: 1, Misses: 2, Entries: 2, Bytes: 200}, fs.ContentCacheStats())
+
+	// files larger than the limit for each file are not cached
+	read("large.txt")
+	read("large.txt")
+	assert.Equal(2, fs.ContentCacheStats().Entries)
+
+	// ReadFile returns a copy
+	data, err := fs.ReadFile("/a.txt")
+	require.NoError(err)
+	data[0] = 'x'
+	read("a.txt")
+
+	// the least recently used files are evicted
+	cache.maxBytes = 250
+	read("c.txt")
+	stats := fs.ContentCacheStats()
+	assert.Equal(int64(1), stats.Evictions)
+	assert.Equal(int64(200), stats.Bytes)
+	assert.NotContains(cache.items, "b.txt", "b.txt was least recently used")
+	assert.Contains(cache.items, "a.txt")
+
+	_, err = fs.ReadFile("/missing.txt")
+	assert.Error(err)
+	_, err = fs.ReadFile("/")
+	assert.ErrorIs(err, ErrIsDirectory)
+
+	// without a cache the stats are zero
+	fs2 := newTestFileSystem(t, files)
+	data, err = fs2.ReadFile("a.txt")
+	require.NoError(err)
+	assert.Equal(files["a.txt"], string(data))
+	assert.Equal(ContentCacheStats{}, fs2.ContentCacheStats())
+}
+
+func TestContentCacheConcurrent(t *testing.T) {
+	assert := assert.New(t)
+
+	files := make(map[string]string)
+	for i := 0; i < 20; i++ {
+		files[fmt.Sprintf("file-%02d.txt", i)] = strings.Repeat(fmt.Sprint(i%10), 100+i)
+	}
+	fs := newTestFileSystem(t, files, WithContentCache(1000))
+	handler := FileServer(fs)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				name := fmt.Sprintf("file-%02d.txt", (i*7+j)%20)
+				w := serveTestRequest(handler, "GET", "/"+name)
+				assert.Equal(200, w.status)
+				assert.Equal(files[name], w.buf.String())
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	stats := fs.ContentCacheStats()
+	assert.Equal(int64(400), stats.Hits+stats.Misses)
+	assert.LessOrEqual(stats.Bytes, int64(1000))
+	assert.Positive(stats.Evictions)
+}
+
+func TestContentCacheServe(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	fs, err := New("testdata/testdata.zip", WithContentCache(1<<20))
+	require.NoError(err)
+	defer fs.Close()
+	handler := FileServer(fs)
+
+	want, err := fs.ReadFile("/test.html")
+	require.NoError(err)
+	for i := 0; i < 3; i++ {
+		w := serveTestRequest(handler, "GET", "/test.html")
+		assert.Equal(200, w.status)
+		assert.Empty(w.Header().Get("Content-Encoding"))
+		assert.Equal(want, w.buf.Bytes())
+	}
+	assert.Equal(int64(3), fs.ContentCacheStats().Hits)
+
+	// deflated responses and stored files do not use the cache
+	serveTestRequest(handler, "GET", "/test.html", "Accept-Encoding: deflate")
+	serveTestRequest(handler, "GET", "/random.dat")
+	assert.Equal(ContentCacheStats{Hits: 3, Misses: 1, Entries: 1, Bytes: 134}, fs.ContentCacheStats())
+
+	// seeking uses the cache
+	f, err := fs.Open("/test.html")
+	require.NoError(err)
+	defer f.Close()
+	_, err = f.Seek(0, io.SeekEnd)
+	require.NoError(err)
+	_, err = f.Seek(10, io.SeekStart)
+	require.NoError(err)
+	buf := make([]byte, 10)
+	_, err = io.ReadFull(f, buf)
+	require.NoError(err)
+	assert.Equal(want[10:20], buf)
+	assert.Equal(int64(4), fs.ContentCacheStats().Hits)
+}
+
+func benchmarkContentCache(b *testing.B, opts ...Option) {
+	fs, err := New("testdata/testdata.zip", opts...)
+	require.NoError(b, err)
+	defer fs.Close()
+	handler := FileServer(fs)
+	req := &http.Request{
+		Method: "GET",
+		URL:    &url.URL{Path: "/test.html"},
+		Header: make(http.Header),
+	}
+	w := &discardResponseWriter{header: make(http.Header)}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		header := w.Header()
+		for key := range header {
+			delete(header, key)
+		}
+		handler.ServeHTTP(w, req)
+	}
+}
+
+func BenchmarkServeIdentityUncached(b *testing.B) {
+	benchmarkContentCache(b)
+}
+
+func BenchmarkServeIdentityCached(b *testing.B) {
+	benchmarkContentCache(b, WithContentCache(1<<20))
+}
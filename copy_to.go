@@ -0,0 +1,88 @@
+package zipfs
+
+import (
+	"archive/zip"
+	iofs "io/fs"
+	"os"
+	"strings"
+)
+
+// CopyTo copies the files and directories with the given names, such as
+// "/img/circle.png", to zw, or all of them if there are no names. Like
+// ZipDir, it copies the compressed contents without decompressing them,
+// preserving the compression methods, checksums, modification times and
+// extra fields, and symbolic links are copied as they are. The entries
+// keep their names, a directory is copied with everything in it, and the
+// directories containing the entries are added if they are not already
+// in zw. If any of the names does not exist then nothing is written.
+// Closing zw is left to the caller, so that other files can be added.
+func (fs *FileSystem) CopyTo(zw *zip.Writer, names ...string) error {
+	if fs.reader == nil {
+		return ErrClosed
+	}
+	if len(names) == 0 {
+		for _, zf := range fs.reader.File {
+			if err := copyRaw(zw, zf, zf.Name); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	fis := make([]*fileInfo, len(names))
+	for i, name := range names {
+		fi, err := fs.openFileInfo("/" + name)
+		if err != nil {
+			return err
+		}
+		fis[i] = fi
+	}
+	c := &entryCopier{zw: zw, copied: make(map[*fileInfo]bool)}
+	for _, fi := range fis {
+		parts := strings.Split(strings.TrimSuffix(fi.name, "/"), "/")
+		for i := 1; i < len(parts); i++ {
+			if err := c.copy(fs.fileInfos[strings.Join(parts[:i], "/")]); err != nil {
+				return err
+			}
+		}
+		if !fi.IsDir() {
+			if err := c.copy(fi); err != nil {
+				return err
+			}
+			continue
+		}
+		err := fs.Walk(fi.name, func(name string, d iofs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			info, _ := d.Info()
+			return c.copy(info.(*fileInfo))
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// entryCopier copies entries to a zip.Writer for CopyTo,
+// copying each one once.
+type entryCopier struct {
+	zw     *zip.Writer
+	copied map[*fileInfo]bool
+}
+
+func (c *entryCopier) copy(fi *fileInfo) error {
+	if c.copied[fi] || fi.name == "/" {
+		return nil
+	}
+	c.copied[fi] = true
+	if fi.zipFile != nil {
+		return copyRaw(c.zw, fi.zipFile, fi.zipFile.Name)
+	}
+	// The directory has no entry of its own.
+	fh := &zip.FileHeader{Name: fi.name, Method: zip.Store}
+	fh.SetMode(os.ModeDir | 0755)
+	_, err := c.zw.CreateHeader(fh)
+	return err
+}
@@ -0,0 +1,129 @@
+package zipfs
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCopyTo(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	fs, err := New("testdata/testdata.zip")
+	require.NoError(err)
+	defer fs.Close()
+
+	source := make(map[string]*zip.File)
+	for _, zf := range fs.reader.File {
+		source[zf.Name] = zf
+	}
+
+	// copyTo writes a new ZIP file with the names, and opens it.
+	copyTo := func(names ...string) *FileSystem {
+		name := filepath.Join(t.TempDir(), "copy.zip")
+		f, err := os.Create(name)
+		require.NoError(err)
+		zw := zip.NewWriter(f)
+		require.NoError(fs.CopyTo(zw, names...))
+		require.NoError(zw.Close())
+		require.NoError(f.Close())
+		copied, err := New(name)
+		require.NoError(err)
+		t.Cleanup(func() { copied.Close() })
+		return copied
+	}
+
+	testCases := []struct {
+		Names  []string
+		Copied []string
+	}{
+		{
+			Names:  []string{"/img/circle.png", "/random.dat", "js"},
+			Copied: []string{"img/", "img/circle.png", "random.dat", "js/", "js/application-23a0..js"},
+		},
+		{
+			Names:  []string{"/img", "img/circle.png"},
+			Copied: []string{"img/", "img/another-circle.png", "img/circle.png"},
+		},
+		{
+			Names:  []string{"/empty/"},
+			Copied: []string{"empty/"},
+		},
+	}
+	for _, tc := range testCases {
+		copied := copyTo(tc.Names...)
+		var names []string
+		for _, zf := range copied.reader.File {
+			names = append(names, zf.Name)
+			src := source[zf.Name]
+			require.NotNil(src, zf.Name)
+			assert.Equal(src.CRC32, zf.CRC32, zf.Name)
+			assert.Equal(src.Method, zf.Method, zf.Name)
+			assert.Equal(src.ExternalAttrs, zf.ExternalAttrs, zf.Name)
+			assert.True(src.Modified.Equal(zf.Modified), zf.Name)
+
+			// the compressed bytes are the same
+			want, err := readRaw(src)
+			require.NoError(err)
+			got, err := readRaw(zf)
+			require.NoError(err)
+			assert.True(bytes.Equal(want, got), zf.Name)
+		}
+		assert.Equal(tc.Copied, names, tc.Names)
+
+		// the copy can be served
+		if copied.IsFile("/img/circle.png") {
+			f, err := copied.Open("/img/circle.png")
+			require.NoError(err)
+			data, err := io.ReadAll(f)
+			f.Close()
+			require.NoError(err)
+			want, err := readZipFile(source["img/circle.png"])
+			require.NoError(err)
+			assert.Equal(want, data)
+		}
+	}
+
+	// everything
+	copied := copyTo()
+	assert.Equal(fs.Names(), copied.Names())
+	assert.Equal(fs.Dirs(), copied.Dirs())
+
+	// directories without entries are added
+	fs2 := newTestFileSystem(t, map[string]string{"a/b/c.txt": "c"})
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	require.NoError(fs2.CopyTo(zw, "/a/b/c.txt"))
+	require.NoError(zw.Close())
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(err)
+	require.Len(zr.File, 3)
+	assert.Equal("a/", zr.File[0].Name)
+	assert.True(zr.File[0].Mode().IsDir())
+	assert.Equal("a/b/", zr.File[1].Name)
+
+	// nothing is written for a missing name
+	buf.Reset()
+	zw = zip.NewWriter(&buf)
+	err = fs.CopyTo(zw, "/index.html", "/missing")
+	assert.True(os.IsNotExist(err), err)
+	require.NoError(zw.Close())
+	zr, err = zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(err)
+	assert.Empty(zr.File)
+}
+
+func readRaw(zf *zip.File) ([]byte, error) {
+	r, err := zf.OpenRaw()
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
@@ -0,0 +1,563 @@
+package zipfs
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	iofs "io/fs"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// COWFS is a copy-on-write file system, which layers files written in
+// memory over the files of a FileSystem, which is not changed. Files can
+// be written and removed while the file system is in use, and are served
+// by COWFileServer.
+//
+// Each written file is compressed when it is written, and then behaves
+// exactly as it would in a ZIP file, with an ETag calculated from its
+// contents. Reads look for each name in the written files first, then
+// in the removed files, and then in the base, whose files are served
+// as they are. Directory listings include the files of both, except for
+// the removed ones. The changes are kept in memory, so COWFS is intended
+// for a small number of changes, such as edits in a preview environment.
+type COWFS struct {
+	base *FileSystem
+
+	mu      sync.Mutex
+	files   map[string]*cowFile // written files, keyed by name without the leading slash
+	removed map[string]bool     // files and directories of base that are removed
+	current *cowSnapshot        // nil if there have been changes since it was built
+	closed  bool
+}
+
+// cowFile is a file written to a COWFS, which is kept in a file system
+// of its own that holds only the file. The file system is closed when
+// the file has been replaced and is no longer in use.
+type cowFile struct {
+	fi   *fileInfo
+	refs int // held by the COWFS and by each snapshot that includes the file
+}
+
+// cowSnapshot is a file system with the changes made to a COWFS at
+// one time. It is released when it has been replaced and is not in use.
+type cowSnapshot struct {
+	fs    *FileSystem
+	files []*cowFile // the written files that fs includes
+	refs  int
+}
+
+// NewCOW returns a copy-on-write file system with the files of base.
+// Closing the COWFS does not close base.
+func NewCOW(base *FileSystem) *COWFS {
+	return &COWFS{
+		base:    base,
+		files:   make(map[string]*cowFile),
+		removed: make(map[string]bool),
+	}
+}
+
+// WriteFile writes data to the file at name, replacing any file in
+// the base file system, and creating the directories containing it as
+// needed. The data is copied, so the caller can change it afterwards.
+// It is an error to write to a directory, or below a file.
+func (c *COWFS) WriteFile(name string, data []byte) error {
+	name = cowName(name)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return &os.PathError{Op: "WriteFile", Path: "/" + name, Err: ErrClosed}
+	}
+	if exists, isDir := c.lookup(name); exists && isDir {
+		return &os.PathError{Op: "WriteFile", Path: "/" + name, Err: ErrIsDirectory}
+	}
+	for dir := path.Dir(name); dir != "."; dir = path.Dir(dir) {
+		if exists, isDir := c.lookup(dir); exists && !isDir {
+			return &os.PathError{Op: "WriteFile", Path: "/" + name, Err: ErrNotDirectory}
+		}
+	}
+	f, err := c.newFile(name, data)
+	if err != nil {
+		return &os.PathError{Op: "WriteFile", Path: "/" + name, Err: err}
+	}
+	if old := c.files[name]; old != nil {
+		c.unref(old)
+	}
+	c.files[name] = f
+	c.changed()
+	return nil
+}
+
+// newFile returns a file written at name, compressed using deflate in
+// a ZIP file of its own. It has the permissions of any file that it
+// replaces in the base file system.
+func (c *COWFS) newFile(name string, data []byte) (*cowFile, error) {
+	mode := os.FileMode(0644)
+	if fi := c.base.lookup(name); fi != nil && !fi.IsDir() {
+		mode = fi.zipFile.Mode().Perm()
+	}
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	fh := &zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: time.Now(),
+	}
+	fh.SetMode(mode)
+	w, err := zw.CreateHeader(fh)
+	if err == nil {
+		_, err = w.Write(data)
+	}
+	if err == nil {
+		err = zw.Close()
+	}
+	if err != nil {
+		return nil, err
+	}
+	fs, err := newFileSystem(bytes.NewReader(buf.Bytes()), int64(buf.Len()), nil, inheritOptions(c.base))
+	if err != nil {
+		return nil, err
+	}
+	return &cowFile{fi: fs.fileInfos[name], refs: 1}, nil
+}
+
+// Remove removes the file or directory at name, including everything
+// in a directory, whether it is in the base file system or was written.
+func (c *COWFS) Remove(name string) error {
+	name = cowName(name)
+	if name == "" {
+		return &os.PathError{Op: "Remove", Path: "/", Err: iofs.ErrInvalid}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return &os.PathError{Op: "Remove", Path: "/" + name, Err: ErrClosed}
+	}
+	if exists, _ := c.lookup(name); !exists {
+		return &os.PathError{Op: "Remove", Path: "/" + name, Err: iofs.ErrNotExist}
+	}
+	for key, f := range c.files {
+		if key == name || strings.HasPrefix(key, name+"/") {
+			c.unref(f)
+			delete(c.files, key)
+		}
+	}
+	if !c.isRemoved(name) && c.base.lookup(name) != nil {
+		c.removed[name] = true
+	}
+	c.changed()
+	return nil
+}
+
+// Open opens the file at name, as for FileSystem.Open. It implements
+// the http.FileSystem interface.
+func (c *COWFS) Open(name string) (http.File, error) {
+	s, err := c.acquire()
+	if err != nil {
+		return nil, err
+	}
+	f, err := s.fs.Open(name)
+	if err != nil {
+		c.release(s)
+		return nil, err
+	}
+	return &cowHandle{File: f, release: func() { c.release(s) }}, nil
+}
+
+// Close releases the memory and temporary files used for the changes,
+// after which the methods of c return ErrClosed. Files that are open
+// can be read until they are closed. It does not close the base file
+// system.
+func (c *COWFS) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	c.changed()
+	for name, f := range c.files {
+		c.unref(f)
+		delete(c.files, name)
+	}
+	return nil
+}
+
+// cowName returns the name of a file in a COWFS
+// without the leading slash.
+func cowName(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+name), "/")
+}
+
+// cowParent returns the name of the directory containing the file at
+// name, which is empty for the root directory.
+func cowParent(name string) string {
+	if dir := path.Dir(name); dir != "." {
+		return dir
+	}
+	return ""
+}
+
+// lookup reports whether there is a file or directory at name, and
+// whether it is a directory, after the changes. The lock must be held.
+func (c *COWFS) lookup(name string) (exists, isDir bool) {
+	if c.files[name] != nil {
+		return true, false
+	}
+	for key := range c.files {
+		if name == "" || strings.HasPrefix(key, name+"/") {
+			return true, true
+		}
+	}
+	if c.isRemoved(name) {
+		return false, false
+	}
+	fi := c.base.lookup(name)
+	return fi != nil, fi != nil && fi.IsDir()
+}
+
+// isRemoved reports whether the file or directory of the base file
+// system at name, or a directory containing it, has been removed.
+func (c *COWFS) isRemoved(name string) bool {
+	for ; name != "." && name != ""; name = path.Dir(name) {
+		if c.removed[name] {
+			return true
+		}
+	}
+	return false
+}
+
+// changed discards the current snapshot after a change.
+// The lock must be held.
+func (c *COWFS) changed() {
+	if s := c.current; s != nil {
+		c.current = nil
+		if s.refs == 0 {
+			c.closeSnapshot(s)
+		}
+	}
+}
+
+// unref releases a reference to a written file, closing its file
+// system if it is no longer in use. The lock must be held.
+func (c *COWFS) unref(f *cowFile) {
+	f.refs--
+	if f.refs == 0 {
+		f.fi.fs.Close()
+	}
+}
+
+// acquire returns the snapshot with the current changes, making it
+// if necessary. It must be released when it is no longer in use.
+func (c *COWFS) acquire() (*cowSnapshot, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil, ErrClosed
+	}
+	if c.current == nil {
+		s := &cowSnapshot{fs: c.base}
+		if len(c.files) > 0 || len(c.removed) > 0 {
+			fs, err := c.overlay()
+			if err != nil {
+				return nil, err
+			}
+			s.fs = fs
+			for _, f := range c.files {
+				f.refs++
+				s.files = append(s.files, f)
+			}
+		}
+		c.current = s
+	}
+	c.current.refs++
+	return c.current, nil
+}
+
+// release releases a snapshot returned by acquire.
+func (c *COWFS) release(s *cowSnapshot) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s.refs--
+	if s.refs == 0 && s != c.current {
+		c.closeSnapshot(s)
+	}
+}
+
+// closeSnapshot releases the written files included in a snapshot. Its
+// file system is not closed, because it shares the fileInfos of the
+// base file system. The lock must be held.
+func (c *COWFS) closeSnapshot(s *cowSnapshot) {
+	for _, f := range s.files {
+		c.unref(f)
+	}
+}
+
+// overlay returns a file system with the files of the base and the
+// changes, without copying the contents of either. Each name is looked
+// up in the written files, then in the removed files, and then in the
+// base, whose fileInfos are shared, so that unchanged files are served
+// as they are by the base. Only the directories containing changes have
+// fileInfos of their own, which list the entries of both layers. The
+// lock must be held.
+func (c *COWFS) overlay() (*FileSystem, error) {
+	base := c.base
+	if base.reader == nil {
+		return nil, ErrClosed
+	}
+	inPlace, added := c.entries()
+	fs := &FileSystem{
+		readerAt:  base.readerAt,
+		size:      base.size,
+		reader:    &zip.Reader{File: append(inPlace, added...)},
+		fileInfos: make(fileInfoMap, len(base.fileInfos)+len(c.files)),
+	}
+	inheritOptions(base)(fs)
+	for key, fi := range base.fileInfos {
+		name := strings.Trim(key, "/")
+		if name == "" || c.files[name] == nil && !c.isRemoved(name) {
+			fs.fileInfos[key] = fi
+		}
+	}
+	for name, f := range c.files {
+		fs.fileInfos[name] = f.fi
+	}
+
+	// The directories containing written files, and those containing
+	// removed files that remain, keyed by name without slashes.
+	dirs := make(map[string]*fileInfo)
+	addDir := func(dir string) {
+		if dirs[dir] != nil {
+			return
+		}
+		d := &fileInfo{name: dir + "/", fs: fs}
+		if dir == "" {
+			d.name = "/"
+		}
+		if fi := fs.fileInfos[dir]; fi != nil {
+			d.zipFile = fi.zipFile
+		}
+		dirs[dir] = d
+	}
+	for name := range c.files {
+		for dir := cowParent(name); ; dir = cowParent(dir) {
+			addDir(dir)
+			if dir == "" {
+				break
+			}
+		}
+	}
+	for name := range c.removed {
+		for dir := cowParent(name); ; dir = cowParent(dir) {
+			if fs.fileInfos[dir] != nil {
+				addDir(dir)
+			}
+			if dir == "" {
+				break
+			}
+		}
+	}
+
+	resolve := func(name string) *fileInfo {
+		if d := dirs[name]; d != nil {
+			return d
+		}
+		return fs.fileInfos[name]
+	}
+	for dir, d := range dirs {
+		seen := make(map[*fileInfo]bool)
+		add := func(fi *fileInfo) {
+			if fi != nil && !seen[fi] {
+				seen[fi] = true
+				d.fileInfos = append(d.fileInfos, fi)
+			}
+		}
+		if fi := base.fileInfos[dir]; fi != nil && !c.isRemoved(dir) {
+			for _, entry := range fi.fileInfos {
+				add(resolve(strings.TrimSuffix(entry.name, "/")))
+			}
+		}
+		for name, f := range c.files {
+			if cowParent(name) == dir {
+				add(f.fi)
+			}
+		}
+		for name, sub := range dirs {
+			if name != "" && cowParent(name) == dir {
+				add(sub)
+			}
+		}
+		sort.Sort(d.fileInfos)
+		if fs.dirsFirst || fs.foldSort {
+			d.listing = fs.listingOrder(d.fileInfos)
+		}
+		fs.fileInfos[dir] = d
+		fs.fileInfos[d.name] = d
+	}
+	return fs, nil
+}
+
+// entries returns the entries of a ZIP file with the changes: those of
+// the base that are not removed, with written files in place of those
+// that they replace, and then the entries of new files, in sorted
+// order. The lock must be held.
+func (c *COWFS) entries() (inPlace, added []*zip.File) {
+	written := make(map[string]bool)
+	for _, zf := range c.base.reader.File {
+		name := strings.TrimSuffix(zf.Name, "/")
+		if f := c.files[name]; f != nil {
+			if !written[name] {
+				written[name] = true
+				inPlace = append(inPlace, f.fi.zipFile)
+			}
+			continue
+		}
+		if !c.isRemoved(name) {
+			inPlace = append(inPlace, zf)
+		}
+	}
+	names := make([]string, 0, len(c.files))
+	for name := range c.files {
+		if !written[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		added = append(added, c.files[name].fi.zipFile)
+	}
+	return inPlace, added
+}
+
+// Save writes a ZIP file with the files of the base file system and the
+// changes made to c to w, which can be opened using New. The entries of
+// unchanged files and directories are copied without being decompressed,
+// so their contents, checksums and modification times are the same as in
+// the base. Written files are compressed using deflate, and replace the
+// files of the base in place, with the same permissions. New files follow,
+// in sorted order, with entries for any new directories containing them.
+func (c *COWFS) Save(w io.Writer) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed || c.base.reader == nil {
+		return ErrClosed
+	}
+	return c.writeZip(w)
+}
+
+// writeZip implements Save. The lock must be held.
+func (c *COWFS) writeZip(w io.Writer) error {
+	zw := zip.NewWriter(w)
+	inPlace, added := c.entries()
+	dirs := make(map[string]bool)
+	for _, zf := range inPlace {
+		if err := copyRaw(zw, zf, zf.Name); err != nil {
+			return err
+		}
+		if zf.Mode().IsDir() {
+			dirs[strings.TrimSuffix(zf.Name, "/")] = true
+		}
+	}
+	for _, zf := range added {
+		if err := writeCOWDirs(zw, path.Dir(zf.Name), zf.Modified, dirs); err != nil {
+			return err
+		}
+		if err := copyRaw(zw, zf, zf.Name); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// writeCOWDirs writes entries to zw for the directory dir and the
+// directories containing it, outermost first, unless they are in dirs,
+// and adds them to dirs.
+func writeCOWDirs(zw *zip.Writer, dir string, modTime time.Time, dirs map[string]bool) error {
+	if dir == "." || dirs[dir] {
+		return nil
+	}
+	if err := writeCOWDirs(zw, path.Dir(dir), modTime, dirs); err != nil {
+		return err
+	}
+	dirs[dir] = true
+	fh := &zip.FileHeader{
+		Name:     dir + "/",
+		Method:   zip.Store,
+		Modified: modTime,
+	}
+	fh.SetMode(os.ModeDir | 0755)
+	_, err := zw.CreateHeader(fh)
+	return err
+}
+
+// inheritOptions is an Option that gives a file system
+// the same options as base.
+func inheritOptions(base *FileSystem) Option {
+	return func(fs *FileSystem) {
+		fs.seekInterval = base.seekInterval
+		fs.memorySeekLimit = base.memorySeekLimit
+		fs.mmap = base.mmap
+		fs.pinPatterns = base.pinPatterns
+		fs.contentTypes = base.contentTypes
+		fs.contentTypeFunc = base.contentTypeFunc
+		fs.dirsFirst = base.dirsFirst
+		fs.foldSort = base.foldSort
+		fs.listingFilter = base.listingFilter
+	}
+}
+
+// cowHandle is a file opened from a COWFS, which holds
+// the snapshot that it was opened from until it is closed.
+type cowHandle struct {
+	http.File
+	once    sync.Once
+	release func()
+}
+
+func (h *cowHandle) Close() error {
+	err := h.File.Close()
+	h.once.Do(h.release)
+	return err
+}
+
+// COWFileServer returns a handler that serves the files of c, as
+// FileServer does for a FileSystem. The changes made to c are served
+// as soon as the methods making them return. The archive served by
+// WithArchiveDownload is that of the base file system, without the
+// changes, which Save writes.
+func COWFileServer(c *COWFS, opts ...HandlerOption) http.Handler {
+	return &cowServer{cow: c, opts: opts}
+}
+
+// cowServer serves a COWFS using a handler returned by FileServer for
+// the current snapshot, which is replaced when the snapshot changes.
+type cowServer struct {
+	cow  *COWFS
+	opts []HandlerOption
+
+	mu       sync.Mutex
+	snapshot *cowSnapshot
+	handler  http.Handler
+}
+
+func (cs *cowServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s, err := cs.cow.acquire()
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	defer cs.cow.release(s)
+	cs.mu.Lock()
+	if cs.snapshot != s {
+		cs.snapshot = s
+		cs.handler = FileServer(s.fs, cs.opts...)
+	}
+	handler := cs.handler
+	cs.mu.Unlock()
+	handler.ServeHTTP(w, r)
+}
@@ -0,0 +1,302 @@
+package zipfs
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"hash/crc32"
+	"io"
+	iofs "io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCOWFS(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	base, err := New("testdata/testdata.zip")
+	require.NoError(err)
+	defer base.Close()
+	cow := NewCOW(base)
+	defer cow.Close()
+	handler := COWFileServer(cow, WithDirectoryListing())
+
+	// listNames returns the names in the JSON listing of dir.
+	listNames := func(dir string) []string {
+		w := serveTestRequest(handler, "GET", dir, "Accept: application/json")
+		require.Equal(200, w.status, dir)
+		var entries []struct {
+			Name string `json:"name"`
+		}
+		require.NoError(json.Unmarshal(w.buf.Bytes(), &entries))
+		var names []string
+		for _, entry := range entries {
+			names = append(names, entry.Name)
+		}
+		return names
+	}
+
+	// without changes the base is served
+	w := serveTestRequest(handler, "GET", "/test.html")
+	require.Equal(200, w.status)
+	baseETag := w.Header().Get("Etag")
+	assert.NotEmpty(baseETag)
+
+	// override
+	require.NoError(cow.WriteFile("/test.html", []byte("<html>edited</html>")))
+	w = serveTestRequest(handler, "GET", "/test.html")
+	require.Equal(200, w.status)
+	assert.Equal("<html>edited</html>", w.buf.String())
+	assert.NotEqual(baseETag, w.Header().Get("Etag"))
+	assert.Equal("text/html; charset=utf-8", w.Header().Get("Content-Type"))
+	w = serveTestRequest(handler, "GET", "/test.html", "Accept-Encoding: deflate")
+	assert.Equal("deflate", w.Header().Get("Content-Encoding"))
+
+	// new files, in new and existing directories
+	require.NoError(cow.WriteFile("img/square.png", []byte("square")))
+	require.NoError(cow.WriteFile("/docs/a/b.txt", []byte("b")))
+	w = serveTestRequest(handler, "GET", "/docs/a/b.txt")
+	assert.Equal(200, w.status)
+	assert.Equal("b", w.buf.String())
+	assert.Equal([]string{"another-circle.png", "circle.png", "square.png"}, listNames("/img/"))
+	assert.Equal([]string{"a"}, listNames("/docs/"))
+
+	// deletion
+	require.NoError(cow.Remove("/img/circle.png"))
+	require.NoError(cow.Remove("lots-of-files"))
+	assert.Equal(404, serveTestRequest(handler, "GET", "/img/circle.png").status)
+	assert.Equal(404, serveTestRequest(handler, "GET", "/lots-of-files/file-01").status)
+	assert.Equal([]string{"another-circle.png", "square.png"}, listNames("/img/"))
+	root, err := cow.Open("/")
+	require.NoError(err)
+	files, err := root.Readdir(0)
+	require.NoError(err)
+	require.NoError(root.Close())
+	var names []string
+	for _, file := range files {
+		names = append(names, file.Name())
+	}
+	assert.Equal([]string{
+		"docs", "empty", "img", "index.html", "js",
+		"not-a-zip-file.txt", "random.dat", "test.html",
+	}, names)
+
+	// a removed directory can be written to again
+	require.NoError(cow.WriteFile("/lots-of-files/new", []byte("new")))
+	assert.Equal([]string{"new"}, listNames("/lots-of-files/"))
+
+	// written files can be removed
+	require.NoError(cow.Remove("/docs"))
+	assert.Equal(404, serveTestRequest(handler, "GET", "/docs/a/b.txt").status)
+
+	// errors
+	err = cow.Remove("/missing")
+	assert.True(errors.Is(err, iofs.ErrNotExist), err)
+	err = cow.Remove("/img/circle.png")
+	assert.True(errors.Is(err, iofs.ErrNotExist), err)
+	err = cow.Remove("/")
+	assert.True(errors.Is(err, iofs.ErrInvalid), err)
+	err = cow.WriteFile("/img", nil)
+	assert.True(errors.Is(err, ErrIsDirectory), err)
+	err = cow.WriteFile("/index.html/file", nil)
+	assert.True(errors.Is(err, ErrNotDirectory), err)
+
+	// the base is not changed
+	assert.True(base.IsFile("/img/circle.png"))
+	assert.False(base.Exists("/img/square.png"))
+
+	// http.FileSystem
+	f, err := cow.Open("/img/square.png")
+	require.NoError(err)
+	data, err := io.ReadAll(f)
+	require.NoError(err)
+	assert.Equal("square", string(data))
+	// the file can be read after further changes
+	require.NoError(cow.WriteFile("/img/square.png", []byte("changed")))
+	_, err = f.Seek(0, io.SeekStart)
+	require.NoError(err)
+	data, err = io.ReadAll(f)
+	require.NoError(err)
+	assert.Equal("square", string(data))
+	require.NoError(f.Close())
+	_, err = cow.Open("/img/circle.png")
+	assert.True(errors.Is(err, iofs.ErrNotExist), err)
+}
+
+func TestCOWFSOverlay(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	base, err := New("testdata/testdata.zip")
+	require.NoError(err)
+	defer base.Close()
+	cow := NewCOW(base)
+	defer cow.Close()
+	handler := COWFileServer(cow)
+
+	// unchanged files are served by the base, not copied
+	require.NoError(cow.WriteFile("/test.html", []byte("edited")))
+	s, err := cow.acquire()
+	require.NoError(err)
+	assert.Same(base.fileInfos["img/circle.png"], s.fs.fileInfos["img/circle.png"])
+	assert.Same(base.fileInfos["img/"], s.fs.fileInfos["img/"])
+	cow.release(s)
+
+	// the ETags of written files depend only on their contents
+	etag := serveTestRequest(handler, "GET", "/test.html").Header().Get("Etag")
+	require.NoError(cow.WriteFile("/test.html", []byte("edited")))
+	assert.Equal(etag, serveTestRequest(handler, "GET", "/test.html").Header().Get("Etag"))
+	require.NoError(cow.WriteFile("/test.html", []byte("edited again")))
+	assert.NotEqual(etag, serveTestRequest(handler, "GET", "/test.html").Header().Get("Etag"))
+
+	// replaced files are closed when they are no longer in use
+	f, err := cow.Open("/test.html")
+	require.NoError(err)
+	written := cow.files["test.html"]
+	require.NoError(cow.WriteFile("/test.html", []byte("replaced")))
+	data, err := io.ReadAll(f)
+	require.NoError(err)
+	assert.Equal("edited again", string(data))
+	assert.NotNil(written.fi.fs.readerAt)
+	require.NoError(f.Close())
+	assert.Nil(written.fi.fs.readerAt)
+
+	// closing closes the written files
+	written = cow.files["test.html"]
+	require.NoError(cow.Close())
+	assert.Nil(written.fi.fs.readerAt)
+	_, err = cow.Open("/test.html")
+	assert.ErrorIs(err, ErrClosed)
+	assert.ErrorIs(cow.WriteFile("/test.html", nil), ErrClosed)
+	assert.ErrorIs(cow.Save(io.Discard), ErrClosed)
+	assert.True(base.IsFile("/test.html"))
+}
+
+func TestCOWFSConcurrent(t *testing.T) {
+	base, err := New("testdata/testdata.zip")
+	require.NoError(t, err)
+	defer base.Close()
+	cow := NewCOW(base)
+	defer cow.Close()
+	handler := COWFileServer(cow)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				w := serveTestRequest(handler, "GET", "/img/circle.png", "Range: bytes=100-199")
+				assert.Equal(t, 206, w.status)
+				assert.Equal(t, 100, w.buf.Len())
+				w = serveTestRequest(handler, "GET", "/edited.txt")
+				if w.status == 200 {
+					assert.Contains(t, w.buf.String(), "version")
+				}
+			}
+		}()
+	}
+	for j := 0; j < 50; j++ {
+		require.NoError(t, cow.WriteFile("/edited.txt", []byte("version "+string(rune('a'+j%26)))))
+	}
+	wg.Wait()
+}
+
+func TestCOWFSSave(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	base, err := New("testdata/testdata.zip")
+	require.NoError(err)
+	defer base.Close()
+	cow := NewCOW(base)
+	defer cow.Close()
+
+	require.NoError(cow.WriteFile("/index.html", []byte("<html>edited</html>")))
+	require.NoError(cow.WriteFile("/docs/guide/intro.txt", []byte("intro")))
+	require.NoError(cow.Remove("/img/circle.png"))
+	require.NoError(cow.Remove("/lots-of-files"))
+
+	name := filepath.Join(t.TempDir(), "saved.zip")
+	f, err := os.Create(name)
+	require.NoError(err)
+	require.NoError(cow.Save(f))
+	require.NoError(f.Close())
+	saved, err := New(name)
+	require.NoError(err)
+	defer saved.Close()
+
+	source := make(map[string]*zip.File)
+	for _, zf := range base.reader.File {
+		source[zf.Name] = zf
+	}
+	var names []string
+	for _, zf := range saved.reader.File {
+		names = append(names, zf.Name)
+		src := source[zf.Name]
+		switch zf.Name {
+		case "index.html":
+			assert.Equal(uint16(zip.Deflate), zf.Method)
+			assert.Equal(crc32.ChecksumIEEE([]byte("<html>edited</html>")), zf.CRC32)
+			assert.False(src.Modified.Equal(zf.Modified))
+		case "docs/", "docs/guide/":
+			assert.True(zf.Mode().IsDir(), zf.Name)
+		case "docs/guide/intro.txt":
+			assert.Equal(uint16(zip.Deflate), zf.Method)
+			assert.Equal(crc32.ChecksumIEEE([]byte("intro")), zf.CRC32)
+		default:
+			// unchanged entries are copied as they are
+			require.NotNil(src, zf.Name)
+			assert.Equal(src.CRC32, zf.CRC32, zf.Name)
+			assert.Equal(src.Method, zf.Method, zf.Name)
+			assert.True(src.Modified.Equal(zf.Modified), zf.Name)
+			want, err := readRaw(src)
+			require.NoError(err)
+			got, err := readRaw(zf)
+			require.NoError(err)
+			assert.Equal(want, got, zf.Name)
+		}
+	}
+	assert.Equal([]string{
+		"empty/",
+		"img/",
+		"img/another-circle.png",
+		"index.html",
+		"js/",
+		"js/application-23a0..js",
+		"not-a-zip-file.txt",
+		"random.dat",
+		"test.html",
+		"docs/",
+		"docs/guide/",
+		"docs/guide/intro.txt",
+	}, names)
+
+	data, err := readZipFile(saved.fileInfos["index.html"].zipFile)
+	require.NoError(err)
+	assert.Equal("<html>edited</html>", string(data))
+
+	// saving again gives the same result
+	var buf1, buf2 bytes.Buffer
+	require.NoError(cow.Save(&buf1))
+	require.NoError(cow.Save(&buf2))
+	assert.Equal(buf1.Bytes(), buf2.Bytes())
+
+	// without changes the entries are the same as the base
+	buf1.Reset()
+	require.NoError(NewCOW(base).Save(&buf1))
+	zr, err := zip.NewReader(bytes.NewReader(buf1.Bytes()), int64(buf1.Len()))
+	require.NoError(err)
+	require.Len(zr.File, len(base.reader.File))
+	for i, zf := range zr.File {
+		assert.Equal(base.reader.File[i].Name, zf.Name)
+		assert.Equal(base.reader.File[i].CRC32, zf.CRC32)
+	}
+}
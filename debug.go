@@ -0,0 +1,146 @@
+package zipfs
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strconv"
+)
+
+// debugInfo is the data shown by the debug endpoint.
+type debugInfo struct {
+	Entries             []debugEntry `json:"entries"`
+	Files               int          `json:"files"`
+	TotalSize           int64        `json:"totalSize"`
+	TotalCompressedSize int64        `json:"totalCompressedSize"`
+	TempFiles           int          `json:"tempFiles"`
+	SeekIndexes         int          `json:"seekIndexes"`
+	Extractions         int64        `json:"extractions"`
+	SharedExtractions   int64        `json:"sharedExtractions"`
+}
+
+// debugEntry describes a file in the ZIP file for the debug endpoint.
+type debugEntry struct {
+	Name           string `json:"name"`
+	Size           int64  `json:"size"`
+	CompressedSize int64  `json:"compressedSize"`
+	Method         string `json:"method"`
+	CRC32          string `json:"crc32"`
+	ETag           string `json:"etag,omitempty"`
+	TempFile       bool   `json:"tempFile"`
+	SeekIndex      bool   `json:"seekIndex"`
+}
+
+var debugTemplate = template.Must(template.New("debug").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>zipfs</title>
+</head>
+<body>
+<h1>zipfs</h1>
+<p>{{.Files}} files, {{.TotalSize}} bytes ({{.TotalCompressedSize}} compressed).
+{{.TempFiles}} temporary files, {{.SeekIndexes}} seek indexes,
+{{.Extractions}} extractions ({{.SharedExtractions}} shared).</p>
+<table>
+<tr><th>Name</th><th>Size</th><th>Compressed</th><th>Method</th><th>CRC-32</th><th>ETag</th><th>Temporary file</th><th>Seek index</th></tr>
+{{range .Entries}}<tr><td>{{.Name}}</td><td>{{.Size}}</td><td>{{.CompressedSize}}</td><td>{{.Method}}</td><td>{{.CRC32}}</td><td>{{.ETag}}</td><td>{{if .TempFile}}yes{{end}}</td><td>{{if .SeekIndex}}yes{{end}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// methodName returns the name of a ZIP compression method.
+func methodName(method uint16) string {
+	switch method {
+	case zip.Store:
+		return "store"
+	case zip.Deflate:
+		return "deflate"
+	}
+	return strconv.Itoa(int(method))
+}
+
+// debugInfo returns the state of the files in the file system, in the
+// order that they appear in the ZIP file. Directories are left out.
+func (h *fileHandler) debugInfo() *debugInfo {
+	fs := h.fs
+	stats := fs.ExtractStats()
+	info := &debugInfo{
+		Entries:           []debugEntry{},
+		Extractions:       stats.Extractions,
+		SharedExtractions: stats.Shared,
+	}
+	for _, zf := range fs.reader.File {
+		fi := fs.fileInfos[zf.Name]
+		if fi == nil || fi.IsDir() {
+			continue
+		}
+		tempFile := fi.hasTempFile()
+		fi.mutex.Lock()
+		seekIndex := fi.seekIndex != nil
+		fi.mutex.Unlock()
+
+		entry := debugEntry{
+			Name:           "/" + zf.Name,
+			Size:           uncompressedSize(zf),
+			CompressedSize: compressedSize(zf),
+			Method:         methodName(zf.Method),
+			CRC32:          fmt.Sprintf("%08x", zf.CRC32),
+			ETag:           h.etag("/"+zf.Name, fi),
+			TempFile:       tempFile,
+			SeekIndex:      seekIndex,
+		}
+		info.Entries = append(info.Entries, entry)
+		info.Files++
+		info.TotalSize += entry.Size
+		info.TotalCompressedSize += entry.CompressedSize
+		if tempFile {
+			info.TempFiles++
+		}
+		if seekIndex {
+			info.SeekIndexes++
+		}
+	}
+	return info
+}
+
+// serveDebug responds to a request for the debug endpoint with the
+// state of the file system, in JSON if the client accepts it and
+// otherwise in HTML.
+func (h *fileHandler) serveDebug(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		w.Header().Set("Allow", "GET, HEAD")
+		h.error(w, r, http.StatusMethodNotAllowed, errMethodNotAllowed)
+		return
+	}
+	if h.fs.readerAt == nil {
+		h.error(w, r, http.StatusInternalServerError, ErrClosed)
+		return
+	}
+
+	// The state changes as files are served.
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Add("Vary", "Accept")
+	info := h.debugInfo()
+	if acceptsJSON(r) {
+		data, err := json.Marshal(info)
+		if err != nil {
+			h.error(w, r, http.StatusInternalServerError, err)
+			return
+		}
+		setContentType(w, "application/json")
+		writeListing(w, r, data)
+		return
+	}
+	var buf bytes.Buffer
+	if err := debugTemplate.Execute(&buf, info); err != nil {
+		h.error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	setContentType(w, "text/html; charset=utf-8")
+	writeListing(w, r, buf.Bytes())
+}
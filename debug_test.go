@@ -0,0 +1,78 @@
+package zipfs
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDebugEndpoint(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	fs, err := New("testdata/testdata.zip", WithMemorySeekLimit(0))
+	require.NoError(err)
+	defer fs.Close()
+	handler := FileServer(fs, WithDebugEndpoint("_zipfs"))
+
+	// a range request extracts a deflated file to a temporary file
+	w := serveTestRequest(handler, "GET", "/img/circle.png", "Range: bytes=0-9")
+	require.Equal(206, w.status)
+
+	w = serveTestRequest(handler, "GET", "/_zipfs", "Accept: application/json")
+	require.Equal(200, w.status)
+	assert.Equal("application/json", w.Header().Get("Content-Type"))
+	assert.Equal("no-store", w.Header().Get("Cache-Control"))
+	var info debugInfo
+	require.NoError(json.Unmarshal(w.buf.Bytes(), &info))
+
+	entries := make(map[string]debugEntry)
+	for _, entry := range info.Entries {
+		entries[entry.Name] = entry
+	}
+	assert.Equal(debugEntry{
+		Name:           "/img/circle.png",
+		Size:           5973,
+		CompressedSize: 4758,
+		Method:         "deflate",
+		CRC32:          "529fb2ff",
+		ETag:           `"1755529fb2ff"`,
+		TempFile:       true,
+	}, entries["/img/circle.png"])
+	assert.Equal("store", entries["/random.dat"].Method)
+	assert.Equal(int64(10000), entries["/random.dat"].Size)
+	assert.False(entries["/random.dat"].TempFile)
+	assert.Contains(entries, "/lots-of-files/file-20")
+	assert.NotContains(entries, "/img/", "directories are not listed")
+	assert.Equal(len(info.Entries), info.Files)
+	assert.Equal(1, info.TempFiles)
+	assert.Equal(int64(1), info.Extractions)
+	var total int64
+	for _, entry := range info.Entries {
+		total += entry.Size
+	}
+	assert.Equal(total, info.TotalSize)
+
+	// HTML for browsers
+	w = serveTestRequest(handler, "GET", "/_zipfs")
+	assert.Equal(200, w.status)
+	assert.Equal("text/html; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Contains(w.buf.String(), "<td>/img/circle.png</td>")
+
+	w = serveTestRequest(handler, "POST", "/_zipfs")
+	assert.Equal(405, w.status)
+	assert.Equal("GET, HEAD", w.Header().Get("Allow"))
+
+	// without the option there is no endpoint
+	w = serveTestRequest(FileServer(fs), "GET", "/_zipfs")
+	assert.Equal(404, w.status)
+
+	// a file at the same path does not shadow the endpoint
+	fs2 := newTestFileSystem(t, map[string]string{"_zipfs": "file"})
+	w = serveTestRequest(FileServer(fs2, WithDebugEndpoint("/_zipfs")), "GET", "/_zipfs")
+	assert.Equal(200, w.status)
+	assert.NotEqual("file", w.buf.String())
+	assert.Equal("file", serveTestRequest(FileServer(fs2), "GET", "/_zipfs").buf.String())
+}
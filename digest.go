@@ -0,0 +1,112 @@
+package zipfs
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"hash"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// digestAlgorithms are the hash functions supported by WithDigests, keyed
+// by their names in the HTTP Digest Algorithm Values registry.
+var digestAlgorithms = map[string]func() hash.Hash{
+	"sha-256": sha256.New,
+	"sha-512": sha512.New,
+	"md5":     md5.New,
+}
+
+// digests returns the base64 encoded digests of the uncompressed content
+// of the file, for each of the algorithms. Digests are calculated once
+// and cached. If calculate is false and any of the digests have not yet
+// been calculated, then digests returns nil.
+func (fi *fileInfo) digests(algorithms []string, calculate bool) ([]string, error) {
+	values := make([]string, len(algorithms))
+	var missing []string
+	fi.mutex.Lock()
+	for i, algorithm := range algorithms {
+		if values[i] = fi.digestValues[algorithm]; values[i] == "" {
+			missing = append(missing, algorithm)
+		}
+	}
+	fi.mutex.Unlock()
+	if len(missing) == 0 {
+		return values, nil
+	}
+	if !calculate {
+		return nil, nil
+	}
+
+	hashes := make([]hash.Hash, len(missing))
+	writers := make([]io.Writer, len(missing))
+	for i, algorithm := range missing {
+		hashes[i] = digestAlgorithms[algorithm]()
+		writers[i] = hashes[i]
+	}
+	reader, err := fi.zipFile.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	buf := bufPool.Get()
+	defer bufPool.Free(buf)
+	if _, err := io.CopyBuffer(io.MultiWriter(writers...), reader, buf); err != nil {
+		return nil, err
+	}
+
+	fi.mutex.Lock()
+	defer fi.mutex.Unlock()
+	if fi.digestValues == nil {
+		fi.digestValues = make(map[string]string)
+	}
+	for i, algorithm := range missing {
+		fi.digestValues[algorithm] = base64.StdEncoding.EncodeToString(hashes[i].Sum(nil))
+	}
+	for i, algorithm := range algorithms {
+		values[i] = fi.digestValues[algorithm]
+	}
+	return values, nil
+}
+
+// setDigests sets the Repr-Digest and Content-MD5 headers for the file
+// fi. The digests are calculated if they have not been already, except
+// for HEAD requests. Content-MD5 is the digest of the response body, so
+// it is only set if whole is true, meaning that the body is the whole
+// uncompressed content of the file.
+func (h *fileHandler) setDigests(w http.ResponseWriter, r *http.Request, fi *fileInfo, whole bool) {
+	values, err := fi.digests(h.digestAlgorithms, r.Method != "HEAD")
+	if err != nil {
+		h.logError(r, err)
+		return
+	}
+	if values == nil {
+		return
+	}
+	var members []string
+	for i, algorithm := range h.digestAlgorithms {
+		if algorithm == "md5" {
+			if whole {
+				w.Header().Set("Content-MD5", values[i])
+			}
+			continue
+		}
+		// The value is a byte sequence in a structured field dictionary.
+		members = append(members, algorithm+"=:"+values[i]+":")
+	}
+	if len(members) > 0 {
+		w.Header().Set("Repr-Digest", strings.Join(members, ", "))
+	}
+}
+
+// warmDigests calculates the digests of all of the files,
+// so that they can be sent in response to HEAD requests.
+func (h *fileHandler) warmDigests() {
+	for _, fi := range h.fs.fileInfos {
+		if !fi.IsDir() {
+			fi.digests(h.digestAlgorithms, true)
+		}
+	}
+}
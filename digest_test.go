@@ -0,0 +1,87 @@
+package zipfs
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDigests(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	fs, err := New("testdata/testdata.zip")
+	require.NoError(err)
+	defer fs.Close()
+	handler := FileServer(fs, WithDigests("sha-256", "md5"))
+
+	// the known MD5s of the files, from TestFile
+	testCases := []struct {
+		Path string
+		MD5  string
+	}{
+		{"/random.dat", "3c9fe0521cabb2ab38484cd1c024a61d"},
+		{"/img/circle.png", "05e3048db45e71749e06658ccfc0753b"},
+	}
+	for _, tc := range testCases {
+		md5, err := hex.DecodeString(tc.MD5)
+		require.NoError(err)
+		contentMD5 := base64.StdEncoding.EncodeToString(md5)
+
+		f, err := fs.Open(tc.Path)
+		require.NoError(err)
+		hash := sha256.New()
+		_, err = io.Copy(hash, f)
+		f.Close()
+		require.NoError(err)
+		reprDigest := "sha-256=:" + base64.StdEncoding.EncodeToString(hash.Sum(nil)) + ":"
+
+		// HEAD does not calculate the digests
+		w := serveTestRequest(handler, "HEAD", tc.Path)
+		assert.Equal(200, w.status, tc.Path)
+		assert.Empty(w.Header().Get("Repr-Digest"), tc.Path)
+		assert.Empty(w.Header().Get("Content-MD5"), tc.Path)
+
+		w = serveTestRequest(handler, "GET", tc.Path)
+		assert.Equal(200, w.status, tc.Path)
+		assert.Equal(reprDigest, w.Header().Get("Repr-Digest"), tc.Path)
+		assert.Equal(contentMD5, w.Header().Get("Content-MD5"), tc.Path)
+
+		w = serveTestRequest(handler, "HEAD", tc.Path)
+		assert.Equal(reprDigest, w.Header().Get("Repr-Digest"), tc.Path)
+		assert.Equal(contentMD5, w.Header().Get("Content-MD5"), tc.Path)
+
+		// Content-MD5 is only sent for the whole uncompressed file
+		for _, header := range []string{"Range: bytes=0-9", "Accept-Encoding: deflate"} {
+			w = serveTestRequest(handler, "GET", tc.Path, header)
+			assert.Equal(reprDigest, w.Header().Get("Repr-Digest"), tc.Path, header)
+			if w.Header().Get("Content-Encoding") != "" || w.status == 206 {
+				assert.Empty(w.Header().Get("Content-MD5"), tc.Path, header)
+			}
+		}
+	}
+
+	assert.Panics(func() { WithDigests("sha-1") })
+}
+
+func TestDigestWarmup(t *testing.T) {
+	assert := assert.New(t)
+
+	fs := newTestFileSystem(t, map[string]string{
+		"a.txt": "a",
+		"b.txt": "b",
+	})
+	handler := FileServer(fs, WithDigests("sha-512", "sha-256"), WithDigestWarmup())
+
+	w := serveTestRequest(handler, "HEAD", "/a.txt")
+	assert.Equal(200, w.status)
+	sha512 := "sha-512=:H0D8ktokFpR1CXnubPWC8tXX0o4YM13gWrxU0FYOD1MChgxlK/CNVgJSql50IQVG82n7u86MEs/HlXsmUv6adQ==:"
+	sha256 := "sha-256=:ypeBEsobvcr6wjGzmiPcTaeG7/gUfE5yuYB3ha/uSLs=:"
+	assert.Equal(sha512+", "+sha256, w.Header().Get("Repr-Digest"))
+	assert.Empty(w.Header().Get("Content-MD5"))
+}
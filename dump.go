@@ -0,0 +1,81 @@
+package zipfs
+
+import (
+	"fmt"
+	"io"
+	iofs "io/fs"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Dump writes a description of the file system to w, for debugging. It
+// is an indented tree of the directories and files, in the order of
+// Walk, with the size, compression method, compressed size and
+// modification time of each file. Directories that have no entries in
+// the ZIP file are shown with "-" for the time. The output does not
+// depend on the order of the entries in the ZIP file, so dumps of
+// different builds of the same content can be compared with diff.
+func (fs *FileSystem) Dump(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	err := fs.Walk("/", func(name string, d iofs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if name == "/" {
+			_, err := fmt.Fprintf(tw, "/\n")
+			return err
+		}
+		info, _ := d.Info()
+		fi := info.(*fileInfo)
+		indent := strings.Repeat("  ", strings.Count(name, "/"))
+		if fi.IsDir() {
+			modTime := "-"
+			if fi.zipFile != nil {
+				modTime = formatDumpTime(fi.zipFile.Modified)
+			}
+			_, err := fmt.Fprintf(tw, "%s%s/\t\t\t\t%s\n", indent, d.Name(), modTime)
+			return err
+		}
+		zf := fi.zipFile
+		_, err = fmt.Fprintf(tw, "%s%s\t%d\t%s\t%d\t%s\n", indent, d.Name(),
+			uncompressedSize(zf), methodName(zf.Method), compressedSize(zf),
+			formatDumpTime(zf.Modified))
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return tw.Flush()
+}
+
+// formatDumpTime formats a modification time for Dump,
+// in UTC so that the output does not depend on the time zone.
+func formatDumpTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+// String returns a summary of the file system, with the name of the
+// ZIP file if it was opened by New, the number of entries and files,
+// and the total size of the files, uncompressed and compressed.
+func (fs *FileSystem) String() string {
+	name := fs.name
+	if name == "" {
+		name = "zipfs"
+	}
+	if fs.reader == nil {
+		return name + ": closed"
+	}
+	var files int
+	var size, compressed int64
+	for _, zf := range fs.reader.File {
+		if zf.Mode().IsDir() {
+			continue
+		}
+		files++
+		size += uncompressedSize(zf)
+		compressed += compressedSize(zf)
+	}
+	return fmt.Sprintf("%s: %d entries, %d files, %d bytes (%d compressed)",
+		name, len(fs.reader.File), files, size, compressed)
+}
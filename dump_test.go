@@ -0,0 +1,76 @@
+package zipfs
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testdataDump = `/
+  empty/                                         2016-03-12T06:39:39Z
+  img/                                           2016-03-12T06:38:56Z
+    another-circle.png    5973   deflate  4758   2016-02-12T04:01:01Z
+    circle.png            5973   deflate  4758   2016-02-12T04:01:01Z
+  index.html              122    deflate  85     2016-02-12T04:02:20Z
+  js/                                            2016-03-12T05:52:54Z
+    application-23a0..js  79     store    79     2016-03-12T05:55:45Z
+  lots-of-files/                                 2016-03-12T06:41:36Z
+    file-01               5      store    5      2016-03-12T06:41:36Z
+    file-02               5      store    5      2016-03-12T06:41:36Z
+    file-03               5      store    5      2016-03-12T06:41:36Z
+    file-04               5      store    5      2016-03-12T06:41:36Z
+    file-05               5      store    5      2016-03-12T06:41:36Z
+    file-06               5      store    5      2016-03-12T06:41:36Z
+    file-07               5      store    5      2016-03-12T06:41:36Z
+    file-08               5      store    5      2016-03-12T06:41:36Z
+    file-09               5      store    5      2016-03-12T06:41:36Z
+    file-10               5      store    5      2016-03-12T06:41:36Z
+    file-11               5      store    5      2016-03-12T06:41:36Z
+    file-12               5      store    5      2016-03-12T06:41:36Z
+    file-13               5      store    5      2016-03-12T06:41:36Z
+    file-14               5      store    5      2016-03-12T06:41:36Z
+    file-15               5      store    5      2016-03-12T06:41:36Z
+    file-16               5      store    5      2016-03-12T06:41:36Z
+    file-17               5      store    5      2016-03-12T06:41:36Z
+    file-18               5      store    5      2016-03-12T06:41:36Z
+    file-19               5      store    5      2016-03-12T06:41:36Z
+    file-20               5      store    5      2016-03-12T06:41:36Z
+  not-a-zip-file.txt      25     store    25     2016-02-12T04:13:08Z
+  random.dat              10000  store    10000  2016-02-12T04:49:11Z
+  test.html               134    deflate  89     2016-03-12T05:57:25Z
+`
+
+func TestDump(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	fs, err := New("testdata/testdata.zip")
+	require.NoError(err)
+
+	var buf bytes.Buffer
+	require.NoError(fs.Dump(&buf))
+	assert.Equal(testdataDump, buf.String())
+	assert.Equal("testdata/testdata.zip: 31 entries, 27 files, 22406 bytes (19894 compressed)", fs.String())
+
+	fs.Close()
+	assert.Equal("testdata/testdata.zip: closed", fs.String())
+	assert.True(errors.Is(fs.Dump(&buf), ErrClosed))
+
+	// directories without entries have no time
+	fs = newTestFileSystem(t, map[string]string{"a/b.dat": "b"})
+	buf.Reset()
+	require.NoError(fs.Dump(&buf))
+	assert.Equal("/\n  a/                    -\n    b.dat  1  store  1  2020-01-02T03:04:06Z\n", buf.String())
+
+	// without a file name
+	data, err := os.ReadFile("testdata/testdata.zip")
+	require.NoError(err)
+	fs, err = newFileSystem(bytes.NewReader(data), int64(len(data)), nil)
+	require.NoError(err)
+	assert.Equal("zipfs: 31 entries, 27 files, 22406 bytes (19894 compressed)", fs.String())
+
+}
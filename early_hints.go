@@ -0,0 +1,76 @@
+package zipfs
+
+import (
+	"net/http"
+	"strings"
+)
+
+// LinkHint is a resource that the client should start loading early,
+// because it is needed by a page. See WithEarlyHints.
+type LinkHint struct {
+	// URL is the location of the resource. A path is relative to the
+	// handler, in the same way as the location of a redirect.
+	URL string
+
+	// Rel is the relation type of the link. The default is "preload".
+	Rel string
+
+	// As is the type of the resource, such as "style", "script"
+	// or "font", for preload links.
+	As string
+
+	// CrossOrigin adds the crossorigin attribute, which is needed
+	// to preload fonts.
+	CrossOrigin bool
+}
+
+// value returns the value of a Link header for the hint,
+// with the URL at location.
+func (hint LinkHint) value(location string) string {
+	rel := hint.Rel
+	if rel == "" {
+		rel = "preload"
+	}
+	var b strings.Builder
+	b.WriteString("<" + location + ">; rel=" + rel)
+	if hint.As != "" {
+		b.WriteString("; as=" + hint.As)
+	}
+	if hint.CrossOrigin {
+		b.WriteString("; crossorigin")
+	}
+	return b.String()
+}
+
+// setLinkHints adds the Link headers configured by WithEarlyHints for
+// the file at name, and reports whether there were any.
+func (h *fileHandler) setLinkHints(w http.ResponseWriter, r *http.Request, name string) bool {
+	hints := h.earlyHints[name]
+	for _, hint := range hints {
+		w.Header().Add("Link", hint.value(h.location(r, hint.URL)))
+	}
+	return len(hints) > 0
+}
+
+// sendEarlyHints sends a 103 Early Hints response with the Link headers
+// that have been set, so that the client can load the resources while
+// the final response is sent. Clients using HTTP/1.0 do not support
+// informational responses.
+func sendEarlyHints(w http.ResponseWriter, r *http.Request) {
+	if !r.ProtoAtLeast(1, 1) {
+		return
+	}
+	// All of the headers set so far would be sent with the informational
+	// response, so only the links are kept while it is written.
+	header := w.Header()
+	saved := header.Clone()
+	for key := range header {
+		if key != "Link" {
+			delete(header, key)
+		}
+	}
+	w.WriteHeader(http.StatusEarlyHints)
+	for key, values := range saved {
+		header[key] = values
+	}
+}
@@ -0,0 +1,108 @@
+package zipfs
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"net/textproto"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEarlyHints(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	fs := newTestFileSystem(t, map[string]string{
+		"index.html":   "<html></html>",
+		"about.html":   "<html>about</html>",
+		"css/main.css": "body {}",
+	})
+	handler := FileServer(fs, WithEarlyHints(map[string][]LinkHint{
+		"/index.html": {
+			{URL: "/css/main.css", As: "style"},
+			{URL: "https://fonts.example.com/font.woff2", As: "font", CrossOrigin: true},
+			{URL: "/js/app.js", Rel: "modulepreload"},
+		},
+	}))
+	links := []string{
+		"</css/main.css>; rel=preload; as=style",
+		"<https://fonts.example.com/font.woff2>; rel=preload; as=font; crossorigin",
+		"</js/app.js>; rel=modulepreload",
+	}
+
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	get := func(path string) (*http.Response, []int, []textproto.MIMEHeader) {
+		var codes []int
+		var headers []textproto.MIMEHeader
+		trace := &httptrace.ClientTrace{
+			Got1xxResponse: func(code int, header textproto.MIMEHeader) error {
+				codes = append(codes, code)
+				headers = append(headers, header)
+				return nil
+			},
+		}
+		ctx := httptrace.WithClientTrace(context.Background(), trace)
+		req, err := http.NewRequestWithContext(ctx, "GET", server.URL+path, nil)
+		require.NoError(err)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(err)
+		defer resp.Body.Close()
+		_, err = io.ReadAll(resp.Body)
+		require.NoError(err)
+		return resp, codes, headers
+	}
+
+	resp, codes, headers := get("/")
+	assert.Equal(200, resp.StatusCode)
+	assert.Equal(links, resp.Header.Values("Link"))
+	if assert.Equal([]int{http.StatusEarlyHints}, codes) {
+		assert.Equal(links, headers[0].Values("Link"))
+		assert.Empty(headers[0].Get("Content-Type"), "only links in the early hints")
+		assert.Empty(headers[0].Get("Etag"))
+	}
+	assert.Equal("text/html; charset=utf-8", resp.Header.Get("Content-Type"))
+
+	resp, codes, _ = get("/about.html")
+	assert.Equal(200, resp.StatusCode)
+	assert.Empty(resp.Header.Values("Link"))
+	assert.Empty(codes)
+
+	// no early hints for HTTP/1.0
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Proto, r.ProtoMajor, r.ProtoMinor = "HTTP/1.0", 1, 0
+	w := &statusRecorder{TestResponseWriter: NewTestResponseWriter()}
+	handler.ServeHTTP(w, r)
+	assert.Equal([]int{200}, w.statuses)
+	assert.Equal(links, w.Header().Values("Link"))
+
+	r = httptest.NewRequest("GET", "/", nil)
+	w = &statusRecorder{TestResponseWriter: NewTestResponseWriter()}
+	handler.ServeHTTP(w, r)
+	assert.Equal([]int{103, 200}, w.statuses)
+}
+
+// statusRecorder records the status codes written,
+// including informational responses.
+type statusRecorder struct {
+	*TestResponseWriter
+	statuses []int
+}
+
+func (w *statusRecorder) WriteHeader(status int) {
+	w.statuses = append(w.statuses, status)
+	w.TestResponseWriter.WriteHeader(status)
+}
+
+func (w *statusRecorder) Write(b []byte) (int, error) {
+	if len(w.statuses) == 0 || w.statuses[len(w.statuses)-1] < 200 {
+		w.WriteHeader(200)
+	}
+	return w.TestResponseWriter.Write(b)
+}
@@ -0,0 +1,104 @@
+package zipfs
+
+import (
+	"net/http"
+	"net/textproto"
+	"strings"
+)
+
+// parseETagList parses a comma-separated list of entity tags, as found
+// in the If-None-Match and If-Match headers. Each entity tag is returned
+// including its quotes and any "W/" prefix. The wildcard "*" is returned
+// as is. Members that are not valid entity tags are skipped.
+func parseETagList(s string) []string {
+	var etags []string
+	for {
+		s = textproto.TrimString(s)
+		if s == "" {
+			return etags
+		}
+		if s[0] == ',' {
+			s = s[1:]
+			continue
+		}
+
+		var etag, remain string
+		if s[0] == '*' {
+			etag, remain = "*", s[1:]
+		} else {
+			etag, remain = scanETag(s)
+		}
+
+		// A valid member is followed by the end of the list or a comma.
+		remain = textproto.TrimString(remain)
+		if etag == "" || (remain != "" && remain[0] != ',') {
+			s = skipListMember(s)
+			continue
+		}
+		etags = append(etags, etag)
+		s = remain
+	}
+}
+
+// scanETag determines if a syntactically valid ETag is present at s. If so,
+// the ETag and remaining text after consuming ETag is returned. Otherwise,
+// it returns "", "".
+func scanETag(s string) (etag string, remain string) {
+	s = textproto.TrimString(s)
+	start := 0
+	if strings.HasPrefix(s, "W/") {
+		start = 2
+	}
+	if len(s[start:]) < 2 || s[start] != '"' {
+		return "", ""
+	}
+	// ETag is either W/"text" or "text".
+	// See RFC 9110, section 8.8.3.
+	for i := start + 1; i < len(s); i++ {
+		c := s[i]
+		switch {
+		// Character values allowed in ETags.
+		case c == 0x21 || c >= 0x23 && c <= 0x7E || c >= 0x80:
+		case c == '"':
+			return s[:i+1], s[i+1:]
+		default:
+			return "", ""
+		}
+	}
+	return "", ""
+}
+
+// skipListMember returns s after the next comma that is not part
+// of a quoted string, or an empty string if there is none.
+func skipListMember(s string) string {
+	quoted := false
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '"':
+			quoted = !quoted
+		case ',':
+			if !quoted {
+				return s[i+1:]
+			}
+		}
+	}
+	return ""
+}
+
+// headerList returns all values of the header key joined into
+// a single comma-separated list.
+func headerList(h http.Header, key string) string {
+	return strings.Join(h[textproto.CanonicalMIMEHeaderKey(key)], ",")
+}
+
+// etagStrongMatch reports whether a and b match using strong ETag comparison.
+// Assumes a and b are valid ETags.
+func etagStrongMatch(a, b string) bool {
+	return a == b && a != "" && a[0] == '"'
+}
+
+// etagWeakMatch reports whether a and b match using weak ETag comparison.
+// Assumes a and b are valid ETags.
+func etagWeakMatch(a, b string) bool {
+	return strings.TrimPrefix(a, "W/") == strings.TrimPrefix(b, "W/")
+}
@@ -0,0 +1,67 @@
+package zipfs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseETagList(t *testing.T) {
+	assert := assert.New(t)
+	testCases := []struct {
+		Header string
+		ETags  []string
+	}{
+		// Examples from RFC 9110, section 13.1.2.
+		{`"xyzzy"`, []string{`"xyzzy"`}},
+		{`W/"xyzzy"`, []string{`W/"xyzzy"`}},
+		{`"xyzzy", "r2d2xxxx", "c3piozzzz"`, []string{`"xyzzy"`, `"r2d2xxxx"`, `"c3piozzzz"`}},
+		{`W/"xyzzy", W/"r2d2xxxx", W/"c3piozzzz"`, []string{`W/"xyzzy"`, `W/"r2d2xxxx"`, `W/"c3piozzzz"`}},
+		{`*`, []string{`*`}},
+
+		// Whitespace and empty members.
+		{``, nil},
+		{`   `, nil},
+		{` "a" ,"b",	W/"c" `, []string{`"a"`, `"b"`, `W/"c"`}},
+		{`,, "a",,`, []string{`"a"`}},
+		{`""`, []string{`""`}},
+		{`"a,b", "c"`, []string{`"a,b"`, `"c"`}},
+
+		// Malformed members are skipped.
+		{`a, "b"`, []string{`"b"`}},
+		{`"a" x, "b"`, []string{`"b"`}},
+		{`w/"a", "b"`, []string{`"b"`}},
+		{`W/ "a", "b"`, []string{`"b"`}},
+		{`"a b", "c"`, []string{`"c"`}},
+		{`"a`, nil},
+		{`"`, nil},
+		{`W/`, nil},
+		{`**, "a"`, []string{`"a"`}},
+		{`"a""b", "c"`, []string{`"c"`}},
+		{`"x,y" junk, "z"`, []string{`"z"`}},
+		{"\"a\x7f\", \"b\"", []string{`"b"`}},
+	}
+
+	for _, tc := range testCases {
+		assert.Equal(tc.ETags, parseETagList(tc.Header), tc.Header)
+	}
+}
+
+func TestETagMatch(t *testing.T) {
+	assert := assert.New(t)
+	testCases := []struct {
+		A, B   string
+		Strong bool
+		Weak   bool
+	}{
+		{`W/"1"`, `W/"1"`, false, true},
+		{`W/"1"`, `W/"2"`, false, false},
+		{`W/"1"`, `"1"`, false, true},
+		{`"1"`, `"1"`, true, true},
+	}
+
+	for _, tc := range testCases {
+		assert.Equal(tc.Strong, etagStrongMatch(tc.A, tc.B), tc.A+" "+tc.B)
+		assert.Equal(tc.Weak, etagWeakMatch(tc.A, tc.B), tc.A+" "+tc.B)
+	}
+}
@@ -1,16 +1,32 @@
 package zipfs_test
 
 import (
+	"archive/zip"
+	"log"
 	"net/http"
 
 	"github.com/spexp/zipfs"
 )
 
-func Example() error {
+func Example() {
 	fs, err := zipfs.New("testdata/testdata.zip")
 	if err != nil {
-		return err
+		log.Fatal(err)
 	}
 
-	return http.ListenAndServe(":8080", zipfs.FileServer(fs))
+	log.Fatal(http.ListenAndServe(":8080", zipfs.FileServer(fs)))
+}
+
+func ExampleWithETagFunc() {
+	fs, err := zipfs.New("testdata/testdata.zip")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Disable ETags because they are generated by an upstream proxy.
+	noETag := func(name string, f *zip.File) string {
+		return ""
+	}
+
+	log.Fatal(http.ListenAndServe(":8080", zipfs.FileServer(fs, zipfs.WithETagFunc(noETag))))
 }
@@ -0,0 +1,255 @@
+package zipfs
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"io"
+	iofs "io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+var errInvalidName = errors.New("invalid name")
+
+// OverwritePolicy determines what Extract does when a file
+// already exists.
+type OverwritePolicy int
+
+const (
+	// OverwriteNever causes Extract to fail if a file exists.
+	OverwriteNever OverwritePolicy = iota
+
+	// OverwriteSkip causes Extract to leave existing files as they are.
+	OverwriteSkip
+
+	// OverwriteAlways causes Extract to replace existing files.
+	OverwriteAlways
+)
+
+// ExtractOption configures Extract.
+type ExtractOption func(opts *extractOptions)
+
+type extractOptions struct {
+	overwrite   OverwritePolicy
+	prefix      string
+	concurrency int
+}
+
+// WithOverwrite sets what Extract does with files that already exist.
+// The default is OverwriteNever. Existing directories are always used.
+func WithOverwrite(policy OverwritePolicy) ExtractOption {
+	return func(opts *extractOptions) {
+		opts.overwrite = policy
+	}
+}
+
+// WithExtractPrefix causes Extract to extract only the files and
+// directories with names starting with prefix, such as "/img/" for
+// the directory img. Their names are not changed, so they are written
+// to the same paths as without the option.
+func WithExtractPrefix(prefix string) ExtractOption {
+	return func(opts *extractOptions) {
+		if !strings.HasPrefix(prefix, "/") {
+			prefix = "/" + prefix
+		}
+		opts.prefix = prefix
+	}
+}
+
+// WithExtractConcurrency sets the number of files that Extract writes
+// at the same time. The default is one.
+func WithExtractConcurrency(n int) ExtractOption {
+	return func(opts *extractOptions) {
+		if n < 1 {
+			n = 1
+		}
+		opts.concurrency = n
+	}
+}
+
+// Extract writes the files in the file system to the directory dir,
+// creating it and any subdirectories as needed. The files have the
+// permissions recorded in the ZIP file, subject to the umask, and its
+// modification times. Symbolic links are created if their targets are
+// within dir.
+//
+// Before anything is written, the names of the entries are checked, and
+// if any could refer to a path outside dir, such as "../file", then
+// Extract returns an error. If ctx is cancelled then Extract stops,
+// leaving the files written so far, and returns the context's error.
+func (fs *FileSystem) Extract(ctx context.Context, dir string, opts ...ExtractOption) error {
+	o := extractOptions{concurrency: 1}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if fs.reader == nil {
+		return ErrClosed
+	}
+	for _, zf := range fs.reader.File {
+		name := strings.TrimSuffix(zf.Name, "/")
+		if !iofs.ValidPath(name) || !isLocal(filepath.FromSlash(name)) {
+			return &os.PathError{Op: "Extract", Path: zf.Name, Err: errInvalidName}
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+		sem      = make(chan struct{}, o.concurrency)
+		dirs     []struct {
+			path    string
+			modTime time.Time
+		}
+	)
+	setErr := func(err error) {
+		errOnce.Do(func() {
+			firstErr = err
+			cancel()
+		})
+	}
+	err := fs.Walk("/", func(name string, d iofs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return iofs.SkipAll
+		}
+		info, _ := d.Info()
+		fi := info.(*fileInfo)
+		target := filepath.Join(dir, filepath.FromSlash(name))
+		if fi.IsDir() {
+			if !strings.HasPrefix(name+"/", o.prefix) {
+				// Directories containing the prefix are walked.
+				if name == "/" || strings.HasPrefix(o.prefix, name+"/") {
+					return nil
+				}
+				return iofs.SkipDir
+			}
+			if fi.zipFile != nil {
+				dirs = append(dirs, struct {
+					path    string
+					modTime time.Time
+				}{target, fi.zipFile.Modified})
+			}
+			return os.MkdirAll(target, 0755)
+		}
+		if !strings.HasPrefix(name, o.prefix) {
+			return nil
+		}
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			if err := extractFile(ctx, dir, target, fi.zipFile, o.overwrite); err != nil {
+				setErr(err)
+			}
+		}()
+		return nil
+	})
+	wg.Wait()
+	if err != nil {
+		return err
+	}
+	if firstErr != nil {
+		return firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// Setting the times of directories is left until last,
+	// because creating files in them changes their times.
+	for _, d := range dirs {
+		if err := os.Chtimes(d.path, d.modTime, d.modTime); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// extractFile writes the file zf to the path target in dir.
+func extractFile(ctx context.Context, dir, target string, zf *zip.File, overwrite OverwritePolicy) error {
+	if overwrite == OverwriteAlways {
+		// A file is replaced rather than truncated, so that
+		// its permissions are set and links are not followed.
+		if err := os.Remove(target); err != nil && !errors.Is(err, iofs.ErrNotExist) {
+			return err
+		}
+	}
+	r, err := zf.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	if zf.Mode()&iofs.ModeSymlink != 0 {
+		return extractSymlink(dir, target, r, overwrite)
+	}
+	f, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, zf.Mode().Perm())
+	if err != nil {
+		if overwrite == OverwriteSkip && errors.Is(err, iofs.ErrExist) {
+			return nil
+		}
+		return err
+	}
+	buf := bufPool.Get()
+	defer bufPool.Free(buf)
+	_, err = io.CopyBuffer(f, &contextReader{ctx: ctx, r: r}, buf)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Chtimes(target, zf.Modified, zf.Modified)
+}
+
+// extractSymlink creates a symbolic link at target in dir to the
+// location read from r, if it is within dir.
+func extractSymlink(dir, target string, r io.Reader, overwrite OverwritePolicy) error {
+	data, err := io.ReadAll(io.LimitReader(r, 4096))
+	if err != nil {
+		return err
+	}
+	link := filepath.FromSlash(string(data))
+	rel, err := filepath.Rel(dir, filepath.Join(filepath.Dir(target), link))
+	if err != nil || filepath.IsAbs(link) || !isLocal(rel) {
+		return &os.PathError{Op: "Extract", Path: target, Err: errInvalidName}
+	}
+	err = os.Symlink(link, target)
+	if overwrite == OverwriteSkip && errors.Is(err, iofs.ErrExist) {
+		return nil
+	}
+	return err
+}
+
+// isLocal reports whether the file path p, which must be relative,
+// refers to a location within the directory it is relative to.
+func isLocal(p string) bool {
+	p = filepath.Clean(p)
+	return p != ".." && !strings.HasPrefix(p, ".."+string(filepath.Separator)) &&
+		!filepath.IsAbs(p) && filepath.VolumeName(p) == ""
+}
+
+// contextReader is a reader that fails once its context is done.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (cr *contextReader) Read(p []byte) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cr.r.Read(p)
+}
@@ -0,0 +1,131 @@
+package zipfs
+
+import (
+	"context"
+	"errors"
+	"hash/crc32"
+	iofs "io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/spexp/zipfs/zipfstest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExtract(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	fs, err := New("testdata/testdata.zip")
+	require.NoError(err)
+	defer fs.Close()
+
+	dir := filepath.Join(t.TempDir(), "out")
+	require.NoError(fs.Extract(context.Background(), dir, WithExtractConcurrency(4)))
+	for _, zf := range fs.reader.File {
+		target := filepath.Join(dir, filepath.FromSlash(zf.Name))
+		info, err := os.Stat(target)
+		require.NoError(err, zf.Name)
+		assert.Equal(zf.Mode().IsDir(), info.IsDir(), zf.Name)
+		assert.True(zf.Modified.Equal(info.ModTime()), zf.Name)
+		assert.Zero(info.Mode().Perm()&^zf.Mode().Perm(), zf.Name)
+		if info.IsDir() {
+			continue
+		}
+		data, err := os.ReadFile(target)
+		require.NoError(err)
+		assert.Equal(zf.CRC32, crc32.ChecksumIEEE(data), zf.Name)
+	}
+
+	// existing files
+	err = fs.Extract(context.Background(), dir)
+	assert.True(errors.Is(err, iofs.ErrExist), err)
+	require.NoError(os.WriteFile(filepath.Join(dir, "index.html"), []byte("changed"), 0644))
+	require.NoError(fs.Extract(context.Background(), dir, WithOverwrite(OverwriteSkip)))
+	data, err := os.ReadFile(filepath.Join(dir, "index.html"))
+	require.NoError(err)
+	assert.Equal("changed", string(data))
+	require.NoError(fs.Extract(context.Background(), dir, WithOverwrite(OverwriteAlways)))
+	data, err = os.ReadFile(filepath.Join(dir, "index.html"))
+	require.NoError(err)
+	assert.Len(data, 122)
+
+	// a subtree
+	dir = t.TempDir()
+	require.NoError(fs.Extract(context.Background(), dir, WithExtractPrefix("img/")))
+	var names []string
+	err = filepath.WalkDir(dir, func(p string, d iofs.DirEntry, err error) error {
+		rel, _ := filepath.Rel(dir, p)
+		names = append(names, filepath.ToSlash(rel))
+		return err
+	})
+	require.NoError(err)
+	assert.Equal([]string{".", "img", "img/another-circle.png", "img/circle.png"}, names)
+
+	// cancellation
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	dir = t.TempDir()
+	err = fs.Extract(ctx, dir)
+	assert.Equal(context.Canceled, err)
+	entries, err := os.ReadDir(dir)
+	require.NoError(err)
+	assert.Empty(entries)
+
+	fs.Close()
+	assert.Equal(ErrClosed, fs.Extract(context.Background(), t.TempDir()))
+}
+
+func TestExtractModes(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("permissions and symbolic links")
+	}
+	assert := assert.New(t)
+	require := require.New(t)
+
+	fs := newBuilderFileSystem(t, zipfstest.NewBuilder().
+		AddDir("bin").
+		AddFile("bin/run.sh", []byte("#!/bin/sh\n"), zipfstest.ModTime, 0755).
+		AddSymlink("bin/link", "../doc.txt").
+		AddFile("doc.txt", []byte("doc"), zipfstest.ModTime, 0600))
+	dir := t.TempDir()
+	require.NoError(fs.Extract(context.Background(), dir))
+	info, err := os.Stat(filepath.Join(dir, "bin/run.sh"))
+	require.NoError(err)
+	assert.NotZero(info.Mode().Perm() & 0100)
+	info, err = os.Stat(filepath.Join(dir, "doc.txt"))
+	require.NoError(err)
+	assert.Equal(os.FileMode(0600), info.Mode().Perm())
+	link, err := os.Readlink(filepath.Join(dir, "bin/link"))
+	require.NoError(err)
+	assert.Equal("../doc.txt", link)
+
+	// links outside the directory are not created
+	for _, target := range []string{"../../doc.txt", "/etc/passwd"} {
+		fs = newBuilderFileSystem(t, zipfstest.NewBuilder().AddSymlink("bin/link", target))
+		dir = t.TempDir()
+		err = fs.Extract(context.Background(), dir)
+		assert.True(errors.Is(err, errInvalidName), err)
+		_, err = os.Lstat(filepath.Join(dir, "bin/link"))
+		assert.True(errors.Is(err, iofs.ErrNotExist), err)
+	}
+}
+
+func TestExtractHostileNames(t *testing.T) {
+	for _, name := range []string{"../evil.txt", "a/../../evil.txt", "/evil.txt", "a//evil.txt"} {
+		fs := newBuilderFileSystem(t, zipfstest.NewBuilder().
+			AddDeflated("ok.txt", nil).
+			AddDeflated(name, nil))
+		dir := filepath.Join(t.TempDir(), "a", "out")
+		err := fs.Extract(context.Background(), dir)
+		assert.True(t, errors.Is(err, errInvalidName), name)
+		// nothing is written
+		_, err = os.Stat(dir)
+		assert.True(t, errors.Is(err, iofs.ErrNotExist), name)
+		_, err = os.Stat(filepath.Join(dir, "..", "..", "evil.txt"))
+		assert.True(t, errors.Is(err, iofs.ErrNotExist), name)
+	}
+}
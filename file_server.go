@@ -9,14 +9,22 @@ package zipfs
 
 import (
 	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"html/template"
 	"io"
+	"log"
 	"mime"
 	"net/http"
+	"net/url"
 	"os"
 	"path"
 	"path/filepath"
+	"regexp"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -25,170 +33,805 @@ import (
 // It provides slightly better performance than the
 // http.FileServer implementation because it serves compressed content
 // to clients that can accept the "deflate" compression algorithm.
-func FileServer(fs *FileSystem) http.Handler {
+// The handler can be configured with zero or more options.
+func FileServer(fs *FileSystem, opts ...HandlerOption) http.Handler {
 	h := &fileHandler{
-		fs: fs,
+		fs:             fs,
+		indexNames:     []string{"index.html"},
+		redirectStatus: http.StatusMovedPermanently,
+		spaMatch:       hasNoExtension,
+		allowedMethods: []string{"GET", "HEAD"},
 	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	if h.headersFile != "" {
+		h.loadHeadersFile(h.headersFile)
+	}
+	if h.redirectsFile != "" {
+		h.loadRedirectsFile(h.redirectsFile)
+	}
+	if h.debugPath != "" {
+		// A file at the same path would never be served.
+		h.hide(h.debugPath)
+	}
+	if h.archivePath != "" {
+		if _, err := h.fs.openFileInfo(h.archivePath); err == nil {
+			log.Printf("zipfs: %s is in the archive, so it is served instead of the archive", h.archivePath)
+			h.archivePath = ""
+		} else if h.fs.reader != nil {
+			h.archiveETag = archiveETag(h.fs)
+		}
+	}
+	if h.defaultLanguage != "" && h.fs.reader != nil {
+		h.findLanguageVariants()
+	}
+	if h.digestWarmup && len(h.digestAlgorithms) > 0 {
+		h.warmDigests()
+	}
+	h.methods = make(map[string]bool)
+	for _, method := range h.allowedMethods {
+		h.methods[method] = true
+	}
+	h.allow = strings.Join(append(h.allowedMethods, "OPTIONS"), ", ")
 
 	return h
 }
 
 type fileHandler struct {
-	fs *FileSystem
+	fs           *FileSystem
+	etagFunc     func(name string, f *zip.File) string
+	weakETags    bool
+	cacheControl string
+	cacheRules   []CacheRule
+	fingerprint  *regexp.Regexp
+	headerFunc   func(h http.Header, name string, fi os.FileInfo)
+	headersFile  string
+	headerRules  []headerRule
+	hidden       map[string]bool
+	noDotfiles   bool
+	deny         []string
+	allowOnly    []string
+	accessCheck  func(r *http.Request, name string, fi os.FileInfo) error
+	indexNames   []string
+
+	redirectStatus  int
+	noRedirects     bool
+	trailingSlash   TrailingSlashPolicy
+	mountPrefix     string // without a trailing slash, set by Mount
+	forwardedPrefix bool
+
+	noIndex NoIndexBehavior
+
+	redirectsFile string
+	redirectRules []redirectRule
+	aliases       map[string]string
+	rewrite       func(path string) string
+
+	spaFallback     string
+	spaMatch        func(r *http.Request) bool
+	notFoundPage    string
+	notFoundHandler http.Handler
+
+	allowedMethods  []string
+	methods         map[string]bool // set of allowedMethods
+	allow           string          // value of the Allow header
+	errorHandler    func(w http.ResponseWriter, r *http.Request, code int, err error)
+	errorLog        func(r *http.Request, err error)
+	listingTemplate *template.Template
+
+	debugPath        string
+	archivePath      string
+	dirDownload      bool
+	archiveETag      string
+	noSniff          bool
+	serverTiming     bool
+	push             map[string][]string
+	earlyHints       map[string][]LinkHint
+	digestAlgorithms []string
+	digestWarmup     bool
+	attachments      []string
+	attachmentFunc   func(r *http.Request, name string, attachment bool) bool
+	languageSuffixes bool
+	languageTags     map[string]string // keyed by lower case suffix
+	defaultLanguage  string
+	languageVariants map[string][]languageVariant // set if negotiating
+	defaultCharset   string
+	noCharset        map[string]bool // media types without a default charset
+	charsetTypes     sync.Map        // content types with the default charset
+	rangeMemoryLimit int64
+	rangeLimitSet    bool // set by WithRangeMemoryLimit
+	maxServeSize     int64
+	flushInterval    time.Duration
+}
+
+// hide prevents the file at name from being served.
+func (h *fileHandler) hide(name string) {
+	if h.hidden == nil {
+		h.hidden = make(map[string]bool)
+	}
+	h.hidden[name] = true
+}
+
+// isHidden reports whether the file or directory at name must not be
+// served, because it has been hidden, is a dotfile that should not be
+// served, or matches a WithDeny pattern. A pattern for the files in a
+// directory also hides the directory.
+func (h *fileHandler) isHidden(name string) bool {
+	if h.hidden[name] {
+		return true
+	}
+	if h.noDotfiles && hasDotSegment(name) {
+		return true
+	}
+	for _, pattern := range h.deny {
+		if matchPath(pattern, name) || matchPath(pattern, name+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// hasDotSegment reports whether any element
+// of the path name starts with a dot.
+func hasDotSegment(name string) bool {
+	for _, seg := range strings.Split(name, "/") {
+		if strings.HasPrefix(seg, ".") {
+			return true
+		}
+	}
+	return false
+}
+
+// isAllowed reports whether the file at name matches one of the
+// WithAllowOnly patterns, if there are any. Directories are not
+// checked, but the files in them are.
+func (h *fileHandler) isAllowed(name string) bool {
+	if len(h.allowOnly) == 0 {
+		return true
+	}
+	for _, pattern := range h.allowOnly {
+		if matchPath(pattern, name) {
+			return true
+		}
+	}
+	return false
 }
 
 func (h *fileHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.serverTiming {
+		r = withServerTiming(r)
+	}
+	if h.mountPrefix != "" {
+		if r = h.unmount(w, r); r == nil {
+			return
+		}
+	}
 	upath := r.URL.Path
 	if !strings.HasPrefix(upath, "/") {
+		// Serve a copy of the request with an absolute path, so that
+		// the original can be passed to the not found handler.
 		upath = "/" + upath
-		r.URL.Path = upath
+		r2 := r.WithContext(context.WithValue(r.Context(), originalRequestKey{}, r))
+		r2.URL = new(url.URL)
+		*r2.URL = *r.URL
+		r2.URL.Path = upath
+		r = r2
 	}
 
-	serveFile(w, r, h.fs, path.Clean(upath), true)
+	name := path.Clean(upath)
+	if h.debugPath != "" && name == h.debugPath {
+		h.serveDebug(w, r)
+		return
+	}
+	if h.archivePath != "" && name == h.archivePath {
+		h.serveArchive(w, r)
+		return
+	}
+	if h.serveRedirectRule(w, r, name) {
+		return
+	}
+	if target := h.rewritePath(name); target != name {
+		// Serve the target as if it had been requested,
+		// without redirecting the client to it.
+		h.serveFile(w, r, target, false)
+		return
+	}
+	h.serveFile(w, r, name, !h.noRedirects)
+}
+
+// rewritePath returns the name of the file to serve for the cleaned
+// path name, after applying the aliases and then the rewrite function.
+func (h *fileHandler) rewritePath(name string) string {
+	if target, ok := h.aliases[name]; ok {
+		name = target
+	}
+	if h.rewrite != nil {
+		name = path.Clean("/" + h.rewrite(name))
+	}
+	return name
 }
 
 // name is '/'-separated, not filepath.Separator.
-func serveFile(w http.ResponseWriter, r *http.Request, fs *FileSystem, name string, redirect bool) {
-	const indexPage = "/index.html"
+func (h *fileHandler) serveFile(w http.ResponseWriter, r *http.Request, name string, redirect bool) {
+	fs := h.fs
 
 	// redirect .../index.html to .../
 	// can't use Redirect() because that would make the path absolute,
 	// which would be a problem running under StripPrefix
-	if strings.HasSuffix(r.URL.Path, indexPage) {
-		localRedirect(w, r, "./")
+	if redirect && h.isIndexRequest(r.URL.Path) {
+		dir := path.Dir(r.URL.Path)
+		if h.trailingSlash == TrailingSlashStrip && dir != "/" {
+			h.localRedirect(w, r, "../"+path.Base(dir), h.redirectStatus)
+		} else {
+			h.localRedirect(w, r, "./", h.redirectStatus)
+		}
 		return
 	}
 
+	if h.isHidden(name) {
+		h.notFound(w, r)
+		return
+	}
+	if h.languageVariants != nil {
+		name = h.negotiateLanguage(w, r, name)
+	}
+
 	d, err := fs.openFileInfo(name)
 	if err != nil {
-		msg, code := toHTTPError(err)
-		http.Error(w, msg, code)
+		code := toHTTPStatus(err)
+		if code == http.StatusNotFound {
+			h.notFound(w, r)
+			return
+		}
+		h.error(w, r, code, err)
+		return
+	}
+	if !d.IsDir() && !h.isAllowed(name) {
+		h.notFound(w, r)
+		return
+	}
+	if !h.checkAccess(w, r, name, d) {
+		return
+	}
+
+	// The file exists, so the response to other methods is
+	// 405 Method Not Allowed rather than 404 Not Found.
+	if h.checkMethod(w, r) {
 		return
 	}
 
+	// use contents of the index document for directory, if present
+	var index string
+	var indexInfo *fileInfo
+	if d.IsDir() {
+		index, indexInfo = h.findIndex(name)
+		if indexInfo != nil && !h.checkAccess(w, r, index, indexInfo) {
+			return
+		}
+	}
+
 	if redirect {
-		// redirect to canonical path: / at end of directory url
+		// redirect to canonical path, according to the trailing slash
+		// policy. A directory without an index document is not served
+		// unless it is listed, so it has no canonical path.
 		// r.URL.Path always begins with /
 		url := r.URL.Path
-		if d.IsDir() {
-			if url[len(url)-1] != '/' {
-				localRedirect(w, r, path.Base(url)+"/")
-				return
-			}
-		} else {
-			if url[len(url)-1] == '/' {
-				localRedirect(w, r, "../"+path.Base(url))
-				return
-			}
+		slash := url[len(url)-1] == '/'
+		switch {
+		case d.IsDir() && indexInfo == nil && h.noIndex != NoIndexListing:
+		case d.IsDir() && !slash && h.trailingSlash == TrailingSlashAdd:
+			h.localRedirect(w, r, path.Base(url)+"/", h.redirectStatus)
+			return
+		case d.IsDir() && slash && h.trailingSlash == TrailingSlashStrip && url != "/":
+			h.localRedirect(w, r, "../"+path.Base(url), h.redirectStatus)
+			return
+		case !d.IsDir() && slash && h.trailingSlash != TrailingSlashNone:
+			h.localRedirect(w, r, "../"+path.Base(url), h.redirectStatus)
+			return
 		}
 	}
 
-	// use contents of index.html for directory, if present
-	if d.IsDir() {
-		index := strings.TrimSuffix(name, "/") + indexPage
-		dd, err := fs.openFileInfo(index)
-		if err == nil {
-			d = dd
-		}
+	if d.IsDir() && h.dirDownload && r.URL.Query().Get("download") == "zip" {
+		h.serveDirZip(w, r, name)
+		return
+	}
+
+	if indexInfo != nil {
+		d = indexInfo
+		name = index
 	}
 
-	// Still a directory? (we didn't find an index.html file)
+	// Still a directory? (we didn't find an index document)
 	if d.IsDir() {
 		// Unlike the standard library implementation, directory
-		// listing is prohibited.
-		http.Error(w, "Forbidden", http.StatusForbidden)
+		// listing is prohibited unless enabled.
+		switch h.noIndex {
+		case NoIndexListing:
+			h.serveListing(w, r, name, d)
+		case NoIndexNotFound:
+			h.notFound(w, r)
+		default:
+			h.error(w, r, http.StatusForbidden, ErrIsDirectory)
+		}
+		return
+	}
+
+	// Decided from the size in the central directory,
+	// without reading the file.
+	if h.maxServeSize > 0 && d.Size() > h.maxServeSize {
+		h.error(w, r, http.StatusForbidden, errFileTooLarge)
 		return
 	}
 
 	// serveContent will check modification time and ETag
-	serveContent(w, r, fs, d)
+	h.serveContent(w, r, name, d)
 }
 
-// if name is empty, filename is unknown. (used for mime type, before sniffing)
-// if modtime.IsZero(), modtime is unknown.
-// content must be seeked to the beginning of the file.
-// The sizeFunc is called at most once. Its error, if any, is sent in the HTTP response.
-func serveContent(w http.ResponseWriter, r *http.Request, fs *FileSystem, fi *fileInfo) {
-	if checkLastModified(w, r, fi.ModTime()) {
+// checkAccess calls the access check, if there is one, for the file or
+// directory fi found at name. If access is refused, then checkAccess
+// responds to the request and returns false.
+func (h *fileHandler) checkAccess(w http.ResponseWriter, r *http.Request, name string, fi os.FileInfo) bool {
+	if h.accessCheck == nil {
+		return true
+	}
+	err := h.accessCheck(r, name, fi)
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, ErrUnauthorized):
+		h.error(w, r, http.StatusUnauthorized, err)
+	case errors.Is(err, os.ErrNotExist):
+		h.notFound(w, r)
+	default:
+		h.error(w, r, http.StatusForbidden, err)
+	}
+	return false
+}
+
+// originalRequestKey is the context key for the request
+// received by the handler, if it had to be modified.
+type originalRequestKey struct{}
+
+// notFound responds to a request for a file that does not exist. If there
+// is a single page application fallback for the request then it is served,
+// otherwise the request is passed to the not found handler if there is one,
+// and otherwise the response is 404 Not Found, with the custom not found
+// page if there is one. No headers have been set when this is called.
+func (h *fileHandler) notFound(w http.ResponseWriter, r *http.Request) {
+	if h.spaFallback != "" && (r.Method == "GET" || r.Method == "HEAD") && h.spaMatch(r) {
+		name := path.Clean("/" + h.spaFallback)
+		fi, err := h.fs.openFileInfo(name)
+		if err == nil && !fi.IsDir() && !h.isHidden(name) {
+			// The fallback is served for many paths, and the
+			// application can change, so it must be revalidated.
+			w.Header().Set("Cache-Control", "no-cache")
+			h.serveContent(w, r, name, fi)
+			return
+		}
+	}
+	if h.notFoundHandler != nil {
+		if orig, ok := r.Context().Value(originalRequestKey{}).(*http.Request); ok {
+			r = orig
+		}
+		h.notFoundHandler.ServeHTTP(w, r)
 		return
 	}
+	if h.notFoundPage != "" {
+		name := path.Clean("/" + h.notFoundPage)
+		fi, err := h.fs.openFileInfo(name)
+		if err == nil && !fi.IsDir() {
+			h.servePage(w, r, http.StatusNotFound, fi)
+			return
+		}
+	}
+	h.error(w, r, http.StatusNotFound, os.ErrNotExist)
+}
+
+// servePage serves the contents of the file fi as the body of a
+// response with the status code, such as an error page. Unlike
+// serveContent, the response does not include the validators or
+// cache headers of the file, because it is not the requested resource.
+func (h *fileHandler) servePage(w http.ResponseWriter, r *http.Request, code int, fi *fileInfo) {
+	zf := fi.zipFile
+	header := w.Header()
+	for _, key := range []string{"Etag", "Last-Modified", "Cache-Control", "Accept-Ranges"} {
+		delete(header, key)
+	}
+	header.Set("Content-Type", h.contentType(fi))
+
+	useDeflate := zf.Method == zip.Deflate && acceptsDeflate(r)
+	if zf.Method == zip.Deflate {
+		header.Add("Vary", "Accept-Encoding")
+	}
+	if useDeflate {
+		header.Set("Content-Encoding", "deflate")
+		header.Set("Content-Length", fi.compressedLength)
+	} else {
+		header.Del("Content-Encoding")
+		header.Set("Content-Length", fi.contentLength)
+	}
+	w.WriteHeader(code)
+
+	if useDeflate {
+		h.serveDeflate(w, r, fi)
+	} else {
+		h.serveIdentity(w, r, fi)
+	}
+}
+
+// hasNoExtension reports whether the last element of the
+// request path has no file name extension.
+func hasNoExtension(r *http.Request) bool {
+	return path.Ext(r.URL.Path) == ""
+}
+
+// findIndex returns the name and file info of the index document
+// for the directory dir, which is the first of the index names that
+// exists. It returns a nil file info if there is no index document.
+func (h *fileHandler) findIndex(dir string) (string, *fileInfo) {
+	for _, index := range h.indexNames {
+		name := strings.TrimSuffix(dir, "/") + "/" + index
+		if h.isHidden(name) || !h.isAllowed(name) {
+			continue
+		}
+		fi, err := h.fs.openFileInfo(name)
+		if err == nil && !fi.IsDir() {
+			return name, fi
+		}
+	}
+	return "", nil
+}
+
+// isIndexRequest reports whether the request path names the index
+// document that is served for its directory, and so should be
+// redirected to the directory.
+func (h *fileHandler) isIndexRequest(upath string) bool {
+	for _, index := range h.indexNames {
+		if strings.HasSuffix(upath, "/"+index) {
+			name, fi := h.findIndex(path.Dir(upath))
+			return fi == nil || path.Base(name) == index
+		}
+	}
+	return false
+}
+
+// serveContent serves the file fi, which was found at name.
+// All of the response headers are set before the modification time
+// and ETag are checked, and before any content is sent.
+func (h *fileHandler) serveContent(w http.ResponseWriter, r *http.Request, name string, fi *fileInfo) {
+	zf := fi.zipFile
+	timing := serverTimingFrom(r)
+	if timing != nil {
+		timing.lookupDone(w)
+	}
+	modtime := fi.ModTime()
+	etag := h.etag(name, fi)
+	if etag != "" {
+		w.Header().Set("Etag", etag)
+	}
+	if !isZeroTime(modtime) {
+		w.Header().Set("Last-Modified", modtime.UTC().Format(http.TimeFormat))
+	}
+	h.setCacheControl(w, name)
+	if zf.Method == zip.Deflate {
+		// The response depends on whether the client accepts deflate,
+		// including when the response is 304 Not Modified.
+		w.Header().Add("Vary", "Accept-Encoding")
+	}
+	setContentType(w, h.contentType(fi))
+	if lang := h.contentLanguage(name); lang != "" {
+		w.Header().Set("Content-Language", lang)
+	}
+	h.setContentDisposition(w, r, name)
+	hasHints := h.earlyHints != nil && h.setLinkHints(w, r, name)
+	h.setFileHeaders(w, path.Clean(r.URL.Path))
+
+	// The encoding depends on whether this is a range request, because
+	// ranges are always served from the uncompressed content.
+	ranges, rangeErr := effectiveRanges(checkIfRange(r, etag, modtime), fi.Size())
+	isRange := len(ranges) > 0 || rangeErr != nil
+	useDeflate := !isRange && zf.Method == zip.Deflate && acceptsDeflate(r)
+	if !isRange {
+		if useDeflate {
+			w.Header().Set("Content-Encoding", "deflate")
+			w.Header().Set("Content-Length", fi.compressedLength)
+		} else {
+			w.Header().Del("Content-Encoding")
+			w.Header().Set("Content-Length", fi.contentLength)
+		}
+	}
+	if useDeflate {
+		// Ranges of the deflated content are not supported.
+		w.Header().Del("Accept-Ranges")
+	} else {
+		w.Header().Set("Accept-Ranges", "bytes")
+	}
+	if len(h.digestAlgorithms) > 0 {
+		h.setDigests(w, r, fi, !isRange && !useDeflate)
+	}
 
-	// Set the Etag header in the response before calling checkETag.
-	// The checkETag function obtains the files ETag from the response header.
-	w.Header().Set("Etag", calcEtag(fi.zipFile))
-	rangeReq, done := checkETag(w, r, fi.ModTime())
-	if done {
+	if h.headerFunc != nil {
+		h.headerFunc(w.Header(), name, fi)
+	}
+	h.setNoSniff(w, fi)
+
+	if h.checkPreconditions(w, r, modtime) {
 		return
 	}
-	if rangeReq != "" {
-		// Range request requires seeking, so at this point create a temporary
-		// file and let the standard library serve it.
-		f := fi.openReader(r.URL.Path)
-		defer f.Close()
-		f.createTempFile()
-		http.ServeContent(w, r, fi.Name(), fi.ModTime(), f.file)
+	if rangeErr != nil {
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", fi.Size()))
+		h.error(w, r, http.StatusRequestedRangeNotSatisfiable, rangeErr)
 		return
 	}
+	if timing != nil {
+		defer timing.sendDone(w, time.Now())
+	}
+	if len(ranges) > 0 {
+		h.serveRange(w, r, fi, ranges)
+		return
+	}
+	if h.push != nil {
+		h.pushAssets(w, r, name)
+	}
+	if hasHints && r.Method == "GET" {
+		sendEarlyHints(w, r)
+	}
 
-	setContentType(w, fi.Name())
-
-	switch fi.zipFile.Method {
+	switch zf.Method {
 	case zip.Store:
-		serveIdentity(w, r, fi.zipFile)
+		h.serveIdentity(w, r, fi)
 	case zip.Deflate:
-		serveDeflate(w, r, fi.zipFile, fs.readerAt)
+		if useDeflate {
+			h.serveDeflate(w, r, fi)
+		} else {
+			h.serveIdentity(w, r, fi)
+		}
 	default:
-		http.Error(w, fmt.Sprintf("unsupported zip method: %d", fi.zipFile.Method), http.StatusInternalServerError)
+		h.error(w, r, http.StatusInternalServerError, fmt.Errorf("unsupported zip method: %d", zf.Method))
 	}
 }
 
-func serveIdentity(w http.ResponseWriter, r *http.Request, zf *zip.File) {
+// acceptsDeflate reports whether the client will accept
+// a response with the deflate content encoding.
+func acceptsDeflate(r *http.Request) bool {
+	// TODO: need to parse the accept header to work out if the
+	// client is explicitly forbidding deflate (ie deflate;q=0)
+	return strings.Contains(r.Header.Get("Accept-Encoding"), "deflate")
+}
+
+// uncompressedSize returns the uncompressed size of the file.
+func uncompressedSize(f *zip.File) int64 {
+	if f.UncompressedSize64 == 0 {
+		return int64(f.UncompressedSize)
+	}
+	return int64(f.UncompressedSize64)
+}
+
+// compressedSize returns the compressed size of the file.
+func compressedSize(f *zip.File) int64 {
+	if f.CompressedSize64 == 0 {
+		return int64(f.CompressedSize)
+	}
+	return int64(f.CompressedSize64)
+}
+
+// serveIdentity sends the uncompressed contents of the file. The
+// response headers must have already been set.
+func (h *fileHandler) serveIdentity(w http.ResponseWriter, r *http.Request, fi *fileInfo) {
+	zf := fi.zipFile
 	// TODO: need to check if the client explicitly refuses to accept
 	// identity encoding (Accept-Encoding: identity;q=0), but this is
 	// going to be very rare.
 
+	if r.Method == "HEAD" {
+		return
+	}
+	if fi.pinned != nil {
+		tw := h.bodyWriter(w, r)
+		if _, err := tw.Write(fi.pinned); err != nil {
+			h.logError(r, newBodyError(r, zf.Name, tw.written, tw.err, err))
+		}
+		return
+	}
+	// Sending through ReadFrom would bypass the periodic flushing.
+	if rf, ok := w.(io.ReaderFrom); ok && zf.Method == zip.Store && h.flushInterval == 0 {
+		if h.sendStored(rf, r, fi) {
+			return
+		}
+	}
+	// Compressed files are served from the content cache, if there is
+	// one. Stored files need no decompression.
+	if cache := fi.fs.contentCache; cache != nil && zf.Method != zip.Store && cache.cacheable(fi.Size()) {
+		data, err := cache.load(fi)
+		if err != nil {
+			h.error(w, r, http.StatusInternalServerError, err)
+			return
+		}
+		tw := h.bodyWriter(w, r)
+		if _, err := tw.Write(data); err != nil {
+			h.logError(r, newBodyError(r, zf.Name, tw.written, tw.err, err))
+		}
+		return
+	}
+
 	reader, err := zf.Open()
 	if err != nil {
-		internalServerError(w, r, err)
+		h.error(w, r, http.StatusInternalServerError, err)
 		return
 	}
 	defer reader.Close()
 
-	size := zf.FileInfo().Size()
-	w.Header().Del("Content-Encoding")
-	w.Header().Set("Content-Length", fmt.Sprintf("%d", size))
-	if r.Method != "HEAD" {
-		io.CopyN(w, reader, int64(size))
+	// Copy to the end of the reader, rather than just the size of the
+	// file, so that the reader verifies the checksum of the contents.
+	tw := h.bodyWriter(w, r)
+	_, err = io.Copy(tw, reader)
+	if err == nil && tw.written != uncompressedSize(zf) {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		h.logError(r, newBodyError(r, zf.Name, tw.written, tw.err, err))
 	}
 }
 
-func serveDeflate(w http.ResponseWriter, r *http.Request, f *zip.File, readerAt io.ReaderAt) {
-	acceptEncoding := r.Header.Get("Accept-Encoding")
+// sendStored sends the contents of a file stored without compression
+// by passing a reader of the ZIP file to rf. If the ZIP file is an
+// *os.File, net/http can then send the contents with the sendfile
+// system call, without copying them. The checksum of the contents is
+// not verified. It reports false if nothing was sent, in which case the
+// contents should be copied instead.
+func (h *fileHandler) sendStored(rf io.ReaderFrom, r *http.Request, fi *fileInfo) bool {
+	zf := fi.zipFile
+	offset, err := zf.DataOffset()
+	if err != nil {
+		return false
+	}
+	file, err := fi.fs.openAt(offset)
+	if err != nil {
+		return false
+	}
 
-	// TODO: need to parse the accept header to work out if the
-	// client is explicitly forbidding deflate (ie deflate;q=0)
-	acceptsDeflate := strings.Contains(acceptEncoding, "deflate")
-	if !acceptsDeflate {
-		// client will not accept deflate, so serve as identity
-		serveIdentity(w, r, f)
-		return
+	// net/http only uses sendfile for an *os.File,
+	// or an *io.LimitedReader of an *os.File.
+	size := uncompressedSize(zf)
+	n, err := rf.ReadFrom(&io.LimitedReader{R: file, N: size})
+	if err == nil && n != size {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		// It is not known whether reading or writing failed,
+		// but reading a file that is already open rarely fails.
+		h.logError(r, newBodyError(r, zf.Name, n, err, err))
+		file.Close()
+		return true
+	}
+	fi.fs.releaseAt(file)
+	return true
+}
+
+// trackingWriter records the number of bytes written to w, and the
+// first write error. If ctx is not nil, writes fail once it is done.
+// If flusher is not nil, it is flushed after a write once flushInterval
+// has passed since it was last flushed.
+type trackingWriter struct {
+	w       io.Writer
+	ctx     context.Context
+	written int64
+	err     error
+
+	flusher       http.Flusher
+	flushInterval time.Duration
+	lastFlush     time.Time
+}
+
+// bodyWriter returns a trackingWriter for sending the body of
+// the response to r, which flushes w periodically if the handler
+// has a flush interval and w supports flushing.
+func (h *fileHandler) bodyWriter(w http.ResponseWriter, r *http.Request) *trackingWriter {
+	tw := &trackingWriter{w: w, ctx: r.Context()}
+	if flusher, ok := w.(http.Flusher); ok && h.flushInterval > 0 {
+		tw.flusher = flusher
+		tw.flushInterval = h.flushInterval
+		tw.lastFlush = time.Now()
+	}
+	return tw
+}
+
+func (tw *trackingWriter) Write(p []byte) (int, error) {
+	if tw.ctx != nil {
+		if err := tw.ctx.Err(); err != nil {
+			if tw.err == nil {
+				tw.err = err
+			}
+			return 0, err
+		}
 	}
+	n, err := tw.w.Write(p)
+	tw.written += int64(n)
+	if err != nil && tw.err == nil {
+		tw.err = err
+	}
+	if err == nil && tw.flusher != nil && time.Since(tw.lastFlush) >= tw.flushInterval {
+		tw.flusher.Flush()
+		tw.lastFlush = time.Now()
+	}
+	return n, err
+}
+
+// BodyError is passed to the error log when the body of a response
+// could not be sent in full. The status and headers of the response
+// have already been sent, so the client receives a truncated body.
+type BodyError struct {
+	// Name is the name of the file in the ZIP file.
+	Name string
+
+	// Written is the number of bytes of the body that were sent.
+	Written int64
+
+	Err error
+
+	// Aborted is true if the response could not be written to the
+	// client, usually because the client has gone away. Otherwise
+	// the file could not be read, and is probably corrupt.
+	Aborted bool
+
+	// Canceled is true if sending stopped because the request's
+	// context was canceled, which happens when the client closes
+	// the connection. Aborted is false when Canceled is true.
+	Canceled bool
+}
 
-	contentLength := int64(f.CompressedSize64)
-	if contentLength == 0 {
-		contentLength = int64(f.CompressedSize)
+func (e *BodyError) Error() string {
+	if e.Canceled {
+		return fmt.Sprintf("zipfs: sending %s canceled after %d bytes: %v", e.Name, e.Written, e.Err)
 	}
-	w.Header().Set("Content-Encoding", "deflate")
-	w.Header().Set("Content-Length", fmt.Sprintf("%d", contentLength))
+	if e.Aborted {
+		return fmt.Sprintf("zipfs: sending %s aborted after %d bytes: %v", e.Name, e.Written, e.Err)
+	}
+	return fmt.Sprintf("zipfs: reading %s failed after %d bytes: %v", e.Name, e.Written, e.Err)
+}
+
+func (e *BodyError) Unwrap() error {
+	return e.Err
+}
+
+// newBodyError returns the error to log when sending the body of the
+// named file failed with err after written bytes. The error writeErr is
+// the error writing to the client, if there was one.
+func newBodyError(r *http.Request, name string, written int64, writeErr, err error) *BodyError {
+	e := &BodyError{Name: name, Written: written, Err: err}
+	switch {
+	case r.Context().Err() != nil:
+		e.Canceled = true
+	case writeErr != nil:
+		e.Aborted = true
+	}
+	return e
+}
+
+// logError passes err to the error log, if there is one.
+func (h *fileHandler) logError(r *http.Request, err error) {
+	if h.errorLog != nil {
+		h.errorLog(r, err)
+	}
+}
+
+// serveDeflate sends the compressed contents of the file, which must
+// use the deflate method. The response headers must have already been set.
+func (h *fileHandler) serveDeflate(w http.ResponseWriter, r *http.Request, fi *fileInfo) {
 	if r.Method == "HEAD" {
 		return
 	}
-
-	var written int64
-	remaining := contentLength
-	offset, err := f.DataOffset()
+	f := fi.zipFile
+	var section *io.SectionReader
+	var err error
+	if fi.pinnedRaw != nil {
+		section = io.NewSectionReader(bytes.NewReader(fi.pinnedRaw), 0, int64(len(fi.pinnedRaw)))
+	} else {
+		section, err = rawSection(fi.fs.readerAt, f)
+	}
 	if err != nil {
-		internalServerError(w, r, err)
+		h.error(w, r, http.StatusInternalServerError, err)
 		return
 	}
 
@@ -196,56 +839,118 @@ func serveDeflate(w http.ResponseWriter, r *http.Request, f *zip.File, readerAt
 	buf := bufPool.Get()
 	defer bufPool.Free(buf)
 
-	// loop to write the raw deflated content to the client
-	for remaining > 0 {
-		size := len(buf)
-		if int64(size) > remaining {
-			size = int(remaining)
-		}
-
-		// Note that we read into a different slice than was
-		// obtained from bufPool.Get. The reason for this is that
-		// we want to be able to give back the original slice
-		// so that it can be re-used.
-		b := buf[:size]
-		_, err := readerAt.ReadAt(b, offset)
-		if err != nil {
-			if written == 0 {
-				// have not written anything to the client yet, so we can send an error
-				internalServerError(w, r, err)
-			}
-			return
-		}
-		if _, err := w.Write(b); err != nil {
-			// Cannot write an error to the client because, er,  we just
-			// failed to write to the client.
+	// write the raw deflated content to the client
+	tw := h.bodyWriter(w, r)
+	_, err = io.CopyBuffer(tw, section, buf)
+	if err == nil && tw.written != section.Size() {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		if tw.written == 0 && tw.err == nil {
+			// have not written anything to the client yet, so we can send an error
+			h.error(w, r, http.StatusInternalServerError, err)
 			return
 		}
-		written += int64(size)
-		remaining -= int64(size)
-		offset += int64(size)
+		h.logError(r, newBodyError(r, f.Name, tw.written, tw.err, err))
 	}
 }
 
-func setContentType(w http.ResponseWriter, filename string) {
-	ctypes, haveType := w.Header()["Content-Type"]
-	var ctype string
-	if !haveType {
-		ctype = mime.TypeByExtension(filepath.Ext(path.Base(filename)))
-		if ctype == "" {
-			// the standard library sniffs content to decide whether it is
-			// binary or text, but this requires a ReaderSeeker, and we
-			// only have a reader from the zip file. Assume binary.
-			ctype = "application/octet-stream"
-		}
-	} else if len(ctypes) > 0 {
-		ctype = ctypes[0]
-	}
-	if ctype != "" {
+// setContentType sets the Content-Type header to ctype,
+// unless the header has already been set.
+func setContentType(w http.ResponseWriter, ctype string) {
+	if _, haveType := w.Header()["Content-Type"]; !haveType {
 		w.Header().Set("Content-Type", ctype)
 	}
 }
 
+// setNoSniff sets the X-Content-Type-Options header so that clients
+// do not sniff the type of the response, if WithNoSniff is used. The
+// header is left out if there is no content type, or if the content type
+// is the one assumed for the unknown type of the file fi, because then
+// the client must sniff the content to make use of it. fi is nil for
+// responses that are not the contents of a file.
+func (h *fileHandler) setNoSniff(w http.ResponseWriter, fi *fileInfo) {
+	if !h.noSniff {
+		return
+	}
+	ctype := w.Header().Get("Content-Type")
+	if ctype == "" || fi != nil && fi.unknownType && ctype == h.contentType(fi) {
+		return
+	}
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+}
+
+// contentType returns the content type of the file fi, with the
+// default charset added if it is a text type without a charset.
+func (h *fileHandler) contentType(fi *fileInfo) string {
+	if h.defaultCharset == "" {
+		return fi.contentType
+	}
+	if ctype, ok := h.charsetTypes.Load(fi.contentType); ok {
+		return ctype.(string)
+	}
+	ctype := fi.contentType
+	mediaType, params, err := mime.ParseMediaType(ctype)
+	if err == nil && params["charset"] == "" && isTextType(mediaType) && !h.noCharset[mediaType] {
+		ctype += "; charset=" + h.defaultCharset
+	}
+	h.charsetTypes.Store(fi.contentType, ctype)
+	return ctype
+}
+
+// isTextType reports whether the media type is text,
+// and so can have a charset parameter.
+func isTextType(mediaType string) bool {
+	switch mediaType {
+	case "application/json", "application/javascript", "application/x-javascript",
+		"application/ecmascript", "application/xml":
+		return true
+	}
+	return strings.HasPrefix(mediaType, "text/") ||
+		strings.HasSuffix(mediaType, "+json") ||
+		strings.HasSuffix(mediaType, "+xml")
+}
+
+// defaultContentTypes are the content types of extensions that the mime
+// package does not know on some systems, or has the wrong type for. They
+// are used instead of the mime package, so that the types do not depend
+// on the system.
+var defaultContentTypes = map[string]string{
+	".avif":        "image/avif",
+	".mjs":         "text/javascript; charset=utf-8",
+	".wasm":        "application/wasm",
+	".webmanifest": "application/manifest+json",
+}
+
+// contentTypeByName returns the content type for a file based on the
+// extension of its name. The types set by WithContentTypes take precedence
+// over the default types, which take precedence over the mime package.
+// It returns an empty string if the type is unknown.
+func (fs *FileSystem) contentTypeByName(filename string) string {
+	ext := filepath.Ext(path.Base(filename))
+	lower := strings.ToLower(ext)
+	if ctype, ok := fs.contentTypes[lower]; ok {
+		return ctype
+	}
+	if ctype, ok := defaultContentTypes[lower]; ok {
+		return ctype
+	}
+	return mime.TypeByExtension(ext)
+}
+
+// etag returns the ETag for the file fi found at name,
+// or an empty string if no ETag should be sent.
+func (h *fileHandler) etag(name string, fi *fileInfo) string {
+	etag := fi.etag
+	if h.etagFunc != nil {
+		etag = h.etagFunc(name, fi.zipFile)
+	}
+	if etag != "" && h.weakETags && !strings.HasPrefix(etag, "W/") {
+		etag = "W/" + etag
+	}
+	return etag
+}
+
 // calcEtag calculates and ETag value for a given zip file based on
 // the file's CRC and its length.
 func calcEtag(f *zip.File) string {
@@ -259,141 +964,410 @@ func calcEtag(f *zip.File) string {
 	return fmt.Sprintf(`"%x"`, etag)
 }
 
-// serveStandard extracts the file from the zip file to a temporary
-// location and serves it using the std library. This only happens
-// for more complicated requests, such as range requests.
-func serveStandard(w http.ResponseWriter, r *http.Request, f *zip.File) {
-	tempFile, err := createTempFile(f)
-	if err != nil {
-		internalServerError(w, r, err)
+// serveRange serves a range request. A file that is stored without
+// compression is read directly from the ZIP file. A small file is
+// decompressed into memory. A file with a seek index is decompressed
+// from the nearest checkpoint, and otherwise the file is extracted
+// from the zip file to a temporary location, which is kept for
+// subsequent requests until the file system is closed.
+//
+// The conditional request headers have already been evaluated by
+// the time this function is called, and ranges are the effective
+// ranges, of which there is at least one.
+func (h *fileHandler) serveRange(w http.ResponseWriter, r *http.Request, fi *fileInfo, ranges []httpRange) {
+	f := fi.zipFile
+	if r.Method == "HEAD" {
+		// The content is not needed.
+		h.serveRanges(w, r, f.Name, nil, uncompressedSize(f), ranges)
 		return
 	}
-	defer func() {
-		tempFile.Close()
-		os.Remove(tempFile.Name())
-	}()
 
-	http.ServeContent(w, r, f.Name, f.ModTime(), tempFile)
+	// The extraction is described by the Server-Timing header.
+	timing := serverTimingFrom(r)
+	start := time.Now()
+	extraction := ""
+
+	var content io.ReaderAt
+	switch {
+	case fi.pinned != nil:
+		content = bytes.NewReader(fi.pinned)
+	case f.Method == zip.Store:
+		section, err := rawSection(fi.fs.readerAt, f)
+		if err != nil {
+			h.error(w, r, http.StatusInternalServerError, err)
+			return
+		}
+		content = section
+	case !h.rangeLimitSet && fi.Size() <= fi.fs.memorySeekLimit:
+		data, err := fi.memoryContent()
+		if err != nil {
+			h.error(w, r, http.StatusInternalServerError, err)
+			return
+		}
+		content = bytes.NewReader(data)
+		extraction = "memory"
+	case uncompressedSize(f) <= h.rangeMemoryLimit:
+		data, err := readZipFile(f)
+		if err != nil {
+			h.error(w, r, http.StatusInternalServerError, err)
+			return
+		}
+		content = bytes.NewReader(data)
+		extraction = "memory"
+	default:
+		ir, err := fi.indexedReader()
+		if err != nil {
+			h.error(w, r, http.StatusInternalServerError, err)
+			return
+		}
+		if ir != nil {
+			content = ir
+			extraction = "index"
+			break
+		}
+		extraction = "cold"
+		if fi.hasTempFile() {
+			extraction = "cached"
+		}
+		tempFile, err := fi.openTempFile(r.Context())
+		if err != nil {
+			// There is no one to respond to if the request was canceled.
+			if r.Context().Err() == nil {
+				h.error(w, r, http.StatusInternalServerError, err)
+			}
+			return
+		}
+		defer fi.releaseTempFile(tempFile)
+		content = tempFile
+		if data := fi.mapTempFile(tempFile); data != nil {
+			defer munmap(data)
+			content = bytes.NewReader(data)
+		}
+	}
+	if timing != nil && extraction != "" {
+		timing.extractDone(w, start, extraction)
+	}
+
+	h.serveRanges(w, r, f.Name, content, uncompressedSize(f), ranges)
 }
 
-// TODO: not a good idea to leak error messages back to the user, but
-// possibly helpful at the moment. Could add a logger to the file Server
-// for logging errors.
-func internalServerError(w http.ResponseWriter, r *http.Request, err error) {
-	http.Error(w, err.Error(), http.StatusInternalServerError)
+// rawSection returns a reader for the contents of a file as they are
+// stored in the ZIP file. For a file stored without compression these
+// are the file's contents, so no extraction is necessary.
+func rawSection(readerAt io.ReaderAt, f *zip.File) (*io.SectionReader, error) {
+	offset, err := f.DataOffset()
+	if err != nil {
+		return nil, err
+	}
+	return io.NewSectionReader(readerAt, offset, compressedSize(f)), nil
+}
+
+// error sends a response with the error status code. The error err
+// describes the cause, and is passed to the error handler, if there
+// is one, but is not sent to the client.
+func (h *fileHandler) error(w http.ResponseWriter, r *http.Request, code int, err error) {
+	// The error response must not be cached or validated
+	// as if it were the file.
+	header := w.Header()
+	delete(header, "Cache-Control")
+	delete(header, "Etag")
+	delete(header, "Last-Modified")
+	delete(header, "Content-Encoding")
+	delete(header, "Content-Length")
+	delete(header, "Accept-Ranges")
+
+	if h.errorHandler != nil {
+		h.errorHandler(w, r, code, err)
+		return
+	}
+	switch code {
+	case http.StatusRequestedRangeNotSatisfiable, http.StatusPreconditionFailed:
+		// no body, as the response describes the file's size
+		// or the failed condition
+		delete(header, "Content-Type")
+		header.Set("Content-Length", "0")
+		w.WriteHeader(code)
+	case http.StatusForbidden:
+		http.Error(w, "Forbidden", code)
+	default:
+		http.Error(w, fmt.Sprintf("%d %s", code, errorText(code)), code)
+	}
+}
+
+// errorText returns the text used in the body of an error response.
+func errorText(code int) string {
+	if code == http.StatusNotFound {
+		return "page not found"
+	}
+	return http.StatusText(code)
 }
 
 var unixEpochTime = time.Unix(0, 0)
 
+// isZeroTime reports whether t is obviously unspecified (either zero or Unix()=0).
+func isZeroTime(t time.Time) bool {
+	return t.IsZero() || t.Equal(unixEpochTime)
+}
+
+// checkMethod responds to OPTIONS requests with the allowed methods,
+// and to requests with other methods that are not allowed with 405
+// Method Not Allowed. The return value is whether this request is now
+// complete.
+func (h *fileHandler) checkMethod(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method == "OPTIONS" {
+		w.Header().Set("Allow", h.allow)
+		w.WriteHeader(http.StatusNoContent)
+		return true
+	}
+	if !h.methods[r.Method] {
+		w.Header().Set("Allow", h.allow)
+		h.error(w, r, http.StatusMethodNotAllowed, errMethodNotAllowed)
+		return true
+	}
+	return false
+}
+
+// checkPreconditions evaluates the conditional request headers in the
+// order given by RFC 9110, section 13.2.2. The ETag and Last-Modified
+// headers, if any, must have been previously set in the ResponseWriter's
+// headers. The If-Range header is evaluated separately by checkIfRange.
+//
+// The return value is whether this request is now complete.
+func (h *fileHandler) checkPreconditions(w http.ResponseWriter, r *http.Request, modtime time.Time) (done bool) {
+	if r.Header.Get("If-Match") != "" {
+		if h.checkIfMatch(w, r) {
+			return true
+		}
+	} else if h.checkIfUnmodifiedSince(w, r, modtime) {
+		return true
+	}
+
+	// If-Modified-Since is ignored when If-None-Match is present.
+	if r.Header.Get("If-None-Match") != "" {
+		return h.checkIfNoneMatch(w, r)
+	}
+	return checkLastModified(w, r, modtime)
+}
+
 // modtime is the modification time of the resource to be served, or IsZero().
 // return value is whether this request is now complete.
 func checkLastModified(w http.ResponseWriter, r *http.Request, modtime time.Time) bool {
-	if modtime.IsZero() || modtime.Equal(unixEpochTime) {
+	if isZeroTime(modtime) {
 		// If the file doesn't have a modtime (IsZero), or the modtime
 		// is obviously garbage (Unix time == 0), then ignore modtimes
 		// and don't process the If-Modified-Since header.
 		return false
 	}
+	if r.Method != "GET" && r.Method != "HEAD" {
+		return false
+	}
 
-	// The Date-Modified header truncates sub-second precision, so
-	// use mtime < t+1s instead of mtime <= t to check for unmodified.
-	if t, err := time.Parse(http.TimeFormat, r.Header.Get("If-Modified-Since")); err == nil && modtime.Before(t.Add(1*time.Second)) {
-		h := w.Header()
-		delete(h, "Content-Type")
-		delete(h, "Content-Length")
-		w.WriteHeader(http.StatusNotModified)
+	// The Last-Modified header truncates sub-second precision, and ZIP
+	// file times have a granularity of two seconds, so compare times
+	// truncated to the second.
+	t, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err == nil && !modtime.Truncate(time.Second).After(t) {
+		writeNotModified(w)
 		return true
 	}
-	w.Header().Set("Last-Modified", modtime.UTC().Format(http.TimeFormat))
 	return false
 }
 
-// checkETag implements If-None-Match and If-Range checks.
-//
-// The ETag or modtime must have been previously set in the
-// ResponseWriter's headers.  The modtime is only compared at second
-// granularity and may be the zero value to mean unknown.
+// checkIfUnmodifiedSince implements the If-Unmodified-Since check.
+// If the file has been modified since the time in the header then
+// a 412 Precondition Failed response is sent. The return value is
+// whether this request is now complete.
+func (h *fileHandler) checkIfUnmodifiedSince(w http.ResponseWriter, r *http.Request, modtime time.Time) bool {
+	if isZeroTime(modtime) {
+		return false
+	}
+	t, err := http.ParseTime(r.Header.Get("If-Unmodified-Since"))
+	if err != nil {
+		return false
+	}
+	if modtime.Truncate(time.Second).After(t) {
+		h.error(w, r, http.StatusPreconditionFailed, errPreconditionFailed)
+		return true
+	}
+	return false
+}
+
+// writeNotModified sends a 304 Not Modified response. The validator
+// (ETag, Last-Modified) and caching (Cache-Control, Vary) headers
+// already set are retained, as required by RFC 9110, section 15.4.5.
+// Headers describing the content are removed, because there is none.
+func writeNotModified(w http.ResponseWriter) {
+	h := w.Header()
+	delete(h, "Content-Type")
+	delete(h, "Content-Length")
+	delete(h, "Content-Encoding")
+	w.WriteHeader(http.StatusNotModified)
+}
+
+// checkIfMatch implements the If-Match check. The ETag, if any, must
+// have been previously set in the ResponseWriter's headers.
+// If the header is present and no member strongly matches the ETag
+// then a 412 Precondition Failed response is sent. The "*" member
+// matches any file. The return value is whether this request is now
+// complete.
+func (h *fileHandler) checkIfMatch(w http.ResponseWriter, r *http.Request) bool {
+	im := headerList(r.Header, "If-Match")
+	if im == "" {
+		return false
+	}
+	etag := w.Header().Get("Etag")
+	for _, tag := range parseETagList(im) {
+		if tag == "*" || etagStrongMatch(tag, etag) {
+			return false
+		}
+	}
+	h.error(w, r, http.StatusPreconditionFailed, errPreconditionFailed)
+	return true
+}
+
+// checkIfNoneMatch implements the If-None-Match check. The ETag must
+// have been previously set in the ResponseWriter's headers.
+// A matching If-None-Match results in 304 Not Modified for GET and
+// HEAD requests, and 412 Precondition Failed for all other methods.
 //
-// The return value is the effective request "Range" header to use and
-// whether this request is now considered done.
-func checkETag(w http.ResponseWriter, r *http.Request, modtime time.Time) (rangeReq string, done bool) {
+// The return value is whether this request is now complete.
+func (h *fileHandler) checkIfNoneMatch(w http.ResponseWriter, r *http.Request) bool {
 	etag := w.Header().Get("Etag")
+	inm := headerList(r.Header, "If-None-Match")
+
+	// Must know ETag.
+	if etag == "" || inm == "" {
+		return false
+	}
+
+	for _, tag := range parseETagList(inm) {
+		if tag == "*" || etagWeakMatch(tag, etag) {
+			// RFC 9110, section 13.1.2: a matching If-None-Match
+			// means 304 for GET and HEAD, and 412 for other methods.
+			if r.Method == "GET" || r.Method == "HEAD" {
+				writeNotModified(w)
+			} else {
+				h.error(w, r, http.StatusPreconditionFailed, errPreconditionFailed)
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// checkIfRange implements the If-Range check. The modtime is only
+// compared at second granularity and may be the zero value to mean
+// unknown. If the etag is empty then the file has no ETag.
+//
+// The return value is the effective request "Range" header to use.
+func checkIfRange(r *http.Request, etag string, modtime time.Time) (rangeReq string) {
 	rangeReq = r.Header.Get("Range")
 
 	// Invalidate the range request if the entity doesn't match the one
 	// the client was expecting.
 	// "If-Range: version" means "ignore the Range: header unless version matches the
 	// current file."
-	// We only support ETag versions.
-	// The caller must have set the ETag on the response already.
-	if ir := r.Header.Get("If-Range"); ir != "" && ir != etag {
-		// The If-Range value is typically the ETag value, but it may also be
-		// the modtime date. See golang.org/issue/8367.
-		timeMatches := false
-		if !modtime.IsZero() {
-			if t, err := http.ParseTime(ir); err == nil && t.Unix() == modtime.Unix() {
-				timeMatches = true
-			}
-		}
-		if !timeMatches {
-			rangeReq = ""
-		}
+	// If-Range requires the strong comparison function, so a weak
+	// ETag never validates a range request.
+	ir := r.Header.Get("If-Range")
+	if ir == "" || (etag != "" && etagStrongMatch(ir, etag)) {
+		return rangeReq
+	}
+	if etag == "" {
+		// Without an ETag an If-Range precondition cannot be
+		// satisfied, in which case the range is ignored and the
+		// whole file is sent.
+		return ""
 	}
 
-	if inm := r.Header.Get("If-None-Match"); inm != "" {
-		// Must know ETag.
-		if etag == "" {
-			return rangeReq, false
-		}
-
-		// TODO(bradfitz): non-GET/HEAD requests require more work:
-		// sending a different status code on matches, and
-		// also can't use weak cache validators (those with a "W/
-		// prefix).  But most users of ServeContent will be using
-		// it on GET or HEAD, so only support those for now.
-		if r.Method != "GET" && r.Method != "HEAD" {
-			return rangeReq, false
-		}
-
-		// TODO(bradfitz): deal with comma-separated or multiple-valued
-		// list of If-None-match values.  For now just handle the common
-		// case of a single item.
-		if inm == etag || inm == "*" {
-			h := w.Header()
-			delete(h, "Content-Type")
-			delete(h, "Content-Length")
-			w.WriteHeader(http.StatusNotModified)
-			return "", true
+	// The If-Range value is typically the ETag value, but it may also be
+	// the modtime date. See golang.org/issue/8367.
+	if !isZeroTime(modtime) {
+		if t, err := http.ParseTime(ir); err == nil && t.Unix() == modtime.Unix() {
+			return rangeReq
 		}
 	}
-	return rangeReq, false
+	return ""
 }
 
-// toHTTPError returns a non-specific HTTP error message and status code
-// for a given non-nil error value. It's important that toHTTPError does not
-// actually return err.Error(), since msg and httpStatus are returned to users,
-// and historically Go's ServeContent always returned just "404 Not Found" for
-// all errors. We don't want to start leaking information in error messages.
-func toHTTPError(err error) (msg string, httpStatus int) {
+// toHTTPStatus returns the HTTP status code for a given non-nil error
+// value returned when opening a file.
+func toHTTPStatus(err error) int {
 	if pathErr, ok := err.(*os.PathError); ok {
 		err = pathErr.Err
 	}
 	if os.IsNotExist(err) {
-		return "404 page not found", http.StatusNotFound
+		return http.StatusNotFound
 	}
 	if os.IsPermission(err) {
-		return "403 Forbidden", http.StatusForbidden
+		return http.StatusForbidden
 	}
 	// Default:
-	return "500 Internal Server Error", http.StatusInternalServerError
+	return http.StatusInternalServerError
 }
 
-// localRedirect gives a Moved Permanently response.
-// It does not convert relative paths to absolute paths like Redirect does.
-func localRedirect(w http.ResponseWriter, r *http.Request, newPath string) {
+// localRedirect gives a redirect response with the status code.
+// It does not convert relative paths to absolute paths like Redirect does,
+// unless the handler is mounted, in which case see location.
+// The query string of the request is preserved, so that parameters are
+// not lost when the path is canonicalized.
+func (h *fileHandler) localRedirect(w http.ResponseWriter, r *http.Request, newPath string, code int) {
 	if q := r.URL.RawQuery; q != "" {
 		newPath += "?" + q
 	}
-	w.Header().Set("Location", newPath)
-	w.WriteHeader(http.StatusMovedPermanently)
+	w.Header().Set("Location", h.location(r, newPath))
+	w.WriteHeader(code)
+}
+
+// externalPrefix returns the prefix of the path requested by the client
+// that was removed before the handler saw it, without a trailing slash.
+// It consists of the forwarded prefix, if the option is set, followed by
+// the mount prefix.
+func (h *fileHandler) externalPrefix(r *http.Request) string {
+	if !h.forwardedPrefix {
+		return h.mountPrefix
+	}
+	return forwardedPrefix(r) + h.mountPrefix
+}
+
+// forwardedPrefix returns the prefix in the X-Forwarded-Prefix header
+// without a trailing slash, or "" if there is none or it is not safe to
+// redirect to. Only the first of a list of prefixes is used.
+func forwardedPrefix(r *http.Request) string {
+	prefix, _, _ := strings.Cut(r.Header.Get("X-Forwarded-Prefix"), ",")
+	prefix = strings.TrimSpace(prefix)
+	// A prefix starting with "//" would redirect to another host.
+	if !strings.HasPrefix(prefix, "/") || strings.HasPrefix(prefix, "//") {
+		return ""
+	}
+	for _, c := range prefix {
+		if c < 0x20 || c == 0x7f || c == '\\' || c == '?' || c == '#' {
+			return ""
+		}
+	}
+	for _, seg := range strings.Split(prefix, "/") {
+		if seg == ".." {
+			return ""
+		}
+	}
+	return strings.TrimSuffix(prefix, "/")
+}
+
+// location returns the Location header for a redirect to newPath, which
+// is relative to the path of the request as seen by the handler. If the
+// path requested by the client has a prefix that the handler does not
+// see, the location is made absolute, including the prefix. Locations of
+// other hosts are returned unchanged.
+func (h *fileHandler) location(r *http.Request, newPath string) string {
+	prefix := h.externalPrefix(r)
+	if prefix == "" || strings.Contains(newPath, "://") || strings.HasPrefix(newPath, "//") {
+		return newPath
+	}
+	p, query, hasQuery := strings.Cut(newPath, "?")
+	base := &url.URL{Path: r.URL.Path}
+	loc := prefix + base.ResolveReference(&url.URL{Path: p}).Path
+	if hasQuery {
+		loc += "?" + query
+	}
+	return loc
 }
@@ -1,11 +1,26 @@
 package zipfs
 
 import (
+	"archive/zip"
 	"bytes"
+	"compress/flate"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
+	"os"
+	"path"
+	"strconv"
 	"strings"
+	"sync/atomic"
+	"syscall"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -36,6 +51,32 @@ func (w *TestResponseWriter) WriteHeader(status int) {
 	w.status = status
 }
 
+// serveTestRequest sends a request to handler and returns the response.
+// Each header is formatted as "Key: value".
+func serveTestRequest(handler http.Handler, method, path string, headers ...string) *TestResponseWriter {
+	path, query, _ := strings.Cut(path, "?")
+	req := &http.Request{
+		URL: &url.URL{
+			Scheme:   "http",
+			Host:     "test-server.com",
+			Path:     path,
+			RawQuery: query,
+		},
+		Header: make(http.Header),
+		Method: method,
+	}
+	for _, header := range headers {
+		arr := strings.SplitN(header, ":", 2)
+		key := strings.TrimSpace(arr[0])
+		value := strings.TrimSpace(arr[1])
+		req.Header.Add(key, value)
+	}
+
+	w := NewTestResponseWriter()
+	handler.ServeHTTP(w, req)
+	return w
+}
+
 func TestNew(t *testing.T) {
 	assert := assert.New(t)
 	testCases := []struct {
@@ -44,7 +85,7 @@ func TestNew(t *testing.T) {
 	}{
 		{
 			Name:  "testdata/does-not-exist.zip",
-			Error: "The system cannot find the file specified",
+			Error: "does-not-exist.zip",
 		},
 		{
 			Name:  "testdata/testdata.zip",
@@ -92,6 +133,7 @@ func TestServeHTTP(t *testing.T) {
 		ETag            string
 		Size            int
 		Location        string
+		Vary            string
 	}{
 		{
 			Path:   "/img/circle.png",
@@ -203,6 +245,20 @@ func TestServeHTTP(t *testing.T) {
 			Size:            0,
 			ETag:            `"27106c15f45b"`,
 		},
+		{
+			Path:   "/img/circle.png",
+			Status: 304,
+			Headers: []string{
+				`If-None-Match: "1755529fb2ff"`,
+				"Accept-Encoding: deflate, gzip",
+			},
+			ContentType:     "",
+			ContentLength:   "",
+			ContentEncoding: "",
+			Size:            0,
+			ETag:            `"1755529fb2ff"`,
+			Vary:            "Accept-Encoding",
+		},
 		{
 			Path:          "random.dat",
 			Status:        200,
@@ -219,10 +275,11 @@ func TestServeHTTP(t *testing.T) {
 			Location: "./",
 		},
 		{
-			Path:     "/empty",
-			Status:   301,
-			Headers:  []string{},
-			Location: "empty/",
+			// no redirect, because there is no index document
+			Path:        "/empty",
+			Status:      403,
+			ContentType: "text/plain; charset=utf-8",
+			Headers:     []string{},
 		},
 		{
 			Path:     "/img/circle.png/",
@@ -278,5 +335,2360 @@ func TestServeHTTP(t *testing.T) {
 		if tc.Location != "" {
 			assert.Equal(tc.Location, w.Header().Get("Location"), tc.Path)
 		}
+		if tc.Vary != "" {
+			assert.Equal(tc.Vary, w.Header().Get("Vary"), tc.Path)
+		}
+		if tc.Status == 304 {
+			// validators must be included in the not modified response
+			assert.NotEmpty(w.Header().Get("Etag"), tc.Path)
+			assert.NotEmpty(w.Header().Get("Last-Modified"), tc.Path)
+			assert.Empty(w.Header().Get("Content-Length"), tc.Path)
+			assert.Equal(0, w.buf.Len(), tc.Path)
+		}
+	}
+}
+
+func TestETagFunc(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	fs, err := New("testdata/testdata.zip")
+	require.NoError(err)
+	defer fs.Close()
+
+	var names []string
+	constant := FileServer(fs, WithETagFunc(func(name string, f *zip.File) string {
+		names = append(names, name)
+		return `"constant"`
+	}))
+	disabled := FileServer(fs, WithETagFunc(func(name string, f *zip.File) string {
+		return ""
+	}))
+
+	testCases := []struct {
+		Handler http.Handler
+		Path    string
+		Headers []string
+		Status  int
+		ETag    string
+		Size    int
+	}{
+		{
+			Handler: constant,
+			Path:    "/random.dat",
+			Status:  200,
+			ETag:    `"constant"`,
+			Size:    10000,
+		},
+		{
+			Handler: constant,
+			Path:    "/random.dat",
+			Headers: []string{`If-None-Match: "constant"`},
+			Status:  304,
+			ETag:    `"constant"`,
+		},
+		{
+			Handler: constant,
+			Path:    "/random.dat",
+			Headers: []string{`If-None-Match: "27106c15f45b"`},
+			Status:  200,
+			ETag:    `"constant"`,
+			Size:    10000,
+		},
+		{
+			Handler: constant,
+			Path:    "/random.dat",
+			Headers: []string{`If-Range: "constant"`, "Range: bytes=0-499"},
+			Status:  206,
+			ETag:    `"constant"`,
+			Size:    500,
+		},
+		{
+			Handler: disabled,
+			Path:    "/random.dat",
+			Status:  200,
+			Size:    10000,
+		},
+		{
+			Handler: disabled,
+			Path:    "/random.dat",
+			Headers: []string{`If-None-Match: *`},
+			Status:  200,
+			Size:    10000,
+		},
+		{
+			Handler: disabled,
+			Path:    "/random.dat",
+			Headers: []string{`If-Range: "27106c15f45b"`, "Range: bytes=0-499"},
+			Status:  200,
+			Size:    10000,
+		},
+		{
+			Handler: disabled,
+			Path:    "/random.dat",
+			Headers: []string{"Range: bytes=0-499"},
+			Status:  206,
+			Size:    500,
+		},
+	}
+
+	for _, tc := range testCases {
+		w := serveTestRequest(tc.Handler, "GET", tc.Path, tc.Headers...)
+		assert.Equal(tc.Status, w.status, tc.Headers)
+		assert.Equal(tc.ETag, w.Header().Get("Etag"), tc.Headers)
+		assert.Equal(tc.Size, w.buf.Len(), tc.Headers)
+	}
+
+	w := serveTestRequest(constant, "GET", "/")
+	assert.Equal(200, w.status)
+	assert.Contains(names, "/random.dat")
+	assert.Contains(names, "/index.html")
+}
+
+func TestWeakETags(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	fs, err := New("testdata/testdata.zip")
+	require.NoError(err)
+	defer fs.Close()
+
+	strong := FileServer(fs)
+	weak := FileServer(fs, WithWeakETags())
+
+	testCases := []struct {
+		Handler http.Handler
+		Headers []string
+		Status  int
+		ETag    string
+		Size    int
+	}{
+		{
+			Handler: weak,
+			Status:  200,
+			ETag:    `W/"27106c15f45b"`,
+			Size:    10000,
+		},
+		{
+			Handler: weak,
+			Headers: []string{`If-None-Match: W/"27106c15f45b"`},
+			Status:  304,
+			ETag:    `W/"27106c15f45b"`,
+		},
+		{
+			Handler: weak,
+			Headers: []string{`If-None-Match: "27106c15f45b"`},
+			Status:  304,
+			ETag:    `W/"27106c15f45b"`,
+		},
+		{
+			Handler: weak,
+			Headers: []string{`If-Range: W/"27106c15f45b"`, "Range: bytes=0-499"},
+			Status:  200,
+			ETag:    `W/"27106c15f45b"`,
+			Size:    10000,
+		},
+		{
+			Handler: weak,
+			Headers: []string{`If-Range: "27106c15f45b"`, "Range: bytes=0-499"},
+			Status:  200,
+			ETag:    `W/"27106c15f45b"`,
+			Size:    10000,
+		},
+		{
+			Handler: weak,
+			Headers: []string{`If-None-Match: "xyzzy", W/"27106c15f45b"`},
+			Status:  304,
+			ETag:    `W/"27106c15f45b"`,
+		},
+		{
+			Handler: strong,
+			Headers: []string{`If-None-Match: "xyzzy", bad, "27106c15f45b"`},
+			Status:  304,
+			ETag:    `"27106c15f45b"`,
+		},
+		{
+			Handler: strong,
+			Headers: []string{`If-None-Match: "xyzzy"`, `If-None-Match: "27106c15f45b"`},
+			Status:  304,
+			ETag:    `"27106c15f45b"`,
+		},
+		{
+			Handler: strong,
+			Headers: []string{`If-None-Match: "xyzzy", "r2d2xxxx"`},
+			Status:  200,
+			ETag:    `"27106c15f45b"`,
+			Size:    10000,
+		},
+		{
+			Handler: strong,
+			Headers: []string{`If-None-Match: W/"27106c15f45b"`},
+			Status:  304,
+			ETag:    `"27106c15f45b"`,
+		},
+		{
+			Handler: strong,
+			Headers: []string{`If-Range: W/"27106c15f45b"`, "Range: bytes=0-499"},
+			Status:  200,
+			ETag:    `"27106c15f45b"`,
+			Size:    10000,
+		},
+		{
+			Handler: strong,
+			Headers: []string{`If-Range: "27106c15f45b"`, "Range: bytes=0-499"},
+			Status:  206,
+			ETag:    `"27106c15f45b"`,
+			Size:    500,
+		},
+	}
+
+	for _, tc := range testCases {
+		w := serveTestRequest(tc.Handler, "GET", "/random.dat", tc.Headers...)
+		assert.Equal(tc.Status, w.status, tc.Headers)
+		assert.Equal(tc.ETag, w.Header().Get("Etag"), tc.Headers)
+		assert.Equal(tc.Size, w.buf.Len(), tc.Headers)
+	}
+}
+
+func TestIfNoneMatchMethods(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	fs, err := New("testdata/testdata.zip")
+	require.NoError(err)
+	defer fs.Close()
+	handler := FileServer(fs, WithAllowedMethods("GET", "HEAD", "POST", "PUT"))
+
+	testCases := []struct {
+		Method  string
+		Headers []string
+		Status  int
+		Size    int
+	}{
+		{
+			Method:  "GET",
+			Headers: []string{`If-None-Match: "27106c15f45b"`},
+			Status:  304,
+		},
+		{
+			Method:  "HEAD",
+			Headers: []string{`If-None-Match: "27106c15f45b"`},
+			Status:  304,
+		},
+		{
+			Method:  "POST",
+			Headers: []string{`If-None-Match: "27106c15f45b"`},
+			Status:  412,
+		},
+		{
+			Method:  "PUT",
+			Headers: []string{`If-None-Match: *`},
+			Status:  412,
+		},
+		{
+			Method:  "POST",
+			Headers: []string{`If-None-Match: W/"27106c15f45b"`},
+			Status:  412,
+		},
+		{
+			Method:  "POST",
+			Headers: []string{`If-None-Match: "xyzzy"`},
+			Status:  200,
+			Size:    10000,
+		},
+	}
+
+	for _, tc := range testCases {
+		w := serveTestRequest(handler, tc.Method, "/random.dat", tc.Headers...)
+		assert.Equal(tc.Status, w.status, tc.Method, tc.Headers)
+		assert.Equal(tc.Size, w.buf.Len(), tc.Method, tc.Headers)
+	}
+}
+
+func TestMethods(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	fs, err := New("testdata/testdata.zip")
+	require.NoError(err)
+	defer fs.Close()
+
+	testCases := []struct {
+		Options []HandlerOption
+		Method  string
+		Path    string
+		Headers []string
+		Status  int
+		Allow   string
+	}{
+		{Method: "POST", Path: "/random.dat", Status: 405, Allow: "GET, HEAD, OPTIONS"},
+		{Method: "PUT", Path: "/random.dat", Status: 405, Allow: "GET, HEAD, OPTIONS"},
+		{Method: "DELETE", Path: "/random.dat", Status: 405, Allow: "GET, HEAD, OPTIONS"},
+		{Method: "DELETE", Path: "/img/", Status: 405, Allow: "GET, HEAD, OPTIONS"},
+		{Method: "OPTIONS", Path: "/random.dat", Status: 204, Allow: "GET, HEAD, OPTIONS"},
+		{Method: "OPTIONS", Path: "/", Status: 204, Allow: "GET, HEAD, OPTIONS"},
+		{Method: "POST", Path: "/missing", Status: 404},
+		{Method: "OPTIONS", Path: "/missing", Status: 404},
+		{
+			// preconditions are not evaluated for methods that are not allowed
+			Method:  "POST",
+			Path:    "/random.dat",
+			Headers: []string{`If-None-Match: "27106c15f45b"`},
+			Status:  405,
+			Allow:   "GET, HEAD, OPTIONS",
+		},
+		{
+			Options: []HandlerOption{WithAllowedMethods("GET", "HEAD", "POST")},
+			Method:  "POST",
+			Path:    "/random.dat",
+			Status:  200,
+		},
+		{
+			Options: []HandlerOption{WithAllowedMethods("GET", "HEAD", "POST")},
+			Method:  "PUT",
+			Path:    "/random.dat",
+			Status:  405,
+			Allow:   "GET, HEAD, POST, OPTIONS",
+		},
+		{
+			Options: []HandlerOption{WithAllowedMethods("GET", "HEAD", "POST")},
+			Method:  "OPTIONS",
+			Path:    "/random.dat",
+			Status:  204,
+			Allow:   "GET, HEAD, POST, OPTIONS",
+		},
+	}
+	for _, tc := range testCases {
+		handler := FileServer(fs, tc.Options...)
+		w := serveTestRequest(handler, tc.Method, tc.Path, tc.Headers...)
+		assert.Equal(tc.Status, w.status, tc.Method, tc.Path)
+		assert.Equal(tc.Allow, w.Header().Get("Allow"), tc.Method, tc.Path)
+		if tc.Status != 200 {
+			assert.Empty(w.Header().Get("Etag"), tc.Method, tc.Path)
+		}
+		if tc.Status == 204 {
+			assert.Equal(0, w.buf.Len(), tc.Method, tc.Path)
+		}
+	}
+}
+
+// countingReaderAt counts the calls to ReadAt.
+type countingReaderAt struct {
+	r     io.ReaderAt
+	count int64
+}
+
+func (c *countingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	atomic.AddInt64(&c.count, 1)
+	return c.r.ReadAt(p, off)
+}
+
+func TestHeadDoesNotRead(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	file, err := os.Open("testdata/testdata.zip")
+	require.NoError(err)
+	stat, err := file.Stat()
+	require.NoError(err)
+	readerAt := &countingReaderAt{r: file}
+	fs, err := newFileSystem(readerAt, stat.Size(), file)
+	require.NoError(err)
+	defer fs.Close()
+	handler := FileServer(fs)
+
+	testCases := []struct {
+		Path    string
+		Headers []string
+		Status  int
+	}{
+		{Path: "/random.dat", Status: 200},
+		{Path: "/img/circle.png", Status: 200},
+		{Path: "/img/circle.png", Headers: []string{"Accept-Encoding: deflate"}, Status: 200},
+		{Path: "/img/circle.png", Headers: []string{"Range: bytes=100-199"}, Status: 206},
+		{Path: "/random.dat", Headers: []string{"Range: bytes=0-9,100-199"}, Status: 206},
+	}
+	count := atomic.LoadInt64(&tempFileCount)
+	for _, tc := range testCases {
+		atomic.StoreInt64(&readerAt.count, 0)
+		w := serveTestRequest(handler, "HEAD", tc.Path, tc.Headers...)
+		assert.Equal(tc.Status, w.status, tc.Path, tc.Headers)
+		assert.NotEmpty(w.Header().Get("Content-Length"), tc.Path, tc.Headers)
+		assert.Equal(int64(0), atomic.LoadInt64(&readerAt.count), tc.Path, tc.Headers)
+	}
+	assert.Equal(count, atomic.LoadInt64(&tempFileCount))
+
+	w := serveTestRequest(handler, "GET", "/random.dat")
+	assert.Equal(200, w.status)
+	assert.NotZero(atomic.LoadInt64(&readerAt.count))
+}
+
+func TestMaxServeSize(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	file, err := os.Open("testdata/testdata.zip")
+	require.NoError(err)
+	stat, err := file.Stat()
+	require.NoError(err)
+	readerAt := &countingReaderAt{r: file}
+	fs, err := newFileSystem(readerAt, stat.Size(), file)
+	require.NoError(err)
+	defer fs.Close()
+	handler := FileServer(fs, WithMaxServeSize(5000))
+
+	testCases := []struct {
+		Method  string
+		Path    string
+		Headers []string
+		Status  int
+	}{
+		{"GET", "/random.dat", nil, 403},
+		{"HEAD", "/random.dat", nil, 403},
+		{"GET", "/random.dat", []string{"Range: bytes=0-9"}, 403},
+		{"GET", "/random.dat", []string{"Accept-Encoding: deflate"}, 403},
+		{"GET", "/test.html", nil, 200},
+		{"GET", "/", nil, 200},
+	}
+	for _, tc := range testCases {
+		atomic.StoreInt64(&readerAt.count, 0)
+		w := serveTestRequest(handler, tc.Method, tc.Path, tc.Headers...)
+		assert.Equal(tc.Status, w.status, tc.Method, tc.Path, tc.Headers)
+		if tc.Status == 403 {
+			assert.Zero(atomic.LoadInt64(&readerAt.count), tc.Method, tc.Path, tc.Headers)
+			assert.Empty(w.Header().Get("Content-Range"))
+		}
+	}
+
+	// the response can be changed by the error handler
+	handler = FileServer(fs, WithMaxServeSize(5000), WithErrorHandler(func(w http.ResponseWriter, r *http.Request, code int, err error) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	assert.Equal(404, serveTestRequest(handler, "GET", "/random.dat").status)
+}
+
+// failingResponseWriter fails writes once limit bytes have been written.
+type failingResponseWriter struct {
+	*TestResponseWriter
+	limit int
+}
+
+func (w *failingResponseWriter) Write(b []byte) (int, error) {
+	if w.buf.Len()+len(b) > w.limit {
+		n, _ := w.buf.Write(b[:w.limit-w.buf.Len()])
+		return n, syscall.EPIPE
+	}
+	return w.buf.Write(b)
+}
+
+func TestBodyErrors(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	data := make([]byte, 100000)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, name := range []string{"video.dat", "video.bin"} {
+		method := zip.Deflate
+		if name == "video.dat" {
+			method = zip.Store
+		}
+		fw, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: method})
+		require.NoError(err)
+		_, err = fw.Write(data)
+		require.NoError(err)
+	}
+	require.NoError(zw.Close())
+	zipData := buf.Bytes()
+
+	var errs []error
+	newHandler := func(zipData []byte) http.Handler {
+		fs, err := newFileSystem(bytes.NewReader(zipData), int64(len(zipData)), nil)
+		require.NoError(err)
+		return FileServer(fs, WithErrorLog(func(r *http.Request, err error) {
+			errs = append(errs, err)
+		}))
+	}
+
+	// a client that goes away
+	handler := newHandler(zipData)
+	for _, path := range []string{"/video.dat", "/video.bin"} {
+		errs = nil
+		w := &failingResponseWriter{TestResponseWriter: NewTestResponseWriter(), limit: 50000}
+		handler.ServeHTTP(w, &http.Request{Method: "GET", URL: &url.URL{Path: path}, Header: make(http.Header)})
+		require.Len(errs, 1, path)
+		var bodyErr *BodyError
+		require.ErrorAs(errs[0], &bodyErr)
+		assert.True(bodyErr.Aborted, path)
+		assert.Equal(int64(50000), bodyErr.Written, path)
+		assert.Equal(path[1:], bodyErr.Name)
+		assert.ErrorIs(errs[0], syscall.EPIPE, path)
+	}
+
+	// corrupt contents are detected by the checksum
+	corrupt := append([]byte(nil), zipData...)
+	i := bytes.Index(corrupt, data[60000:60100])
+	require.True(i > 0)
+	corrupt[i] ^= 0xff
+	handler = newHandler(corrupt)
+	errs = nil
+	w := serveTestRequest(handler, "GET", "/video.dat")
+	assert.Equal(200, w.status)
+	require.Len(errs, 1)
+	var bodyErr *BodyError
+	require.ErrorAs(errs[0], &bodyErr)
+	assert.False(bodyErr.Aborted)
+	assert.Equal(int64(len(data)), bodyErr.Written)
+	assert.ErrorIs(errs[0], zip.ErrChecksum)
+
+	// no errors for a successful response
+	handler = newHandler(zipData)
+	errs = nil
+	w = serveTestRequest(handler, "GET", "/video.bin")
+	assert.Equal(data, w.buf.Bytes())
+	assert.Empty(errs)
+}
+
+// slowResponseWriter takes a while to write, and calls cancel
+// once limit writes have been made.
+type slowResponseWriter struct {
+	*TestResponseWriter
+	writes int
+	limit  int
+	cancel func()
+}
+
+func (w *slowResponseWriter) Write(b []byte) (int, error) {
+	time.Sleep(time.Millisecond)
+	w.writes++
+	if w.writes == w.limit {
+		w.cancel()
+	}
+	return w.buf.Write(b)
+}
+
+func TestBodyCanceled(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	// random data does not compress, so the deflated file is large too
+	data := make([]byte, 1<<20)
+	rand.New(rand.NewSource(1)).Read(data)
+	fs := newTestFileSystem(t, map[string]string{"video.bin": string(data)})
+	var errs []error
+	handler := FileServer(fs, WithErrorLog(func(r *http.Request, err error) {
+		errs = append(errs, err)
+	}))
+
+	for _, encoding := range []string{"identity", "deflate"} {
+		errs = nil
+		ctx, cancel := context.WithCancel(context.Background())
+		w := &slowResponseWriter{TestResponseWriter: NewTestResponseWriter(), limit: 2, cancel: cancel}
+		req := &http.Request{
+			Method: "GET",
+			URL:    &url.URL{Path: "/video.bin"},
+			Header: http.Header{"Accept-Encoding": {encoding}},
+		}
+		handler.ServeHTTP(w, req.WithContext(ctx))
+		assert.Equal(2, w.writes, encoding)
+		require.Len(errs, 1, encoding)
+		var bodyErr *BodyError
+		require.ErrorAs(errs[0], &bodyErr)
+		assert.True(bodyErr.Canceled, encoding)
+		assert.False(bodyErr.Aborted, encoding)
+		assert.Equal(int64(w.buf.Len()), bodyErr.Written, encoding)
+		assert.ErrorIs(errs[0], context.Canceled, encoding)
+	}
+}
+
+func TestRangeBodyErrors(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	data := make([]byte, 100000)
+	rand.New(rand.NewSource(1)).Read(data)
+	fs := newTestFileSystem(t, map[string]string{"video.dat": string(data)})
+	var errs []error
+	handler := FileServer(fs, WithArchiveDownload("/site.zip"), WithErrorLog(func(r *http.Request, err error) {
+		errs = append(errs, err)
+	}))
+
+	// a client that goes away
+	testCases := []struct {
+		Path  string
+		Range string
+		Name  string
+	}{
+		{Path: "/video.dat", Range: "bytes=0-99999", Name: "video.dat"},
+		{Path: "/video.dat", Range: "bytes=0-29999,40000-99999", Name: "video.dat"},
+		{Path: "/site.zip", Range: "bytes=0-99999", Name: "/site.zip"},
+	}
+	for _, tc := range testCases {
+		errs = nil
+		w := &failingResponseWriter{TestResponseWriter: NewTestResponseWriter(), limit: 50000}
+		handler.ServeHTTP(w, &http.Request{
+			Method: "GET",
+			URL:    &url.URL{Path: tc.Path},
+			Header: http.Header{"Range": {tc.Range}},
+		})
+		assert.Equal(206, w.status, tc.Range)
+		require.Len(errs, 1, tc.Range)
+		var bodyErr *BodyError
+		require.ErrorAs(errs[0], &bodyErr)
+		assert.True(bodyErr.Aborted, tc.Range)
+		assert.Equal(int64(50000), bodyErr.Written, tc.Range)
+		assert.Equal(tc.Name, bodyErr.Name, tc.Range)
+		assert.ErrorIs(errs[0], syscall.EPIPE, tc.Range)
+	}
+
+	// sending stops when the request is canceled
+	errs = nil
+	ctx, cancel := context.WithCancel(context.Background())
+	w := &slowResponseWriter{TestResponseWriter: NewTestResponseWriter(), limit: 2, cancel: cancel}
+	req := &http.Request{
+		Method: "GET",
+		URL:    &url.URL{Path: "/video.dat"},
+		Header: http.Header{"Range": {"bytes=0-9999,20000-29999,40000-49999,60000-69999"}},
+	}
+	handler.ServeHTTP(w, req.WithContext(ctx))
+	assert.Equal(2, w.writes)
+	require.Len(errs, 1)
+	var bodyErr *BodyError
+	require.ErrorAs(errs[0], &bodyErr)
+	assert.True(bodyErr.Canceled)
+	assert.ErrorIs(errs[0], context.Canceled)
+
+	// no errors for a successful response
+	errs = nil
+	rw := serveTestRequest(handler, "GET", "/video.dat", "Range: bytes=0-29999,40000-99999")
+	assert.Equal(206, rw.status)
+	assert.Empty(errs)
+}
+
+func TestSendStored(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	fs, err := New("testdata/testdata.zip")
+	require.NoError(err)
+	defer fs.Close()
+	handler := FileServer(fs)
+	expected, err := os.ReadFile("testdata/random.dat")
+	require.NoError(err)
+	copied := serveTestRequest(handler, "GET", "/random.dat")
+	require.Equal(expected, copied.buf.Bytes())
+
+	// net/http's ResponseWriter implements io.ReaderFrom
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	resp, err := http.Get(server.URL + "/random.dat")
+	require.NoError(err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(err)
+	assert.Equal(200, resp.StatusCode)
+	assert.Equal(expected, body)
+	for _, key := range []string{"Content-Length", "Content-Type", "Etag"} {
+		assert.Equal(copied.Header().Get(key), resp.Header.Get(key), key)
 	}
+
+	w := &readFromTestResponseWriter{TestResponseWriter: NewTestResponseWriter()}
+	handler.ServeHTTP(w, &http.Request{Method: "GET", URL: &url.URL{Path: "/random.dat"}})
+	assert.Equal(expected, w.buf.Bytes())
+	assert.Equal(1, w.readFroms)
+
+	// files that are not stored, or not in an *os.File, are copied
+	w = &readFromTestResponseWriter{TestResponseWriter: NewTestResponseWriter()}
+	handler.ServeHTTP(w, &http.Request{Method: "GET", URL: &url.URL{Path: "/test.html"}})
+	assert.Equal(200, w.status)
+	assert.Zero(w.readFroms)
+	memFS := newTestFileSystem(t, map[string]string{"file.txt": "contents"})
+	w = &readFromTestResponseWriter{TestResponseWriter: NewTestResponseWriter()}
+	FileServer(memFS).ServeHTTP(w, &http.Request{Method: "GET", URL: &url.URL{Path: "/file.txt"}})
+	assert.Equal("contents", w.buf.String())
+	assert.Zero(w.readFroms)
+}
+
+func TestSendStoredHandles(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	expected, err := os.ReadFile("testdata/random.dat")
+	require.NoError(err)
+	fs, err := New("testdata/testdata.zip")
+	require.NoError(err)
+	defer fs.Close()
+	handler := FileServer(fs)
+
+	// the relative path still works after changing directory
+	wd, err := os.Getwd()
+	require.NoError(err)
+	require.NoError(os.Chdir(t.TempDir()))
+	defer os.Chdir(wd)
+
+	for i := 0; i < 3; i++ {
+		w := &readFromTestResponseWriter{TestResponseWriter: NewTestResponseWriter()}
+		handler.ServeHTTP(w, &http.Request{Method: "GET", URL: &url.URL{Path: "/random.dat"}})
+		assert.Equal(expected, w.buf.Bytes())
+		assert.Equal(1, w.readFroms)
+	}
+	// the handle is reused
+	assert.Len(fs.idleHandles, 1)
+
+	require.NoError(fs.Close())
+	assert.Empty(fs.idleHandles)
+}
+
+// readFromTestResponseWriter is a TestResponseWriter
+// that counts the calls to ReadFrom.
+type readFromTestResponseWriter struct {
+	*TestResponseWriter
+	readFroms int
+}
+
+func (w *readFromTestResponseWriter) ReadFrom(r io.Reader) (int64, error) {
+	w.readFroms++
+	return w.buf.ReadFrom(r)
+}
+
+// flushResponseWriter is a TestResponseWriter that implements
+// http.Flusher, and records the order of writes and flushes.
+type flushResponseWriter struct {
+	*TestResponseWriter
+	events []string
+}
+
+func (w *flushResponseWriter) Write(b []byte) (int, error) {
+	w.events = append(w.events, "write")
+	return w.buf.Write(b)
+}
+
+func (w *flushResponseWriter) Flush() {
+	w.events = append(w.events, "flush")
+}
+
+func TestFlushInterval(t *testing.T) {
+	assert := assert.New(t)
+
+	data := make([]byte, 200000)
+	rand.New(rand.NewSource(1)).Read(data)
+	fs := newTestFileSystem(t, map[string]string{"video.bin": string(data)})
+
+	count := func(events []string, event string) int {
+		n := 0
+		for _, e := range events {
+			if e == event {
+				n++
+			}
+		}
+		return n
+	}
+
+	testCases := []struct {
+		Opts     []HandlerOption
+		Encoding string
+		Flushes  bool
+	}{
+		{Encoding: "identity"},
+		{Encoding: "deflate"},
+		{Opts: []HandlerOption{WithFlushInterval(time.Nanosecond)}, Encoding: "identity", Flushes: true},
+		{Opts: []HandlerOption{WithFlushInterval(time.Nanosecond)}, Encoding: "deflate", Flushes: true},
+		{Opts: []HandlerOption{WithFlushInterval(time.Hour)}, Encoding: "identity"},
+	}
+	for i, tc := range testCases {
+		handler := FileServer(fs, tc.Opts...)
+		w := &flushResponseWriter{TestResponseWriter: NewTestResponseWriter()}
+		req := &http.Request{
+			Method: "GET",
+			URL:    &url.URL{Path: "/video.bin"},
+			Header: http.Header{"Accept-Encoding": {tc.Encoding}},
+		}
+		handler.ServeHTTP(w, req)
+		assert.Equal(200, w.status, i)
+		assert.Equal(tc.Encoding == "deflate", w.Header().Get("Content-Encoding") == "deflate", i)
+		if !tc.Flushes {
+			assert.Zero(count(w.events, "flush"), i)
+			continue
+		}
+		// never flushed before the body, so that the headers can be changed
+		assert.Equal("write", w.events[0], i)
+		assert.Positive(count(w.events, "flush"), i)
+	}
+}
+
+// shortReaderAt returns at most limit bytes from each call to ReadAt,
+// and fills the rest of the buffer with garbage. A zero limit disables
+// short reads.
+type shortReaderAt struct {
+	r     io.ReaderAt
+	limit int
+}
+
+func (s *shortReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if s.limit == 0 || len(p) <= s.limit {
+		return s.r.ReadAt(p, off)
+	}
+	n, err := s.r.ReadAt(p[:s.limit], off)
+	for i := n; i < len(p); i++ {
+		p[i] = 0xff
+	}
+	return n, err
+}
+
+func TestDeflateShortReads(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	file, err := os.Open("testdata/testdata.zip")
+	require.NoError(err)
+	stat, err := file.Stat()
+	require.NoError(err)
+	readerAt := &shortReaderAt{r: file}
+	fs, err := newFileSystem(readerAt, stat.Size(), file)
+	require.NoError(err)
+	defer fs.Close()
+	handler := FileServer(fs)
+
+	// the zip reader needs complete reads, so only read short when serving
+	readerAt.limit = 100
+
+	expected, err := os.ReadFile("testdata/img/circle.png")
+	require.NoError(err)
+
+	w := serveTestRequest(handler, "GET", "/img/circle.png", "Accept-Encoding: deflate")
+	assert.Equal(200, w.status)
+	assert.Equal("deflate", w.Header().Get("Content-Encoding"))
+	assert.Equal(w.Header().Get("Content-Length"), strconv.Itoa(w.buf.Len()))
+	content, err := io.ReadAll(flate.NewReader(&w.buf))
+	require.NoError(err)
+	assert.Equal(expected, content)
+}
+
+func TestIfMatch(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	fs, err := New("testdata/testdata.zip")
+	require.NoError(err)
+	defer fs.Close()
+	handler := FileServer(fs)
+	weak := FileServer(fs, WithWeakETags())
+
+	testCases := []struct {
+		Handler http.Handler
+		Path    string
+		Headers []string
+		Status  int
+		Size    int
+	}{
+		{
+			Handler: handler,
+			Path:    "/random.dat",
+			Headers: []string{`If-Match: "27106c15f45b"`},
+			Status:  200,
+			Size:    10000,
+		},
+		{
+			Handler: handler,
+			Path:    "/random.dat",
+			Headers: []string{`If-Match: "xyzzy", "27106c15f45b"`},
+			Status:  200,
+			Size:    10000,
+		},
+		{
+			Handler: handler,
+			Path:    "/random.dat",
+			Headers: []string{`If-Match: "xyzzy"`},
+			Status:  412,
+		},
+		{
+			Handler: handler,
+			Path:    "/random.dat",
+			Headers: []string{`If-Match: W/"27106c15f45b"`},
+			Status:  412,
+		},
+		{
+			Handler: weak,
+			Path:    "/random.dat",
+			Headers: []string{`If-Match: W/"27106c15f45b"`},
+			Status:  412,
+		},
+		{
+			Handler: handler,
+			Path:    "/random.dat",
+			Headers: []string{`If-Match: *`},
+			Status:  200,
+			Size:    10000,
+		},
+		{
+			// If-Match is evaluated before If-None-Match.
+			Handler: handler,
+			Path:    "/random.dat",
+			Headers: []string{`If-Match: "xyzzy"`, `If-None-Match: "27106c15f45b"`},
+			Status:  412,
+		},
+		{
+			Handler: handler,
+			Path:    "/random.dat",
+			Headers: []string{`If-Match: "27106c15f45b"`, "Range: bytes=0-499"},
+			Status:  206,
+			Size:    500,
+		},
+		{
+			// Preconditions do not apply when the file does not exist.
+			Handler: handler,
+			Path:    "/does/not/exist",
+			Headers: []string{`If-Match: *`},
+			Status:  404,
+		},
+	}
+
+	for _, tc := range testCases {
+		w := serveTestRequest(tc.Handler, "GET", tc.Path, tc.Headers...)
+		assert.Equal(tc.Status, w.status, tc.Headers)
+		if tc.Size > 0 {
+			assert.Equal(tc.Size, w.buf.Len(), tc.Headers)
+		}
+		if tc.Status == 412 {
+			assert.Equal(0, w.buf.Len(), tc.Headers)
+		}
+	}
+}
+
+func TestLastModified(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	fs, err := New("testdata/testdata.zip")
+	require.NoError(err)
+	defer fs.Close()
+	handler := FileServer(fs, WithAllowedMethods("GET", "HEAD", "POST"))
+
+	f, err := fs.Open("/random.dat")
+	require.NoError(err)
+	fi, err := f.Stat()
+	require.NoError(err)
+	f.Close()
+	modtime := fi.ModTime().UTC()
+	lastModified := modtime.Format(http.TimeFormat)
+	before := modtime.Add(-time.Hour).Format(http.TimeFormat)
+	after := modtime.Add(time.Hour).Format(http.TimeFormat)
+
+	testCases := []struct {
+		Method  string
+		Headers []string
+		Status  int
+		Size    int
+	}{
+		{
+			Status: 200,
+			Size:   10000,
+		},
+		{
+			Headers: []string{"Range: bytes=0-499"},
+			Status:  206,
+			Size:    500,
+		},
+		{
+			Headers: []string{"If-Modified-Since: " + lastModified},
+			Status:  304,
+		},
+		{
+			Headers: []string{"If-Modified-Since: " + after},
+			Status:  304,
+		},
+		{
+			Headers: []string{"If-Modified-Since: " + before},
+			Status:  200,
+			Size:    10000,
+		},
+		{
+			Headers: []string{"If-Modified-Since: not a date"},
+			Status:  200,
+			Size:    10000,
+		},
+		{
+			// If-None-Match takes precedence over If-Modified-Since.
+			Headers: []string{"If-Modified-Since: " + lastModified, `If-None-Match: "xyzzy"`},
+			Status:  200,
+			Size:    10000,
+		},
+		{
+			Headers: []string{"If-Modified-Since: " + before, `If-None-Match: "27106c15f45b"`},
+			Status:  304,
+		},
+		{
+			Method:  "POST",
+			Headers: []string{"If-Modified-Since: " + lastModified},
+			Status:  200,
+			Size:    10000,
+		},
+		{
+			Headers: []string{"If-Unmodified-Since: " + lastModified},
+			Status:  200,
+			Size:    10000,
+		},
+		{
+			Headers: []string{"If-Unmodified-Since: " + before},
+			Status:  412,
+		},
+		{
+			// If-Unmodified-Since is ignored when If-Match is present.
+			Headers: []string{"If-Unmodified-Since: " + before, `If-Match: "27106c15f45b"`},
+			Status:  200,
+			Size:    10000,
+		},
+	}
+
+	for _, tc := range testCases {
+		method := tc.Method
+		if method == "" {
+			method = "GET"
+		}
+		w := serveTestRequest(handler, method, "/random.dat", tc.Headers...)
+		assert.Equal(tc.Status, w.status, tc.Headers)
+		assert.Equal(tc.Size, w.buf.Len(), tc.Headers)
+		if tc.Status != 412 {
+			assert.Equal(lastModified, w.Header().Get("Last-Modified"), tc.Headers)
+		}
+	}
+}
+
+func TestPreconditionFailedServer(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	fs, err := New("testdata/testdata.zip")
+	require.NoError(err)
+	defer fs.Close()
+	modtime := fs.fileInfos["test.html"].ModTime().UTC()
+	before := modtime.Add(-time.Hour).Format(http.TimeFormat)
+
+	// A real server, because TestResponseWriter does not check the
+	// Content-Length against the body.
+	server := httptest.NewUnstartedServer(FileServer(fs, WithAllowedMethods("GET", "HEAD", "POST")))
+	var conns int32
+	server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&conns, 1)
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	testCases := []struct {
+		Method string
+		Header string
+	}{
+		{Method: "GET", Header: `If-Match: "xyzzy"`},
+		{Method: "GET", Header: "If-Unmodified-Since: " + before},
+		{Method: "POST", Header: "If-None-Match: *"},
+		{Method: "GET"},
+	}
+	for i, tc := range testCases {
+		req, err := http.NewRequest(tc.Method, server.URL+"/test.html", nil)
+		require.NoError(err)
+		req.Header.Set("Accept-Encoding", "deflate")
+		if key, value, ok := strings.Cut(tc.Header, ": "); ok {
+			req.Header.Set(key, value)
+		}
+		resp, err := server.Client().Do(req)
+		require.NoError(err, tc.Header)
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		require.NoError(err, tc.Header)
+		if i < len(testCases)-1 {
+			assert.Equal(412, resp.StatusCode, tc.Header)
+			assert.Empty(body, tc.Header)
+			assert.Empty(resp.Header.Get("Content-Encoding"), tc.Header)
+		} else {
+			assert.Equal(200, resp.StatusCode)
+			assert.NotEmpty(body)
+		}
+	}
+	// Every response was complete, so the connection was reused.
+	assert.Equal(int32(1), atomic.LoadInt32(&conns))
+}
+
+// presetHeader is a handler that sets a response header
+// before passing the request to the next handler.
+func presetHeader(key, value string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(key, value)
+		next.ServeHTTP(w, r)
+	})
+}
+
+func TestCacheControl(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	fs, err := New("testdata/testdata.zip")
+	require.NoError(err)
+	defer fs.Close()
+	const cacheControl = "public, max-age=3600"
+	handler := FileServer(fs, WithCacheControl(cacheControl))
+
+	testCases := []struct {
+		Handler      http.Handler
+		Path         string
+		Headers      []string
+		Status       int
+		CacheControl string
+	}{
+		{
+			Handler:      handler,
+			Path:         "/random.dat",
+			Status:       200,
+			CacheControl: cacheControl,
+		},
+		{
+			Handler:      handler,
+			Path:         "/img/circle.png",
+			Headers:      []string{"Accept-Encoding: deflate"},
+			Status:       200,
+			CacheControl: cacheControl,
+		},
+		{
+			Handler:      handler,
+			Path:         "/random.dat",
+			Headers:      []string{"Range: bytes=0-499"},
+			Status:       206,
+			CacheControl: cacheControl,
+		},
+		{
+			Handler:      handler,
+			Path:         "/random.dat",
+			Headers:      []string{`If-None-Match: "27106c15f45b"`},
+			Status:       304,
+			CacheControl: cacheControl,
+		},
+		{
+			Handler: handler,
+			Path:    "/does/not/exist",
+			Status:  404,
+		},
+		{
+			Handler: handler,
+			Path:    "/empty/",
+			Status:  403,
+		},
+		{
+			Handler:      presetHeader("Cache-Control", "no-store", handler),
+			Path:         "/random.dat",
+			Status:       200,
+			CacheControl: "no-store",
+		},
+		{
+			Handler: FileServer(fs),
+			Path:    "/random.dat",
+			Status:  200,
+		},
+	}
+
+	for _, tc := range testCases {
+		w := serveTestRequest(tc.Handler, "GET", tc.Path, tc.Headers...)
+		assert.Equal(tc.Status, w.status, tc.Path)
+		assert.Equal(tc.CacheControl, w.Header().Get("Cache-Control"), tc.Path)
+	}
+}
+
+func TestHeaderFunc(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	fs, err := New("testdata/testdata.zip")
+	require.NoError(err)
+	defer fs.Close()
+
+	handler := FileServer(fs, WithHeaderFunc(func(h http.Header, name string, fi os.FileInfo) {
+		if strings.HasPrefix(name, "/img/") {
+			h.Set("Access-Control-Allow-Origin", "*")
+			assert.Equal("image/png", h.Get("Content-Type"), name)
+		}
+		if name == "/random.dat" {
+			h.Del("Etag")
+			assert.Equal(int64(10000), fi.Size())
+		}
+	}))
+
+	testCases := []struct {
+		Path    string
+		Headers []string
+		Status  int
+		CORS    string
+		ETag    string
+		NoETag  bool
+	}{
+		{
+			Path:   "/img/circle.png",
+			Status: 200,
+			CORS:   "*",
+			ETag:   `"1755529fb2ff"`,
+		},
+		{
+			Path:    "/img/circle.png",
+			Headers: []string{"Accept-Encoding: deflate"},
+			Status:  200,
+			CORS:    "*",
+			ETag:    `"1755529fb2ff"`,
+		},
+		{
+			Path:    "/img/another-circle.png",
+			Headers: []string{`If-None-Match: "1755529fb2ff"`},
+			Status:  304,
+			CORS:    "*",
+			ETag:    `"1755529fb2ff"`,
+		},
+		{
+			Path:    "/img/circle.png",
+			Headers: []string{"Range: bytes=0-99"},
+			Status:  206,
+			CORS:    "*",
+			ETag:    `"1755529fb2ff"`,
+		},
+		{
+			Path:   "/test.html",
+			Status: 200,
+		},
+		{
+			Path:   "/img/does-not-exist.png",
+			Status: 404,
+		},
+		{
+			// The ETag was deleted, so If-None-Match does not match.
+			Path:    "/random.dat",
+			Headers: []string{`If-None-Match: "27106c15f45b"`},
+			Status:  200,
+			NoETag:  true,
+		},
+	}
+
+	for _, tc := range testCases {
+		w := serveTestRequest(handler, "GET", tc.Path, tc.Headers...)
+		assert.Equal(tc.Status, w.status, tc.Path)
+		assert.Equal(tc.CORS, w.Header().Get("Access-Control-Allow-Origin"), tc.Path)
+		if tc.ETag != "" || tc.NoETag {
+			assert.Equal(tc.ETag, w.Header().Get("Etag"), tc.Path)
+		}
+	}
+}
+
+// discardResponseWriter is a http.ResponseWriter that discards
+// everything written to it, for use in benchmarks.
+type discardResponseWriter struct {
+	header http.Header
+}
+
+func (w *discardResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *discardResponseWriter) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+func (w *discardResponseWriter) WriteHeader(status int) {}
+
+// readFromResponseWriter is a discardResponseWriter
+// that implements io.ReaderFrom, as net/http does.
+type readFromResponseWriter struct {
+	*discardResponseWriter
+}
+
+func (w readFromResponseWriter) ReadFrom(r io.Reader) (int64, error) {
+	return io.Copy(io.Discard, r)
+}
+
+func benchmarkServe(b *testing.B, w http.ResponseWriter, path string, headers ...string) {
+	fs, err := New("testdata/testdata.zip")
+	require.NoError(b, err)
+	defer fs.Close()
+	handler := FileServer(fs)
+
+	req := &http.Request{
+		Method: "GET",
+		URL:    &url.URL{Path: path},
+		Header: make(http.Header),
+	}
+	for _, header := range headers {
+		arr := strings.SplitN(header, ":", 2)
+		req.Header.Add(strings.TrimSpace(arr[0]), strings.TrimSpace(arr[1]))
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		header := w.Header()
+		for key := range header {
+			delete(header, key)
+		}
+		handler.ServeHTTP(w, req)
+	}
+}
+
+func BenchmarkServeDeflate(b *testing.B) {
+	w := &discardResponseWriter{header: make(http.Header)}
+	benchmarkServe(b, w, "/img/circle.png", "Accept-Encoding: deflate")
+}
+
+func BenchmarkServeIdentity(b *testing.B) {
+	w := &discardResponseWriter{header: make(http.Header)}
+	benchmarkServe(b, w, "/random.dat")
+}
+
+func BenchmarkServeReadFrom(b *testing.B) {
+	w := readFromResponseWriter{&discardResponseWriter{header: make(http.Header)}}
+	benchmarkServe(b, w, "/random.dat")
+}
+
+func TestAcceptRanges(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	fs, err := New("testdata/testdata.zip")
+	require.NoError(err)
+	defer fs.Close()
+	handler := FileServer(fs)
+
+	testCases := []struct {
+		Path            string
+		Headers         []string
+		Status          int
+		ContentEncoding string
+		AcceptRanges    string
+	}{
+		{
+			Path:         "/random.dat",
+			Status:       200,
+			AcceptRanges: "bytes",
+		},
+		{
+			Path:         "/random.dat",
+			Headers:      []string{"Range: bytes=0-499"},
+			Status:       206,
+			AcceptRanges: "bytes",
+		},
+		{
+			Path:         "/img/circle.png",
+			Status:       200,
+			AcceptRanges: "bytes",
+		},
+		{
+			Path:            "/img/circle.png",
+			Headers:         []string{"Accept-Encoding: deflate"},
+			Status:          200,
+			ContentEncoding: "deflate",
+			AcceptRanges:    "",
+		},
+		{
+			Path:         "/img/circle.png",
+			Headers:      []string{"Accept-Encoding: deflate", "Range: bytes=0-499"},
+			Status:       206,
+			AcceptRanges: "bytes",
+		},
+	}
+
+	for _, tc := range testCases {
+		w := serveTestRequest(handler, "GET", tc.Path, tc.Headers...)
+		assert.Equal(tc.Status, w.status, tc.Path, tc.Headers)
+		assert.Equal(tc.ContentEncoding, w.Header().Get("Content-Encoding"), tc.Path, tc.Headers)
+		assert.Equal(tc.AcceptRanges, w.Header().Get("Accept-Ranges"), tc.Path, tc.Headers)
+	}
+}
+
+func TestRangeStored(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	data := make([]byte, 100000)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	fs := newTestFileSystem(t, map[string]string{
+		"video.dat":  string(data),
+		"video.webm": string(data),
+	}, WithMemorySeekLimit(0))
+	handler := FileServer(fs)
+
+	f, err := fs.Open("/video.dat")
+	require.NoError(err)
+	fi, err := f.Stat()
+	require.NoError(err)
+	require.Equal(zip.Store, fi.Sys().(*zip.File).Method)
+	f.Close()
+
+	count := atomic.LoadInt64(&tempFileCount)
+	w := serveTestRequest(handler, "GET", "/video.dat", "Range: bytes=50000-50999")
+	assert.Equal(206, w.status)
+	assert.Equal("bytes 50000-50999/100000", w.Header().Get("Content-Range"))
+	assert.Equal(data[50000:51000], w.buf.Bytes())
+	assert.Equal(count, atomic.LoadInt64(&tempFileCount), "no temp file for stored file")
+
+	// deflated files are extracted to a temporary file
+	w = serveTestRequest(handler, "GET", "/video.webm", "Range: bytes=50000-50999")
+	assert.Equal(206, w.status)
+	assert.Equal(data[50000:51000], w.buf.Bytes())
+	assert.Equal(count+1, atomic.LoadInt64(&tempFileCount))
+}
+
+func TestRangeMemoryLimit(t *testing.T) {
+	assert := assert.New(t)
+
+	data := make([]byte, 100000)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	fs := newTestFileSystem(t, map[string]string{
+		"small.bin": string(data[:1000]),
+		"large.bin": string(data),
+	})
+	// the explicit limit takes precedence over the default memory seek limit
+	handler := FileServer(fs, WithRangeMemoryLimit(50000))
+
+	count := atomic.LoadInt64(&tempFileCount)
+	w := serveTestRequest(handler, "GET", "/small.bin", "Range: bytes=100-199")
+	assert.Equal(206, w.status)
+	assert.Equal(data[100:200], w.buf.Bytes())
+	assert.Equal(count, atomic.LoadInt64(&tempFileCount), "no temp file for small file")
+
+	w = serveTestRequest(handler, "GET", "/large.bin", "Range: bytes=100-199")
+	assert.Equal(206, w.status)
+	assert.Equal(data[100:200], w.buf.Bytes())
+	assert.Equal(count+1, atomic.LoadInt64(&tempFileCount))
+}
+
+func TestRangeSharedTempFile(t *testing.T) {
+	assert := assert.New(t)
+
+	data := make([]byte, 100000)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	fs := newTestFileSystem(t, map[string]string{
+		"video.webm": string(data),
+	}, WithMemorySeekLimit(0))
+	handler := FileServer(fs)
+
+	count := atomic.LoadInt64(&tempFileCount)
+	w := serveTestRequest(handler, "GET", "/video.webm", "Range: bytes=100-199")
+	assert.Equal(206, w.status)
+	assert.Equal(data[100:200], w.buf.Bytes())
+
+	w = serveTestRequest(handler, "GET", "/video.webm", "Range: bytes=90000-")
+	assert.Equal(206, w.status)
+	assert.Equal(data[90000:], w.buf.Bytes())
+	assert.Equal(count+1, atomic.LoadInt64(&tempFileCount), "one extraction")
+}
+
+func TestIndexNames(t *testing.T) {
+	assert := assert.New(t)
+
+	fs := newTestFileSystem(t, map[string]string{
+		"index.html":         "root index.html",
+		"docs/index.htm":     "docs index.htm",
+		"both/index.html":    "both index.html",
+		"both/index.htm":     "both index.htm",
+		"other/default.html": "other default.html",
+		"none/file.txt":      "file",
+	})
+	handler := FileServer(fs, WithIndexNames("index.html", "index.htm", "default.html"))
+
+	testCases := []struct {
+		Path     string
+		Status   int
+		Location string
+		Body     string
+	}{
+		{Path: "/", Status: 200, Body: "root index.html"},
+		{Path: "/docs/", Status: 200, Body: "docs index.htm"},
+		{Path: "/docs", Status: 301, Location: "docs/"},
+		{Path: "/docs/index.htm", Status: 301, Location: "./"},
+		{Path: "/both/", Status: 200, Body: "both index.html"},
+		{Path: "/both/index.html", Status: 301, Location: "./"},
+		{Path: "/both/index.htm", Status: 200, Body: "both index.htm"},
+		{Path: "/other/", Status: 200, Body: "other default.html"},
+		{Path: "/none", Status: 403},
+		{Path: "/none/", Status: 403},
+	}
+	for _, tc := range testCases {
+		w := serveTestRequest(handler, "GET", tc.Path, "Accept-Encoding: deflate")
+		assert.Equal(tc.Status, w.status, tc.Path)
+		assert.Equal(tc.Location, w.Header().Get("Location"), tc.Path)
+		if tc.Body != "" {
+			assert.Equal("deflate", w.Header().Get("Content-Encoding"), tc.Path)
+			assert.NotEmpty(w.Header().Get("Etag"), tc.Path)
+			body, err := io.ReadAll(flate.NewReader(&w.buf))
+			assert.NoError(err)
+			assert.Equal(tc.Body, string(body), tc.Path)
+		}
+	}
+}
+
+func TestRedirectStatus(t *testing.T) {
+	assert := assert.New(t)
+
+	fs := newTestFileSystem(t, map[string]string{
+		"docs/index.html": "docs",
+		"docs/page.txt":   "page",
+	})
+	for _, code := range []int{301, 302, 307, 308} {
+		handler := FileServer(fs, WithRedirectStatus(code))
+		for _, path := range []string{"/docs/index.html", "/docs", "/docs/page.txt/"} {
+			w := serveTestRequest(handler, "GET", path)
+			assert.Equal(code, w.status, path)
+			assert.NotEmpty(w.Header().Get("Location"), path)
+		}
+	}
+
+	assert.Panics(func() { WithRedirectStatus(200) })
+	assert.Panics(func() { WithRedirectStatus(303) })
+}
+
+func TestWithoutRedirects(t *testing.T) {
+	assert := assert.New(t)
+
+	fs := newTestFileSystem(t, map[string]string{
+		"index.html":      "root",
+		"docs/index.html": "docs",
+		"docs/page.txt":   "page",
+	})
+	handler := FileServer(fs, WithoutRedirects())
+
+	testCases := []struct {
+		Path string
+		Body string
+	}{
+		{Path: "/", Body: "root"},
+		{Path: "/index.html", Body: "root"},
+		{Path: "/docs", Body: "docs"},
+		{Path: "/docs/", Body: "docs"},
+		{Path: "/docs/index.html", Body: "docs"},
+		{Path: "/docs/page.txt", Body: "page"},
+		{Path: "/docs/page.txt/", Body: "page"},
+	}
+	for _, tc := range testCases {
+		w := serveTestRequest(handler, "GET", tc.Path)
+		assert.Equal(200, w.status, tc.Path)
+		assert.Empty(w.Header().Get("Location"), tc.Path)
+		assert.Equal(tc.Body, w.buf.String(), tc.Path)
+	}
+}
+
+func TestRedirectQuery(t *testing.T) {
+	assert := assert.New(t)
+
+	fs := newTestFileSystem(t, map[string]string{
+		"docs/index.html": "docs",
+		"docs/page.txt":   "page",
+	})
+	handler := FileServer(fs)
+
+	testCases := []struct {
+		Path     string
+		Location string
+		Resolved string
+	}{
+		{
+			Path:     "/docs?page=2",
+			Location: "docs/?page=2",
+			Resolved: "/docs/?page=2",
+		},
+		{
+			Path:     "/docs/index.html?page=2&sort=name",
+			Location: "./?page=2&sort=name",
+			Resolved: "/docs/?page=2&sort=name",
+		},
+		{
+			Path:     "/docs/page.txt/?q=a%20b",
+			Location: "../page.txt?q=a%20b",
+			Resolved: "/docs/page.txt?q=a%20b",
+		},
+		{
+			Path:     "/docs",
+			Location: "docs/",
+			Resolved: "/docs/",
+		},
+	}
+	for _, tc := range testCases {
+		w := serveTestRequest(handler, "GET", tc.Path)
+		assert.Equal(301, w.status, tc.Path)
+		location := w.Header().Get("Location")
+		assert.Equal(tc.Location, location, tc.Path)
+
+		base, err := url.Parse("http://test-server.com" + tc.Path)
+		assert.NoError(err)
+		ref, err := url.Parse(location)
+		assert.NoError(err)
+		assert.Equal(tc.Resolved, base.ResolveReference(ref).RequestURI(), tc.Path)
+	}
+}
+
+func TestForwardedPrefix(t *testing.T) {
+	assert := assert.New(t)
+
+	fs := newTestFileSystem(t, map[string]string{
+		"index.html":      "<html>root</html>",
+		"docs/index.html": "<html>docs</html>",
+		"img/circle.png":  "png",
+	})
+	handler := FileServer(fs, WithForwardedPrefix())
+
+	testCases := []struct {
+		Path     string
+		Prefix   string
+		Location string
+	}{
+		{"/docs", "/site", "/site/docs/"},
+		{"/docs", "/site/", "/site/docs/"},
+		{"/docs?q=1", "/a/b", "/a/b/docs/?q=1"},
+		{"/docs/index.html", "/site", "/site/docs/"},
+		{"/index.html", "/site", "/site/"},
+		{"/img/circle.png/", "/site", "/site/img/circle.png"},
+		{"/docs", "/site, /other", "/site/docs/"},
+		// without a usable prefix, redirects are relative
+		{"/docs", "", "docs/"},
+		{"/docs", "/", "docs/"},
+		{"/docs", "site", "docs/"},
+		{"/docs", "//evil.example.com", "docs/"},
+		{"/docs", "/site/../..", "docs/"},
+		{"/docs", "/../site", "docs/"},
+		{"/docs", "/site\\x", "docs/"},
+		{"/docs", "/site?x", "docs/"},
+		{"/docs", "/site\tx", "docs/"},
+	}
+
+	for _, tc := range testCases {
+		w := serveTestRequest(handler, "GET", tc.Path, "X-Forwarded-Prefix: "+tc.Prefix)
+		assert.Equal(301, w.status, tc.Path, tc.Prefix)
+		assert.Equal(tc.Location, w.Header().Get("Location"), tc.Path, tc.Prefix)
+	}
+
+	// files are served as usual
+	w := serveTestRequest(handler, "GET", "/img/circle.png", "X-Forwarded-Prefix: /site")
+	assert.Equal(200, w.status)
+	assert.Equal("png", w.buf.String())
+
+	// the header is ignored without the option
+	w = serveTestRequest(FileServer(fs), "GET", "/docs", "X-Forwarded-Prefix: /site")
+	assert.Equal("docs/", w.Header().Get("Location"))
+
+	// the forwarded prefix comes before the mount prefix
+	handler = Mount("/static/", fs, WithForwardedPrefix())
+	w = serveTestRequest(handler, "GET", "/static/docs", "X-Forwarded-Prefix: /site")
+	assert.Equal("/site/static/docs/", w.Header().Get("Location"))
+	w = serveTestRequest(handler, "GET", "/static", "X-Forwarded-Prefix: /site")
+	assert.Equal("/site/static/", w.Header().Get("Location"))
+	w = serveTestRequest(Mount("/static/", fs), "GET", "/static/docs", "X-Forwarded-Prefix: /site")
+	assert.Equal("/static/docs/", w.Header().Get("Location"))
+}
+
+func TestTrailingSlashPolicy(t *testing.T) {
+	assert := assert.New(t)
+
+	fs := newTestFileSystem(t, map[string]string{
+		"index.html":      "root",
+		"docs/index.html": "docs",
+		"docs/page.txt":   "page",
+	})
+
+	testCases := []struct {
+		Policy   TrailingSlashPolicy
+		Path     string
+		Status   int
+		Location string
+		Body     string
+	}{
+		{Policy: TrailingSlashAdd, Path: "/docs", Status: 301, Location: "docs/"},
+		{Policy: TrailingSlashAdd, Path: "/docs/", Status: 200, Body: "docs"},
+		{Policy: TrailingSlashAdd, Path: "/docs/index.html", Status: 301, Location: "./"},
+		{Policy: TrailingSlashAdd, Path: "/docs/page.txt", Status: 200, Body: "page"},
+		{Policy: TrailingSlashAdd, Path: "/docs/page.txt/", Status: 301, Location: "../page.txt"},
+		{Policy: TrailingSlashAdd, Path: "/", Status: 200, Body: "root"},
+
+		{Policy: TrailingSlashStrip, Path: "/docs", Status: 200, Body: "docs"},
+		{Policy: TrailingSlashStrip, Path: "/docs/", Status: 301, Location: "../docs"},
+		{Policy: TrailingSlashStrip, Path: "/docs/index.html", Status: 301, Location: "../docs"},
+		{Policy: TrailingSlashStrip, Path: "/docs/page.txt", Status: 200, Body: "page"},
+		{Policy: TrailingSlashStrip, Path: "/docs/page.txt/", Status: 301, Location: "../page.txt"},
+		{Policy: TrailingSlashStrip, Path: "/", Status: 200, Body: "root"},
+		{Policy: TrailingSlashStrip, Path: "/index.html", Status: 301, Location: "./"},
+
+		{Policy: TrailingSlashNone, Path: "/docs", Status: 200, Body: "docs"},
+		{Policy: TrailingSlashNone, Path: "/docs/", Status: 200, Body: "docs"},
+		{Policy: TrailingSlashNone, Path: "/docs/index.html", Status: 301, Location: "./"},
+		{Policy: TrailingSlashNone, Path: "/docs/page.txt", Status: 200, Body: "page"},
+		{Policy: TrailingSlashNone, Path: "/docs/page.txt/", Status: 200, Body: "page"},
+		{Policy: TrailingSlashNone, Path: "/", Status: 200, Body: "root"},
+	}
+	for _, tc := range testCases {
+		handler := FileServer(fs, WithTrailingSlashPolicy(tc.Policy))
+		w := serveTestRequest(handler, "GET", tc.Path)
+		assert.Equal(tc.Status, w.status, "%d %s", tc.Policy, tc.Path)
+		assert.Equal(tc.Location, w.Header().Get("Location"), "%d %s", tc.Policy, tc.Path)
+		if tc.Body != "" {
+			assert.Equal(tc.Body, w.buf.String(), "%d %s", tc.Policy, tc.Path)
+		}
+	}
+}
+
+func TestSPAFallback(t *testing.T) {
+	assert := assert.New(t)
+
+	fs := newTestFileSystem(t, map[string]string{
+		"index.html":    "<html>app</html>",
+		"static/app.js": "app()",
+	})
+	handler := FileServer(fs, WithSPAFallback("/index.html"))
+
+	testCases := []struct {
+		Method string
+		Path   string
+		Status int
+		Body   string
+	}{
+		{Method: "GET", Path: "/users/42/settings", Status: 200, Body: "<html>app</html>"},
+		{Method: "HEAD", Path: "/users/42", Status: 200},
+		{Method: "GET", Path: "/static/app.js", Status: 200, Body: "app()"},
+		{Method: "GET", Path: "/static/missing.js", Status: 404},
+		{Method: "POST", Path: "/users/42/settings", Status: 404},
+	}
+	for _, tc := range testCases {
+		w := serveTestRequest(handler, tc.Method, tc.Path)
+		assert.Equal(tc.Status, w.status, tc.Path)
+		if tc.Status == 200 && tc.Path != "/static/app.js" {
+			assert.Equal("text/html; charset=utf-8", w.Header().Get("Content-Type"), tc.Path)
+			assert.Equal("no-cache", w.Header().Get("Cache-Control"), tc.Path)
+		}
+		if tc.Body != "" {
+			assert.Equal(tc.Body, w.buf.String(), tc.Path)
+		}
+	}
+
+	// the predicate can be changed
+	handler = FileServer(fs, WithSPAFallback("/index.html"), WithSPAFallbackMatch(func(r *http.Request) bool {
+		return strings.HasPrefix(r.URL.Path, "/app/")
+	}))
+	assert.Equal(200, serveTestRequest(handler, "GET", "/app/page.html").status)
+	assert.Equal(404, serveTestRequest(handler, "GET", "/users/42").status)
+
+	// a missing fallback is not found
+	handler = FileServer(fs, WithSPAFallback("/missing.html"))
+	assert.Equal(404, serveTestRequest(handler, "GET", "/users/42").status)
+}
+
+func TestWithoutDotfiles(t *testing.T) {
+	assert := assert.New(t)
+
+	fs := newTestFileSystem(t, map[string]string{
+		".env":                "SECRET=1",
+		".git/config":         "[core]",
+		".git/HEAD":           "ref: refs/heads/main",
+		"docs/.DS_Store":      "junk",
+		"docs/guide.txt":      "guide",
+		"docs/.drafts/a.txt":  "draft",
+		"docs/not.dotted.txt": "dots",
+	})
+	handler := FileServer(fs, WithoutDotfiles(), WithDirectoryListing())
+
+	testCases := []struct {
+		Path   string
+		Status int
+	}{
+		{"/.env", 404},
+		{"/.git", 404},
+		{"/.git/", 404},
+		{"/.git/config", 404},
+		{"/docs/.DS_Store", 404},
+		{"/docs/.drafts/a.txt", 404},
+		{"/docs/guide.txt", 200},
+		{"/docs/not.dotted.txt", 200},
+		{"/docs/", 200},
+	}
+	for _, tc := range testCases {
+		w := serveTestRequest(handler, "GET", tc.Path)
+		assert.Equal(tc.Status, w.status, tc.Path)
+	}
+
+	w := serveTestRequest(handler, "GET", "/", "Accept: application/json")
+	assert.Equal(200, w.status)
+	assert.NotContains(w.buf.String(), ".env")
+	w = serveTestRequest(handler, "GET", "/docs/")
+	assert.Contains(w.buf.String(), "guide.txt")
+	assert.NotContains(w.buf.String(), ".DS_Store")
+
+	// without the option dotfiles are served
+	assert.Equal(200, serveTestRequest(FileServer(fs), "GET", "/.git/config").status)
+
+	// the files can still be opened
+	f, err := fs.Open("/.env")
+	assert.NoError(err)
+	f.Close()
+}
+
+func TestDenyAndAllowOnly(t *testing.T) {
+	assert := assert.New(t)
+
+	fs := newTestFileSystem(t, map[string]string{
+		"index.html":                "<html>root</html>",
+		"app.js":                    "app()",
+		"app.js.map":                "{}",
+		"internal/notes.txt":        "notes",
+		"internal/deep/secret.html": "secret",
+		"internal/index.html":       "<html>internal</html>",
+		"public/index.html":         "<html>public</html>",
+		"public/data.json":          "[]",
+		"public/js/lib.js.map":      "{}",
+	})
+
+	testCases := []struct {
+		Path   string
+		Deny   int
+		Allow  int
+		Listed bool
+	}{
+		{"/", 200, 200, true},
+		{"/app.js", 200, 404, true},
+		{"/app.js.map", 404, 404, false},
+		{"/internal", 404, 301, false},
+		{"/internal/", 404, 200, false},
+		{"/internal/notes.txt", 404, 404, false},
+		{"/internal/deep/secret.html", 404, 200, false},
+		{"/public/", 200, 200, true},
+		{"/public/data.json", 200, 404, true},
+		{"/public/js/lib.js.map", 404, 404, false},
+		{"/missing.map", 404, 404, false},
+	}
+
+	deny := FileServer(fs, WithDeny("/internal/**", "*.map"), WithDirectoryListing())
+	allow := FileServer(fs, WithAllowOnly("*.html"), WithDeny("*.map"), WithDirectoryListing())
+	for _, tc := range testCases {
+		w := serveTestRequest(deny, "GET", tc.Path)
+		assert.Equal(tc.Deny, w.status, "deny", tc.Path)
+		w = serveTestRequest(allow, "GET", tc.Path)
+		assert.Equal(tc.Allow, w.status, "allow only", tc.Path)
+	}
+
+	// denied and disallowed files are not listed
+	deny = FileServer(fs, WithDeny("/internal/", "*.map"), WithDirectoryListing(), WithIndexNames())
+	w := serveTestRequest(deny, "GET", "/")
+	assert.Equal(200, w.status)
+	assert.Contains(w.buf.String(), "app.js")
+	assert.NotContains(w.buf.String(), "app.js.map")
+	assert.NotContains(w.buf.String(), "internal")
+	allow = FileServer(fs, WithAllowOnly("*.html"), WithDirectoryListing(), WithIndexNames())
+	w = serveTestRequest(allow, "GET", "/public/")
+	assert.Equal(200, w.status)
+	assert.Contains(w.buf.String(), "index.html")
+	assert.NotContains(w.buf.String(), "data.json")
+
+	// a denied index document is not served for its directory
+	deny = FileServer(fs, WithDeny("/public/index.html"))
+	assert.Equal(403, serveTestRequest(deny, "GET", "/public/").status)
+
+	// the files can still be opened
+	f, err := fs.Open("/internal/notes.txt")
+	assert.NoError(err)
+	f.Close()
+}
+
+func TestAccessCheck(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	fs, err := New("testdata/testdata.zip")
+	require.NoError(err)
+	defer fs.Close()
+
+	var checked []string
+	handler := FileServer(fs, WithDirectoryListing(), WithAccessCheck(func(r *http.Request, name string, fi os.FileInfo) error {
+		checked = append(checked, name)
+		if !matchPath("/img/**", name) && name != "/img" {
+			return nil
+		}
+		switch r.Header.Get("X-Token") {
+		case "secret":
+			if name == "/img/another-circle.png" {
+				return os.ErrNotExist
+			}
+			return nil
+		case "":
+			return ErrUnauthorized
+		}
+		return errors.New("bad token")
+	}))
+
+	testCases := []struct {
+		Path     string
+		Token    string
+		Status   int
+		Location string
+	}{
+		{Path: "/img/circle.png", Status: 401},
+		{Path: "/img/circle.png", Token: "wrong", Status: 403},
+		{Path: "/img/circle.png", Token: "secret", Status: 200},
+		{Path: "/img/another-circle.png", Token: "secret", Status: 404},
+		// protected directories are not revealed by redirects
+		{Path: "/img", Status: 401},
+		{Path: "/img", Token: "secret", Status: 301, Location: "img/"},
+		{Path: "/img/", Status: 401},
+		{Path: "/img/", Token: "secret", Status: 200},
+		{Path: "/test.html", Status: 200},
+		{Path: "/img/missing.png", Status: 404},
+	}
+	for _, tc := range testCases {
+		w := serveTestRequest(handler, "GET", tc.Path, "X-Token: "+tc.Token)
+		assert.Equal(tc.Status, w.status, tc.Path, tc.Token)
+		assert.Equal(tc.Location, w.Header().Get("Location"), tc.Path, tc.Token)
+		if tc.Status == 401 || tc.Status == 403 {
+			assert.Empty(w.Header().Get("Etag"), tc.Path, tc.Token)
+			assert.Empty(w.Header().Get("Last-Modified"), tc.Path, tc.Token)
+		}
+	}
+
+	// both a directory and its index document are checked
+	checked = nil
+	w := serveTestRequest(handler, "GET", "/")
+	assert.Equal(200, w.status)
+	assert.Equal([]string{"/", "/index.html"}, checked)
+}
+
+func TestContentTypes(t *testing.T) {
+	assert := assert.New(t)
+
+	fs := newTestFileSystem(t, map[string]string{
+		"app.wasm":          strings.Repeat("wasm", 100),
+		"module.mjs":        "export {}",
+		"photo.AVIF":        "avif",
+		"site.webmanifest":  "{}",
+		"README.md":         "# readme",
+		"notes.txt":         "notes",
+		"data.unknownext":   "data",
+		"override.wasm.txt": "text",
+	}, WithContentTypes(map[string]string{
+		".md": "text/markdown; charset=utf-8",
+		"TXT": "text/x-notes",
+	}))
+	handler := FileServer(fs)
+
+	testCases := []struct {
+		Path        string
+		ContentType string
+	}{
+		{"/app.wasm", "application/wasm"},
+		{"/module.mjs", "text/javascript; charset=utf-8"},
+		{"/photo.AVIF", "image/avif"},
+		{"/site.webmanifest", "application/manifest+json"},
+		{"/README.md", "text/markdown; charset=utf-8"},
+		{"/notes.txt", "text/x-notes"},
+		{"/override.wasm.txt", "text/x-notes"},
+		{"/data.unknownext", "application/octet-stream"},
+	}
+	for _, tc := range testCases {
+		for _, headers := range [][]string{
+			nil,
+			{"Accept-Encoding: deflate"},
+			{"Range: bytes=0-1"},
+		} {
+			w := serveTestRequest(handler, "GET", tc.Path, headers...)
+			assert.Equal(tc.ContentType, w.Header().Get("Content-Type"), tc.Path, headers)
+		}
+	}
+}
+
+func TestContentTypeFunc(t *testing.T) {
+	assert := assert.New(t)
+
+	calls := make(map[string]int)
+	fs := newTestFileSystem(t, map[string]string{
+		"LICENSE":              "license",
+		"docker/Dockerfile":    "FROM scratch",
+		"generated/data-1":     "{}",
+		"page.html":            "<html></html>",
+		"unknown/no-extension": "data",
+	}, WithContentTypeFunc(func(name string, f *zip.File) string {
+		calls[name]++
+		switch {
+		case name == "/LICENSE", path.Base(name) == "Dockerfile":
+			return "text/plain; charset=utf-8"
+		case strings.HasPrefix(name, "/generated/"):
+			return "application/json"
+		}
+		return ""
+	}))
+	handler := FileServer(fs)
+
+	testCases := []struct {
+		Path        string
+		ContentType string
+	}{
+		{"/LICENSE", "text/plain; charset=utf-8"},
+		{"/docker/Dockerfile", "text/plain; charset=utf-8"},
+		{"/generated/data-1", "application/json"},
+		{"/page.html", "text/html; charset=utf-8"},
+		{"/unknown/no-extension", "application/octet-stream"},
+	}
+	for i := 0; i < 2; i++ {
+		for _, tc := range testCases {
+			w := serveTestRequest(handler, "GET", tc.Path)
+			assert.Equal(200, w.status, tc.Path)
+			assert.Equal(tc.ContentType, w.Header().Get("Content-Type"), tc.Path)
+		}
+	}
+
+	// the function is called once for each file
+	for _, tc := range testCases {
+		assert.Equal(1, calls[tc.Path], tc.Path)
+	}
+}
+
+func TestNoSniff(t *testing.T) {
+	assert := assert.New(t)
+
+	fs := newTestFileSystem(t, map[string]string{
+		"script.js":       "x()",
+		"module.esm":      "export {}",
+		"data.bin":        "data",
+		"data.unknownext": "data",
+		"dir/":            "",
+		"dir/file.txt":    "text",
+	}, WithContentTypes(map[string]string{
+		".esm": "text/javascript",
+		".bin": "application/octet-stream",
+	}))
+	handler := FileServer(fs, WithNoSniff(), WithDirectoryListing())
+
+	testCases := []struct {
+		Path    string
+		Headers []string
+		Status  int
+		NoSniff bool
+	}{
+		{Path: "/script.js", Status: 200, NoSniff: true},
+		{Path: "/script.js", Headers: []string{"Range: bytes=0-1"}, Status: 206, NoSniff: true},
+		{Path: "/script.js", Headers: []string{`If-None-Match: "x"`}, Status: 200, NoSniff: true},
+		{Path: "/script.js", Headers: []string{"If-Modified-Since: " + time.Now().UTC().Format(http.TimeFormat)}, Status: 304, NoSniff: true},
+		// types from WithContentTypes are trusted
+		{Path: "/module.esm", Status: 200, NoSniff: true},
+		{Path: "/data.bin", Status: 200, NoSniff: true},
+		// a type assumed for an unknown extension is not
+		{Path: "/data.unknownext", Status: 200, NoSniff: false},
+		{Path: "/dir/", Status: 200, NoSniff: true},
+	}
+	for _, tc := range testCases {
+		w := serveTestRequest(handler, "GET", tc.Path, tc.Headers...)
+		assert.Equal(tc.Status, w.status, tc.Path, tc.Headers)
+		nosniff := ""
+		if tc.NoSniff {
+			nosniff = "nosniff"
+		}
+		assert.Equal(nosniff, w.Header().Get("X-Content-Type-Options"), tc.Path, tc.Headers)
+	}
+
+	// off by default
+	w := serveTestRequest(FileServer(fs), "GET", "/script.js")
+	assert.Equal(200, w.status)
+	assert.Empty(w.Header().Get("X-Content-Type-Options"))
+}
+
+func TestDefaultCharset(t *testing.T) {
+	assert := assert.New(t)
+
+	fs := newTestFileSystem(t, map[string]string{
+		"data.json":   `{"a": 1}`,
+		"data.csv":    "a,b",
+		"feed.atom":   "<feed/>",
+		"latin1.txt":  "text",
+		"page.html":   "<html></html>",
+		"image.png":   "png",
+		"script.js":   "x()",
+		"report.tsv":  "a\tb",
+		"dir/dir.txt": "text",
+	}, WithContentTypes(map[string]string{
+		".json": "application/json",
+		".csv":  "text/csv",
+		".atom": "application/atom+xml",
+		".txt":  "text/plain; charset=iso-8859-1",
+		".png":  "image/png",
+		".js":   "application/javascript",
+		".tsv":  "text/tab-separated-values",
+	}))
+	handler := FileServer(fs, WithDefaultCharset("utf-8"), WithoutCharset("Text/Tab-Separated-Values"))
+
+	testCases := []struct {
+		Path        string
+		ContentType string
+	}{
+		{"/data.json", "application/json; charset=utf-8"},
+		{"/data.csv", "text/csv; charset=utf-8"},
+		{"/feed.atom", "application/atom+xml; charset=utf-8"},
+		{"/script.js", "application/javascript; charset=utf-8"},
+		// a charset is not replaced or repeated
+		{"/latin1.txt", "text/plain; charset=iso-8859-1"},
+		{"/page.html", "text/html; charset=utf-8"},
+		{"/image.png", "image/png"},
+		{"/report.tsv", "text/tab-separated-values"},
+	}
+	for _, tc := range testCases {
+		for _, headers := range [][]string{
+			nil,
+			{"Accept-Encoding: deflate"},
+			{"Range: bytes=0-1"},
+		} {
+			w := serveTestRequest(handler, "GET", tc.Path, headers...)
+			assert.Equal(tc.ContentType, w.Header().Get("Content-Type"), tc.Path, headers)
+		}
+	}
+
+	// without the option the content type is unchanged
+	w := serveTestRequest(FileServer(fs), "GET", "/data.json")
+	assert.Equal("application/json", w.Header().Get("Content-Type"))
+}
+
+func TestAliases(t *testing.T) {
+	assert := assert.New(t)
+
+	fs := newTestFileSystem(t, map[string]string{
+		"img/favicon.ico":   "icon",
+		"static/robots.txt": "User-agent: *",
+		"docs/v2/intro.txt": "intro",
+	})
+
+	testCases := []struct {
+		Path        string
+		Status      int
+		Body        string
+		ContentType string
+	}{
+		{Path: "/robots.txt", Status: 200, Body: "User-agent: *", ContentType: "text/plain; charset=utf-8"},
+		{Path: "/favicon.ico", Status: 200, Body: "icon"},
+		{Path: "/static/robots.txt", Status: 200, Body: "User-agent: *"},
+		{Path: "/docs/latest/intro.txt", Status: 200, Body: "intro"},
+		{Path: "/docs/v2/intro.txt", Status: 200, Body: "intro"},
+		{Path: "/missing.txt", Status: 404},
+		{Path: "/docs/latest/missing.txt", Status: 404},
+	}
+
+	handlers := map[string]http.Handler{
+		"map": FileServer(fs, WithAliases(map[string]string{
+			"/favicon.ico":           "/img/favicon.ico",
+			"robots.txt":             "static/robots.txt",
+			"/docs/latest/intro.txt": "/docs/v2/intro.txt",
+			"/missing.txt":           "/static/missing.txt",
+		})),
+		"func": FileServer(fs, WithRewriteFunc(func(p string) string {
+			switch {
+			case p == "/favicon.ico":
+				return "/img/favicon.ico"
+			case p == "/robots.txt":
+				return "/static/robots.txt"
+			case strings.HasPrefix(p, "/docs/latest/"):
+				return "/docs/v2/" + strings.TrimPrefix(p, "/docs/latest/")
+			}
+			return p
+		})),
+	}
+	for form, handler := range handlers {
+		for _, tc := range testCases {
+			w := serveTestRequest(handler, "GET", tc.Path)
+			assert.Equal(tc.Status, w.status, form, tc.Path)
+			assert.Empty(w.Header().Get("Location"), form, tc.Path)
+			if tc.Body != "" {
+				assert.Equal(tc.Body, w.buf.String(), form, tc.Path)
+			}
+			if tc.ContentType != "" {
+				assert.Equal(tc.ContentType, w.Header().Get("Content-Type"), form, tc.Path)
+			}
+		}
+	}
+}
+
+func TestNotFoundPage(t *testing.T) {
+	assert := assert.New(t)
+
+	page := "<html><body>" + strings.Repeat("Not found. ", 20) + "</body></html>"
+	fs := newTestFileSystem(t, map[string]string{
+		"404.html":   page,
+		"index.html": "index",
+	})
+	handler := FileServer(fs, WithNotFoundPage("/404.html"), WithCacheControl("max-age=3600"))
+
+	w := serveTestRequest(handler, "GET", "/missing")
+	assert.Equal(404, w.status)
+	assert.Equal("text/html; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Equal(page, w.buf.String())
+	assert.Empty(w.Header().Get("Etag"))
+	assert.Empty(w.Header().Get("Last-Modified"))
+	assert.Empty(w.Header().Get("Cache-Control"))
+
+	w = serveTestRequest(handler, "GET", "/missing", "Accept-Encoding: deflate")
+	assert.Equal(404, w.status)
+	assert.Equal("deflate", w.Header().Get("Content-Encoding"))
+	assert.Empty(w.Header().Get("Etag"))
+	body, err := io.ReadAll(flate.NewReader(&w.buf))
+	assert.NoError(err)
+	assert.Equal(page, string(body))
+
+	// the page is still served normally
+	w = serveTestRequest(handler, "GET", "/404.html")
+	assert.Equal(200, w.status)
+	assert.NotEmpty(w.Header().Get("Etag"))
+
+	// a missing page falls back to plain text
+	handler = FileServer(fs, WithNotFoundPage("/missing.html"))
+	w = serveTestRequest(handler, "GET", "/missing")
+	assert.Equal(404, w.status)
+	assert.Equal("text/plain; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Equal("404 page not found\n", w.buf.String())
+}
+
+func TestErrorHandler(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	fs, err := New("testdata/testdata.zip")
+	require.NoError(err)
+
+	type errorCall struct {
+		Code int
+		Err  error
+	}
+	var calls []errorCall
+	handler := FileServer(fs, WithCacheControl("max-age=60"), WithErrorHandler(
+		func(w http.ResponseWriter, r *http.Request, code int, err error) {
+			calls = append(calls, errorCall{Code: code, Err: err})
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(code)
+			json.NewEncoder(w).Encode(map[string]interface{}{"status": code, "path": r.URL.Path})
+		}))
+
+	testCases := []struct {
+		Path    string
+		Headers []string
+		Code    int
+		Err     error
+	}{
+		{Path: "/missing", Code: 404, Err: os.ErrNotExist},
+		{Path: "/empty/", Code: 403, Err: ErrIsDirectory},
+		{Path: "/random.dat", Headers: []string{"Range: bytes=20000-"}, Code: 416, Err: errNoOverlap},
+		{Path: "/random.dat", Headers: []string{`If-Match: "xyzzy"`}, Code: 412, Err: errPreconditionFailed},
+	}
+	for _, tc := range testCases {
+		calls = nil
+		w := serveTestRequest(handler, "GET", tc.Path, tc.Headers...)
+		assert.Equal(tc.Code, w.status, tc.Path)
+		assert.Equal([]errorCall{{Code: tc.Code, Err: tc.Err}}, calls, tc.Path)
+		assert.Equal("application/json", w.Header().Get("Content-Type"), tc.Path)
+		assert.Empty(w.Header().Get("Cache-Control"), tc.Path)
+		assert.Empty(w.Header().Get("Etag"), tc.Path)
+		var body map[string]interface{}
+		assert.NoError(json.Unmarshal(w.buf.Bytes(), &body), tc.Path)
+		assert.Equal(float64(tc.Code), body["status"], tc.Path)
+		assert.Equal(tc.Path, body["path"], tc.Path)
+	}
+	w := serveTestRequest(handler, "GET", "/random.dat", "Range: bytes=20000-")
+	assert.Equal("bytes */10000", w.Header().Get("Content-Range"))
+
+	// internal errors are passed to the handler, but are
+	// not sent to the client by default
+	fs.Close()
+	calls = nil
+	w = serveTestRequest(handler, "GET", "/random.dat")
+	assert.Equal(500, w.status)
+	require.Len(calls, 1)
+	assert.Equal(500, calls[0].Code)
+	assert.True(errors.Is(calls[0].Err, ErrClosed), calls[0].Err)
+
+	w = serveTestRequest(FileServer(fs), "GET", "/random.dat")
+	assert.Equal(500, w.status)
+	assert.Equal("500 Internal Server Error\n", w.buf.String())
+}
+
+func TestNotFoundHandler(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	fs, err := New("testdata/testdata.zip")
+	require.NoError(err)
+	defer fs.Close()
+
+	var got *http.Request
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		assert.Empty(w.Header(), "no headers set before falling through")
+		w.WriteHeader(http.StatusTeapot)
+	})
+	handler := FileServer(fs, WithNotFoundHandler(next))
+
+	w := serveTestRequest(handler, "GET", "/api/users?id=42")
+	assert.Equal(http.StatusTeapot, w.status)
+	require.NotNil(got)
+	assert.Equal("/api/users", got.URL.Path)
+	assert.Equal("id=42", got.URL.RawQuery)
+
+	got = nil
+	w = serveTestRequest(handler, "POST", "/random.dat/missing")
+	assert.Equal(http.StatusTeapot, w.status)
+	require.NotNil(got)
+	assert.Equal("POST", got.Method)
+
+	// files in the archive are served
+	got = nil
+	w = serveTestRequest(handler, "GET", "/random.dat")
+	assert.Equal(200, w.status)
+	assert.Nil(got)
+
+	// a request without a leading slash, such as one from
+	// http.StripPrefix, is passed on unchanged
+	req := &http.Request{
+		Method: "GET",
+		URL:    &url.URL{Path: "api/users"},
+		Header: make(http.Header),
+	}
+	got = nil
+	handler.ServeHTTP(NewTestResponseWriter(), req)
+	assert.Same(req, got)
+	assert.Equal("api/users", got.URL.Path)
+
+	req.URL.Path = "random.dat"
+	w = NewTestResponseWriter()
+	handler.ServeHTTP(w, req)
+	assert.Equal(200, w.status)
+	assert.Equal("random.dat", req.URL.Path)
+}
+
+func benchmarkRange(b *testing.B, opts ...HandlerOption) {
+	data := make([]byte, 100*1024)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+	fs := newTestFileSystem(b, map[string]string{"file.bin": string(data)})
+	handler := FileServer(fs, opts...)
+
+	req := &http.Request{
+		Method: "GET",
+		URL:    &url.URL{Path: "/file.bin"},
+		Header: http.Header{"Range": {"bytes=1000-1999"}},
+	}
+	w := &discardResponseWriter{header: make(http.Header)}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for key := range w.header {
+			delete(w.header, key)
+		}
+		handler.ServeHTTP(w, req)
+	}
+}
+
+func BenchmarkRangeTempFile(b *testing.B) {
+	benchmarkRange(b)
+}
+
+func BenchmarkRangeMemory(b *testing.B) {
+	benchmarkRange(b, WithRangeMemoryLimit(1<<20))
 }
@@ -2,55 +2,179 @@ package zipfs
 
 import (
 	"archive/zip"
+	"bytes"
+	"context"
 	"errors"
+	"fmt"
 	"io"
+	iofs "io/fs"
 	"io/ioutil"
 	"net/http"
 	"os"
 	"path"
+	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// Errors returned by the file system and the files opened from it,
+// usually wrapped in an *os.PathError, so they should be tested for
+// using errors.Is.
 var (
-	errNotImplemented   = errors.New("not implemented yet")
-	errFileClosed       = errors.New("file closed")
-	errFileSystemClosed = errors.New("filesystem closed")
-	errNotDirectory     = errors.New("not a directory")
-	errDirectory        = errors.New("is a directory")
+	// ErrClosed is returned when the file system has been closed.
+	ErrClosed = errors.New("filesystem closed")
+
+	// ErrFileClosed is returned when a file has been closed.
+	ErrFileClosed = errors.New("file closed")
+
+	// ErrNotDirectory is returned when a directory is
+	// expected, such as by Readdir, but a file is found.
+	ErrNotDirectory = errors.New("not a directory")
+
+	// ErrIsDirectory is returned when a file is
+	// expected, but a directory is found.
+	ErrIsDirectory = errors.New("is a directory")
+)
+
+var (
+	errNotImplemented     = errors.New("not implemented yet")
+	errInvalidWhence      = errors.New("invalid whence")
+	errNegativeOffset     = errors.New("negative offset")
+	errMethodNotAllowed   = errors.New("method not allowed")
+	errPreconditionFailed = errors.New("precondition failed")
+	errFileReplaced       = errors.New("file replaced")
+	errFileTooLarge       = errors.New("file too large")
 )
 
 // FileSystem is a file system based on a ZIP file.
 // It implements the http.FileSystem interface.
 type FileSystem struct {
+	name      string // the name of the ZIP file, if opened by New
 	readerAt  io.ReaderAt
+	size      int64
 	reader    *zip.Reader
 	closer    io.Closer
 	fileInfos fileInfoMap
+
+	// memorySeekLimit is the size of the largest file that is
+	// decompressed into memory to seek within it.
+	memorySeekLimit int64
+
+	// contentCache is set by WithContentCache.
+	contentCache *contentCache
+
+	// seekCache holds the contents decompressed for seeking that
+	// are not in contentCache, if memorySeekLimit is positive.
+	seekCache *contentCache
+
+	// mmap is set by WithMmap.
+	mmap bool
+
+	// handlePath and handleStat describe the ZIP file, if it is an
+	// *os.File, so that openAt can open it again. The path is absolute,
+	// in case the working directory changes. The handles that openAt
+	// has finished with are kept in idleHandles until Close.
+	handlePath    string
+	handleStat    os.FileInfo
+	handlesMutex  sync.Mutex
+	idleHandles   []*os.File
+	handlesClosed bool
+
+	// pinPatterns are set by WithPinned, and pinnedBytes is the
+	// size of the contents held in memory because of them.
+	pinPatterns []string
+	pinnedBytes int64
+
+	// seekInterval is the interval between checkpoints in the
+	// seek index for deflated files, or zero for no index.
+	seekInterval int64
+
+	// Counters for ExtractStats, updated atomically.
+	extractions  int64
+	extractWaits int64
+
+	// tempCacheDir is the directory used by WithPersistentTempCache.
+	tempCacheDir string
+
+	// dirsFirst and foldSort are set by WithDirsFirst and
+	// WithCaseInsensitiveSort, and control the order of Readdir.
+	dirsFirst bool
+	foldSort  bool
+
+	// listingFilter is set by WithListingFilter.
+	listingFilter func(fi os.FileInfo, dir string) bool
+
+	// contentTypes are set by WithContentTypes, keyed
+	// by extension in lower case.
+	contentTypes    map[string]string
+	contentTypeFunc func(name string, f *zip.File) string
+
+	// crcIndex holds the names of the files with each
+	// CRC-32, built by FindByCRC32.
+	crcIndex     map[uint32][]string
+	crcIndexOnce sync.Once
+
+	// stats is calculated by the first call to Stats.
+	stats     Stats
+	statsOnce sync.Once
 }
 
 // New will open the Zip file specified by name and
 // return a new FileSystem based on that Zip file.
-func New(name string) (*FileSystem, error) {
+func New(name string, opts ...Option) (*FileSystem, error) {
 	file, err := os.Open(name)
 	if err != nil {
 		return nil, err
 	}
 	fi, err := file.Stat()
 	if err != nil {
+		file.Close()
 		return nil, err
 	}
-	zipReader, err := zip.NewReader(file, fi.Size())
+	fs, err := newFileSystem(file, fi.Size(), file, opts...)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	fs.name = name
+	return fs, nil
+}
+
+// newFileSystem returns a new FileSystem based on the Zip file read
+// from readerAt, which is size bytes long. The closer, if not nil,
+// is closed when the FileSystem is closed.
+func newFileSystem(readerAt io.ReaderAt, size int64, closer io.Closer, opts ...Option) (*FileSystem, error) {
+	zipReader, err := zip.NewReader(readerAt, size)
 	if err != nil {
 		return nil, err
 	}
 	fs := &FileSystem{
-		closer:    file,
-		readerAt:  file,
+		closer:    closer,
+		readerAt:  readerAt,
+		size:      size,
 		reader:    zipReader,
 		fileInfos: fileInfoMap{},
+
+		memorySeekLimit: defaultMemorySeekLimit,
+	}
+	for _, opt := range opts {
+		opt(fs)
+	}
+	if file, ok := readerAt.(*os.File); ok {
+		stat, err := file.Stat()
+		if err == nil {
+			fs.handlePath, err = filepath.Abs(file.Name())
+		}
+		if err == nil {
+			fs.handleStat = stat
+		}
+	}
+	if fs.memorySeekLimit > 0 {
+		fs.seekCache = newSeekCache(fs.memorySeekLimit)
 	}
 
 	// Build a map of file paths to speed lookup.
@@ -61,22 +185,154 @@ func New(name string) (*FileSystem, error) {
 	// to attach each fileInfo to it's parent directory. Once again,
 	// reasonable if the ZIP file does not contain a very large number
 	// of entries.
+	linked := make(map[*fileInfo]bool)
 	for _, zf := range fs.reader.File {
 		fi := fs.fileInfos.FindOrCreate(zf.Name)
 		fi.zipFile = zf
-		dirEntry := fs.fileInfos.FindOrCreateParent(zf.Name)
-		dirEntry.fileInfos = append(dirEntry.fileInfos, fi)
+		fi.precompute(fs)
+		// Directories that have no entries of their own are
+		// attached to their parents along with the first file.
+		for name := zf.Name; name != "/" && !linked[fi]; {
+			linked[fi] = true
+			dirEntry := fs.fileInfos.FindOrCreateParent(name)
+			dirEntry.fileInfos = append(dirEntry.fileInfos, fi)
+			name, fi = dirEntry.name, dirEntry
+		}
 	}
 
 	for _, fi := range fs.fileInfos {
+		fi.fs = fs
 		if len(fi.fileInfos) > 1 {
 			sort.Sort(fi.fileInfos)
+			if fs.dirsFirst || fs.foldSort {
+				fi.listing = fs.listingOrder(fi.fileInfos)
+			}
+		}
+	}
+
+	if len(fs.pinPatterns) > 0 {
+		if err := fs.pin(); err != nil {
+			return nil, err
 		}
 	}
 
 	return fs, nil
 }
 
+// pin reads the files matching the patterns set by WithPinned into
+// memory, so that they are served without reading the ZIP file.
+func (fs *FileSystem) pin() error {
+	for _, zf := range fs.reader.File {
+		fi := fs.fileInfos[zf.Name]
+		if fi == nil || fi.zipFile != zf || fi.IsDir() || !fs.pinnedName("/"+zf.Name) {
+			continue
+		}
+		data, err := readZipFile(zf)
+		if err != nil {
+			return &os.PathError{Op: "Pin", Path: "/" + zf.Name, Err: err}
+		}
+		fi.pinned = data
+		fs.pinnedBytes += int64(len(data))
+		if zf.Method == zip.Store {
+			continue
+		}
+		// Keep the compressed contents too, for clients
+		// that accept them.
+		section, err := rawSection(fs.readerAt, zf)
+		if err == nil {
+			fi.pinnedRaw = make([]byte, section.Size())
+			_, err = io.ReadFull(section, fi.pinnedRaw)
+		}
+		if err != nil {
+			return &os.PathError{Op: "Pin", Path: "/" + zf.Name, Err: err}
+		}
+		fs.pinnedBytes += int64(len(fi.pinnedRaw))
+	}
+	return nil
+}
+
+// pinnedName reports whether the file at name matches
+// any of the patterns set by WithPinned.
+func (fs *FileSystem) pinnedName(name string) bool {
+	for _, pattern := range fs.pinPatterns {
+		if matchPath(pattern, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// PinnedBytes returns the size of the contents held in memory for the
+// files pinned by WithPinned, including the compressed contents of
+// those that are deflated.
+func (fs *FileSystem) PinnedBytes() int64 {
+	return fs.pinnedBytes
+}
+
+// maxIdleHandles is the number of handles on the ZIP file
+// that are kept open by releaseAt for reuse.
+const maxIdleHandles = 8
+
+// openAt returns a separate handle on the ZIP file, positioned at
+// offset, so that it can be read without disturbing other readers.
+// The handle should be passed to releaseAt when it is no longer
+// needed, so that it can be reused. It fails unless the ZIP file is an
+// *os.File, and the file at its path is still the same.
+func (fs *FileSystem) openAt(offset int64) (*os.File, error) {
+	file, err := fs.handle()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return file, nil
+}
+
+// handle returns an idle handle on the ZIP file, or opens a new one.
+func (fs *FileSystem) handle() (*os.File, error) {
+	fs.handlesMutex.Lock()
+	if n := len(fs.idleHandles); n > 0 {
+		file := fs.idleHandles[n-1]
+		fs.idleHandles = fs.idleHandles[:n-1]
+		fs.handlesMutex.Unlock()
+		return file, nil
+	}
+	fs.handlesMutex.Unlock()
+
+	if fs.handlePath == "" {
+		return nil, errNotImplemented
+	}
+	file, err := os.Open(fs.handlePath)
+	if err != nil {
+		return nil, err
+	}
+	stat, err := file.Stat()
+	if err == nil && !os.SameFile(fs.handleStat, stat) {
+		err = errFileReplaced
+	}
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return file, nil
+}
+
+// releaseAt keeps a handle returned by openAt for reuse,
+// or closes it if enough are kept already.
+func (fs *FileSystem) releaseAt(file *os.File) {
+	fs.handlesMutex.Lock()
+	if !fs.handlesClosed && len(fs.idleHandles) < maxIdleHandles {
+		fs.idleHandles = append(fs.idleHandles, file)
+		file = nil
+	}
+	fs.handlesMutex.Unlock()
+	if file != nil {
+		file.Close()
+	}
+}
+
 // Open implements the http.FileSystem interface.
 // A http.File is returned, which can be served by
 // the http.FileServer implementation.
@@ -89,11 +345,128 @@ func (fs *FileSystem) Open(name string) (http.File, error) {
 	return fi.openReader(name), nil
 }
 
+// ReadFile returns the contents of the file at name. As for Open, the
+// leading slash is optional. The contents are taken from the cache set
+// by WithContentCache, if there is one, but the result is always a new
+// slice, so it can be modified by the caller.
+func (fs *FileSystem) ReadFile(name string) ([]byte, error) {
+	fi, err := fs.openFileInfo(name)
+	if err != nil {
+		return nil, err
+	}
+	if fi.IsDir() {
+		return nil, &os.PathError{Op: "ReadFile", Path: name, Err: ErrIsDirectory}
+	}
+	var data []byte
+	if fi.pinned != nil {
+		data = append([]byte(nil), fi.pinned...)
+	} else if fs.contentCache != nil && fs.contentCache.cacheable(fi.Size()) {
+		data, err = fs.contentCache.load(fi)
+		data = append([]byte(nil), data...)
+	} else {
+		data, err = readZipFile(fi.zipFile)
+	}
+	if err != nil {
+		return nil, &os.PathError{Op: "ReadFile", Path: name, Err: err}
+	}
+	return data, nil
+}
+
+// Exists reports whether there is a file or directory at name. As for
+// Open, the leading slash is optional, but a name with a trailing slash
+// must be a directory. It returns false after the file system is closed.
+func (fs *FileSystem) Exists(name string) bool {
+	return fs.lookup(name) != nil
+}
+
+// IsDir reports whether there is a directory at name.
+func (fs *FileSystem) IsDir(name string) bool {
+	fi := fs.lookup(name)
+	return fi != nil && fi.IsDir()
+}
+
+// IsFile reports whether there is a regular file at name.
+func (fs *FileSystem) IsFile(name string) bool {
+	fi := fs.lookup(name)
+	return fi != nil && !fi.IsDir()
+}
+
+// lookup returns the file or directory at name, or nil if there is none.
+// Unlike openFileInfo, a name with a trailing slash only finds directories.
+func (fs *FileSystem) lookup(name string) *fileInfo {
+	fi := fs.fileInfos[strings.TrimLeft(path.Clean("/"+name), "/")]
+	if fi != nil && strings.HasSuffix(name, "/") && !fi.IsDir() {
+		return nil
+	}
+	return fi
+}
+
+// Names returns the names of all of the files in the file system, in
+// sorted order, such as "/img/circle.png". The result is a new slice,
+// so it can be modified by the caller.
+func (fs *FileSystem) Names() []string {
+	return fs.names("/", false)
+}
+
+// NamesWithPrefix returns the sorted names of the files with names
+// starting with prefix, such as "/img/" for the files in "/img" and its
+// subdirectories. The leading slash of the prefix is optional.
+func (fs *FileSystem) NamesWithPrefix(prefix string) []string {
+	return fs.names(prefix, false)
+}
+
+// Dirs returns the names of all of the directories in the file system,
+// not including the root, in sorted order, such as "/img". Directories
+// are included if they contain files, even if the ZIP file has no
+// entries for them.
+func (fs *FileSystem) Dirs() []string {
+	return fs.names("/", true)
+}
+
+// DirsWithPrefix returns the sorted names of the directories with names
+// starting with prefix. The leading slash of the prefix is optional.
+func (fs *FileSystem) DirsWithPrefix(prefix string) []string {
+	return fs.names(prefix, true)
+}
+
+// names returns the sorted names of the files, or the directories
+// if dirs is true, with names starting with prefix.
+func (fs *FileSystem) names(prefix string, dirs bool) []string {
+	if !strings.HasPrefix(prefix, "/") {
+		prefix = "/" + prefix
+	}
+	names := []string{}
+	for key, fi := range fs.fileInfos {
+		// Directories have two keys.
+		if key != fi.name || fi.IsDir() != dirs || key == "/" {
+			continue
+		}
+		name := "/" + strings.TrimSuffix(fi.name, "/")
+		if strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
 // Close closes the file system's underlying ZIP file and
 // releases all memory allocated to internal data structures.
 func (fs *FileSystem) Close() error {
+	for name, fi := range fs.fileInfos {
+		if name == fi.name {
+			fi.evictTempFile()
+		}
+	}
 	fs.reader = nil
 	fs.readerAt = nil
+	fs.handlesMutex.Lock()
+	fs.handlesClosed = true
+	for _, file := range fs.idleHandles {
+		file.Close()
+	}
+	fs.idleHandles = nil
+	fs.handlesMutex.Unlock()
 	var err error
 	if fs.closer != nil {
 		err = fs.closer.Close()
@@ -103,6 +476,27 @@ func (fs *FileSystem) Close() error {
 	return err
 }
 
+// ExtractStats contains counters for the extraction of compressed
+// files to temporary files, which is necessary in order to seek
+// within them.
+type ExtractStats struct {
+	// Extractions is the number of files extracted.
+	Extractions int64
+
+	// Shared is the number of times that a file was needed while
+	// it was being extracted, and so the same extraction was used.
+	Shared int64
+}
+
+// ExtractStats returns counters for the extraction of files
+// to temporary files.
+func (fs *FileSystem) ExtractStats() ExtractStats {
+	return ExtractStats{
+		Extractions: atomic.LoadInt64(&fs.extractions),
+		Shared:      atomic.LoadInt64(&fs.extractWaits),
+	}
+}
+
 type fileInfoList []*fileInfo
 
 func (fl fileInfoList) Len() int {
@@ -121,11 +515,32 @@ func (fl fileInfoList) Swap(i, j int) {
 	fl[j] = fi
 }
 
+// listingOrder returns a copy of the entries of a directory, sorted in
+// the order set by WithDirsFirst and WithCaseInsensitiveSort. Names that
+// are equal ignoring case are sorted by name, so the order is the same
+// each time.
+func (fs *FileSystem) listingOrder(entries fileInfoList) fileInfoList {
+	listing := append(fileInfoList(nil), entries...)
+	sort.SliceStable(listing, func(i, j int) bool {
+		a, b := listing[i], listing[j]
+		if fs.dirsFirst && a.IsDir() != b.IsDir() {
+			return a.IsDir()
+		}
+		if fs.foldSort {
+			if c := strings.Compare(strings.ToLower(a.Name()), strings.ToLower(b.Name())); c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	})
+	return listing
+}
+
 func (fs *FileSystem) openFileInfo(name string) (*fileInfo, error) {
+	name = path.Clean(name)
 	if fs.readerAt == nil {
-		return nil, errFileSystemClosed
+		return nil, &os.PathError{Op: "Open", Path: name, Err: ErrClosed}
 	}
-	name = path.Clean(name)
 	trimmedName := strings.TrimLeft(name, "/")
 	fi := fs.fileInfos[trimmedName]
 	if fi == nil {
@@ -167,12 +582,54 @@ func (fm fileInfoMap) FindOrCreateParent(name string) *fileInfo {
 
 // fileInfo implements the os.FileInfo interface.
 type fileInfo struct {
-	name      string
-	fs        *FileSystem
-	zipFile   *zip.File
-	fileInfos fileInfoList
-	tempPath  string
-	mutex     sync.Mutex
+	name       string
+	fs         *FileSystem
+	zipFile    *zip.File
+	fileInfos  fileInfoList
+	listing    fileInfoList // fileInfos in Readdir order, if not by name
+	tempPath   string
+	pinned     []byte // contents pinned by WithPinned
+	pinnedRaw  []byte // compressed contents pinned by WithPinned
+	tempRefs   int    // number of open handles to tempPath
+	tempStale  bool   // remove tempPath when the last handle is closed
+	extracting *extraction
+	mutex      sync.Mutex
+	seekIndex  *seekIndex
+
+	// digestValues are the base64 encoded digests of the content,
+	// keyed by algorithm, calculated when first needed.
+	digestValues map[string]string
+
+	// Header values calculated once for serving files over HTTP.
+	etag             string
+	contentType      string
+	unknownType      bool // contentType is assumed
+	contentLength    string
+	compressedLength string
+}
+
+// precompute calculates the header values used when serving
+// the file, so that they are not calculated for each request.
+func (fi *fileInfo) precompute(fs *FileSystem) {
+	if fi.IsDir() {
+		return
+	}
+	fi.etag = calcEtag(fi.zipFile)
+	if fs.contentTypeFunc != nil {
+		fi.contentType = fs.contentTypeFunc("/"+fi.name, fi.zipFile)
+	}
+	if fi.contentType == "" {
+		fi.contentType = fs.contentTypeByName(fi.name)
+	}
+	if fi.contentType == "" {
+		// the standard library sniffs content to decide whether it is
+		// binary or text, but this requires a ReaderSeeker, and we
+		// only have a reader from the zip file. Assume binary.
+		fi.contentType = "application/octet-stream"
+		fi.unknownType = true
+	}
+	fi.contentLength = strconv.FormatInt(fi.Size(), 10)
+	fi.compressedLength = strconv.FormatInt(compressedSize(fi.zipFile), 10)
 }
 
 func (fi *fileInfo) Name() string {
@@ -217,31 +674,305 @@ func (fi *fileInfo) Sys() interface{} {
 }
 
 func (fi *fileInfo) openReader(name string) *fileReader {
-	return &fileReader{
+	f := &fileReader{
 		fileInfo: fi,
 		name:     name,
 	}
+	if fi.pinned != nil {
+		f.content = bytes.NewReader(fi.pinned)
+	}
+	return f
+}
+
+// hasTempFile reports whether the contents of the file have been
+// extracted to a temporary file that can be reused.
+func (fi *fileInfo) hasTempFile() bool {
+	fi.mutex.Lock()
+	defer fi.mutex.Unlock()
+	return fi.tempPath != "" && !fi.tempStale
+}
+
+// indexedReader returns a reader providing random access to the file
+// using its seek index, which is built the first time it is needed.
+// It returns nil if the file system does not use seek indexes,
+// or if the file is not compressed using deflate.
+func (fi *fileInfo) indexedReader() (*indexedReader, error) {
+	if fi.fs == nil || fi.fs.seekInterval <= 0 || fi.zipFile == nil || fi.zipFile.Method != zip.Deflate {
+		return nil, nil
+	}
+	compressed, err := rawSection(fi.fs.readerAt, fi.zipFile)
+	if err != nil {
+		return nil, err
+	}
+
+	fi.mutex.Lock()
+	defer fi.mutex.Unlock()
+	if fi.seekIndex == nil {
+		index, err := buildSeekIndex(compressed, fi.Size(), fi.fs.seekInterval)
+		if err != nil {
+			return nil, err
+		}
+		fi.seekIndex = index
+		compressed.Seek(0, io.SeekStart)
+	}
+
+	return &indexedReader{
+		compressed: compressed,
+		size:       fi.Size(),
+		index:      fi.seekIndex,
+	}, nil
+}
+
+// openTempFile returns the contents of the file extracted to a temporary
+// file. The file is extracted once and shared by all readers, and if the
+// file is already being extracted then openTempFile waits for the
+// extraction to finish, or for ctx to be done. An extraction started by
+// openTempFile is abandoned if ctx is done, and is restarted by any
+// others waiting for it. Each file returned must be released by calling
+// releaseTempFile.
+func (fi *fileInfo) openTempFile(ctx context.Context) (*os.File, error) {
+	fi.mutex.Lock()
+	for {
+		if fi.tempPath != "" && !fi.tempStale {
+			file, err := os.Open(fi.tempPath)
+			if err == nil {
+				fi.tempRefs++
+				fi.mutex.Unlock()
+				return file, nil
+			}
+			// The temporary file has been removed by someone else,
+			// so extract the file again.
+		}
+		e := fi.extracting
+		if e == nil {
+			break
+		}
+		fi.mutex.Unlock()
+		if fi.fs != nil {
+			atomic.AddInt64(&fi.fs.extractWaits, 1)
+		}
+		select {
+		case <-e.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if e.err != nil && !isContextError(e.err) {
+			return nil, e.err
+		}
+		fi.mutex.Lock()
+	}
+
+	e := &extraction{done: make(chan struct{})}
+	fi.extracting = e
+	fi.mutex.Unlock()
+
+	file, err := fi.extract(ctx)
+
+	fi.mutex.Lock()
+	defer fi.mutex.Unlock()
+	fi.extracting = nil
+	e.err = err
+	close(e.done)
+	if err != nil {
+		return nil, err
+	}
+	if fi.tempPath != "" && fi.tempRefs == 0 && fi.tempCacheDir() == "" {
+		os.Remove(fi.tempPath)
+	}
+	fi.tempPath = file.Name()
+	fi.tempRefs = 1
+	fi.tempStale = false
+	return file, nil
+}
+
+// tempCacheDir returns the directory of the persistent
+// cache of extracted files, if there is one.
+func (fi *fileInfo) tempCacheDir() string {
+	if fi.fs == nil {
+		return ""
+	}
+	return fi.fs.tempCacheDir
+}
+
+// extract extracts the file to a temporary file. If the file system
+// has a persistent cache, the file is extracted to the cache directory,
+// unless it is already there. The extraction stops if ctx is done.
+func (fi *fileInfo) extract(ctx context.Context) (*os.File, error) {
+	dir := fi.tempCacheDir()
+	if dir == "" {
+		if fi.fs != nil {
+			atomic.AddInt64(&fi.fs.extractions, 1)
+		}
+		return createTempFile(ctx, fi.zipFile, "")
+	}
+
+	// Files are named after their contents, so that they can be
+	// found again by another FileSystem. A file of the wrong size
+	// is assumed to be incomplete, and is replaced.
+	name := filepath.Join(dir, fmt.Sprintf("%08x-%d.bin", fi.zipFile.CRC32, fi.Size()))
+	if stat, err := os.Stat(name); err == nil && stat.Mode().IsRegular() && stat.Size() == fi.Size() {
+		if file, err := os.Open(name); err == nil {
+			return file, nil
+		}
+	}
+
+	atomic.AddInt64(&fi.fs.extractions, 1)
+	tempFile, err := createTempFile(ctx, fi.zipFile, dir)
+	if err != nil {
+		return nil, err
+	}
+	tempFile.Close()
+	if err := os.Rename(tempFile.Name(), name); err != nil {
+		os.Remove(tempFile.Name())
+		return nil, err
+	}
+	return os.Open(name)
+}
+
+// extraction is an extraction of a file to a
+// temporary file that is in progress.
+type extraction struct {
+	done chan struct{} // closed when the extraction has finished
+	err  error
+}
+
+// isContextError reports whether err is the result of
+// a context being canceled or passing its deadline.
+func isContextError(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// memoryContent returns the contents of the file, decompressing them
+// unless they are pinned or cached. The contents are held in the content
+// cache, if it can hold them, and otherwise in the cache for seeking.
+// They are shared by every reader, so they must not be modified.
+func (fi *fileInfo) memoryContent() ([]byte, error) {
+	if fi.pinned != nil {
+		return fi.pinned, nil
+	}
+	if cache := fi.fs.contentCache; cache != nil && cache.cacheable(fi.Size()) {
+		return cache.load(fi)
+	}
+	if cache := fi.fs.seekCache; cache != nil {
+		return cache.load(fi)
+	}
+	return readZipFile(fi.zipFile)
+}
+
+// mapTempFile maps a file returned by openTempFile into memory, if
+// WithMmap is set and the platform supports it, and otherwise returns
+// nil. The mapping must be removed by munmap.
+func (fi *fileInfo) mapTempFile(file *os.File) []byte {
+	if !fi.fs.mmap {
+		return nil
+	}
+	data, err := mmapFile(file)
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+// releaseTempFile closes a file returned by openTempFile. If the
+// temporary file has been evicted, it is removed once it is no longer
+// in use.
+func (fi *fileInfo) releaseTempFile(file *os.File) error {
+	err := file.Close()
+	fi.mutex.Lock()
+	defer fi.mutex.Unlock()
+	if fi.tempCacheDir() != "" {
+		// Files in the persistent cache are never removed.
+		if file.Name() == fi.tempPath {
+			fi.tempRefs--
+		}
+		return err
+	}
+	if file.Name() != fi.tempPath {
+		// An older temporary file that has already been replaced.
+		if removeErr := os.Remove(file.Name()); err == nil && !os.IsNotExist(removeErr) {
+			err = removeErr
+		}
+		return err
+	}
+	fi.tempRefs--
+	if fi.tempStale && fi.tempRefs == 0 {
+		if removeErr := os.Remove(fi.tempPath); err == nil {
+			err = removeErr
+		}
+		fi.tempPath = ""
+		fi.tempStale = false
+	}
+	return err
+}
+
+// evictTempFile removes the temporary file containing the contents of
+// the file. If the temporary file is in use then it is removed when
+// the last reader releases it.
+func (fi *fileInfo) evictTempFile() {
+	fi.mutex.Lock()
+	defer fi.mutex.Unlock()
+	if fi.tempPath == "" {
+		return
+	}
+	if fi.tempCacheDir() != "" {
+		fi.tempPath = ""
+		fi.tempRefs = 0
+		return
+	}
+	if fi.tempRefs > 0 {
+		fi.tempStale = true
+		return
+	}
+	os.Remove(fi.tempPath)
+	fi.tempPath = ""
 }
 
 func (fi *fileInfo) readdir() ([]os.FileInfo, error) {
 	if !fi.Mode().IsDir() {
-		return nil, errNotDirectory
+		return nil, ErrNotDirectory
 	}
 
-	v := make([]os.FileInfo, len(fi.fileInfos))
-	for i, fi := range fi.fileInfos {
-		v[i] = fi
+	entries := fi.entries()
+	v := make([]os.FileInfo, 0, len(entries))
+	for _, entry := range entries {
+		if fi.listed(entry) {
+			v = append(v, entry)
+		}
 	}
 	return v, nil
 }
 
+// entries returns the entries of a directory in the order
+// returned by Readdir, including those left out by the filter.
+func (fi *fileInfo) entries() fileInfoList {
+	if fi.listing != nil {
+		return fi.listing
+	}
+	return fi.fileInfos
+}
+
+// listed reports whether the entry of the directory passes
+// the filter set by WithListingFilter.
+func (fi *fileInfo) listed(entry *fileInfo) bool {
+	filter := fi.fs.listingFilter
+	return filter == nil || filter(entry, "/"+strings.Trim(fi.name, "/"))
+}
+
 type fileReader struct {
 	name     string // the name used to open
 	fileInfo *fileInfo
 	reader   io.ReadCloser
-	file     *os.File
+	content  io.ReadSeeker // the contents, in memory or in file
+	file     *os.File      // the temporary file, if any
+	mapped   []byte        // file mapped into memory, if any
 	closed   bool
-	readdir  []os.FileInfo
+	dirIndex int   // index of the next entry returned by Readdir
+	offset   int64 // position in the file, of reader or file
+
+	readAtMutex  sync.RWMutex // held for reading during ReadAt
+	readAt       io.ReaderAt  // source for ReadAt, created by the first call
+	readAtFile   *os.File     // temporary file opened for ReadAt
+	readAtMapped []byte       // readAtFile mapped into memory, if any
 }
 
 func (f *fileReader) Close() error {
@@ -250,16 +981,28 @@ func (f *fileReader) Close() error {
 		err := f.reader.Close()
 		errs = append(errs, err)
 	}
-	var tempFile string
+	if f.mapped != nil {
+		errs = append(errs, munmap(f.mapped))
+		f.mapped = nil
+	}
 	if f.file != nil {
-		tempFile = f.file.Name()
-		err := f.file.Close()
+		err := f.fileInfo.releaseTempFile(f.file)
 		errs = append(errs, err)
+		f.file = nil
 	}
-	if tempFile != "" {
-		err := os.Remove(tempFile)
+	f.content = nil
+	f.readAtMutex.Lock()
+	if f.readAtMapped != nil {
+		errs = append(errs, munmap(f.readAtMapped))
+		f.readAtMapped = nil
+	}
+	if f.readAtFile != nil {
+		err := f.fileInfo.releaseTempFile(f.readAtFile)
 		errs = append(errs, err)
+		f.readAtFile = nil
 	}
+	f.readAt = nil
+	f.readAtMutex.Unlock()
 
 	f.closed = true
 
@@ -273,101 +1016,419 @@ func (f *fileReader) Close() error {
 
 func (f *fileReader) Read(p []byte) (n int, err error) {
 	if f.closed {
-		return 0, f.pathError("Read", errFileClosed)
+		return 0, f.pathError("Read", ErrFileClosed)
 	}
-	if f.file != nil {
-		return f.file.Read(p)
+	if f.fileInfo.IsDir() {
+		return 0, f.pathError("Read", ErrIsDirectory)
+	}
+	if f.content != nil {
+		n, err = f.content.Read(p)
+		f.offset += int64(n)
+		return n, f.pathError("Read", err)
 	}
 	if f.reader == nil {
 		f.reader, err = f.fileInfo.zipFile.Open()
 		if err != nil {
-			return 0, err
+			return 0, f.pathError("Read", err)
+		}
+		f.offset = 0
+	}
+	n, err = f.reader.Read(p)
+	f.offset += int64(n)
+	return n, f.pathError("Read", err)
+}
+
+// WriteTo writes the rest of the file to w, and implements io.WriterTo
+// so that io.Copy does not need a buffer of its own. Stored files are
+// copied directly from the ZIP file, so that w can use io.ReaderFrom.
+func (f *fileReader) WriteTo(w io.Writer) (int64, error) {
+	if f.closed {
+		return 0, f.pathError("WriteTo", ErrFileClosed)
+	}
+	if f.fileInfo.IsDir() {
+		return 0, f.pathError("WriteTo", ErrIsDirectory)
+	}
+	if f.content != nil {
+		n, err := io.Copy(w, f.content)
+		f.offset += n
+		return n, f.pathError("WriteTo", err)
+	}
+	if f.fileInfo.zipFile.Method == zip.Store && f.fileInfo.fs.readerAt != nil {
+		return f.writeStoredTo(w)
+	}
+
+	buf := bufPool.Get()
+	defer bufPool.Free(buf)
+	var written int64
+	for {
+		n, err := f.Read(buf)
+		if n > 0 {
+			m, werr := w.Write(buf[:n])
+			written += int64(m)
+			if werr != nil {
+				return written, f.pathError("WriteTo", werr)
+			}
+			if m < n {
+				return written, f.pathError("WriteTo", io.ErrShortWrite)
+			}
+		}
+		if err == io.EOF {
+			return written, nil
+		}
+		if err != nil {
+			return written, f.pathError("WriteTo", err)
 		}
 	}
-	return f.reader.Read(p)
+}
+
+// writeStoredTo copies the rest of a stored file from the ZIP file to w,
+// and leaves the reader at the position after the last byte written.
+func (f *fileReader) writeStoredTo(w io.Writer) (int64, error) {
+	var offset int64
+	if f.reader != nil {
+		offset = f.offset
+	}
+	section, err := rawSection(f.fileInfo.fs.readerAt, f.fileInfo.zipFile)
+	if err != nil {
+		return 0, f.pathError("WriteTo", err)
+	}
+	rest := io.NewSectionReader(section, offset, section.Size()-offset)
+	n, err := io.Copy(w, rest)
+	if f.reader != nil {
+		f.reader.Close()
+	}
+	f.reader = io.NopCloser(rest)
+	f.offset = offset + n
+	return n, f.pathError("WriteTo", err)
+}
+
+// ReadAt reads len(p) bytes starting at offset off in the file. It
+// does not change the position used by Read and Seek, and it can be
+// called from more than one goroutine at a time. Stored files are read
+// directly from the ZIP file, and compressed files from a temporary
+// file, which is created by the first call if necessary.
+func (f *fileReader) ReadAt(p []byte, off int64) (int, error) {
+	if f.closed {
+		return 0, f.pathError("ReadAt", ErrFileClosed)
+	}
+	if off < 0 {
+		return 0, f.pathError("ReadAt", errNegativeOffset)
+	}
+	if err := f.openReaderAt(); err != nil {
+		return 0, f.pathError("ReadAt", err)
+	}
+	// The lock keeps Close from unmapping the file during the read.
+	f.readAtMutex.RLock()
+	defer f.readAtMutex.RUnlock()
+	if f.readAt == nil {
+		return 0, f.pathError("ReadAt", ErrFileClosed)
+	}
+	n, err := f.readAt.ReadAt(p, off)
+	return n, f.pathError("ReadAt", err)
+}
+
+// openReaderAt creates the source for ReadAt, if necessary.
+func (f *fileReader) openReaderAt() error {
+	f.readAtMutex.Lock()
+	defer f.readAtMutex.Unlock()
+	if f.closed {
+		return ErrFileClosed
+	}
+	if f.readAt != nil {
+		return nil
+	}
+	fi := f.fileInfo
+	if fi.IsDir() {
+		return ErrIsDirectory
+	}
+	if fi.pinned != nil {
+		f.readAt = bytes.NewReader(fi.pinned)
+		return nil
+	}
+	if fi.fs.readerAt == nil {
+		return ErrClosed
+	}
+	if fi.zipFile.Method == zip.Store {
+		section, err := rawSection(fi.fs.readerAt, fi.zipFile)
+		if err != nil {
+			return err
+		}
+		f.readAt = section
+		return nil
+	}
+	if fi.Size() <= fi.fs.memorySeekLimit {
+		data, err := fi.memoryContent()
+		if err != nil {
+			return err
+		}
+		f.readAt = bytes.NewReader(data)
+		return nil
+	}
+	// A separate handle, so that reads through it do not move the
+	// position of f.file.
+	file, err := fi.openTempFile(context.Background())
+	if err != nil {
+		return err
+	}
+	f.readAtFile = file
+	f.readAt = file
+	if data := fi.mapTempFile(file); data != nil {
+		f.readAtMapped = data
+		f.readAt = bytes.NewReader(data)
+	}
+	return nil
 }
 
 func (f *fileReader) Seek(offset int64, whence int) (int64, error) {
 	if f.closed {
-		return 0, f.pathError("Seek", errFileClosed)
+		return 0, f.pathError("Seek", ErrFileClosed)
+	}
+	if f.fileInfo.IsDir() {
+		// As for os.File, seeking to the start of a directory
+		// restarts Readdir.
+		if offset == 0 && whence == io.SeekStart {
+			f.dirIndex = 0
+			return 0, nil
+		}
+		return 0, f.pathError("Seek", ErrIsDirectory)
+	}
+
+	target, err := f.seekTarget(offset, whence)
+	if err != nil {
+		return 0, f.pathError("Seek", err)
+	}
+
+	// Asking for the position, or seeking to it, leaves the reader
+	// as it is.
+	if target == f.offset {
+		return target, nil
+	}
+
+	// The size is known, so seeking to the end, as is done to find
+	// the size, or after it, needs nothing to be read. Reads from
+	// there return io.EOF.
+	if f.content == nil && target >= f.fileInfo.Size() {
+		if f.reader != nil {
+			if err := f.reader.Close(); err != nil {
+				return 0, f.pathError("Seek", err)
+			}
+		}
+		f.reader = endReader{}
+		f.offset = target
+		return target, nil
+	}
+
+	// A short distance forward is skipped by reading, rather than
+	// by extracting the file.
+	if f.content == nil && target > f.offset && target-f.offset <= maxSeekSkip {
+		return f.skip(target)
 	}
 
 	// The reader cannot seek, so close it.
 	if f.reader != nil {
-		if err := f.reader.Close(); err != nil {
-			return 0, err
+		err := f.reader.Close()
+		f.reader = nil
+		f.offset = 0
+		if err != nil {
+			return 0, f.pathError("Seek", err)
 		}
 	}
 
 	// A special case for when there is no file created and the seek is
 	// to the beginning of the file. Just open (or re-open) the reader
 	// at the beginning of the file.
-	if f.file == nil && offset == 0 && whence == 0 {
-		var err error
+	if f.content == nil && target == 0 {
 		f.reader, err = f.fileInfo.zipFile.Open()
-		return 0, err
+		f.offset = 0
+		return 0, f.pathError("Seek", err)
 	}
 
-	if err := f.createTempFile(); err != nil {
-		return 0, err
+	// If the file has a seek index, restart decompression from
+	// the nearest checkpoint rather than extracting the file.
+	if f.content == nil {
+		ir, err := f.fileInfo.indexedReader()
+		if err != nil {
+			return 0, f.pathError("Seek", err)
+		}
+		if ir != nil {
+			return f.seekIndexed(ir, target)
+		}
 	}
 
-	return f.file.Seek(offset, whence)
+	if err := f.openContent(); err != nil {
+		return 0, f.pathError("Seek", err)
+	}
+
+	n, err := f.content.Seek(target, io.SeekStart)
+	f.offset = n
+	return n, f.pathError("Seek", err)
 }
 
-func (f *fileReader) Readdir(count int) ([]os.FileInfo, error) {
-	var err error
-	var osFileInfos []os.FileInfo
+// endReader is the reader of a file after Seek has moved to its end.
+type endReader struct{}
 
-	if count > 0 {
-		if f.readdir == nil {
-			f.readdir, err = f.fileInfo.readdir()
-			if err != nil {
-				return nil, f.pathError("Readdir", err)
-			}
-		}
-		if len(f.readdir) >= count {
-			osFileInfos = f.readdir[0:count]
-			f.readdir = f.readdir[count:]
-		} else {
-			osFileInfos = f.readdir
-			f.readdir = nil
-			err = io.EOF
-		}
-	} else {
-		osFileInfos, err = f.fileInfo.readdir()
+func (endReader) Read(p []byte) (int, error) {
+	return 0, io.EOF
+}
+
+func (endReader) Close() error {
+	return nil
+}
+
+// maxSeekSkip is the furthest that Seek moves forward in a file by
+// reading and discarding its contents. Further seeks extract the file
+// to a temporary file, or use its seek index.
+const maxSeekSkip = 1 << 20
+
+// seekTarget returns the offset that a call to Seek would move the
+// reader to, without changing its position.
+func (f *fileReader) seekTarget(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += f.fileInfo.Size()
+	default:
+		return 0, errInvalidWhence
+	}
+	if offset < 0 {
+		return 0, errNegativeOffset
+	}
+	return offset, nil
+}
+
+// skip moves the reader forward to target by reading and discarding
+// the contents of the file before it.
+func (f *fileReader) skip(target int64) (int64, error) {
+	if f.reader == nil {
+		reader, err := f.fileInfo.zipFile.Open()
 		if err != nil {
-			return nil, f.pathError("Readdir", err)
+			return 0, f.pathError("Seek", err)
+		}
+		f.reader = reader
+		f.offset = 0
+	}
+	n, err := io.CopyN(io.Discard, f.reader, target-f.offset)
+	f.offset += n
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return f.offset, f.pathError("Seek", err)
+	}
+	return target, nil
+}
+
+func (f *fileReader) seekIndexed(ir *indexedReader, offset int64) (int64, error) {
+	reader, err := ir.open(offset)
+	if err != nil {
+		f.reader = nil
+		f.offset = 0
+		return 0, f.pathError("Seek", err)
+	}
+	f.reader = reader
+	f.offset = offset
+	return offset, nil
+}
+
+// Readdir returns the entries of the directory, as for os.File. If
+// count > 0 it returns at most count entries, continuing from the
+// previous call, and io.EOF at the end of the directory. Otherwise it
+// returns all of the remaining entries, and no error at the end.
+func (f *fileReader) Readdir(count int) ([]os.FileInfo, error) {
+	fi := f.fileInfo
+	if !fi.Mode().IsDir() {
+		return nil, f.pathError("Readdir", ErrNotDirectory)
+	}
+
+	// The entries are read from the directory as they are returned,
+	// so that reading a large directory in pages does not copy it.
+	entries := fi.entries()
+	remaining := len(entries) - f.dirIndex
+	all := count <= 0
+	if all || count > remaining {
+		count = remaining
+	}
+	infos := make([]os.FileInfo, 0, count)
+	for len(infos) < count && f.dirIndex < len(entries) {
+		entry := entries[f.dirIndex]
+		f.dirIndex++
+		if fi.listed(entry) {
+			infos = append(infos, entry)
 		}
 	}
+	if len(infos) == 0 && !all {
+		return nil, io.EOF
+	}
+	return infos, nil
+}
 
-	return osFileInfos, err
+// ReadDir returns the entries of the directory, and implements
+// fs.ReadDirFile. It continues from the same position as Readdir, so
+// the two can be mixed.
+func (f *fileReader) ReadDir(count int) ([]iofs.DirEntry, error) {
+	infos, err := f.Readdir(count)
+	if err != nil {
+		return nil, f.pathError("ReadDir", err)
+	}
+	entries := make([]iofs.DirEntry, len(infos))
+	for i, info := range infos {
+		entries[i] = iofs.FileInfoToDirEntry(info)
+	}
+	return entries, nil
 }
 
 func (f *fileReader) Stat() (os.FileInfo, error) {
 	return f.fileInfo, nil
 }
 
-func (f *fileReader) createTempFile() error {
+// openContent makes the file seekable, by decompressing it into memory
+// if it is no larger than the limit set by WithMemorySeekLimit, and
+// otherwise by extracting it to a temporary file.
+func (f *fileReader) openContent() error {
 	if f.reader != nil {
 		if err := f.reader.Close(); err != nil {
 			return err
 		}
 		f.reader = nil
 	}
-	if f.file == nil {
-		// Open a file that contains the contents of the zip file.
-		osFile, err := createTempFile(f.fileInfo.zipFile)
+	if f.content != nil {
+		return nil
+	}
+	fi := f.fileInfo
+	if fi.Size() <= fi.fs.memorySeekLimit {
+		data, err := fi.memoryContent()
 		if err != nil {
 			return err
 		}
-
-		f.file = osFile
+		f.content = bytes.NewReader(data)
+		return nil
+	}
+	file, err := fi.openTempFile(context.Background())
+	if err != nil {
+		return err
+	}
+	f.file = file
+	f.content = file
+	if data := fi.mapTempFile(file); data != nil {
+		f.mapped = data
+		f.content = bytes.NewReader(data)
 	}
 	return nil
 }
 
+// pathError returns err in an *os.PathError with the operation op and
+// the name used to open the file, or an error already returned for the
+// file with its operation replaced. It returns nil and io.EOF unchanged,
+// because callers compare them directly.
 func (f *fileReader) pathError(op string, err error) error {
+	if err == nil || err == io.EOF {
+		return err
+	}
+	if pathErr, ok := err.(*os.PathError); ok && pathErr.Path == f.name {
+		err = pathErr.Err
+	}
 	return &os.PathError{
 		Op:   op,
 		Path: f.name,
@@ -375,21 +1436,47 @@ func (f *fileReader) pathError(op string, err error) error {
 	}
 }
 
+// readZipFile returns the uncompressed contents of the zip file.
+func readZipFile(f *zip.File) ([]byte, error) {
+	reader, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	data := make([]byte, uncompressedSize(f))
+	if _, err := io.ReadFull(reader, data); err != nil {
+		return nil, err
+	}
+	// Read to the end, so that the checksum is verified.
+	if _, err := io.Copy(io.Discard, reader); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// tempFileCount is the number of temporary files created
+// by createTempFile. It is used for testing.
+var tempFileCount int64
+
 // createTempFile creates a temporary file with the contents of the
-// zip file. Used to implement io.Seeker interface.
-func createTempFile(f *zip.File) (*os.File, error) {
+// zip file in dir, or the default directory for temporary files if
+// dir is empty. Used to implement io.Seeker interface. If ctx is done
+// before the copy is complete, the temporary file is removed.
+func createTempFile(ctx context.Context, f *zip.File, dir string) (*os.File, error) {
+	atomic.AddInt64(&tempFileCount, 1)
 	reader, err := f.Open()
 	if err != nil {
 		return nil, err
 	}
 	defer reader.Close()
 
-	tempFile, err := ioutil.TempFile("", "zipfs")
+	tempFile, err := ioutil.TempFile(dir, "zipfs")
 	if err != nil {
 		return nil, err
 	}
 
-	_, err = io.Copy(tempFile, reader)
+	_, err = io.Copy(&trackingWriter{w: tempFile, ctx: ctx}, reader)
 	if err != nil {
 		tempFile.Close()
 		os.Remove(tempFile.Name())
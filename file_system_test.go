@@ -2,17 +2,81 @@ package zipfs
 
 import (
 	"archive/zip"
+	"bytes"
+	"context"
 	"crypto/md5"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	iofs "io/fs"
 	"os"
+	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"testing/fstest"
+	"time"
 
+	"github.com/spexp/zipfs/zipfstest"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
+// newTestFileSystem creates a ZIP file containing files, which maps
+// names to contents, and returns a FileSystem based on it. Names
+// ending in a slash are directories. Files are compressed using the
+// deflate method unless their name ends in ".dat".
+func newTestFileSystem(t testing.TB, files map[string]string, opts ...Option) *FileSystem {
+	t.Helper()
+	name := filepath.Join(t.TempDir(), "test.zip")
+	f, err := os.Create(name)
+	require.NoError(t, err)
+
+	var names []string
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	zw := zip.NewWriter(f)
+	modTime := time.Date(2020, 1, 2, 3, 4, 6, 0, time.UTC)
+	for _, name := range names {
+		fh := &zip.FileHeader{
+			Name:     name,
+			Method:   zip.Deflate,
+			Modified: modTime,
+		}
+		if strings.HasSuffix(name, "/") || strings.HasSuffix(name, ".dat") {
+			fh.Method = zip.Store
+		}
+		w, err := zw.CreateHeader(fh)
+		require.NoError(t, err)
+		_, err = io.WriteString(w, files[name])
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+	require.NoError(t, f.Close())
+
+	fs, err := New(name, opts...)
+	require.NoError(t, err)
+	t.Cleanup(func() { fs.Close() })
+	return fs
+}
+
+// newBuilderFileSystem returns a file system for the ZIP file built by b.
+func newBuilderFileSystem(t testing.TB, b *zipfstest.Builder) *FileSystem {
+	t.Helper()
+	data, err := b.Bytes()
+	require.NoError(t, err)
+	fs, err := newFileSystem(bytes.NewReader(data), int64(len(data)), nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { fs.Close() })
+	return fs
+}
+
 func TestFileSystem(t *testing.T) {
 	assert := assert.New(t)
 	require := require.New(t)
@@ -64,9 +128,9 @@ func TestOpen(t *testing.T) {
 			// testing error after closing
 			var buf [50]byte
 			_, err := f.Read(buf[:])
-			assert.Error(err)
+			assert.True(errors.Is(err, ErrFileClosed), err)
 			_, err = f.Seek(20, 0)
-			assert.Error(err)
+			assert.True(errors.Is(err, ErrFileClosed), err)
 		} else {
 			assert.Error(err)
 			assert.True(strings.Contains(err.Error(), tc.Error), err.Error())
@@ -79,7 +143,97 @@ func TestOpen(t *testing.T) {
 	f, err := fs.Open("/img/circle.png")
 	assert.Error(err)
 	assert.Nil(f)
-	assert.True(strings.Contains(err.Error(), "filesystem closed"), err.Error())
+	assert.True(errors.Is(err, ErrClosed), err)
+	assert.True(strings.Contains(err.Error(), "/img/circle.png"), err.Error())
+}
+
+func TestExists(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	fs, err := New("testdata/testdata.zip")
+	require.NoError(err)
+
+	testCases := []struct {
+		Path   string
+		Exists bool
+		IsDir  bool
+	}{
+		{Path: "/img/circle.png", Exists: true},
+		{Path: "img/circle.png", Exists: true},
+		{Path: "/img/circle.png/", Exists: false},
+		{Path: "/img", Exists: true, IsDir: true},
+		{Path: "img/", Exists: true, IsDir: true},
+		{Path: "/img/", Exists: true, IsDir: true},
+		{Path: "/empty", Exists: true, IsDir: true},
+		{Path: "/", Exists: true, IsDir: true},
+		{Path: "", Exists: true, IsDir: true},
+		{Path: "/img/../index.html", Exists: true},
+		{Path: "//img//circle.png", Exists: true},
+		{Path: "/does/not/exist", Exists: false},
+		{Path: "/img/circle", Exists: false},
+		{Path: "/IMG/circle.png", Exists: false},
+		{Path: "\x00junk", Exists: false},
+	}
+	for _, tc := range testCases {
+		assert.Equal(tc.Exists, fs.Exists(tc.Path), tc.Path)
+		assert.Equal(tc.Exists && tc.IsDir, fs.IsDir(tc.Path), tc.Path)
+		assert.Equal(tc.Exists && !tc.IsDir, fs.IsFile(tc.Path), tc.Path)
+	}
+
+	// safe for concurrent use
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for _, tc := range testCases {
+				assert.Equal(tc.Exists, fs.Exists(tc.Path), tc.Path)
+			}
+		}()
+	}
+	wg.Wait()
+
+	require.NoError(fs.Close())
+	for _, tc := range testCases {
+		assert.False(fs.Exists(tc.Path), tc.Path)
+		assert.False(fs.IsDir(tc.Path), tc.Path)
+		assert.False(fs.IsFile(tc.Path), tc.Path)
+	}
+}
+
+func TestNames(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	fs, err := New("testdata/testdata.zip")
+	require.NoError(err)
+
+	var lotsOfFiles []string
+	for i := 1; i <= 20; i++ {
+		lotsOfFiles = append(lotsOfFiles, fmt.Sprintf("/lots-of-files/file-%02d", i))
+	}
+	names := fs.Names()
+	assert.Equal(append(append([]string{
+		"/img/another-circle.png",
+		"/img/circle.png",
+		"/index.html",
+		"/js/application-23a0..js",
+	}, lotsOfFiles...), "/not-a-zip-file.txt", "/random.dat", "/test.html"), names)
+	assert.Equal(fs.Names(), fs.NamesWithPrefix("/"))
+	assert.Equal(lotsOfFiles, fs.NamesWithPrefix("lots-of-files/"))
+	assert.Equal([]string{"/img/another-circle.png", "/img/circle.png"}, fs.NamesWithPrefix("/img/"))
+	assert.Equal([]string{"/index.html"}, fs.NamesWithPrefix("/index"))
+	assert.Equal([]string{}, fs.NamesWithPrefix("/missing/"))
+
+	assert.Equal([]string{"/empty", "/img", "/js", "/lots-of-files"}, fs.Dirs())
+	assert.Equal([]string{"/img"}, fs.DirsWithPrefix("/i"))
+
+	// the result is a snapshot that can be modified
+	names[0] = "changed"
+	assert.Equal("/img/another-circle.png", fs.Names()[0])
+
+	require.NoError(fs.Close())
+	assert.Empty(fs.Names())
+	assert.Empty(fs.Dirs())
 }
 
 func TestReaddir(t *testing.T) {
@@ -91,20 +245,18 @@ func TestReaddir(t *testing.T) {
 	testCases := []struct {
 		Path  string
 		Count int
-		Error string
+		Err   error
 		Files []string
 	}{
 		{
-			Path:  "/img",
-			Error: "",
+			Path: "/img",
 			Files: []string{
 				"another-circle.png",
 				"circle.png",
 			},
 		},
 		{
-			Path:  "/",
-			Error: "",
+			Path: "/",
 			Files: []string{
 				"empty",
 				"img",
@@ -117,8 +269,7 @@ func TestReaddir(t *testing.T) {
 			},
 		},
 		{
-			Path:  "/lots-of-files",
-			Error: "",
+			Path: "/lots-of-files",
 			Files: []string{
 				"file-01",
 				"file-02",
@@ -143,12 +294,12 @@ func TestReaddir(t *testing.T) {
 			},
 		},
 		{
-			Path:  "/img/circle.png",
-			Error: "not a directory",
+			Path: "/img/circle.png",
+			Err:  ErrNotDirectory,
 		},
 		{
 			Path:  "/img/circle.png",
-			Error: "not a directory",
+			Err:   ErrNotDirectory,
 			Count: 2,
 		},
 	}
@@ -159,7 +310,7 @@ func TestReaddir(t *testing.T) {
 		require.NotNil(f)
 
 		files, err := f.Readdir(tc.Count)
-		if tc.Error == "" {
+		if tc.Err == nil {
 			assert.NoError(err)
 			assert.NotNil(files)
 			printError := false
@@ -187,7 +338,7 @@ func TestReaddir(t *testing.T) {
 		} else {
 			assert.Error(err)
 			assert.Nil(files)
-			assert.True(strings.Contains(err.Error(), tc.Error), err.Error())
+			assert.True(errors.Is(err, tc.Err), err)
 			assert.True(strings.Contains(err.Error(), tc.Path), err.Error())
 		}
 	}
@@ -207,6 +358,281 @@ func TestReaddir(t *testing.T) {
 	assert.Equal(0, len(a))
 }
 
+func TestReaddirMixed(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	fs, err := New("testdata/testdata.zip")
+	require.NoError(err)
+	defer fs.Close()
+
+	names := func(infos []os.FileInfo) []string {
+		var v []string
+		for _, info := range infos {
+			v = append(v, info.Name())
+		}
+		return v
+	}
+
+	file, err := fs.Open("/lots-of-files")
+	require.NoError(err)
+	defer file.Close()
+
+	// a positive count continues from the previous call
+	a, err := file.Readdir(3)
+	require.NoError(err)
+	assert.Equal([]string{"file-01", "file-02", "file-03"}, names(a))
+
+	// n <= 0 returns the rest, without io.EOF
+	a, err = file.Readdir(-1)
+	require.NoError(err)
+	assert.Len(a, 17)
+	assert.Equal("file-04", a[0].Name())
+	a, err = file.Readdir(0)
+	assert.NoError(err)
+	assert.NotNil(a)
+	assert.Empty(a)
+
+	// a positive count returns io.EOF at the end
+	a, err = file.Readdir(2)
+	assert.Equal(io.EOF, err)
+	assert.Empty(a)
+
+	// the last call of a positive count may return fewer entries
+	_, err = file.Seek(0, io.SeekStart)
+	require.NoError(err)
+	a, err = file.Readdir(15)
+	require.NoError(err)
+	assert.Len(a, 15)
+	a, err = file.Readdir(10)
+	require.NoError(err)
+	assert.Equal([]string{"file-16", "file-17", "file-18", "file-19", "file-20"}, names(a))
+	_, err = file.Readdir(10)
+	assert.Equal(io.EOF, err)
+}
+
+func TestReaddirOrder(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	files := map[string]string{
+		"Makefile":     "all:",
+		"README.md":    "readme",
+		"aardvark":     "a",
+		"b.txt":        "b",
+		"B.txt":        "B",
+		"Docs/a.txt":   "a",
+		"docs/b.txt":   "b",
+		"zebra/z.txt":  "z",
+		"src/main.go":  "package main",
+		"src/Zed.go":   "package main",
+		"src/lib/x.go": "package lib",
+	}
+
+	testCases := []struct {
+		Name string
+		Opts []Option
+		Root []string
+		Src  []string
+	}{
+		{
+			Name: "default",
+			Root: []string{"B.txt", "Docs", "Makefile", "README.md", "aardvark", "b.txt", "docs", "src", "zebra"},
+			Src:  []string{"Zed.go", "lib", "main.go"},
+		},
+		{
+			Name: "dirs first",
+			Opts: []Option{WithDirsFirst()},
+			Root: []string{"Docs", "docs", "src", "zebra", "B.txt", "Makefile", "README.md", "aardvark", "b.txt"},
+			Src:  []string{"lib", "Zed.go", "main.go"},
+		},
+		{
+			Name: "case insensitive",
+			Opts: []Option{WithCaseInsensitiveSort()},
+			Root: []string{"aardvark", "B.txt", "b.txt", "Docs", "docs", "Makefile", "README.md", "src", "zebra"},
+			Src:  []string{"lib", "main.go", "Zed.go"},
+		},
+		{
+			Name: "both",
+			Opts: []Option{WithDirsFirst(), WithCaseInsensitiveSort()},
+			Root: []string{"Docs", "docs", "src", "zebra", "aardvark", "B.txt", "b.txt", "Makefile", "README.md"},
+			Src:  []string{"lib", "main.go", "Zed.go"},
+		},
+	}
+
+	for _, tc := range testCases {
+		fs := newTestFileSystem(t, files, tc.Opts...)
+		for dir, want := range map[string][]string{"/": tc.Root, "/src": tc.Src} {
+			f, err := fs.Open(dir)
+			require.NoError(err)
+			infos, err := f.Readdir(-1)
+			require.NoError(err)
+			var names []string
+			for _, info := range infos {
+				names = append(names, info.Name())
+			}
+			assert.Equal(want, names, "%s %s", tc.Name, dir)
+
+			_, err = f.Seek(0, io.SeekStart)
+			require.NoError(err)
+			entries, err := f.(iofs.ReadDirFile).ReadDir(-1)
+			require.NoError(err)
+			names = nil
+			for _, entry := range entries {
+				names = append(names, entry.Name())
+			}
+			assert.Equal(want, names, "%s %s", tc.Name, dir)
+			require.NoError(f.Close())
+		}
+
+		// listings are in the same order
+		w := serveTestRequest(FileServer(fs, WithDirectoryListing()), "GET", "/src/", "Accept: application/json")
+		require.Equal(200, w.status)
+		var listing []struct {
+			Name string `json:"name"`
+		}
+		require.NoError(json.Unmarshal(w.buf.Bytes(), &listing))
+		var names []string
+		for _, entry := range listing {
+			names = append(names, strings.TrimSuffix(entry.Name, "/"))
+		}
+		assert.Equal(tc.Src, names, tc.Name)
+
+		// Walk is always in lexical order
+		var walked []string
+		require.NoError(fs.Walk("/src", func(name string, d iofs.DirEntry, err error) error {
+			walked = append(walked, name)
+			return err
+		}))
+		assert.Equal([]string{"/src", "/src/Zed.go", "/src/lib", "/src/lib/x.go", "/src/main.go"}, walked, tc.Name)
+	}
+}
+
+func TestListingFilter(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var dirs []string
+	hideDotfiles := func(fi os.FileInfo, dir string) bool {
+		dirs = append(dirs, dir)
+		return !strings.HasPrefix(fi.Name(), ".")
+	}
+	fs := newTestFileSystem(t, map[string]string{
+		".env":           "secret",
+		"index.html":     "index",
+		"css/.gitignore": "*.map",
+		"css/site.css":   "body {}",
+		".git/HEAD":      "ref",
+	}, WithListingFilter(hideDotfiles))
+
+	readdirNames := func(name string) []string {
+		f, err := fs.Open(name)
+		require.NoError(err)
+		defer f.Close()
+		entries, err := f.(iofs.ReadDirFile).ReadDir(-1)
+		require.NoError(err)
+		var names []string
+		for _, entry := range entries {
+			names = append(names, entry.Name())
+		}
+		return names
+	}
+	assert.Equal([]string{"css", "index.html"}, readdirNames("/"))
+	assert.Equal([]string{"site.css"}, readdirNames("/css"))
+	assert.Contains(dirs, "/")
+	assert.Contains(dirs, "/css")
+
+	// pages skip the hidden entries
+	root, err := fs.Open("/")
+	require.NoError(err)
+	for _, name := range []string{"css", "index.html"} {
+		infos, err := root.Readdir(1)
+		require.NoError(err)
+		require.Len(infos, 1)
+		assert.Equal(name, infos[0].Name())
+	}
+	_, err = root.Readdir(1)
+	assert.Equal(io.EOF, err)
+	require.NoError(root.Close())
+
+	// hidden entries can still be opened
+	entries, err := iofs.ReadDir(testFS{fs}, ".git")
+	require.NoError(err)
+	assert.Len(entries, 1)
+	f, err := fs.Open("/.env")
+	require.NoError(err)
+	data, err := io.ReadAll(f)
+	require.NoError(err)
+	assert.Equal("secret", string(data))
+	require.NoError(f.Close())
+
+	// and are left out of listings
+	w := serveTestRequest(FileServer(fs, WithDirectoryListing()), "GET", "/css/", "Accept: application/json")
+	require.Equal(200, w.status)
+	assert.NotContains(w.buf.String(), ".gitignore")
+	assert.Contains(w.buf.String(), "site.css")
+}
+
+// testFS is an fs.FS view of a file system, for testing the files
+// opened from it against the io/fs contracts.
+type testFS struct {
+	fs *FileSystem
+}
+
+func (tfs testFS) Open(name string) (iofs.File, error) {
+	if !iofs.ValidPath(name) {
+		return nil, &iofs.PathError{Op: "open", Path: name, Err: iofs.ErrInvalid}
+	}
+	return tfs.fs.Open("/" + name)
+}
+
+func TestReadDir(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	fs, err := New("testdata/testdata.zip")
+	require.NoError(err)
+	defer fs.Close()
+
+	entries, err := iofs.ReadDir(testFS{fs}, "img")
+	require.NoError(err)
+	require.Len(entries, 2)
+	assert.Equal("another-circle.png", entries[0].Name())
+	assert.Equal("circle.png", entries[1].Name())
+	info, err := entries[1].Info()
+	require.NoError(err)
+	f, err := fs.Open("/img/circle.png")
+	require.NoError(err)
+	stat, err := f.Stat()
+	require.NoError(err)
+	require.NoError(f.Close())
+	assert.Equal(stat, info)
+
+	// ReadDir and Readdir share the position in the directory
+	file, err := fs.Open("/lots-of-files")
+	require.NoError(err)
+	defer file.Close()
+	rdf, ok := file.(iofs.ReadDirFile)
+	require.True(ok)
+	entries, err = rdf.ReadDir(2)
+	require.NoError(err)
+	assert.Equal("file-02", entries[1].Name())
+	infos, err := file.Readdir(2)
+	require.NoError(err)
+	assert.Equal("file-03", infos[0].Name())
+	entries, err = rdf.ReadDir(-1)
+	require.NoError(err)
+	assert.Len(entries, 16)
+	entries, err = rdf.ReadDir(1)
+	assert.Equal(io.EOF, err)
+	assert.Empty(entries)
+
+	f, err = fs.Open("/index.html")
+	require.NoError(err)
+	defer f.Close()
+	_, err = f.(iofs.ReadDirFile).ReadDir(-1)
+	assert.True(errors.Is(err, ErrNotDirectory), err)
+	assert.Contains(err.Error(), "ReadDir /index.html")
+}
+
 // TestFileInfo tests the os.FileInfo associated with the http.File
 func TestFileInfo(t *testing.T) {
 	require := require.New(t)
@@ -296,7 +722,7 @@ func TestFile(t *testing.T) {
 			require.Equal(int64(0), n)
 		}
 		buf := make([]byte, size)
-		n, err := r.Read(buf)
+		n, err := io.ReadFull(r, buf)
 		require.NoError(err)
 		require.Equal(size, n)
 		md5Text := fmt.Sprintf("%x", md5.Sum(buf))
@@ -327,3 +753,795 @@ func TestFile(t *testing.T) {
 		file.Close()
 	}
 }
+
+func TestFileReadAt(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	fs, err := New("testdata/testdata.zip")
+	require.NoError(err)
+	defer fs.Close()
+
+	for _, name := range []string{"/random.dat", "/img/circle.png"} {
+		fi, err := fs.openFileInfo(name)
+		require.NoError(err)
+		want, err := readZipFile(fi.zipFile)
+		require.NoError(err)
+
+		file, err := fs.Open(name)
+		require.NoError(err)
+		ra, ok := file.(io.ReaderAt)
+		require.True(ok, name)
+
+		// start reading sequentially before the concurrent reads
+		head := make([]byte, 100)
+		_, err = io.ReadFull(file, head)
+		require.NoError(err)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				off := int64(i * len(want) / 10)
+				buf := make([]byte, len(want)/4)
+				n, err := ra.ReadAt(buf, off)
+				assert.NoError(err, name)
+				assert.Equal(want[off:off+int64(n)], buf[:n], name)
+			}(i)
+		}
+		wg.Wait()
+
+		// reading past the end returns io.EOF
+		buf := make([]byte, 100)
+		n, err := ra.ReadAt(buf, int64(len(want)-10))
+		assert.Equal(io.EOF, err, name)
+		assert.Equal(want[len(want)-10:], buf[:n], name)
+		_, err = ra.ReadAt(buf, -1)
+		assert.True(errors.Is(err, errNegativeOffset), name)
+
+		// the sequential position is unchanged
+		rest, err := io.ReadAll(file)
+		require.NoError(err)
+		assert.Equal(want, append(head, rest...), name)
+
+		require.NoError(file.Close())
+		_, err = ra.ReadAt(buf, 0)
+		assert.True(errors.Is(err, ErrFileClosed), name)
+	}
+}
+
+func TestDirectoryRead(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	fs, err := New("testdata/testdata.zip")
+	require.NoError(err)
+	defer fs.Close()
+	fs2 := newTestFileSystem(t, map[string]string{"a/b/c.txt": "c"})
+
+	testCases := []struct {
+		FS   *FileSystem
+		Path string
+	}{
+		{FS: fs, Path: "/lots-of-files"}, // explicit directory entry
+		{FS: fs, Path: "/"},              // synthesized root
+		{FS: fs2, Path: "/a/b"},          // synthesized directory
+	}
+
+	for _, tc := range testCases {
+		file, err := tc.FS.Open(tc.Path)
+		require.NoError(err, tc.Path)
+
+		_, err = file.Read(make([]byte, 10))
+		assert.True(errors.Is(err, ErrIsDirectory), tc.Path)
+		var pathErr *os.PathError
+		if assert.True(errors.As(err, &pathErr), tc.Path) {
+			assert.Equal("Read", pathErr.Op)
+		}
+		_, err = file.(io.ReaderAt).ReadAt(make([]byte, 10), 0)
+		assert.True(errors.Is(err, ErrIsDirectory), tc.Path)
+		_, err = file.(io.WriterTo).WriteTo(io.Discard)
+		assert.True(errors.Is(err, ErrIsDirectory), tc.Path)
+
+		_, err = file.Seek(10, io.SeekStart)
+		assert.True(errors.Is(err, ErrIsDirectory), tc.Path)
+		_, err = file.Seek(0, io.SeekEnd)
+		assert.True(errors.Is(err, ErrIsDirectory), tc.Path)
+
+		// seeking to the start is allowed, and restarts Readdir
+		first, err := file.Readdir(1)
+		require.NoError(err, tc.Path)
+		n, err := file.Seek(0, io.SeekStart)
+		assert.NoError(err, tc.Path)
+		assert.Equal(int64(0), n, tc.Path)
+		again, err := file.Readdir(1)
+		require.NoError(err, tc.Path)
+		assert.Equal(first[0].Name(), again[0].Name(), tc.Path)
+
+		require.NoError(file.Close())
+	}
+}
+
+func TestFileWriteTo(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	fs, err := New("testdata/testdata.zip")
+	require.NoError(err)
+	defer fs.Close()
+
+	for _, name := range []string{"/random.dat", "/img/circle.png"} {
+		fi, err := fs.openFileInfo(name)
+		require.NoError(err)
+		want, err := readZipFile(fi.zipFile)
+		require.NoError(err)
+
+		file, err := fs.Open(name)
+		require.NoError(err)
+		wt, ok := file.(io.WriterTo)
+		require.True(ok, name)
+
+		// the copy starts at the current offset
+		head := make([]byte, 100)
+		_, err = io.ReadFull(file, head)
+		require.NoError(err)
+		var buf bytes.Buffer
+		n, err := wt.WriteTo(&buf)
+		assert.NoError(err, name)
+		assert.Equal(int64(len(want)-100), n, name)
+		assert.Equal(want[100:], buf.Bytes(), name)
+
+		// and leaves the file at the end
+		n2, err := file.Read(head)
+		assert.Equal(0, n2, name)
+		assert.Equal(io.EOF, err, name)
+
+		// after seeking, the copy is from the new position
+		_, err = file.Seek(int64(len(want)-10), io.SeekStart)
+		require.NoError(err)
+		buf.Reset()
+		_, err = wt.WriteTo(&buf)
+		assert.NoError(err, name)
+		assert.Equal(want[len(want)-10:], buf.Bytes(), name)
+
+		require.NoError(file.Close())
+		_, err = wt.WriteTo(&buf)
+		assert.True(errors.Is(err, ErrFileClosed), name)
+	}
+}
+
+func benchmarkFileCopy(b *testing.B, wrap func(io.Reader) io.Reader) {
+	fs, err := New("testdata/testdata.zip")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer fs.Close()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		file, err := fs.Open("/random.dat")
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err := io.Copy(io.Discard, wrap(file)); err != nil {
+			b.Fatal(err)
+		}
+		file.Close()
+	}
+}
+
+// BenchmarkFileCopyRead hides WriteTo, for comparison.
+func BenchmarkFileCopyRead(b *testing.B) {
+	benchmarkFileCopy(b, func(r io.Reader) io.Reader {
+		return struct{ io.Reader }{r}
+	})
+}
+
+func BenchmarkFileCopyWriteTo(b *testing.B) {
+	benchmarkFileCopy(b, func(r io.Reader) io.Reader {
+		return r
+	})
+}
+
+func TestTempFile(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	fs := newTestFileSystem(t, map[string]string{
+		"file.txt": strings.Repeat("0123456789", 1000),
+	}, WithMemorySeekLimit(0))
+	count := atomic.LoadInt64(&tempFileCount)
+
+	// seeking backward extracts the file
+	f1, err := fs.Open("/file.txt")
+	require.NoError(err)
+	_, err = io.ReadFull(f1, make([]byte, 300))
+	require.NoError(err)
+	_, err = f1.Seek(100, io.SeekStart)
+	require.NoError(err)
+	f2, err := fs.Open("/file.txt")
+	require.NoError(err)
+	_, err = io.ReadFull(f2, make([]byte, 300))
+	require.NoError(err)
+	_, err = f2.Seek(200, io.SeekStart)
+	require.NoError(err)
+	assert.Equal(count+1, atomic.LoadInt64(&tempFileCount), "one extraction")
+
+	fi, err := fs.openFileInfo("/file.txt")
+	require.NoError(err)
+	tempPath := fi.tempPath
+	require.NotEmpty(tempPath)
+
+	// closing a reader keeps the temporary file for later readers
+	require.NoError(f1.Close())
+	_, err = os.Stat(tempPath)
+	assert.NoError(err)
+
+	// closing the file system removes the temporary file
+	// once the remaining reader has finished with it
+	require.NoError(fs.Close())
+	buf := make([]byte, 10)
+	_, err = io.ReadFull(f2, buf)
+	assert.NoError(err)
+	assert.Equal("0123456789", string(buf))
+	require.NoError(f2.Close())
+	_, err = os.Stat(tempPath)
+	assert.True(os.IsNotExist(err))
+}
+
+func TestSeekSkip(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	data := make([]byte, 3<<20)
+	for i := range data {
+		data[i] = byte(i * i >> 8)
+	}
+	fs := newTestFileSystem(t, map[string]string{
+		"large.bin": string(data),
+	})
+	readAt := func(f io.Reader, offset int) {
+		t.Helper()
+		buf := make([]byte, 100)
+		_, err := io.ReadFull(f, buf)
+		require.NoError(err)
+		assert.Equal(data[offset:offset+100], buf)
+	}
+
+	// short seeks forward are skipped by reading
+	f, err := fs.Open("/large.bin")
+	require.NoError(err)
+	defer f.Close()
+	pos, err := f.Seek(1000, io.SeekStart)
+	require.NoError(err)
+	assert.Equal(int64(1000), pos)
+	readAt(f, 1000)
+	pos, err = f.Seek(5000, io.SeekCurrent)
+	require.NoError(err)
+	assert.Equal(int64(6100), pos)
+	readAt(f, 6100)
+	pos, err = f.Seek(-(3<<20)+100000, io.SeekEnd)
+	require.NoError(err)
+	assert.Equal(int64(100000), pos)
+	readAt(f, 100000)
+	assert.Equal(int64(0), fs.ExtractStats().Extractions)
+
+	// seeking backward extracts the file
+	pos, err = f.Seek(500, io.SeekStart)
+	require.NoError(err)
+	assert.Equal(int64(500), pos)
+	readAt(f, 500)
+	assert.Equal(int64(1), fs.ExtractStats().Extractions)
+
+	// as does a long seek forward, which uses the same temporary file
+	f2, err := fs.Open("/large.bin")
+	require.NoError(err)
+	defer f2.Close()
+	_, err = f2.Seek(2<<20, io.SeekStart)
+	require.NoError(err)
+	readAt(f2, 2<<20)
+	assert.Equal(int64(1), fs.ExtractStats().Extractions)
+	fi, err := fs.openFileInfo("/large.bin")
+	require.NoError(err)
+	assert.True(fi.hasTempFile())
+}
+
+func TestSeekPosition(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	fs, err := New("testdata/testdata.zip", WithMemorySeekLimit(0))
+	require.NoError(err)
+	defer fs.Close()
+	fi, err := fs.openFileInfo("/img/circle.png")
+	require.NoError(err)
+	want, err := readZipFile(fi.zipFile)
+	require.NoError(err)
+
+	f, err := fs.Open("/img/circle.png")
+	require.NoError(err)
+	defer f.Close()
+	var got []byte
+	buf := make([]byte, 1000)
+	for {
+		pos, err := f.Seek(0, io.SeekCurrent)
+		require.NoError(err)
+		assert.Equal(int64(len(got)), pos)
+		pos, err = f.Seek(pos, io.SeekStart)
+		require.NoError(err)
+		assert.Equal(int64(len(got)), pos)
+
+		n, err := f.Read(buf)
+		got = append(got, buf[:n]...)
+		if err == io.EOF {
+			break
+		}
+		require.NoError(err)
+	}
+	assert.Equal(want, got)
+	assert.Equal(int64(0), fs.ExtractStats().Extractions)
+
+	// the position is kept after the file is extracted
+	_, err = f.Seek(100, io.SeekStart)
+	require.NoError(err)
+	assert.Equal(int64(1), fs.ExtractStats().Extractions)
+	_, err = io.ReadFull(f, buf[:50])
+	require.NoError(err)
+	pos, err := f.Seek(0, io.SeekCurrent)
+	require.NoError(err)
+	assert.Equal(int64(150), pos)
+	pos, err = f.Seek(10, io.SeekCurrent)
+	require.NoError(err)
+	assert.Equal(int64(160), pos)
+	_, err = io.ReadFull(f, buf[:10])
+	require.NoError(err)
+	assert.Equal(want[160:170], buf[:10])
+
+	// the files satisfy the io/fs tests, which check the
+	// position after reading and seeking
+	require.NoError(fstest.TestFS(testFS{fs}, "index.html", "img/circle.png", "lots-of-files/file-20", "random.dat"))
+}
+
+func TestSeekEnd(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	fs, err := New("testdata/testdata.zip", WithMemorySeekLimit(0))
+	require.NoError(err)
+	defer fs.Close()
+	fi, err := fs.openFileInfo("/img/circle.png")
+	require.NoError(err)
+	want, err := readZipFile(fi.zipFile)
+	require.NoError(err)
+
+	// finding the size needs no extraction
+	f, err := fs.Open("/img/circle.png")
+	require.NoError(err)
+	defer f.Close()
+	size, err := f.Seek(0, io.SeekEnd)
+	require.NoError(err)
+	assert.Equal(int64(5973), size)
+	n, err := f.Read(make([]byte, 10))
+	assert.Equal(0, n)
+	assert.Equal(io.EOF, err)
+	pos, err := f.Seek(10, io.SeekEnd)
+	require.NoError(err)
+	assert.Equal(int64(5983), pos)
+	_, err = f.Read(make([]byte, 10))
+	assert.Equal(io.EOF, err)
+	assert.Equal(int64(0), fs.ExtractStats().Extractions)
+
+	// nor does going back to the start
+	_, err = f.Seek(0, io.SeekStart)
+	require.NoError(err)
+	buf := make([]byte, 100)
+	_, err = io.ReadFull(f, buf)
+	require.NoError(err)
+	assert.Equal(want[:100], buf)
+	assert.Equal(int64(0), fs.ExtractStats().Extractions)
+
+	// but reading from before the end does
+	_, err = f.Seek(0, io.SeekEnd)
+	require.NoError(err)
+	pos, err = f.Seek(-200, io.SeekCurrent)
+	require.NoError(err)
+	assert.Equal(int64(5773), pos)
+	_, err = io.ReadFull(f, buf)
+	require.NoError(err)
+	assert.Equal(want[5773:5873], buf)
+	assert.Equal(int64(1), fs.ExtractStats().Extractions)
+}
+
+func TestMemorySeek(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	small := strings.Repeat("body { color: red; }\n", 150)
+	large := strings.Repeat("0123456789", 1000)
+	files := map[string]string{
+		"site.css":  small,
+		"large.txt": large,
+	}
+	for i := 0; i < 12; i++ {
+		files[fmt.Sprintf("more/%02d.css", i)] = small
+	}
+	fs := newTestFileSystem(t, files, WithMemorySeekLimit(4000))
+	count := atomic.LoadInt64(&tempFileCount)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			f, err := fs.Open("/site.css")
+			if !assert.NoError(err) {
+				return
+			}
+			defer f.Close()
+			_, err = io.ReadFull(f, make([]byte, 1000))
+			assert.NoError(err)
+			offset := int64(i * 100)
+			_, err = f.Seek(offset, io.SeekStart)
+			assert.NoError(err)
+			buf := make([]byte, 50)
+			_, err = io.ReadFull(f, buf)
+			assert.NoError(err)
+			assert.Equal(small[offset:offset+50], string(buf))
+			_, err = f.(io.ReaderAt).ReadAt(buf, 2000)
+			assert.NoError(err)
+			assert.Equal(small[2000:2050], string(buf))
+		}(i)
+	}
+	wg.Wait()
+	assert.Equal(count, atomic.LoadInt64(&tempFileCount), "no temp file for small file")
+
+	// the handles share one copy of the contents
+	fi, err := fs.openFileInfo("/site.css")
+	require.NoError(err)
+	data, err := fi.memoryContent()
+	require.NoError(err)
+	require.Contains(fs.seekCache.items, "site.css")
+	cached := fs.seekCache.items["site.css"].Value.(*contentCacheItem).data
+	assert.Same(&cached[0], &data[0])
+	w := serveTestRequest(FileServer(fs), "GET", "/site.css", "Range: bytes=10-19")
+	assert.Equal(206, w.status)
+	assert.Equal(small[10:20], w.buf.String())
+	s, err := fs.OpenSeeker("/site.css")
+	require.NoError(err)
+	_, err = s.Seek(100, io.SeekStart)
+	require.NoError(err)
+	buf := make([]byte, 10)
+	_, err = io.ReadFull(s, buf)
+	require.NoError(err)
+	assert.Equal(small[100:110], string(buf))
+	require.NoError(s.Close())
+	assert.Equal(int64(1), fs.seekCache.stats().Misses, "decompressed once")
+	assert.Equal(count, atomic.LoadInt64(&tempFileCount))
+
+	// larger files are extracted to a temporary file
+	f, err := fs.Open("/large.txt")
+	require.NoError(err)
+	defer f.Close()
+	_, err = io.ReadFull(f, make([]byte, 1000))
+	require.NoError(err)
+	_, err = f.Seek(100, io.SeekStart)
+	require.NoError(err)
+	_, err = io.ReadFull(f, buf)
+	require.NoError(err)
+	assert.Equal(large[100:110], string(buf))
+	assert.Equal(count+1, atomic.LoadInt64(&tempFileCount))
+	assert.NotContains(fs.seekCache.items, "large.txt")
+
+	// the contents in memory are limited to eight files of the limit
+	for i := 0; i < 12; i++ {
+		w := serveTestRequest(FileServer(fs), "GET", fmt.Sprintf("/more/%02d.css", i), "Range: bytes=10-19")
+		assert.Equal(small[10:20], w.buf.String())
+	}
+	stats := fs.seekCache.stats()
+	assert.LessOrEqual(stats.Bytes, int64(8*4000))
+	assert.Positive(stats.Evictions)
+}
+
+func TestTempFileConcurrent(t *testing.T) {
+	assert := assert.New(t)
+
+	data := make([]byte, 8<<20)
+	for i := range data {
+		data[i] = byte(i * i >> 8)
+	}
+	fs := newTestFileSystem(t, map[string]string{
+		"large.bin": string(data),
+	})
+	handler := FileServer(fs)
+	count := atomic.LoadInt64(&tempFileCount)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			offset := i * 100000
+			w := serveTestRequest(handler, "GET", "/large.bin", fmt.Sprintf("Range: bytes=%d-%d", offset, offset+99))
+			assert.Equal(206, w.status)
+			assert.Equal(data[offset:offset+100], w.buf.Bytes())
+		}(i)
+	}
+	wg.Wait()
+
+	assert.Equal(count+1, atomic.LoadInt64(&tempFileCount), "one extraction")
+	stats := fs.ExtractStats()
+	assert.Equal(int64(1), stats.Extractions)
+	assert.LessOrEqual(stats.Shared, int64(9))
+}
+
+func TestTempFileCanceled(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	fs := newTestFileSystem(t, map[string]string{
+		"file.txt": "contents",
+	})
+	fi, err := fs.openFileInfo("/file.txt")
+	require.NoError(err)
+
+	// pretend that another goroutine is extracting the file
+	e := &extraction{done: make(chan struct{})}
+	fi.extracting = e
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = fi.openTempFile(ctx)
+	assert.Equal(context.Canceled, err)
+	assert.Equal(ExtractStats{Shared: 1}, fs.ExtractStats())
+
+	// a failed extraction is reported to those waiting
+	e.err = errors.New("extraction failed")
+	close(e.done)
+	_, err = fi.openTempFile(context.Background())
+	assert.Equal(e.err, err)
+
+	// an extraction abandoned because its request was canceled
+	// is restarted by those waiting for it
+	e = &extraction{done: make(chan struct{})}
+	fi.extracting = e
+	done := make(chan error)
+	go func() {
+		file, err := fi.openTempFile(context.Background())
+		if err == nil {
+			fi.releaseTempFile(file)
+		}
+		done <- err
+	}()
+	for fs.ExtractStats().Shared < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	fi.mutex.Lock()
+	fi.extracting = nil
+	e.err = context.Canceled
+	close(e.done)
+	fi.mutex.Unlock()
+	assert.NoError(<-done)
+	assert.Equal(ExtractStats{Extractions: 1, Shared: 2}, fs.ExtractStats())
+
+	// a canceled extraction leaves no temporary file behind
+	dir := t.TempDir()
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	_, err = createTempFile(ctx, fi.zipFile, dir)
+	assert.Equal(context.Canceled, err)
+	entries, err := os.ReadDir(dir)
+	require.NoError(err)
+	assert.Empty(entries)
+}
+
+func TestPersistentTempCache(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dir := t.TempDir()
+	const md5Sum = "05e3048db45e71749e06658ccfc0753b"
+	readFile := func() ExtractStats {
+		fs, err := New("testdata/testdata.zip", WithPersistentTempCache(dir), WithMemorySeekLimit(0))
+		require.NoError(err)
+		defer fs.Close()
+		f, err := fs.Open("/img/circle.png")
+		require.NoError(err)
+		defer f.Close()
+		_, err = io.ReadFull(f, make([]byte, 20))
+		require.NoError(err)
+		_, err = f.Seek(10, io.SeekStart)
+		require.NoError(err)
+		_, err = f.Seek(0, io.SeekStart)
+		require.NoError(err)
+		data, err := io.ReadAll(f)
+		require.NoError(err)
+		assert.Equal(md5Sum, fmt.Sprintf("%x", md5.Sum(data)))
+		return fs.ExtractStats()
+	}
+
+	assert.Equal(int64(1), readFile().Extractions)
+	name := filepath.Join(dir, "529fb2ff-5973.bin")
+	_, err := os.Stat(name)
+	require.NoError(err, "file kept after close")
+
+	// a new file system uses the existing file
+	assert.Equal(int64(0), readFile().Extractions)
+
+	// a truncated file is extracted again
+	require.NoError(os.Truncate(name, 100))
+	assert.Equal(int64(1), readFile().Extractions)
+	stat, err := os.Stat(name)
+	require.NoError(err)
+	assert.Equal(int64(5973), stat.Size())
+}
+
+func TestErrors(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	fs, err := New("testdata/testdata.zip")
+	require.NoError(err)
+
+	var pathErr *os.PathError
+	f, err := fs.Open("/img/circle.png")
+	require.NoError(err)
+	_, err = f.Readdir(0)
+	assert.True(errors.Is(err, ErrNotDirectory), err)
+	assert.True(errors.As(err, &pathErr))
+	assert.Equal("Readdir", pathErr.Op)
+	require.NoError(f.Close())
+	_, err = f.Read(make([]byte, 10))
+	assert.True(errors.Is(err, ErrFileClosed), err)
+	assert.True(errors.As(err, &pathErr))
+	assert.Equal("/img/circle.png", pathErr.Path)
+	_, err = f.Seek(0, io.SeekStart)
+	assert.True(errors.Is(err, ErrFileClosed), err)
+
+	err = fs.ZipDir(io.Discard, "/index.html")
+	assert.True(errors.Is(err, ErrNotDirectory), err)
+	_, err = fs.OpenSeeker("/img")
+	assert.True(errors.Is(err, ErrIsDirectory), err)
+
+	require.NoError(fs.Close())
+	_, err = fs.Open("/index.html")
+	assert.True(errors.Is(err, ErrClosed), err)
+	assert.True(errors.As(err, &pathErr))
+	assert.Equal("Open", pathErr.Op)
+	_, err = fs.OpenSeeker("/index.html")
+	assert.True(errors.Is(err, ErrClosed), err)
+	assert.True(errors.Is(fs.ZipDir(io.Discard, "/"), ErrClosed))
+	assert.True(errors.Is(fs.TarTo(io.Discard), ErrClosed))
+}
+
+func TestFileErrorPaths(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	content := []byte(strings.Repeat("0123456789", 100))
+	b := zipfstest.NewBuilder()
+	b.AddStored("dir/data.txt", content)
+	data, err := b.Bytes()
+	require.NoError(err)
+	i := bytes.Index(data, content[500:510])
+	require.True(i > 0)
+	data[i] ^= 0xff
+	fs, err := newFileSystem(bytes.NewReader(data), int64(len(data)), nil)
+	require.NoError(err)
+	defer fs.Close()
+
+	// each error names the operation and the path used to open the file
+	checkError := func(err error, op string, target error) {
+		t.Helper()
+		var pathErr *os.PathError
+		if assert.True(errors.As(err, &pathErr), err) {
+			assert.Equal(op, pathErr.Op)
+			assert.Equal("/dir/data.txt", pathErr.Path)
+		}
+		assert.Contains(fmt.Sprint(err), "/dir/data.txt")
+		assert.True(errors.Is(err, target), err)
+	}
+
+	f, err := fs.Open("/dir/data.txt")
+	require.NoError(err)
+	defer f.Close()
+	_, err = io.ReadAll(f)
+	checkError(err, "Read", zip.ErrChecksum)
+	_, err = f.Seek(10, io.SeekStart)
+	checkError(err, "Seek", zip.ErrChecksum)
+	_, err = f.Readdir(0)
+	checkError(err, "Readdir", ErrNotDirectory)
+}
+
+// BenchmarkReaddirPaged reads a large directory 100 entries at a time,
+// either in full or only the first page, as a paged listing would.
+func BenchmarkReaddirPaged(b *testing.B) {
+	builder := zipfstest.NewBuilder()
+	for i := 0; i < 50000; i++ {
+		builder.AddStored(fmt.Sprintf("dir/file-%05d", i), nil)
+	}
+	fs := newBuilderFileSystem(b, builder)
+
+	for _, pages := range []int{1, 500} {
+		b.Run(fmt.Sprintf("pages=%d", pages), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				f, err := fs.Open("/dir")
+				if err != nil {
+					b.Fatal(err)
+				}
+				for page := 0; page < pages; page++ {
+					if _, err := f.Readdir(100); err != nil {
+						b.Fatal(err)
+					}
+				}
+				f.Close()
+			}
+		})
+	}
+}
+
+func TestPinned(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	data, err := os.ReadFile("testdata/testdata.zip")
+	require.NoError(err)
+	readerAt := &countingReaderAt{r: bytes.NewReader(data)}
+	fs, err := newFileSystem(readerAt, int64(len(data)), nil, WithPinned("*.html", "/random.dat"))
+	require.NoError(err)
+	defer fs.Close()
+
+	var want int64
+	for _, name := range []string{"index.html", "test.html", "random.dat"} {
+		zf := fs.fileInfos[name].zipFile
+		want += int64(zf.UncompressedSize64)
+		if zf.Method != zip.Store {
+			want += int64(zf.CompressedSize64)
+		}
+	}
+	assert.Equal(want, fs.PinnedBytes())
+	assert.Nil(fs.fileInfos["img/circle.png"].pinned)
+
+	html, err := fs.ReadFile("/test.html")
+	require.NoError(err)
+	random, err := fs.ReadFile("/random.dat")
+	require.NoError(err)
+
+	// Nothing more is read from the ZIP file to serve pinned files.
+	atomic.StoreInt64(&readerAt.count, 0)
+	handler := FileServer(fs)
+	w := serveTestRequest(handler, "GET", "/test.html")
+	assert.Equal(200, w.status)
+	assert.Equal(html, w.buf.Bytes())
+	w = serveTestRequest(handler, "GET", "/test.html", "Accept-Encoding: deflate")
+	assert.Equal(200, w.status)
+	assert.Equal("deflate", w.Header().Get("Content-Encoding"))
+	assert.Equal(fs.fileInfos["test.html"].pinnedRaw, w.buf.Bytes())
+	w = serveTestRequest(handler, "GET", "/test.html", "Range: bytes=10-19")
+	assert.Equal(206, w.status)
+	assert.Equal(html[10:20], w.buf.Bytes())
+	w = serveTestRequest(handler, "GET", "/random.dat")
+	assert.Equal(200, w.status)
+	assert.Equal(random, w.buf.Bytes())
+	w = serveTestRequest(handler, "GET", "/")
+	assert.Equal(200, w.status)
+
+	f, err := fs.Open("/random.dat")
+	require.NoError(err)
+	_, err = f.Seek(100, io.SeekStart)
+	require.NoError(err)
+	buf := make([]byte, 10)
+	_, err = io.ReadFull(f, buf)
+	require.NoError(err)
+	assert.Equal(random[100:110], buf)
+	_, err = f.(io.ReaderAt).ReadAt(buf, 200)
+	require.NoError(err)
+	assert.Equal(random[200:210], buf)
+	require.NoError(f.Close())
+	assert.Zero(atomic.LoadInt64(&readerAt.count))
+
+	// Other files are still read from the ZIP file.
+	w = serveTestRequest(handler, "GET", "/img/circle.png")
+	assert.Equal(200, w.status)
+	assert.Positive(atomic.LoadInt64(&readerAt.count))
+}
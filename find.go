@@ -0,0 +1,56 @@
+package zipfs
+
+import (
+	"encoding/base64"
+	"sort"
+	"strings"
+)
+
+// FindByCRC32 returns the names of the files with the CRC-32 checksum
+// crc, in sorted order. There can be more than one, because the same
+// content can appear in more than one file, and different contents can
+// have the same checksum. The index of checksums is built the first time
+// FindByCRC32 is called.
+func (fs *FileSystem) FindByCRC32(crc uint32) []string {
+	fs.crcIndexOnce.Do(func() {
+		index := make(map[uint32][]string)
+		if fs.reader != nil {
+			for _, zf := range fs.reader.File {
+				if !strings.HasSuffix(zf.Name, "/") {
+					index[zf.CRC32] = append(index[zf.CRC32], "/"+zf.Name)
+				}
+			}
+		}
+		for _, names := range index {
+			sort.Strings(names)
+		}
+		fs.crcIndex = index
+	})
+	return append([]string(nil), fs.crcIndex[crc]...)
+}
+
+// FindByDigest returns the name of a file with the digest calculated
+// using algo, such as "sha-256", for WithDigests. Only the files whose
+// digests have already been calculated are found, so it is usually used
+// with WithDigestWarmup. If more than one file has the digest, then the
+// first in the ZIP file is returned.
+func (fs *FileSystem) FindByDigest(algo string, digest []byte) (string, bool) {
+	if fs.reader == nil {
+		return "", false
+	}
+	value := base64.StdEncoding.EncodeToString(digest)
+	for _, zf := range fs.reader.File {
+		fi := fs.fileInfos[zf.Name]
+		if fi == nil || fi.IsDir() {
+			continue
+		}
+		fi.mutex.Lock()
+		v, ok := fi.digestValues[algo]
+		fi.mutex.Unlock()
+		found := ok && v == value
+		if found {
+			return "/" + zf.Name, true
+		}
+	}
+	return "", false
+}
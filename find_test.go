@@ -0,0 +1,65 @@
+package zipfs
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindByCRC32(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	fs, err := New("testdata/testdata.zip")
+	require.NoError(err)
+	defer fs.Close()
+
+	// the two circles have the same content
+	assert.Equal([]string{"/img/another-circle.png", "/img/circle.png"}, fs.FindByCRC32(0x529fb2ff))
+	assert.Equal([]string{"/random.dat"}, fs.FindByCRC32(0x6c15f45b))
+	assert.Empty(fs.FindByCRC32(0x12345678))
+
+	// the result can be modified
+	names := fs.FindByCRC32(0x529fb2ff)
+	names[0] = "changed"
+	assert.Equal("/img/another-circle.png", fs.FindByCRC32(0x529fb2ff)[0])
+}
+
+func TestFindByDigest(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	fs := newTestFileSystem(t, map[string]string{
+		"a.txt":     "a",
+		"dir/b.txt": "b",
+	})
+	sum := sha256.Sum256([]byte("b"))
+	md5, err := hex.DecodeString("92eb5ffee6ae2fec3ad71c777531578f")
+	require.NoError(err)
+
+	// not found until the digests are calculated
+	_, ok := fs.FindByDigest("sha-256", sum[:])
+	assert.False(ok)
+	_, ok = fs.FindByDigest("sha-256", nil)
+	assert.False(ok, "empty digest")
+
+	FileServer(fs, WithDigests("sha-256", "md5"), WithDigestWarmup())
+	name, ok := fs.FindByDigest("sha-256", sum[:])
+	assert.True(ok)
+	assert.Equal("/dir/b.txt", name)
+	name, ok = fs.FindByDigest("md5", md5)
+	assert.True(ok)
+	assert.Equal("/dir/b.txt", name)
+
+	_, ok = fs.FindByDigest("sha-512", sum[:])
+	assert.False(ok)
+	_, ok = fs.FindByDigest("sha-256", md5)
+	assert.False(ok)
+	_, ok = fs.FindByDigest("sha-256", []byte{})
+	assert.False(ok, "empty digest")
+	_, ok = fs.FindByDigest("sha-512", nil)
+	assert.False(ok, "empty digest")
+}
@@ -0,0 +1,52 @@
+package zipfs
+
+import (
+	iofs "io/fs"
+	"path"
+)
+
+// ForEach calls fn for each file and directory in the file system,
+// other than the root, with its rooted name, such as "/img/circle.png".
+// The entries are visited in the same order as Walk: in lexical order,
+// directories before their contents. If fn returns false then ForEach
+// stops. It is the equivalent of All for toolchains without range over
+// function types.
+func (fs *FileSystem) ForEach(fn func(name string, info iofs.FileInfo) bool) {
+	if root := fs.fileInfos["/"]; root != nil {
+		forEach("/", root, fn)
+	}
+}
+
+// ForEachInDir calls fn for each file and directory in the directory
+// dir, in lexical order, without descending into subdirectories. If fn
+// returns false then ForEachInDir stops. If dir does not exist, or is
+// not a directory, then fn is not called. It is the equivalent of InDir
+// for toolchains without range over function types.
+func (fs *FileSystem) ForEachInDir(dir string, fn func(name string, info iofs.FileInfo) bool) {
+	d := fs.lookup(dir)
+	if d == nil || !d.IsDir() {
+		return
+	}
+	dir = path.Clean("/" + dir)
+	for _, fi := range d.fileInfos {
+		if !fn(path.Join(dir, fi.Name()), fi) {
+			return
+		}
+	}
+}
+
+// forEach calls fn for the contents of the directory d at dir, and their
+// contents, until fn returns false. It reports whether fn returned true
+// for every entry.
+func forEach(dir string, d *fileInfo, fn func(name string, info iofs.FileInfo) bool) bool {
+	for _, fi := range d.fileInfos {
+		name := path.Join(dir, fi.Name())
+		if !fn(name, fi) {
+			return false
+		}
+		if fi.IsDir() && !forEach(name, fi, fn) {
+			return false
+		}
+	}
+	return true
+}
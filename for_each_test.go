@@ -0,0 +1,65 @@
+package zipfs
+
+import (
+	iofs "io/fs"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestForEach(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	fs, err := New("testdata/testdata.zip")
+	require.NoError(err)
+	defer fs.Close()
+
+	// the same entries as Walk, in the same order, without the root
+	var walked []string
+	err = fs.Walk("/", func(name string, d iofs.DirEntry, err error) error {
+		if name != "/" {
+			walked = append(walked, name)
+		}
+		return err
+	})
+	require.NoError(err)
+	var names []string
+	fs.ForEach(func(name string, info iofs.FileInfo) bool {
+		names = append(names, name)
+		return true
+	})
+	assert.Equal(walked, names)
+	assert.Len(names, len(fs.Names())+len(fs.Dirs()))
+
+	// early termination
+	names = nil
+	fs.ForEach(func(name string, info iofs.FileInfo) bool {
+		names = append(names, name)
+		return name != "/img/another-circle.png"
+	})
+	assert.Equal([]string{"/empty", "/img", "/img/another-circle.png"}, names)
+
+	names = nil
+	fs.ForEachInDir("/img/", func(name string, info iofs.FileInfo) bool {
+		names = append(names, name)
+		assert.Equal(int64(5973), info.Size())
+		return true
+	})
+	assert.Equal([]string{"/img/another-circle.png", "/img/circle.png"}, names)
+
+	count := 0
+	fs.ForEachInDir("/", func(name string, info iofs.FileInfo) bool {
+		count++
+		return count < 3
+	})
+	assert.Equal(3, count)
+
+	for _, dir := range []string{"/missing", "/index.html", "/empty"} {
+		fs.ForEachInDir(dir, func(name string, info iofs.FileInfo) bool {
+			assert.Fail("unexpected entry", name)
+			return true
+		})
+	}
+}
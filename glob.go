@@ -0,0 +1,59 @@
+package zipfs
+
+import (
+	"path"
+	"sort"
+	"strings"
+)
+
+// GlobAll returns the sorted names of the files and directories that
+// match pattern, such as "/static/**/*.js". The syntax is that of
+// fs.Glob and path.Match, with the addition that a "**" segment matches
+// zero or more whole segments of a name, so "static/**" matches static
+// and everything in it. The leading slash of the pattern is optional, and
+// the names returned have one. The only possible error is
+// path.ErrBadPattern, when the pattern is malformed.
+func (fs *FileSystem) GlobAll(pattern string) ([]string, error) {
+	patternSegs := strings.Split(strings.TrimPrefix(pattern, "/"), "/")
+	for _, seg := range patternSegs {
+		if _, err := path.Match(seg, ""); err != nil {
+			return nil, err
+		}
+	}
+	var names []string
+	for key, fi := range fs.fileInfos {
+		// Directories have two keys.
+		if key != fi.name || key == "/" {
+			continue
+		}
+		name := strings.TrimSuffix(fi.name, "/")
+		if matchSegments(patternSegs, strings.Split(name, "/")) {
+			names = append(names, "/"+name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// matchSegments reports whether the segments of a name match the
+// segments of a pattern for GlobAll. The pattern must be valid.
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
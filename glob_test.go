@@ -0,0 +1,54 @@
+package zipfs
+
+import (
+	"path"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGlobAll(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	fs, err := New("testdata/testdata.zip")
+	require.NoError(err)
+	defer fs.Close()
+
+	lotsOfFiles := []string{"/lots-of-files"}
+	lotsOfFiles = append(lotsOfFiles, fs.NamesWithPrefix("/lots-of-files/")...)
+
+	testCases := []struct {
+		Pattern string
+		Names   []string
+	}{
+		{Pattern: "**/*.png", Names: []string{"/img/another-circle.png", "/img/circle.png"}},
+		{Pattern: "/**/*.png", Names: []string{"/img/another-circle.png", "/img/circle.png"}},
+		{Pattern: "lots-of-files/**", Names: lotsOfFiles},
+		{Pattern: "lots-of-files/file-1?", Names: lotsOfFiles[10:20]},
+		{Pattern: "*.html", Names: []string{"/index.html", "/test.html"}},
+		{Pattern: "**/*.[hj]*", Names: []string{"/index.html", "/js/application-23a0..js", "/test.html"}},
+		{Pattern: "**/**/circle.png", Names: []string{"/img/circle.png"}},
+		{Pattern: "img", Names: []string{"/img"}},
+		{Pattern: "*/", Names: nil},
+		{Pattern: "**/*.gif", Names: nil},
+	}
+	for _, tc := range testCases {
+		names, err := fs.GlobAll(tc.Pattern)
+		assert.NoError(err, tc.Pattern)
+		assert.Equal(tc.Names, names, tc.Pattern)
+	}
+	assert.Len(lotsOfFiles, 21)
+
+	// everything but the root
+	names, err := fs.GlobAll("**")
+	require.NoError(err)
+	all := append(fs.Names(), fs.Dirs()...)
+	sort.Strings(all)
+	assert.Equal(all, names)
+
+	_, err = fs.GlobAll("**/[a-")
+	assert.Equal(path.ErrBadPattern, err)
+}
@@ -0,0 +1,33 @@
+//go:build go1.23
+
+package zipfs
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// HandlerFunc returns a handler that serves fs, for registering with
+// an http.ServeMux pattern ending in a {path...} wildcard, such as
+// "GET /assets/{path...}". The file served is the one at the value of
+// the wildcard, so the handler can be mounted under any prefix without
+// http.StripPrefix. If the pattern has no "path" wildcard then the whole
+// path of the request is used, as for FileServer. Redirects are relative
+// to the URL requested by the client, so they include the prefix.
+func HandlerFunc(fs *FileSystem, opts ...HandlerOption) http.HandlerFunc {
+	h := FileServer(fs, opts...)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !strings.Contains(r.Pattern, "{path...}") && !strings.Contains(r.Pattern, "{path}") {
+			h.ServeHTTP(w, r)
+			return
+		}
+		r2 := r.WithContext(context.WithValue(r.Context(), originalRequestKey{}, r))
+		r2.URL = new(url.URL)
+		*r2.URL = *r.URL
+		r2.URL.Path = "/" + r.PathValue("path")
+		r2.URL.RawPath = ""
+		h.ServeHTTP(w, r2)
+	}
+}
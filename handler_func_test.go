@@ -0,0 +1,68 @@
+//go:build go1.23
+
+package zipfs
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandlerFunc(t *testing.T) {
+	assert := assert.New(t)
+
+	fs := newTestFileSystem(t, map[string]string{
+		"index.html":      "<html>root</html>",
+		"docs/index.html": "<html>docs</html>",
+		"a/b/c.txt":       "c",
+	})
+	var notFoundPath string
+	mux := http.NewServeMux()
+	mux.Handle("GET /assets/{path...}", HandlerFunc(fs, WithNotFoundHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		notFoundPath = r.URL.Path
+		w.WriteHeader(http.StatusNotFound)
+	}))))
+	mux.Handle("GET /static/", HandlerFunc(fs))
+
+	testCases := []struct {
+		Path     string
+		Status   int
+		Body     string
+		Location string
+	}{
+		{Path: "/assets/a/b/c.txt", Status: 200, Body: "c"},
+		{Path: "/assets/", Status: 200, Body: "<html>root</html>"},
+		{Path: "/assets/docs/", Status: 200, Body: "<html>docs</html>"},
+		{Path: "/assets/docs", Status: 301, Location: "/assets/docs/"},
+		{Path: "/assets/docs/index.html", Status: 301, Location: "/assets/docs/"},
+		{Path: "/assets/index.html", Status: 301, Location: "/assets/"},
+		{Path: "/assets/a/b/c.txt/", Status: 301, Location: "/assets/a/b/c.txt"},
+		{Path: "/assets/a/b/missing.txt", Status: 404},
+		// without a path wildcard the whole path is used
+		{Path: "/static/a/b/c.txt", Status: 404},
+	}
+
+	for _, tc := range testCases {
+		req := httptest.NewRequest("GET", tc.Path, nil)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		assert.Equal(tc.Status, w.Code, tc.Path)
+		if tc.Body != "" {
+			assert.Equal(tc.Body, w.Body.String(), tc.Path)
+		}
+		location := ""
+		if w.Header().Get("Location") != "" {
+			loc, err := req.URL.Parse(w.Header().Get("Location"))
+			assert.NoError(err)
+			location = loc.Path
+		}
+		assert.Equal(tc.Location, location, tc.Path)
+	}
+
+	// the not found handler is passed the request from the client
+	notFoundPath = ""
+	mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/assets/missing.txt", nil))
+	assert.Equal("/assets/missing.txt", notFoundPath)
+}
@@ -0,0 +1,83 @@
+package zipfs
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"net/textproto"
+	"path"
+	"strings"
+)
+
+// headerRule is a rule from a _headers file, which specifies
+// response headers for request paths that match a pattern.
+type headerRule struct {
+	pattern string
+	header  http.Header
+}
+
+// parseHeadersFile parses the contents of a _headers file, as used
+// by several static site hosts. Each rule starts with a line containing
+// a path pattern, which is followed by indented "Name: value" lines.
+// Lines starting with "#" are comments. Header lines that are not
+// preceded by a pattern, or that do not contain a colon, are skipped.
+// See matchSplat for the pattern syntax.
+func parseHeadersFile(r io.Reader) ([]headerRule, error) {
+	var rules []headerRule
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if line[0] != ' ' && line[0] != '\t' {
+			rules = append(rules, headerRule{
+				pattern: trimmed,
+				header:  make(http.Header),
+			})
+			continue
+		}
+		if len(rules) == 0 {
+			continue
+		}
+		i := strings.IndexByte(trimmed, ':')
+		if i <= 0 {
+			continue
+		}
+		key := textproto.TrimString(trimmed[:i])
+		value := textproto.TrimString(trimmed[i+1:])
+		rules[len(rules)-1].header.Add(key, value)
+	}
+	return rules, scanner.Err()
+}
+
+// loadHeadersFile reads the rules from the _headers file at name,
+// and hides the file from clients. If the file does not exist, or
+// cannot be read, then there are no rules.
+func (h *fileHandler) loadHeadersFile(name string) {
+	name = path.Clean("/" + name)
+	h.hide(name)
+	f, err := h.fs.Open(name)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	if rules, err := parseHeadersFile(f); err == nil {
+		h.headerRules = rules
+	}
+}
+
+// setFileHeaders sets the headers specified by the _headers file for
+// the request path. Where rules specify the same header, later rules
+// override earlier ones.
+func (h *fileHandler) setFileHeaders(w http.ResponseWriter, upath string) {
+	for _, rule := range h.headerRules {
+		if _, ok := matchSplat(rule.pattern, upath); !ok {
+			continue
+		}
+		for key, values := range rule.header {
+			w.Header()[key] = append([]string(nil), values...)
+		}
+	}
+}
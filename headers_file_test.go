@@ -0,0 +1,133 @@
+package zipfs
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatchSplat(t *testing.T) {
+	assert := assert.New(t)
+	testCases := []struct {
+		Pattern string
+		Name    string
+		Match   bool
+		Params  map[string]string
+	}{
+		{"/", "/", true, nil},
+		{"/about", "/about", true, nil},
+		{"/about", "/about/team", false, nil},
+		{"/about/team", "/about", false, nil},
+		{"/*", "/", true, map[string]string{"splat": ""}},
+		{"/*", "/a/b/c.js", true, map[string]string{"splat": "a/b/c.js"}},
+		{"/news/*", "/news", true, map[string]string{"splat": ""}},
+		{"/news/*", "/news/2020/01", true, map[string]string{"splat": "2020/01"}},
+		{"/news/*", "/newsletter", false, nil},
+		{"/users/:id", "/users/42", true, map[string]string{"id": "42"}},
+		{"/users/:id", "/users", false, nil},
+		{"/users/:id", "/users/42/settings", false, nil},
+		{"/users/:id/:page", "/users/42/settings", true, map[string]string{"id": "42", "page": "settings"}},
+		{"/users/:id/*", "/users/42/a/b", true, map[string]string{"id": "42", "splat": "a/b"}},
+		{"/a*", "/a*", true, nil},
+		{"/a*", "/abc", false, nil},
+	}
+
+	for _, tc := range testCases {
+		params, ok := matchSplat(tc.Pattern, tc.Name)
+		assert.Equal(tc.Match, ok, tc.Pattern+" "+tc.Name)
+		assert.Equal(tc.Params, params, tc.Pattern+" "+tc.Name)
+	}
+}
+
+func TestParseHeadersFile(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	const text = `  X-Ignored: no pattern yet
+# A comment
+/*
+  X-Frame-Options: DENY
+  X-Multi: one
+  X-Multi: two
+
+/img/*
+	Access-Control-Allow-Origin: *
+  # indented comment
+  not a header line
+  Link: </style.css>; rel=preload; as=style
+/users/:id
+`
+	rules, err := parseHeadersFile(strings.NewReader(text))
+	require.NoError(err)
+	require.Len(rules, 3)
+
+	assert.Equal("/*", rules[0].pattern)
+	assert.Equal(http.Header{
+		"X-Frame-Options": {"DENY"},
+		"X-Multi":         {"one", "two"},
+	}, rules[0].header)
+	assert.Equal("/img/*", rules[1].pattern)
+	assert.Equal(http.Header{
+		"Access-Control-Allow-Origin": {"*"},
+		"Link":                        {"</style.css>; rel=preload; as=style"},
+	}, rules[1].header)
+	assert.Equal("/users/:id", rules[2].pattern)
+	assert.Empty(rules[2].header)
+}
+
+func TestHeadersFile(t *testing.T) {
+	assert := assert.New(t)
+
+	fs := newTestFileSystem(t, map[string]string{
+		"_headers": `/*
+  X-Frame-Options: DENY
+  Cache-Control: public, max-age=60
+/img/*
+  Access-Control-Allow-Origin: *
+  X-Frame-Options: SAMEORIGIN
+/users/:id/profile.html
+  Cache-Control: no-cache
+`,
+		"index.html":             "<html></html>",
+		"img/logo.png":           "png",
+		"users/42/profile.html":  "<html>42</html>",
+		"users/42/settings.html": "<html>settings</html>",
+	})
+	handler := FileServer(fs, WithHeadersFile("_headers"), WithCacheControl("no-store"))
+
+	testCases := []struct {
+		Path         string
+		Status       int
+		FrameOptions string
+		CORS         string
+		CacheControl string
+	}{
+		{"/", 200, "DENY", "", "public, max-age=60"},
+		{"/img/logo.png", 200, "SAMEORIGIN", "*", "public, max-age=60"},
+		{"/users/42/profile.html", 200, "DENY", "", "no-cache"},
+		{"/users/42/settings.html", 200, "DENY", "", "public, max-age=60"},
+		{"/_headers", 404, "", "", ""},
+		{"/img/missing.png", 404, "", "", ""},
+	}
+
+	for _, tc := range testCases {
+		w := serveTestRequest(handler, "GET", tc.Path)
+		assert.Equal(tc.Status, w.status, tc.Path)
+		assert.Equal(tc.FrameOptions, w.Header().Get("X-Frame-Options"), tc.Path)
+		assert.Equal(tc.CORS, w.Header().Get("Access-Control-Allow-Origin"), tc.Path)
+		assert.Equal(tc.CacheControl, w.Header().Get("Cache-Control"), tc.Path)
+	}
+
+	// Without the option the file is served and no headers are added.
+	w := serveTestRequest(FileServer(fs), "GET", "/_headers")
+	assert.Equal(200, w.status)
+	w = serveTestRequest(FileServer(fs), "GET", "/img/logo.png")
+	assert.Equal("", w.Header().Get("X-Frame-Options"))
+
+	// A missing file is not an error.
+	w = serveTestRequest(FileServer(fs, WithHeadersFile("missing")), "GET", "/img/logo.png")
+	assert.Equal(200, w.status)
+}
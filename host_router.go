@@ -0,0 +1,86 @@
+package zipfs
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// HostRouter returns a handler that serves each virtual host from its
+// own FileSystem, chosen by the Host of the request. The handler for
+// each FileSystem is created by FileServer with the options opts. See
+// HostHandlerRouter for how hosts are matched, and for how to configure
+// each host differently.
+func HostRouter(hosts map[string]*FileSystem, fallback http.Handler, opts ...HandlerOption) http.Handler {
+	handlers := make(map[string]http.Handler, len(hosts))
+	for host, fs := range hosts {
+		handlers[host] = FileServer(fs, opts...)
+	}
+	return HostHandlerRouter(handlers, fallback)
+}
+
+// HostHandlerRouter returns a handler that passes each request to the
+// handler for the Host of the request. Hosts are matched ignoring case
+// and the port. A host of the form "*.example.com" matches any subdomain
+// of example.com, but not example.com itself, and the most specific
+// match is used. Requests for other hosts are passed to fallback, or if
+// fallback is nil, the response is 421 Misdirected Request.
+func HostHandlerRouter(handlers map[string]http.Handler, fallback http.Handler) http.Handler {
+	hr := &hostRouter{
+		handlers: make(map[string]http.Handler, len(handlers)),
+		fallback: fallback,
+	}
+	for host, handler := range handlers {
+		hr.handlers[normalizeHost(host)] = handler
+	}
+	return hr
+}
+
+type hostRouter struct {
+	handlers map[string]http.Handler // keyed by normalized host
+	fallback http.Handler
+}
+
+func (hr *hostRouter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if handler := hr.match(normalizeHost(r.Host)); handler != nil {
+		handler.ServeHTTP(w, r)
+		return
+	}
+	if hr.fallback != nil {
+		hr.fallback.ServeHTTP(w, r)
+		return
+	}
+	http.Error(w, "421 misdirected request", http.StatusMisdirectedRequest)
+}
+
+// match returns the handler for the normalized host, trying the host
+// itself and then wildcards for each of its parent domains in turn.
+func (hr *hostRouter) match(host string) http.Handler {
+	if host == "" {
+		return nil
+	}
+	if handler, ok := hr.handlers[host]; ok {
+		return handler
+	}
+	for {
+		i := strings.IndexByte(host, '.')
+		if i < 0 {
+			return nil
+		}
+		host = host[i+1:]
+		if handler, ok := hr.handlers["*."+host]; ok {
+			return handler
+		}
+	}
+}
+
+// normalizeHost returns the host without its port,
+// or a trailing dot, in lower case.
+func normalizeHost(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.TrimPrefix(strings.TrimSuffix(host, "]"), "[")
+	host = strings.TrimSuffix(host, ".")
+	return strings.ToLower(host)
+}
@@ -0,0 +1,109 @@
+package zipfs
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeHost(t *testing.T) {
+	assert := assert.New(t)
+	testCases := []struct {
+		Host     string
+		Expected string
+	}{
+		{"example.com", "example.com"},
+		{"Example.COM:8080", "example.com"},
+		{"example.com.", "example.com"},
+		{"[::1]:8080", "::1"},
+		{"[::1]", "::1"},
+		{"", ""},
+	}
+	for _, tc := range testCases {
+		assert.Equal(tc.Expected, normalizeHost(tc.Host), tc.Host)
+	}
+}
+
+func TestHostRouter(t *testing.T) {
+	assert := assert.New(t)
+
+	siteA := newTestFileSystem(t, map[string]string{
+		"index.html": "<html>a</html>",
+		"a.txt":      "a",
+	})
+	siteB := newTestFileSystem(t, map[string]string{
+		"index.html": "<html>b</html>",
+		"b.txt":      "b",
+	})
+	siteW := newTestFileSystem(t, map[string]string{
+		"index.html": "<html>wildcard</html>",
+	})
+	fallback := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+
+	serve := func(handler http.Handler, host, path string) *TestResponseWriter {
+		w := NewTestResponseWriter()
+		handler.ServeHTTP(w, &http.Request{
+			Method: "GET",
+			Host:   host,
+			URL:    &url.URL{Path: path},
+			Header: make(http.Header),
+		})
+		return w
+	}
+
+	hosts := map[string]*FileSystem{
+		"a.example.com":   siteA,
+		"B.example.com":   siteB,
+		"*.example.com":   siteW,
+		"*.b.example.com": siteB,
+	}
+
+	testCases := []struct {
+		Host   string
+		Path   string
+		Status int
+		Body   string
+	}{
+		{"a.example.com", "/", 200, "<html>a</html>"},
+		{"a.example.com", "/a.txt", 200, "a"},
+		{"A.Example.com:8080", "/a.txt", 200, "a"},
+		{"b.example.com", "/", 200, "<html>b</html>"},
+		{"b.example.com.", "/b.txt", 200, "b"},
+		// the sites are isolated from each other
+		{"a.example.com", "/b.txt", 404, ""},
+		{"b.example.com", "/a.txt", 404, ""},
+		// wildcards, with the most specific match used
+		{"c.example.com", "/", 200, "<html>wildcard</html>"},
+		{"x.y.example.com", "/", 200, "<html>wildcard</html>"},
+		{"x.b.example.com", "/b.txt", 200, "b"},
+		// unknown hosts
+		{"example.com", "/", 418, ""},
+		{"other.org", "/", 418, ""},
+		{"", "/", 418, ""},
+	}
+
+	handler := HostRouter(hosts, fallback)
+	for _, tc := range testCases {
+		w := serve(handler, tc.Host, tc.Path)
+		assert.Equal(tc.Status, w.status, tc.Host+tc.Path)
+		if tc.Body != "" {
+			assert.Equal(tc.Body, w.buf.String(), tc.Host+tc.Path)
+		}
+	}
+
+	// without a fallback
+	handler = HostRouter(hosts, nil)
+	assert.Equal(421, serve(handler, "other.org", "/").status)
+
+	// each host can be configured differently
+	handler = HostHandlerRouter(map[string]http.Handler{
+		"a.example.com": FileServer(siteA, WithCacheControl("no-store")),
+		"b.example.com": FileServer(siteB),
+	}, nil)
+	assert.Equal("no-store", serve(handler, "a.example.com", "/a.txt").Header().Get("Cache-Control"))
+	assert.Empty(serve(handler, "b.example.com", "/b.txt").Header().Get("Cache-Control"))
+}
@@ -0,0 +1,382 @@
+package zipfs
+
+import (
+	"bufio"
+	"errors"
+	"io"
+)
+
+// This file contains a simple deflate decoder (RFC 1951), based on the
+// approach taken by zlib's puff.c. It is much slower than compress/flate,
+// and is only used to find the positions of the deflate blocks in a
+// compressed file when building a seek index. The actual decompression
+// is always performed by compress/flate.
+
+var errCorruptDeflate = errors.New("corrupt deflate stream")
+
+const (
+	maxCodeBits = 15
+	windowSize  = 1 << 15
+)
+
+// bitReader reads bits, least significant first, from a byte stream.
+type bitReader struct {
+	r     io.ByteReader
+	bits  uint32
+	nbits uint
+	nread int64 // number of bytes read from r
+}
+
+func (br *bitReader) readBits(n uint) (uint32, error) {
+	for br.nbits < n {
+		b, err := br.r.ReadByte()
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return 0, err
+		}
+		br.nread++
+		br.bits |= uint32(b) << br.nbits
+		br.nbits += 8
+	}
+	v := br.bits & (1<<n - 1)
+	br.bits >>= n
+	br.nbits -= n
+	return v, nil
+}
+
+// align discards the remaining bits of the current byte.
+func (br *bitReader) align() {
+	br.bits = 0
+	br.nbits = 0
+}
+
+// bitOffset returns the number of bits consumed so far.
+func (br *bitReader) bitOffset() int64 {
+	return br.nread*8 - int64(br.nbits)
+}
+
+// huffman is a canonical Huffman code.
+type huffman struct {
+	count  [maxCodeBits + 1]uint16 // number of codes of each length
+	symbol []uint16                // symbols ordered by code
+}
+
+// init builds the code from the code length of each symbol, where a length
+// of zero means the symbol is not used. Incomplete codes are permitted,
+// but over-subscribed codes are not.
+func (h *huffman) init(lengths []uint8) error {
+	h.count = [maxCodeBits + 1]uint16{}
+	for _, l := range lengths {
+		h.count[l]++
+	}
+	left := 1
+	for l := 1; l <= maxCodeBits; l++ {
+		left <<= 1
+		left -= int(h.count[l])
+		if left < 0 {
+			return errCorruptDeflate
+		}
+	}
+
+	var offs [maxCodeBits + 1]uint16
+	for l := 1; l < maxCodeBits; l++ {
+		offs[l+1] = offs[l] + h.count[l]
+	}
+	h.symbol = make([]uint16, len(lengths))
+	for sym, l := range lengths {
+		if l != 0 {
+			h.symbol[offs[l]] = uint16(sym)
+			offs[l]++
+		}
+	}
+	return nil
+}
+
+// decode reads one symbol using the code h.
+func (br *bitReader) decode(h *huffman) (int, error) {
+	code, first, index := 0, 0, 0
+	for l := 1; l <= maxCodeBits; l++ {
+		b, err := br.readBits(1)
+		if err != nil {
+			return 0, err
+		}
+		code |= int(b)
+		count := int(h.count[l])
+		if code-count < first {
+			return int(h.symbol[index+code-first]), nil
+		}
+		index += count
+		first += count
+		first <<= 1
+		code <<= 1
+	}
+	return 0, errCorruptDeflate
+}
+
+var (
+	lengthBase  = [29]uint16{3, 4, 5, 6, 7, 8, 9, 10, 11, 13, 15, 17, 19, 23, 27, 31, 35, 43, 51, 59, 67, 83, 99, 115, 131, 163, 195, 227, 258}
+	lengthExtra = [29]uint8{0, 0, 0, 0, 0, 0, 0, 0, 1, 1, 1, 1, 2, 2, 2, 2, 3, 3, 3, 3, 4, 4, 4, 4, 5, 5, 5, 5, 0}
+	distBase    = [30]uint16{1, 2, 3, 4, 5, 7, 9, 13, 17, 25, 33, 49, 65, 97, 129, 193, 257, 385, 513, 769, 1025, 1537, 2049, 3073, 4097, 6145, 8193, 12289, 16385, 24577}
+	distExtra   = [30]uint8{0, 0, 0, 0, 1, 1, 2, 2, 3, 3, 4, 4, 5, 5, 6, 6, 7, 7, 8, 8, 9, 9, 10, 10, 11, 11, 12, 12, 13, 13}
+
+	// order of the code length code lengths
+	codeLengthOrder = [19]uint8{16, 17, 18, 0, 8, 7, 9, 6, 10, 5, 11, 4, 12, 3, 13, 2, 14, 1, 15}
+)
+
+// inflater decodes a deflate stream, keeping only the last 32KB
+// of output, which is the window used by back references.
+type inflater struct {
+	br     bitReader
+	window [windowSize]byte
+	total  int64 // total number of bytes output
+
+	// blockFunc, if not nil, is called at the start of each block.
+	blockFunc func() error
+}
+
+func newInflater(r io.Reader) *inflater {
+	return &inflater{br: bitReader{r: bufio.NewReader(r)}}
+}
+
+func (f *inflater) output(b byte) {
+	f.window[f.total&(windowSize-1)] = b
+	f.total++
+}
+
+// lastWindow returns a copy of the most recent output,
+// up to the size of the window.
+func (f *inflater) lastWindow() []byte {
+	n := f.total
+	if n > windowSize {
+		n = windowSize
+	}
+	dict := make([]byte, n)
+	start := f.total - n
+	for i := range dict {
+		dict[i] = f.window[(start+int64(i))&(windowSize-1)]
+	}
+	return dict
+}
+
+// run decodes the whole stream.
+func (f *inflater) run() error {
+	for {
+		if f.blockFunc != nil {
+			if err := f.blockFunc(); err != nil {
+				return err
+			}
+		}
+		last, err := f.br.readBits(1)
+		if err != nil {
+			return err
+		}
+		typ, err := f.br.readBits(2)
+		if err != nil {
+			return err
+		}
+		switch typ {
+		case 0:
+			err = f.stored()
+		case 1:
+			err = f.fixed()
+		case 2:
+			err = f.dynamic()
+		default:
+			err = errCorruptDeflate
+		}
+		if err != nil {
+			return err
+		}
+		if last == 1 {
+			return nil
+		}
+	}
+}
+
+func (f *inflater) stored() error {
+	f.br.align()
+	length, err := f.br.readBits(16)
+	if err != nil {
+		return err
+	}
+	nlength, err := f.br.readBits(16)
+	if err != nil {
+		return err
+	}
+	if length != ^nlength&0xffff {
+		return errCorruptDeflate
+	}
+	for i := uint32(0); i < length; i++ {
+		b, err := f.br.readBits(8)
+		if err != nil {
+			return err
+		}
+		f.output(byte(b))
+	}
+	return nil
+}
+
+var fixedLitLen, fixedDist huffman
+
+func init() {
+	var lengths [288]uint8
+	for i := range lengths {
+		switch {
+		case i < 144:
+			lengths[i] = 8
+		case i < 256:
+			lengths[i] = 9
+		case i < 280:
+			lengths[i] = 7
+		default:
+			lengths[i] = 8
+		}
+	}
+	fixedLitLen.init(lengths[:])
+	var dists [30]uint8
+	for i := range dists {
+		dists[i] = 5
+	}
+	fixedDist.init(dists[:])
+}
+
+func (f *inflater) fixed() error {
+	return f.codes(&fixedLitLen, &fixedDist)
+}
+
+func (f *inflater) dynamic() error {
+	nlen, err := f.br.readBits(5)
+	if err != nil {
+		return err
+	}
+	ndist, err := f.br.readBits(5)
+	if err != nil {
+		return err
+	}
+	ncode, err := f.br.readBits(4)
+	if err != nil {
+		return err
+	}
+	nlen += 257
+	ndist++
+	ncode += 4
+	if nlen > 286 || ndist > 30 {
+		return errCorruptDeflate
+	}
+
+	var lengths [286 + 30]uint8
+	for i := uint32(0); i < ncode; i++ {
+		l, err := f.br.readBits(3)
+		if err != nil {
+			return err
+		}
+		lengths[codeLengthOrder[i]] = uint8(l)
+	}
+	var lencode huffman
+	if err := lencode.init(lengths[:19]); err != nil {
+		return err
+	}
+	for i := 0; i < 19; i++ {
+		lengths[i] = 0
+	}
+
+	for index := uint32(0); index < nlen+ndist; {
+		sym, err := f.br.decode(&lencode)
+		if err != nil {
+			return err
+		}
+		if sym < 16 {
+			lengths[index] = uint8(sym)
+			index++
+			continue
+		}
+		var value uint8
+		var repeat uint32
+		switch sym {
+		case 16:
+			if index == 0 {
+				return errCorruptDeflate
+			}
+			value = lengths[index-1]
+			repeat, err = f.br.readBits(2)
+			repeat += 3
+		case 17:
+			repeat, err = f.br.readBits(3)
+			repeat += 3
+		default:
+			repeat, err = f.br.readBits(7)
+			repeat += 11
+		}
+		if err != nil {
+			return err
+		}
+		if index+repeat > nlen+ndist {
+			return errCorruptDeflate
+		}
+		for ; repeat > 0; repeat-- {
+			lengths[index] = value
+			index++
+		}
+	}
+	if lengths[256] == 0 {
+		// no end-of-block code
+		return errCorruptDeflate
+	}
+
+	var litlen, dist huffman
+	if err := litlen.init(lengths[:nlen]); err != nil {
+		return err
+	}
+	if err := dist.init(lengths[nlen : nlen+ndist]); err != nil {
+		return err
+	}
+	return f.codes(&litlen, &dist)
+}
+
+// codes decodes literals and back references until the end of the block.
+func (f *inflater) codes(litlen, dist *huffman) error {
+	for {
+		sym, err := f.br.decode(litlen)
+		if err != nil {
+			return err
+		}
+		if sym < 256 {
+			f.output(byte(sym))
+			continue
+		}
+		if sym == 256 {
+			return nil
+		}
+
+		sym -= 257
+		if sym >= len(lengthBase) {
+			return errCorruptDeflate
+		}
+		extra, err := f.br.readBits(uint(lengthExtra[sym]))
+		if err != nil {
+			return err
+		}
+		length := int(lengthBase[sym]) + int(extra)
+
+		sym, err = f.br.decode(dist)
+		if err != nil {
+			return err
+		}
+		if sym >= len(distBase) {
+			return errCorruptDeflate
+		}
+		extra, err = f.br.readBits(uint(distExtra[sym]))
+		if err != nil {
+			return err
+		}
+		distance := int64(distBase[sym]) + int64(extra)
+		if distance > f.total || distance > windowSize {
+			return errCorruptDeflate
+		}
+		for i := 0; i < length; i++ {
+			f.output(f.window[(f.total-distance)&(windowSize-1)])
+		}
+	}
+}
@@ -0,0 +1,34 @@
+//go:build go1.23
+
+package zipfs
+
+import (
+	iofs "io/fs"
+	"iter"
+)
+
+// All returns an iterator over the files and directories in the file
+// system, other than the root, for use in a range statement:
+//
+//	for name, info := range fs.All() {
+//		...
+//	}
+//
+// The names are rooted, such as "/img/circle.png", and are visited in
+// the same order as Walk. No slice of names is built, so it is cheaper
+// than Names for large ZIP files.
+func (fs *FileSystem) All() iter.Seq2[string, iofs.FileInfo] {
+	return func(yield func(string, iofs.FileInfo) bool) {
+		fs.ForEach(yield)
+	}
+}
+
+// InDir returns an iterator over the files and directories in the
+// directory dir, in lexical order, without descending into
+// subdirectories. If dir does not exist, or is not a directory,
+// then the iterator yields nothing.
+func (fs *FileSystem) InDir(dir string) iter.Seq2[string, iofs.FileInfo] {
+	return func(yield func(string, iofs.FileInfo) bool) {
+		fs.ForEachInDir(dir, yield)
+	}
+}
@@ -0,0 +1,52 @@
+//go:build go1.23
+
+package zipfs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAll(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	fs, err := New("testdata/testdata.zip")
+	require.NoError(err)
+	defer fs.Close()
+
+	files, dirs := 0, 0
+	for _, info := range fs.All() {
+		if info.IsDir() {
+			dirs++
+		} else {
+			files++
+		}
+	}
+	assert.Equal(len(fs.Names()), files)
+	assert.Equal(len(fs.Dirs()), dirs)
+
+	// early break
+	var names []string
+	for name := range fs.All() {
+		if name == "/index.html" {
+			break
+		}
+		names = append(names, name)
+	}
+	assert.Equal([]string{"/empty", "/img", "/img/another-circle.png", "/img/circle.png"}, names)
+
+	count := 0
+	for name, info := range fs.InDir("/lots-of-files") {
+		assert.Equal("/lots-of-files/"+info.Name(), name)
+		count++
+	}
+	assert.Equal(20, count)
+
+	for name := range fs.InDir("/") {
+		assert.Equal("/empty", name)
+		break
+	}
+}
@@ -0,0 +1,242 @@
+package zipfs
+
+import (
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// languageCodes are the two letter ISO 639-1 language codes, which are
+// recognized as the language suffixes of file names.
+var languageCodes = make(map[string]bool)
+
+func init() {
+	for _, code := range strings.Fields(`
+		aa ab ae af ak am an ar as av ay az ba be bg bh bi bm bn bo br bs
+		ca ce ch co cr cs cu cv cy da de dv dz ee el en eo es et eu fa ff
+		fi fj fo fr fy ga gd gl gn gu gv ha he hi ho hr ht hu hy hz ia id
+		ie ig ii ik io is it iu ja jv ka kg ki kj kk kl km kn ko kr ks ku
+		kv kw ky la lb lg li ln lo lt lu lv mg mh mi mk ml mn mr ms mt my
+		na nb nd ne ng nl nn no nr nv ny oc oj om or os pa pi pl ps pt qu
+		rm rn ro ru rw sa sc sd se sg si sk sl sm sn so sq sr ss st su sv
+		sw ta te tg th ti tk tl tn to tr ts tt tw ty ug uk ur uz ve vi vo
+		wa wo xh yi yo za zh zu`) {
+		languageCodes[code] = true
+	}
+}
+
+// languageSuffix returns the component of the base name of the file at
+// name that comes before its extension, such as "en" for "about.en.html",
+// or an empty string if there is no such component.
+func languageSuffix(name string) string {
+	base := path.Base(name)
+	stem := strings.TrimSuffix(base, path.Ext(base))
+	i := strings.LastIndexByte(stem, '.')
+	if i <= 0 {
+		return ""
+	}
+	return stem[i+1:]
+}
+
+// parseLanguageTag returns the language tag for a language suffix, or
+// an empty string if the suffix does not look like one. A suffix is
+// a language code, optionally followed by a four letter script code
+// and a region code, separated by hyphens or underscores, such as
+// "de", "pt-BR" or "zh_Hant". Only the two letter language codes are
+// recognized, because the three letter codes include common suffixes
+// such as "min". The tag is returned in the conventional case.
+func parseLanguageTag(suffix string) string {
+	subtags := strings.Split(strings.ReplaceAll(suffix, "_", "-"), "-")
+	if len(subtags) > 3 || !languageCodes[strings.ToLower(subtags[0])] {
+		return ""
+	}
+	tag := strings.ToLower(subtags[0])
+	subtags = subtags[1:]
+	if len(subtags) > 0 && len(subtags[0]) == 4 && isLetters(subtags[0]) {
+		tag += "-" + strings.ToUpper(subtags[0][:1]) + strings.ToLower(subtags[0][1:])
+		subtags = subtags[1:]
+	}
+	if len(subtags) > 0 {
+		switch region := subtags[0]; {
+		case len(region) == 2 && isLetters(region):
+			tag += "-" + strings.ToUpper(region)
+		case len(region) == 3 && strings.Trim(region, "0123456789") == "":
+			tag += "-" + region
+		default:
+			return ""
+		}
+		subtags = subtags[1:]
+	}
+	if len(subtags) > 0 {
+		return ""
+	}
+	return tag
+}
+
+// isLetters reports whether s consists only of ASCII letters.
+func isLetters(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if c := s[i] | 0x20; c < 'a' || c > 'z' {
+			return false
+		}
+	}
+	return true
+}
+
+// contentLanguage returns the language of the file at name, given by
+// the language suffix of its name, or an empty string if the language
+// is not known or WithLanguageSuffixes is not used.
+func (h *fileHandler) contentLanguage(name string) string {
+	if !h.languageSuffixes {
+		return ""
+	}
+	return h.languageTag(languageSuffix(name))
+}
+
+// languageTag returns the language tag for the language suffix of a file
+// name, or an empty string if the suffix is not a language.
+func (h *fileHandler) languageTag(suffix string) string {
+	if suffix == "" {
+		return ""
+	}
+	if tag, ok := h.languageTags[strings.ToLower(suffix)]; ok {
+		return tag
+	}
+	return parseLanguageTag(suffix)
+}
+
+// languageVariant is a file with a language suffix, which is served
+// for requests for the name of the file without the suffix when the
+// client prefers its language.
+type languageVariant struct {
+	name string
+	tag  string
+}
+
+// findLanguageVariants finds the files in the file system that have a
+// language suffix, keyed by their name without the suffix, so that
+// "/about.de.html" is a variant of "/about.html".
+func (h *fileHandler) findLanguageVariants() {
+	h.languageVariants = make(map[string][]languageVariant)
+	for _, zf := range h.fs.reader.File {
+		fi := h.fs.fileInfos[zf.Name]
+		if fi == nil || fi.IsDir() {
+			continue
+		}
+		name := "/" + zf.Name
+		suffix := languageSuffix(name)
+		tag := h.languageTag(suffix)
+		if tag == "" {
+			continue
+		}
+		ext := path.Ext(name)
+		canonical := strings.TrimSuffix(name, "."+suffix+ext) + ext
+		h.languageVariants[canonical] = append(h.languageVariants[canonical], languageVariant{
+			name: name,
+			tag:  tag,
+		})
+	}
+}
+
+// negotiateLanguage returns the name of the variant of the file at name
+// in the language that best matches the Accept-Language header of the
+// request, or in the default language if none match. If the file has
+// no language variants that can be served, then name is returned.
+func (h *fileHandler) negotiateLanguage(w http.ResponseWriter, r *http.Request, name string) string {
+	var variants []languageVariant
+	for _, v := range h.languageVariants[name] {
+		if !h.isHidden(v.name) && h.isAllowed(v.name) {
+			variants = append(variants, v)
+		}
+	}
+	if len(variants) == 0 {
+		return name
+	}
+	w.Header().Add("Vary", "Accept-Language")
+	for _, lr := range parseAcceptLanguage(headerList(r.Header, "Accept-Language")) {
+		if lr == "*" {
+			break
+		}
+		if v := matchLanguage(variants, lr); v != nil {
+			return v.name
+		}
+	}
+	if v := matchLanguage(variants, h.defaultLanguage); v != nil {
+		return v.name
+	}
+	return name
+}
+
+// matchLanguage returns the variant that best matches the language
+// range lr, or nil if none match. A variant matches if its tag is equal
+// to the range, or if either is a prefix of the other, so that "de-AT"
+// matches "de" and "de" matches "de-CH". An equal tag is preferred, then
+// the longest tag that is a prefix of the range, and then the first
+// variant in the range.
+func matchLanguage(variants []languageVariant, lr string) *languageVariant {
+	var best *languageVariant
+	bestScore := 0
+	for i := range variants {
+		v := &variants[i]
+		score := 0
+		switch {
+		case strings.EqualFold(v.tag, lr):
+			score = 1 << 16
+		case hasLanguagePrefix(lr, v.tag):
+			score = 1<<8 + len(v.tag)
+		case hasLanguagePrefix(v.tag, lr):
+			score = 1
+		}
+		if score > bestScore {
+			best, bestScore = v, score
+		}
+	}
+	return best
+}
+
+// hasLanguagePrefix reports whether the language tag has the prefix,
+// which must end at a subtag boundary.
+func hasLanguagePrefix(tag, prefix string) bool {
+	return len(tag) > len(prefix) && tag[len(prefix)] == '-' &&
+		strings.EqualFold(tag[:len(prefix)], prefix)
+}
+
+// parseAcceptLanguage returns the language ranges of an Accept-Language
+// header that are acceptable, in order of preference. Ranges with the
+// same quality value keep their order in the header.
+func parseAcceptLanguage(header string) []string {
+	type languageRange struct {
+		tag string
+		q   float64
+	}
+	var ranges []languageRange
+	for _, member := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(member, ";")
+		tag = strings.TrimSpace(tag)
+		if tag == "" {
+			continue
+		}
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			key, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if strings.EqualFold(key, "q") {
+				if v, err := strconv.ParseFloat(value, 64); err == nil {
+					q = v
+				}
+			}
+		}
+		if q > 0 {
+			ranges = append(ranges, languageRange{tag, q})
+		}
+	}
+	sort.SliceStable(ranges, func(i, j int) bool {
+		return ranges[i].q > ranges[j].q
+	})
+	tags := make([]string, len(ranges))
+	for i, lr := range ranges {
+		tags[i] = lr.tag
+	}
+	return tags
+}
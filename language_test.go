@@ -0,0 +1,169 @@
+package zipfs
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLanguageTag(t *testing.T) {
+	testCases := []struct {
+		Suffix string
+		Tag    string
+	}{
+		{"en", "en"},
+		{"DE", "de"},
+		{"pt-br", "pt-BR"},
+		{"pt_BR", "pt-BR"},
+		{"zh-hant", "zh-Hant"},
+		{"zh-Hant-TW", "zh-Hant-TW"},
+		{"es-419", "es-419"},
+		{"min", ""},
+		{"js", ""},
+		{"e1", ""},
+		{"en-", ""},
+		{"en-USA", ""},
+		{"en-US-x", ""},
+		{"", ""},
+	}
+	for _, tc := range testCases {
+		assert.Equal(t, tc.Tag, parseLanguageTag(tc.Suffix), tc.Suffix)
+	}
+}
+
+func TestLanguageSuffixes(t *testing.T) {
+	assert := assert.New(t)
+
+	fs := newTestFileSystem(t, map[string]string{
+		"about.en.html":    "about",
+		"about.de.html":    "über",
+		"about.fr.html":    "à propos",
+		"about.pt-BR.html": "sobre",
+		"about.html":       "about",
+		"min.js":           "x()",
+		"jquery.min.js":    "x()",
+		"styles.ie.css":    "body {}",
+		"hello.chr.txt":    "ᎣᏏᏲ",
+		"en.html":          "en",
+	})
+	handler := FileServer(fs, WithLanguageSuffixes(), WithLanguageTags(map[string]string{
+		"IE":  "",
+		"chr": "chr",
+	}))
+
+	testCases := []struct {
+		Path     string
+		Language string
+	}{
+		{"/about.en.html", "en"},
+		{"/about.de.html", "de"},
+		{"/about.fr.html", "fr"},
+		{"/about.pt-BR.html", "pt-BR"},
+		{"/about.html", ""},
+		{"/min.js", ""},
+		{"/jquery.min.js", ""},
+		{"/styles.ie.css", ""},
+		{"/hello.chr.txt", "chr"},
+		{"/en.html", ""},
+	}
+	for _, tc := range testCases {
+		for _, headers := range [][]string{nil, {"Range: bytes=0-1"}} {
+			w := serveTestRequest(handler, "GET", tc.Path, headers...)
+			assert.Contains([]int{200, 206}, w.status, tc.Path)
+			assert.Equal(tc.Language, w.Header().Get("Content-Language"), tc.Path, headers)
+		}
+	}
+
+	// off by default
+	w := serveTestRequest(FileServer(fs), "GET", "/about.de.html")
+	assert.Equal(200, w.status)
+	assert.Empty(w.Header().Get("Content-Language"))
+}
+
+func TestParseAcceptLanguage(t *testing.T) {
+	testCases := []struct {
+		Header string
+		Ranges []string
+	}{
+		{"", []string{}},
+		{"de", []string{"de"}},
+		{"fr;q=0.5, de-AT, en;q=0.8", []string{"de-AT", "en", "fr"}},
+		{"en;q=0, de", []string{"de"}},
+		{"*;q=0.1, fr ; q=0.9", []string{"fr", "*"}},
+		{"de;q=bad, , en", []string{"de", "en"}},
+	}
+	for _, tc := range testCases {
+		assert.Equal(t, tc.Ranges, parseAcceptLanguage(tc.Header), tc.Header)
+	}
+}
+
+func TestLanguageNegotiation(t *testing.T) {
+	assert := assert.New(t)
+
+	fs := newTestFileSystem(t, map[string]string{
+		"about.en.html":       "about",
+		"about.de.html":       "über",
+		"about.fr.html":       "à propos",
+		"about.pt-BR.html":    "sobre",
+		"index.en.html":       "home",
+		"index.de.html":       "start",
+		"docs/guide.de.txt":   "Anleitung",
+		"docs/guide.txt":      "guide",
+		"contact.de.html":     "Kontakt",
+		"plain.html":          "plain",
+		"secret/info.de.html": "geheim",
+	})
+	handler := FileServer(fs,
+		WithLanguageNegotiation("en"),
+		WithAliases(map[string]string{"/": "/index.html"}),
+		WithDeny("/secret/**"))
+
+	testCases := []struct {
+		Path     string
+		Accept   string
+		Status   int
+		Body     string
+		Language string
+		Vary     bool
+	}{
+		// exact match
+		{Path: "/about.html", Accept: "de", Status: 200, Body: "über", Language: "de", Vary: true},
+		{Path: "/about.html", Accept: "fr, de;q=0.9", Status: 200, Body: "à propos", Language: "fr", Vary: true},
+		{Path: "/about.html", Accept: "fr;q=0.5, de;q=0.9", Status: 200, Body: "über", Language: "de", Vary: true},
+		{Path: "/about.html", Accept: "pt-br", Status: 200, Body: "sobre", Language: "pt-BR", Vary: true},
+		// primary tag match
+		{Path: "/about.html", Accept: "de-AT", Status: 200, Body: "über", Language: "de", Vary: true},
+		{Path: "/about.html", Accept: "pt", Status: 200, Body: "sobre", Language: "pt-BR", Vary: true},
+		// fallback to the default language
+		{Path: "/about.html", Accept: "ja", Status: 200, Body: "about", Language: "en", Vary: true},
+		{Path: "/about.html", Accept: "de;q=0, ja", Status: 200, Body: "about", Language: "en", Vary: true},
+		{Path: "/about.html", Status: 200, Body: "about", Language: "en", Vary: true},
+		{Path: "/about.html", Accept: "*", Status: 200, Body: "about", Language: "en", Vary: true},
+		// the variants remain available
+		{Path: "/about.fr.html", Accept: "de", Status: 200, Body: "à propos", Language: "fr"},
+		// the root index by alias
+		{Path: "/", Accept: "de-DE", Status: 200, Body: "start", Language: "de", Vary: true},
+		// a file without a suffix is the fallback without a default variant
+		{Path: "/docs/guide.txt", Accept: "de", Status: 200, Body: "Anleitung", Language: "de", Vary: true},
+		{Path: "/docs/guide.txt", Accept: "fr", Status: 200, Body: "guide", Vary: true},
+		{Path: "/contact.html", Accept: "fr", Status: 404, Vary: true},
+		{Path: "/plain.html", Accept: "de", Status: 200, Body: "plain"},
+		// hidden variants are not served
+		{Path: "/secret/info.html", Accept: "de", Status: 404},
+	}
+	for _, tc := range testCases {
+		var headers []string
+		if tc.Accept != "" {
+			headers = append(headers, "Accept-Language: "+tc.Accept)
+		}
+		w := serveTestRequest(handler, "GET", tc.Path, headers...)
+		assert.Equal(tc.Status, w.status, tc.Path, tc.Accept)
+		if tc.Status == 200 {
+			assert.Equal(tc.Body, w.buf.String(), tc.Path, tc.Accept)
+			assert.Equal(tc.Language, w.Header().Get("Content-Language"), tc.Path, tc.Accept)
+		}
+		vary := strings.Join(w.Header().Values("Vary"), ", ")
+		assert.Equal(tc.Vary, strings.Contains(vary, "Accept-Language"), tc.Path, tc.Accept)
+	}
+}
@@ -0,0 +1,199 @@
+package zipfs
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"html/template"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Listing is the data passed to the template that
+// renders a directory listing.
+type Listing struct {
+	// Path is the path of the directory within the file
+	// system, which always ends with a slash.
+	Path string
+
+	// Entries are the files and directories in the
+	// directory, sorted by name.
+	Entries []ListingEntry
+}
+
+// ListingEntry is a file or directory in a directory listing.
+type ListingEntry struct {
+	// Name is the name of the file. The name of a
+	// directory ends with a slash.
+	Name string
+
+	// URL is the escaped URL of the file, relative
+	// to the URL of the directory listing.
+	URL string
+
+	Size    int64
+	ModTime time.Time
+	IsDir   bool
+
+	// ETag is the ETag of the file, if it has one.
+	ETag string
+}
+
+// jsonListingEntry is an entry in a directory listing in JSON format.
+type jsonListingEntry struct {
+	Name    string    `json:"name"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+	IsDir   bool      `json:"isDir"`
+	ETag    string    `json:"etag,omitempty"`
+}
+
+var defaultListingTemplate = template.Must(template.New("listing").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Index of {{.Path}}</title>
+</head>
+<body>
+<h1>Index of {{.Path}}</h1>
+<table>
+<tr><th>Name</th><th>Size</th><th>Modified</th></tr>
+{{range .Entries}}<tr><td><a href="{{.URL}}">{{.Name}}</a></td><td>{{if not .IsDir}}{{.Size}}{{end}}</td><td>{{.ModTime.UTC.Format "2006-01-02 15:04:05"}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// listing returns the listing of the directory d, found at name.
+// The URLs of the entries are relative to the request path upath.
+func (h *fileHandler) listing(upath string, name string, d *fileInfo) (*Listing, error) {
+	osFileInfos, err := d.readdir()
+	if err != nil {
+		return nil, err
+	}
+
+	dir := strings.TrimSuffix(name, "/") + "/"
+	// Without a trailing slash in the request path, relative
+	// URLs are resolved against the parent directory.
+	var prefix string
+	if !strings.HasSuffix(upath, "/") {
+		prefix = path.Base(upath) + "/"
+	}
+
+	listing := &Listing{Path: dir}
+	for _, osFileInfo := range osFileInfos {
+		fi := osFileInfo.(*fileInfo)
+		entryName := fi.Name()
+		if h.isHidden(dir+entryName) || (!fi.IsDir() && !h.isAllowed(dir+entryName)) {
+			continue
+		}
+		if fi.IsDir() {
+			entryName += "/"
+		}
+		u := url.URL{Path: prefix + entryName}
+		entry := ListingEntry{
+			Name:    entryName,
+			URL:     u.String(),
+			Size:    fi.Size(),
+			ModTime: fi.ModTime(),
+			IsDir:   fi.IsDir(),
+		}
+		if !fi.IsDir() {
+			entry.ETag = h.etag(dir+fi.Name(), fi)
+		}
+		listing.Entries = append(listing.Entries, entry)
+	}
+	return listing, nil
+}
+
+// serveListing serves a listing of the directory d, found at name.
+// The listing is in JSON format if the client accepts JSON,
+// and otherwise it is rendered as HTML.
+func (h *fileHandler) serveListing(w http.ResponseWriter, r *http.Request, name string, d *fileInfo) {
+	listing, err := h.listing(r.URL.Path, name, d)
+	if err != nil {
+		h.error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Add("Vary", "Accept")
+	if acceptsJSON(r) {
+		h.serveJSONListing(w, r, listing)
+		return
+	}
+
+	tmpl := h.listingTemplate
+	if tmpl == nil {
+		tmpl = defaultListingTemplate
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, listing); err != nil {
+		h.error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	setContentType(w, "text/html; charset=utf-8")
+	h.setNoSniff(w, nil)
+	writeListing(w, r, buf.Bytes())
+}
+
+// serveJSONListing serves a directory listing as a JSON array. The
+// ETag of the response is calculated from its content, so that
+// clients can make conditional requests for listings.
+func (h *fileHandler) serveJSONListing(w http.ResponseWriter, r *http.Request, listing *Listing) {
+	entries := make([]jsonListingEntry, len(listing.Entries))
+	for i, entry := range listing.Entries {
+		entries[i] = jsonListingEntry{
+			Name:    strings.TrimSuffix(entry.Name, "/"),
+			Size:    entry.Size,
+			ModTime: entry.ModTime,
+			IsDir:   entry.IsDir,
+			ETag:    entry.ETag,
+		}
+	}
+	data, err := json.Marshal(entries)
+	if err != nil {
+		h.error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	hash := fnv.New64a()
+	hash.Write(data)
+	w.Header().Set("Etag", fmt.Sprintf(`"%x"`, hash.Sum64()))
+	setContentType(w, "application/json")
+	h.setNoSniff(w, nil)
+	if h.checkPreconditions(w, r, time.Time{}) {
+		return
+	}
+	writeListing(w, r, data)
+}
+
+func writeListing(w http.ResponseWriter, r *http.Request, data []byte) {
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.WriteHeader(http.StatusOK)
+	if r.Method != "HEAD" {
+		w.Write(data)
+	}
+}
+
+// acceptsJSON reports whether the Accept header of the request
+// includes the JSON media type.
+func acceptsJSON(r *http.Request) bool {
+	for _, member := range strings.Split(headerList(r.Header, "Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(member)
+		if err != nil || mediaType != "application/json" {
+			continue
+		}
+		if q, err := strconv.ParseFloat(params["q"], 64); err == nil && q == 0 {
+			continue
+		}
+		return true
+	}
+	return false
+}
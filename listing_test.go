@@ -0,0 +1,206 @@
+package zipfs
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var hrefRegexp = regexp.MustCompile(`href="([^"]*)">([^<]*)<`)
+
+// listingLinks returns the links and their text in an HTML listing.
+func listingLinks(body string) [][2]string {
+	var links [][2]string
+	for _, m := range hrefRegexp.FindAllStringSubmatch(body, -1) {
+		links = append(links, [2]string{m[1], m[2]})
+	}
+	return links
+}
+
+func TestDirectoryListing(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	fs, err := New("testdata/testdata.zip")
+	require.NoError(err)
+	defer fs.Close()
+	handler := FileServer(fs, WithDirectoryListing())
+
+	w := serveTestRequest(handler, "GET", "/img/")
+	assert.Equal(200, w.status)
+	assert.Equal("text/html; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Contains(w.buf.String(), "Index of /img/")
+	assert.Equal([][2]string{
+		{"another-circle.png", "another-circle.png"},
+		{"circle.png", "circle.png"},
+	}, listingLinks(w.buf.String()))
+
+	w = serveTestRequest(handler, "GET", "/lots-of-files/")
+	assert.Equal(200, w.status)
+	links := listingLinks(w.buf.String())
+	require.Len(links, 20)
+	for i, link := range links {
+		name := fmt.Sprintf("file-%02d", i+1)
+		assert.Equal([2]string{name, name}, link)
+	}
+
+	// a listing is served, so the directory is redirected
+	w = serveTestRequest(handler, "GET", "/img")
+	assert.Equal(301, w.status)
+	assert.Equal("img/", w.Header().Get("Location"))
+
+	// directories with an index are not listed
+	w = serveTestRequest(handler, "GET", "/")
+	assert.NotContains(w.buf.String(), "Index of")
+
+	w = serveTestRequest(handler, "HEAD", "/img/")
+	assert.Equal(200, w.status)
+	assert.Equal(0, w.buf.Len())
+}
+
+func TestDirectoryListingEscaping(t *testing.T) {
+	assert := assert.New(t)
+
+	fs := newTestFileSystem(t, map[string]string{
+		"dir/a&b <c>.txt": "1",
+		"dir/50%.txt":     "2",
+		"dir/x:y.txt":     "3",
+		"dir/sub dir/":    "",
+		"dir/_headers":    "/*\n  X-Test: 1\n",
+	})
+	handler := FileServer(fs, WithDirectoryListing(), WithHeadersFile("/dir/_headers"))
+
+	w := serveTestRequest(handler, "GET", "/dir/")
+	assert.Equal(200, w.status)
+	assert.Equal([][2]string{
+		{"50%25.txt", "50%.txt"},
+		{"a&amp;b%20%3Cc%3E.txt", "a&amp;b &lt;c&gt;.txt"},
+		{"sub%20dir/", "sub dir/"},
+		{"./x:y.txt", "x:y.txt"},
+	}, listingLinks(w.buf.String()))
+
+	// without a trailing slash, links include the directory name
+	handler = FileServer(fs, WithDirectoryListing(), WithTrailingSlashPolicy(TrailingSlashStrip))
+	w = serveTestRequest(handler, "GET", "/dir")
+	assert.Equal(200, w.status)
+	links := listingLinks(w.buf.String())
+	assert.Contains(links, [2]string{"dir/sub%20dir/", "sub dir/"})
+	assert.Contains(links, [2]string{"dir/_headers", "_headers"})
+}
+
+func TestListingTemplate(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	fs, err := New("testdata/testdata.zip")
+	require.NoError(err)
+	defer fs.Close()
+
+	tmpl := template.Must(template.New("").Parse(
+		`{{.Path}}{{range .Entries}} {{.Name}}={{.Size}}{{end}}`))
+	handler := FileServer(fs, WithListingTemplate(tmpl))
+
+	w := serveTestRequest(handler, "GET", "/img/")
+	assert.Equal(200, w.status)
+	assert.Equal("/img/ another-circle.png=5973 circle.png=5973", w.buf.String())
+}
+
+func TestJSONListing(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	fs, err := New("testdata/testdata.zip")
+	require.NoError(err)
+	defer fs.Close()
+	handler := FileServer(fs, WithDirectoryListing())
+
+	w := serveTestRequest(handler, "GET", "/img/", "Accept: application/json")
+	assert.Equal(200, w.status)
+	assert.Equal("application/json", w.Header().Get("Content-Type"))
+	assert.Equal("Accept", w.Header().Get("Vary"))
+	etag := w.Header().Get("Etag")
+	assert.NotEmpty(etag)
+
+	var entries []struct {
+		Name    string    `json:"name"`
+		Size    int64     `json:"size"`
+		ModTime time.Time `json:"modTime"`
+		IsDir   bool      `json:"isDir"`
+		ETag    string    `json:"etag"`
+	}
+	require.NoError(json.Unmarshal(w.buf.Bytes(), &entries))
+	require.Len(entries, 2)
+	assert.Equal("another-circle.png", entries[0].Name)
+	assert.Equal("circle.png", entries[1].Name)
+	assert.Equal(`"1755529fb2ff"`, entries[1].ETag)
+	for _, entry := range entries {
+		assert.Equal(int64(5973), entry.Size)
+		assert.False(entry.IsDir)
+		assert.Equal(2016, entry.ModTime.Year())
+	}
+
+	w = serveTestRequest(handler, "GET", "/img/", "Accept: application/json", "If-None-Match: "+etag)
+	assert.Equal(304, w.status)
+	assert.Equal(0, w.buf.Len())
+
+	// directories are included, without a trailing slash or ETag
+	w = serveTestRequest(handler, "GET", "/empty/", "Accept: text/html;q=0.9, application/json")
+	assert.Equal(200, w.status)
+	assert.Equal("[]", w.buf.String())
+
+	testCases := []string{
+		"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8",
+		"application/json;q=0",
+		"",
+	}
+	for _, accept := range testCases {
+		w = serveTestRequest(handler, "GET", "/img/", "Accept: "+accept)
+		assert.Equal(200, w.status, accept)
+		assert.Equal("text/html; charset=utf-8", w.Header().Get("Content-Type"), accept)
+	}
+}
+
+func TestNoIndexBehavior(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	fs, err := New("testdata/testdata.zip")
+	require.NoError(err)
+	defer fs.Close()
+
+	testCases := []struct {
+		Behavior NoIndexBehavior
+		Path     string
+		Status   int
+		Location string
+	}{
+		{Behavior: NoIndexForbidden, Path: "/empty", Status: 403},
+		{Behavior: NoIndexForbidden, Path: "/empty/", Status: 403},
+		{Behavior: NoIndexForbidden, Path: "/lots-of-files", Status: 403},
+		{Behavior: NoIndexForbidden, Path: "/lots-of-files/", Status: 403},
+		{Behavior: NoIndexNotFound, Path: "/empty", Status: 404},
+		{Behavior: NoIndexNotFound, Path: "/empty/", Status: 404},
+		{Behavior: NoIndexNotFound, Path: "/lots-of-files", Status: 404},
+		{Behavior: NoIndexNotFound, Path: "/lots-of-files/", Status: 404},
+		{Behavior: NoIndexListing, Path: "/empty", Status: 301, Location: "empty/"},
+		{Behavior: NoIndexListing, Path: "/empty/", Status: 200},
+		{Behavior: NoIndexListing, Path: "/lots-of-files", Status: 301, Location: "lots-of-files/"},
+		{Behavior: NoIndexListing, Path: "/lots-of-files/", Status: 200},
+	}
+	for _, tc := range testCases {
+		handler := FileServer(fs, WithNoIndexBehavior(tc.Behavior))
+		w := serveTestRequest(handler, "GET", tc.Path)
+		assert.Equal(tc.Status, w.status, "%d %s", tc.Behavior, tc.Path)
+		assert.Equal(tc.Location, w.Header().Get("Location"), "%d %s", tc.Behavior, tc.Path)
+		if tc.Behavior == NoIndexNotFound {
+			missing := serveTestRequest(handler, "GET", "/does-not-exist")
+			assert.Equal(missing.buf.String(), w.buf.String(), tc.Path)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package zipfs
+
+import (
+	"fmt"
+	iofs "io/fs"
+	"os"
+	"strings"
+	"testing/fstest"
+)
+
+// Materialize decompresses all of the files in the file system into
+// memory, and returns them as an fstest.MapFS, which can be served using
+// http.FS without any further decompression. The files have the modes
+// and modification times recorded in the ZIP file, and symbolic links
+// are entries with the os.ModeSymlink mode whose data is the target.
+// Directories without entries of their own are included, so that they
+// have the same modification times as in the file system. The names have
+// no leading slash, as for any fs.FS.
+//
+// If the total size of the files is more than maxBytes, then Materialize
+// returns an error without decompressing any of them.
+func (fs *FileSystem) Materialize(maxBytes int64) (iofs.FS, error) {
+	if fs.reader == nil {
+		return nil, ErrClosed
+	}
+	var total int64
+	for _, zf := range fs.reader.File {
+		total += uncompressedSize(zf)
+	}
+	if total > maxBytes {
+		return nil, fmt.Errorf("zipfs: materialize: %d bytes is more than %d: %w", total, maxBytes, errFileTooLarge)
+	}
+
+	mapFS := make(fstest.MapFS)
+	for key, fi := range fs.fileInfos {
+		// Directories have two keys.
+		if key != fi.name || key == "/" {
+			continue
+		}
+		name := strings.TrimSuffix(fi.name, "/")
+		zf := fi.zipFile
+		if zf == nil {
+			mapFS[name] = &fstest.MapFile{Mode: os.ModeDir | 0555, ModTime: dirTime}
+			continue
+		}
+		file := &fstest.MapFile{Mode: zf.Mode(), ModTime: zf.Modified}
+		if !fi.IsDir() {
+			data, err := readZipFile(zf)
+			if err != nil {
+				return nil, &os.PathError{Op: "Materialize", Path: "/" + name, Err: err}
+			}
+			file.Data = data
+		}
+		mapFS[name] = file
+	}
+	return mapFS, nil
+}
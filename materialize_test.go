@@ -0,0 +1,71 @@
+package zipfs
+
+import (
+	"errors"
+	iofs "io/fs"
+	"os"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/spexp/zipfs/zipfstest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMaterialize(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	fs, err := New("testdata/testdata.zip")
+	require.NoError(err)
+	defer fs.Close()
+
+	mfs, err := fs.Materialize(1 << 20)
+	require.NoError(err)
+	var names []string
+	for _, name := range fs.Names() {
+		names = append(names, strings.TrimPrefix(name, "/"))
+	}
+	require.NoError(fstest.TestFS(mfs, names...))
+
+	for _, zf := range fs.reader.File {
+		name := strings.TrimSuffix(zf.Name, "/")
+		info, err := iofs.Stat(mfs, name)
+		require.NoError(err, name)
+		assert.Equal(zf.Mode(), info.Mode(), name)
+		assert.True(zf.Modified.Equal(info.ModTime()), name)
+		if zf.Mode().IsDir() {
+			continue
+		}
+		data, err := iofs.ReadFile(mfs, name)
+		require.NoError(err)
+		want, err := readZipFile(zf)
+		require.NoError(err)
+		assert.Equal(want, data, name)
+	}
+
+	_, err = fs.Materialize(22405)
+	assert.True(errors.Is(err, errFileTooLarge), err)
+	_, err = fs.Materialize(22406)
+	assert.NoError(err)
+
+	// directories without entries, and symbolic links
+	fs = newBuilderFileSystem(t, zipfstest.NewBuilder().
+		AddDeflated("a/b/c.txt", []byte("c")).
+		AddSymlink("a/link", "b/c.txt"))
+	mfs, err = fs.Materialize(100)
+	require.NoError(err)
+	info, err := iofs.Stat(mfs, "a/b")
+	require.NoError(err)
+	assert.True(info.IsDir())
+	assert.True(dirTime.Equal(info.ModTime()))
+	link := mfs.(fstest.MapFS)["a/link"]
+	require.NotNil(link)
+	assert.Equal(os.ModeSymlink|0777, link.Mode)
+	assert.Equal("b/c.txt", string(link.Data))
+
+	fs.Close()
+	_, err = fs.Materialize(100)
+	assert.True(errors.Is(err, ErrClosed), err)
+}
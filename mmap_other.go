@@ -0,0 +1,18 @@
+//go:build !unix
+
+package zipfs
+
+import (
+	"errors"
+	"os"
+)
+
+// mmapFile is not supported on this platform, so
+// temporary files are always read with read system calls.
+func mmapFile(file *os.File) ([]byte, error) {
+	return nil, errors.New("mmap not supported")
+}
+
+func munmap(data []byte) error {
+	return nil
+}
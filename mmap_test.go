@@ -0,0 +1,76 @@
+//go:build unix
+
+package zipfs
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMmap(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	data := make([]byte, 200000)
+	for i := range data {
+		data[i] = byte(i * i >> 8)
+	}
+	fs := newTestFileSystem(t, map[string]string{
+		"large.bin": string(data),
+	}, WithMmap(), WithMemorySeekLimit(0))
+
+	// seeking reads from the mapping
+	f, err := fs.Open("/large.bin")
+	require.NoError(err)
+	for _, offset := range []int64{150000, 100, 199990, 0} {
+		pos, err := f.Seek(offset, io.SeekStart)
+		require.NoError(err)
+		assert.Equal(offset, pos)
+		buf := make([]byte, 10)
+		_, err = io.ReadFull(f, buf)
+		require.NoError(err)
+		assert.Equal(data[offset:offset+10], buf, offset)
+	}
+	assert.NotNil(f.(*fileReader).mapped)
+	rest, err := io.ReadAll(f)
+	require.NoError(err)
+	assert.Equal(data[10:], rest)
+
+	// as does ReadAt, from any number of goroutines
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			buf := make([]byte, 30000)
+			off := int64(i * 20000)
+			n, err := f.(io.ReaderAt).ReadAt(buf, off)
+			assert.NoError(err)
+			assert.Equal(data[off:off+int64(n)], buf[:n])
+		}(i)
+	}
+	wg.Wait()
+	assert.NotNil(f.(*fileReader).readAtMapped)
+	require.NoError(f.Close())
+	assert.Nil(f.(*fileReader).mapped)
+	assert.Nil(f.(*fileReader).readAtMapped)
+	_, err = f.(io.ReaderAt).ReadAt(make([]byte, 10), 0)
+	assert.ErrorIs(err, ErrFileClosed)
+
+	// range requests
+	handler := FileServer(fs)
+	for _, r := range [][2]int{{0, 99}, {100000, 100999}, {199000, 199999}} {
+		w := serveTestRequest(handler, "GET", "/large.bin", fmt.Sprintf("Range: bytes=%d-%d", r[0], r[1]))
+		assert.Equal(206, w.status)
+		assert.Equal(data[r[0]:r[1]+1], w.buf.Bytes())
+	}
+	w := serveTestRequest(handler, "GET", "/large.bin", "Range: bytes=10-19,100-109")
+	assert.Equal(206, w.status)
+	assert.Contains(w.buf.String(), string(data[100:110]))
+
+}
@@ -0,0 +1,29 @@
+//go:build unix
+
+package zipfs
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// mmapFile maps the contents of file into memory, read only. The
+// mapping remains valid after the file is closed, until it is passed
+// to munmap.
+func mmapFile(file *os.File) ([]byte, error) {
+	stat, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := stat.Size()
+	if size <= 0 || int64(int(size)) != size {
+		return nil, fmt.Errorf("cannot map %d bytes", size)
+	}
+	return syscall.Mmap(int(file.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+}
+
+// munmap removes a mapping returned by mmapFile.
+func munmap(data []byte) error {
+	return syscall.Munmap(data)
+}
@@ -0,0 +1,54 @@
+package zipfs
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+)
+
+// Mount returns a handler that serves fs under the path prefix, such as
+// "/static/". The prefix is removed from the path of each request to
+// find the file to serve, as with http.StripPrefix, and paths outside the
+// prefix are not found. Unlike with http.StripPrefix, the handler knows
+// the path requested by the client, so its redirects are to absolute
+// paths that include the prefix, as are the absolute locations of the
+// rules of a _redirects file. A request for the prefix without a
+// trailing slash is redirected to the prefix with one.
+func Mount(prefix string, fs *FileSystem, opts ...HandlerOption) http.Handler {
+	h := FileServer(fs, opts...).(*fileHandler)
+	h.mountPrefix = strings.TrimSuffix(path.Clean("/"+prefix), "/")
+	return h
+}
+
+// unmount returns a copy of the request with the mount prefix removed
+// from its path. If the path is not under the prefix, or is the prefix
+// without a trailing slash, then unmount responds to the request itself
+// and returns nil.
+func (h *fileHandler) unmount(w http.ResponseWriter, r *http.Request) *http.Request {
+	rest, ok := strings.CutPrefix(r.URL.Path, h.mountPrefix)
+	if !ok || (rest != "" && rest[0] != '/') {
+		h.error(w, r, http.StatusNotFound, os.ErrNotExist)
+		return nil
+	}
+	if rest == "" {
+		if !h.noRedirects {
+			loc := h.externalPrefix(r) + "/"
+			if q := r.URL.RawQuery; q != "" {
+				loc += "?" + q
+			}
+			w.Header().Set("Location", loc)
+			w.WriteHeader(h.redirectStatus)
+			return nil
+		}
+		rest = "/"
+	}
+	r2 := r.WithContext(context.WithValue(r.Context(), originalRequestKey{}, r))
+	r2.URL = new(url.URL)
+	*r2.URL = *r.URL
+	r2.URL.Path = rest
+	r2.URL.RawPath = ""
+	return r2
+}
@@ -0,0 +1,89 @@
+package zipfs
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMount(t *testing.T) {
+	assert := assert.New(t)
+
+	fs := newTestFileSystem(t, map[string]string{
+		"index.html":      "<html>root</html>",
+		"docs/index.html": "<html>docs</html>",
+		"img/circle.png":  "png",
+		"_redirects":      "/old.png  /img/circle.png  302\n",
+	})
+
+	testCases := []struct {
+		Opts     []HandlerOption
+		Path     string
+		Status   int
+		Body     string
+		Location string
+	}{
+		{Path: "/static/assets/img/circle.png", Status: 200, Body: "png"},
+		{Path: "/static/assets/", Status: 200, Body: "<html>root</html>"},
+		{Path: "/static/assets/docs/", Status: 200, Body: "<html>docs</html>"},
+		{Path: "/static/assets", Status: 301, Location: "/static/assets/"},
+		{Path: "/static/assets?v=1", Status: 301, Location: "/static/assets/?v=1"},
+		{Path: "/static/assets/docs", Status: 301, Location: "/static/assets/docs/"},
+		{Path: "/static/assets/docs/index.html", Status: 301, Location: "/static/assets/docs/"},
+		{Path: "/static/assets/index.html", Status: 301, Location: "/static/assets/"},
+		{Path: "/static/assets/img/circle.png/", Status: 301, Location: "/static/assets/img/circle.png"},
+		{Path: "/static/assets/docs?q=1", Status: 301, Location: "/static/assets/docs/?q=1"},
+		{Path: "/static/assets/missing.png", Status: 404},
+		// paths outside the prefix
+		{Path: "/static/assetsx/img/circle.png", Status: 404},
+		{Path: "/static/img/circle.png", Status: 404},
+		{Path: "/img/circle.png", Status: 404},
+		// with the trailing slash stripped
+		{
+			Opts:     []HandlerOption{WithTrailingSlashPolicy(TrailingSlashStrip)},
+			Path:     "/static/assets/docs/",
+			Status:   301,
+			Location: "/static/assets/docs",
+		},
+		{
+			Opts:     []HandlerOption{WithTrailingSlashPolicy(TrailingSlashStrip)},
+			Path:     "/static/assets/docs/index.html",
+			Status:   301,
+			Location: "/static/assets/docs",
+		},
+		{
+			Opts:   []HandlerOption{WithoutRedirects()},
+			Path:   "/static/assets",
+			Status: 200,
+			Body:   "<html>root</html>",
+		},
+		// absolute locations in the _redirects file are under the prefix
+		{
+			Opts:     []HandlerOption{WithRedirectsFile("_redirects")},
+			Path:     "/static/assets/old.png",
+			Status:   302,
+			Location: "/static/assets/img/circle.png",
+		},
+	}
+
+	for _, tc := range testCases {
+		for _, prefix := range []string{"/static/assets/", "/static/assets", "static/assets"} {
+			handler := Mount(prefix, fs, tc.Opts...)
+			w := serveTestRequest(handler, "GET", tc.Path)
+			assert.Equal(tc.Status, w.status, prefix, tc.Path)
+			assert.Equal(tc.Location, w.Header().Get("Location"), prefix, tc.Path)
+			if tc.Body != "" {
+				assert.Equal(tc.Body, w.buf.String(), prefix, tc.Path)
+			}
+		}
+	}
+
+	// the not found handler is passed the request from the client
+	var notFoundPath string
+	handler := Mount("/static/", fs, WithNotFoundHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		notFoundPath = r.URL.Path
+	})))
+	serveTestRequest(handler, "GET", "/static/missing.png")
+	assert.Equal("/static/missing.png", notFoundPath)
+}
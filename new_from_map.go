@@ -0,0 +1,72 @@
+package zipfs
+
+import (
+	"archive/zip"
+	"bytes"
+	iofs "io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// NewFromMap returns a file system with the files in the map, keyed
+// by name, such as "img/circle.png". It is intended for tests of code
+// that uses a FileSystem, without the need for a ZIP file in testdata.
+//
+// A real ZIP file is built in memory, with each file compressed using
+// deflate, so the file system behaves exactly as it would with a ZIP
+// file on disk. Entries are added for the directories containing the
+// files, and a name ending in a slash adds an empty directory. All of
+// the entries have the modification time 1 January 2001, UTC. A leading
+// slash on a name is ignored, and any other name that is not valid for
+// fs.ValidPath is an error.
+func NewFromMap(files map[string][]byte, opts ...Option) (*FileSystem, error) {
+	entries := make(map[string][]byte)
+	for name, data := range files {
+		name = strings.TrimPrefix(name, "/")
+		isDir := strings.HasSuffix(name, "/")
+		name = strings.TrimSuffix(name, "/")
+		if !iofs.ValidPath(name) || name == "." {
+			return nil, &os.PathError{Op: "NewFromMap", Path: name, Err: iofs.ErrInvalid}
+		}
+		if isDir {
+			entries[name+"/"] = nil
+		} else {
+			entries[name] = data
+		}
+		for dir := path.Dir(name); dir != "."; dir = path.Dir(dir) {
+			entries[dir+"/"] = nil
+		}
+	}
+	names := make([]string, 0, len(entries))
+	for name := range entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, name := range names {
+		fh := &zip.FileHeader{
+			Name:     name,
+			Method:   zip.Deflate,
+			Modified: dirTime,
+		}
+		if strings.HasSuffix(name, "/") {
+			fh.Method = zip.Store
+			fh.SetMode(os.ModeDir | 0755)
+		}
+		w, err := zw.CreateHeader(fh)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(entries[name]); err != nil {
+			return nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return newFileSystem(bytes.NewReader(buf.Bytes()), int64(buf.Len()), nil, opts...)
+}
@@ -0,0 +1,71 @@
+package zipfs
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	"io"
+	iofs "io/fs"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewFromMap(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	page := bytes.Repeat([]byte("<p>Hello, world!</p>\n"), 100)
+	fs, err := NewFromMap(map[string][]byte{
+		"index.html":       page,
+		"/docs/guide.txt":  []byte("guide"),
+		"assets/js/app.js": []byte("app()"),
+		"empty/":           nil,
+	})
+	require.NoError(err)
+	defer fs.Close()
+
+	assert.Equal([]string{"/assets/js/app.js", "/docs/guide.txt", "/index.html"}, fs.Names())
+	assert.Equal([]string{"/assets", "/assets/js", "/docs", "/empty"}, fs.Dirs())
+	for _, zf := range fs.reader.File {
+		assert.True(dirTime.Equal(zf.Modified), zf.Name)
+		if zf.Mode().IsDir() {
+			assert.Equal(uint16(0), zf.Method, zf.Name)
+		} else {
+			assert.Equal(uint16(8), zf.Method, zf.Name)
+		}
+	}
+
+	handler := FileServer(fs)
+
+	// the compressed data is served as it is
+	w := serveTestRequest(handler, "GET", "/", "Accept-Encoding: deflate")
+	require.Equal(200, w.status)
+	assert.Equal("deflate", w.Header().Get("Content-Encoding"))
+	assert.Less(w.buf.Len(), len(page))
+	data, err := io.ReadAll(flate.NewReader(&w.buf))
+	require.NoError(err)
+	assert.Equal(page, data)
+
+	w = serveTestRequest(handler, "GET", "/docs/guide.txt", "Range: bytes=1-3")
+	assert.Equal(206, w.status)
+	assert.Equal("uid", w.buf.String())
+	f, err := fs.Open("/assets/js/")
+	require.NoError(err)
+	files, err := f.Readdir(0)
+	require.NoError(err)
+	require.Len(files, 1)
+	assert.Equal("app.js", files[0].Name())
+
+	for _, name := range []string{"../up.txt", "a//b.txt", "", "a/./b"} {
+		_, err = NewFromMap(map[string][]byte{name: nil})
+		assert.True(errors.Is(err, iofs.ErrInvalid), name)
+	}
+
+	// options are applied
+	fs, err = NewFromMap(map[string][]byte{"a.txt": []byte("a")}, WithContentTypes(map[string]string{".txt": "text/x-test"}))
+	require.NoError(err)
+	w = serveTestRequest(FileServer(fs), "GET", "/a.txt")
+	assert.Equal("text/x-test", w.Header().Get("Content-Type"))
+}
@@ -0,0 +1,75 @@
+package zipfs
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"io"
+	"os"
+)
+
+// defaultMemorySeekLimit is the default uncompressed size of the largest
+// compressed file that is decompressed into memory, rather than to a
+// temporary file, to make it seekable. See WithMemorySeekLimit.
+const defaultMemorySeekLimit = 1 << 20
+
+// OpenSeeker opens the file at name for reading and seeking. Unlike
+// Open, which extracts compressed files to temporary files when they
+// are first seeked, OpenSeeker makes the file seekable before it
+// returns, so any error in doing so is returned by OpenSeeker. Files
+// stored without compression are read directly from the ZIP file.
+// Small compressed files are decompressed into memory, and others are
+// extracted to a temporary file, and either is shared with other
+// readers.
+func (fs *FileSystem) OpenSeeker(name string) (io.ReadSeekCloser, error) {
+	fi, err := fs.openFileInfo(name)
+	if err != nil {
+		return nil, err
+	}
+	if fi.IsDir() {
+		return nil, &os.PathError{Op: "OpenSeeker", Path: name, Err: ErrIsDirectory}
+	}
+	zf := fi.zipFile
+	switch {
+	case fi.pinned != nil:
+		return &seeker{ReadSeeker: bytes.NewReader(fi.pinned)}, nil
+	case zf.Method == zip.Store:
+		section, err := rawSection(fs.readerAt, zf)
+		if err != nil {
+			return nil, &os.PathError{Op: "OpenSeeker", Path: name, Err: err}
+		}
+		return &seeker{ReadSeeker: section}, nil
+	case fi.Size() <= fs.memorySeekLimit:
+		data, err := fi.memoryContent()
+		if err != nil {
+			return nil, &os.PathError{Op: "OpenSeeker", Path: name, Err: err}
+		}
+		return &seeker{ReadSeeker: bytes.NewReader(data)}, nil
+	}
+	file, err := fi.openTempFile(context.Background())
+	if err != nil {
+		return nil, &os.PathError{Op: "OpenSeeker", Path: name, Err: err}
+	}
+	return &seeker{
+		ReadSeeker: file,
+		release: func() error {
+			return fi.releaseTempFile(file)
+		},
+	}, nil
+}
+
+// seeker is a file opened by OpenSeeker.
+type seeker struct {
+	io.ReadSeeker
+	release func() error // releases the temporary file, if any
+}
+
+// Close releases the resources used by the file.
+func (s *seeker) Close() error {
+	if s.release == nil {
+		return nil
+	}
+	err := s.release()
+	s.release = nil
+	return err
+}
@@ -0,0 +1,71 @@
+package zipfs
+
+import (
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenSeeker(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	large := strings.Repeat("0123456789", defaultMemorySeekLimit/10+1)
+	fs := newTestFileSystem(t, map[string]string{
+		"stored.dat":  "0123456789abcdef",
+		"small.txt":   "0123456789abcdef",
+		"large.txt":   large,
+		"dir/file.js": "x",
+	})
+
+	testCases := []struct {
+		Name      string
+		Content   string
+		TempFiles int64
+	}{
+		{Name: "/stored.dat", Content: "0123456789abcdef"},
+		{Name: "small.txt", Content: "0123456789abcdef"},
+		{Name: "/large.txt", Content: large, TempFiles: 1},
+		// the temporary file is shared
+		{Name: "/large.txt", Content: large},
+	}
+	for _, tc := range testCases {
+		before := atomic.LoadInt64(&tempFileCount)
+		f, err := fs.OpenSeeker(tc.Name)
+		require.NoError(err, tc.Name)
+		assert.Equal(tc.TempFiles, atomic.LoadInt64(&tempFileCount)-before, tc.Name)
+
+		data, err := io.ReadAll(f)
+		require.NoError(err)
+		assert.Equal(tc.Content, string(data), tc.Name)
+
+		offset, err := f.Seek(-6, io.SeekEnd)
+		require.NoError(err)
+		assert.Equal(int64(len(tc.Content)-6), offset)
+		buf := make([]byte, 6)
+		_, err = io.ReadFull(f, buf)
+		require.NoError(err)
+		assert.Equal(tc.Content[len(tc.Content)-6:], string(buf), tc.Name)
+
+		_, err = f.Seek(10, io.SeekStart)
+		require.NoError(err)
+		_, err = io.ReadFull(f, buf)
+		require.NoError(err)
+		assert.Equal(tc.Content[10:16], string(buf), tc.Name)
+
+		assert.NoError(f.Close())
+		assert.NoError(f.Close())
+		assert.Equal(tc.TempFiles, atomic.LoadInt64(&tempFileCount)-before, tc.Name)
+	}
+
+	_, err := fs.OpenSeeker("/missing.txt")
+	assert.True(errors.Is(err, os.ErrNotExist), err)
+	_, err = fs.OpenSeeker("/dir")
+	assert.True(errors.Is(err, ErrIsDirectory), err)
+}
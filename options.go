@@ -0,0 +1,887 @@
+package zipfs
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// HandlerOption configures the HTTP handler returned by FileServer.
+type HandlerOption func(h *fileHandler)
+
+// WithETagFunc sets the function used to calculate the ETag for
+// each file served. The name is the path of the file within the
+// file system. If the function returns an empty string then no
+// ETag header is sent, and If-None-Match and If-Range processing
+// is suppressed for that response. The default ETag is based
+// on the file's CRC and its length.
+func WithETagFunc(fn func(name string, f *zip.File) string) HandlerOption {
+	return func(h *fileHandler) {
+		h.etagFunc = fn
+	}
+}
+
+// WithWeakETags causes ETags to be sent as weak validators (W/"...").
+// The default ETag is derived from the file's CRC rather than the
+// exact bytes of the response, so a weak ETag is more accurate.
+// Weak ETags are honored by If-None-Match, but never satisfy If-Range,
+// so range requests that depend on them receive the whole file.
+func WithWeakETags() HandlerOption {
+	return func(h *fileHandler) {
+		h.weakETags = true
+	}
+}
+
+// WithCacheControl sets the value of the Cache-Control header sent
+// with successful responses, including 304 Not Modified responses.
+// The header is not sent with error responses, and a Cache-Control
+// header already set on the ResponseWriter is not replaced.
+func WithCacheControl(value string) HandlerOption {
+	return func(h *fileHandler) {
+		h.cacheControl = value
+	}
+}
+
+// WithCacheRules sets the Cache-Control header value for files based
+// on their path. The rules are evaluated in order and the first matching
+// rule is used. If no rule matches then the value set by WithCacheControl,
+// if any, is used.
+func WithCacheRules(rules []CacheRule) HandlerOption {
+	return func(h *fileHandler) {
+		h.cacheRules = append([]CacheRule(nil), rules...)
+	}
+}
+
+// WithImmutableFingerprints causes files whose base name matches pattern
+// to be served with "Cache-Control: public, max-age=31536000, immutable".
+// This is intended for files whose names include a fingerprint of their
+// content, and so never change. The header overrides the values set by
+// WithCacheControl and WithCacheRules. If pattern is nil then the default
+// pattern matches names with at least eight hexadecimal digits before the
+// extension, such as "app.3f9ab2c1.js".
+func WithImmutableFingerprints(pattern *regexp.Regexp) HandlerOption {
+	if pattern == nil {
+		pattern = defaultFingerprint
+	}
+	return func(h *fileHandler) {
+		h.fingerprint = pattern
+	}
+}
+
+// WithHeaderFunc sets a function that is called for each file served
+// with a 200, 206 or 304 response. The function is called after the
+// handler has set its own response headers, and before the response
+// status is written. It can add, change or delete any of the headers,
+// and the conditional request headers are then evaluated against the
+// ETag and Last-Modified headers that remain. The name is the path of
+// the file within the file system.
+func WithHeaderFunc(fn func(h http.Header, name string, fi os.FileInfo)) HandlerOption {
+	return func(h *fileHandler) {
+		h.headerFunc = fn
+	}
+}
+
+// WithHeadersFile causes the handler to read response headers from
+// the file at name, in the format of the _headers file used by several
+// static site hosts. For example:
+//
+//	# Headers for all files
+//	/*
+//	  X-Frame-Options: DENY
+//	/fonts/*
+//	  Access-Control-Allow-Origin: *
+//	/users/:id/profile
+//	  Cache-Control: no-cache
+//
+// A line containing a path pattern is followed by indented header lines.
+// In a pattern, a final "*" matches the rest of the path, and a segment
+// starting with a colon matches any single segment. The headers of all
+// rules that match the request path are sent, with later rules
+// overriding earlier ones.
+//
+// The file is read once when the handler is created, and is not itself
+// served. If it does not exist or cannot be read then no headers are added.
+func WithHeadersFile(name string) HandlerOption {
+	return func(h *fileHandler) {
+		h.headersFile = name
+	}
+}
+
+// WithRedirectsFile causes the handler to read redirect rules from the
+// file at name, in the format of the _redirects file used by several
+// static site hosts. For example:
+//
+//	# Redirect the old blog, keeping the rest of the path
+//	/blog/*       /news/:splat          301
+//	/users/:id    /profile.html?id=:id  302
+//	/app/*        /app/index.html       200
+//
+// Each line contains a path pattern, the location to redirect to, and
+// the status code, which is 301 by default. Patterns are as for
+// WithHeadersFile, and the values of placeholders, with "*" called
+// ":splat", are substituted into the location. A status of 301, 302,
+// 303, 307 or 308 redirects the client, passing on the query of the
+// request. A status of 200 serves the file at the location as if it had
+// been requested, without redirecting. The first rule that matches the
+// request path is applied before looking for a file, so rules take
+// precedence over files in the archive.
+//
+// The file is read once when the handler is created, and is not itself
+// served. If it does not exist or cannot be read then there are no rules.
+func WithRedirectsFile(name string) HandlerOption {
+	return func(h *fileHandler) {
+		h.redirectsFile = name
+	}
+}
+
+// WithRangeMemoryLimit sets the uncompressed size of the largest
+// compressed file that is decompressed into memory in order to serve a
+// range request. The contents are decompressed for each request. Larger
+// files are extracted to a temporary file instead. Files stored without
+// compression never need extracting. An explicit WithRangeMemoryLimit
+// takes precedence over the limit set by WithMemorySeekLimit, which
+// otherwise decides which files are decompressed into memory, once, to
+// serve range requests. WithRangeMemoryLimit(0) therefore means that
+// compressed files are never decompressed into memory for range requests.
+func WithRangeMemoryLimit(n int64) HandlerOption {
+	return func(h *fileHandler) {
+		h.rangeMemoryLimit = n
+		h.rangeLimitSet = true
+	}
+}
+
+// WithNoSniff sets the "X-Content-Type-Options: nosniff" header on
+// successful responses, so that clients use the content type sent by
+// the server instead of guessing it from the content. The header is not
+// sent for files with a name that does not give their type, which are
+// sent as "application/octet-stream", because the client can only use
+// them by sniffing. Use WithContentTypes or WithContentTypeFunc to give
+// such files a type.
+func WithNoSniff() HandlerOption {
+	return func(h *fileHandler) {
+		h.noSniff = true
+	}
+}
+
+// WithPush uses HTTP/2 server push to send assets along with the files
+// that need them, such as the critical CSS and JavaScript of an HTML
+// page. The map is keyed by the path of a file, and its values are the
+// paths of the assets to push when the file is served, such as
+// {"/index.html": {"/css/main.css", "/js/app.js"}}. Assets are pushed
+// for GET requests when the ResponseWriter implements http.Pusher,
+// and are skipped if push is not supported or fails. WithPush panics
+// if an asset is not a file in the file system.
+func WithPush(assets map[string][]string) HandlerOption {
+	return func(h *fileHandler) {
+		if h.push == nil {
+			h.push = make(map[string][]string)
+		}
+		for name, paths := range assets {
+			name = path.Clean("/" + name)
+			for _, asset := range paths {
+				asset = path.Clean("/" + asset)
+				if fi, err := h.fs.openFileInfo(asset); err != nil || fi.IsDir() {
+					panic(fmt.Sprintf("zipfs: push asset %q is not a file", asset))
+				}
+				h.push[name] = append(h.push[name], asset)
+			}
+		}
+	}
+}
+
+// WithEarlyHints adds Link headers to the responses for files, so that
+// clients start loading the resources that the files need, such as the
+// stylesheets and scripts of a page. The map is keyed by the path of a
+// file. For GET requests the links are also sent in a 103 Early Hints
+// response before the final response, except to HTTP/1.0 clients. This
+// replaces HTTP/2 server push, which browsers no longer support.
+func WithEarlyHints(hints map[string][]LinkHint) HandlerOption {
+	return func(h *fileHandler) {
+		if h.earlyHints == nil {
+			h.earlyHints = make(map[string][]LinkHint)
+		}
+		for name, links := range hints {
+			name = path.Clean("/" + name)
+			h.earlyHints[name] = append(h.earlyHints[name], links...)
+		}
+	}
+}
+
+// WithServerTiming sends a Server-Timing header with the time taken to
+// serve each file, so that slow responses can be diagnosed with the
+// developer tools of a browser. The metrics are "zipfs-lookup", the time
+// to find the file, and "zipfs-extract", the time to extract a deflated
+// file for a range request, which is described as "cold" if a temporary
+// file was created, "cached" if one was reused, or "memory" or "index".
+// The time to send the body, "zipfs-send", is only known once the body
+// has been sent, so it is sent in a trailer, which clients receive over
+// HTTP/2. The timings are only measured when this option is used.
+func WithServerTiming() HandlerOption {
+	return func(h *fileHandler) {
+		h.serverTiming = true
+	}
+}
+
+// WithArchiveDownload serves the ZIP file itself at the path upath, such
+// as "/site.zip", so that clients can download all of the files at once.
+// The response is an attachment with the "application/zip" content type,
+// and supports conditional and range requests. If there is a file or
+// directory in the archive at upath, then it is served instead, and a
+// warning is logged when the handler is created.
+//
+// The ZIP file contains every entry, so enabling the download exposes
+// all of the files, including those that are not served because of
+// WithDeny, WithoutDotfiles, WithMaxServeSize or the access check set by
+// WithAccessCheck. The access check is called for upath itself, with a
+// FileInfo describing the ZIP file, so that the download can be
+// protected like any other path.
+func WithArchiveDownload(upath string) HandlerOption {
+	return func(h *fileHandler) {
+		h.archivePath = path.Clean("/" + upath)
+	}
+}
+
+// WithDirectoryDownload allows clients to download the files in a
+// directory as a ZIP file by adding "download=zip" to the query, as in
+// "/img/?download=zip". The ZIP file is created as it is sent, from the
+// compressed contents of the files, and excludes files that cannot be
+// served, including those refused by the access check set by
+// WithAccessCheck and those larger than the limit set by
+// WithMaxServeSize. See FileSystem.ZipDir.
+func WithDirectoryDownload() HandlerOption {
+	return func(h *fileHandler) {
+		h.dirDownload = true
+	}
+}
+
+// WithDigests sends digests of the uncompressed content of files, so
+// that clients can verify their downloads. The supported algorithms
+// are "sha-256" and "sha-512", which are sent in the Repr-Digest header
+// of RFC 9530, and "md5", which is sent in the legacy Content-MD5 header.
+// Repr-Digest is sent with ranges and compressed responses, because
+// it describes the whole file, but Content-MD5 is only sent when the
+// body is the whole uncompressed file. WithDigests panics if an
+// algorithm is not supported.
+//
+// The digests of a file are calculated when it is first requested, which
+// requires reading the whole file, and are then kept in memory. Responses
+// to HEAD requests include the digests only if they have already been
+// calculated. Use WithDigestWarmup to calculate them all in advance.
+func WithDigests(algorithms ...string) HandlerOption {
+	for _, algorithm := range algorithms {
+		if digestAlgorithms[algorithm] == nil {
+			panic(fmt.Sprintf("zipfs: unsupported digest algorithm %q", algorithm))
+		}
+	}
+	return func(h *fileHandler) {
+		h.digestAlgorithms = append([]string(nil), algorithms...)
+	}
+}
+
+// WithDigestWarmup calculates the digests for WithDigests of all of the
+// files in the file system when the handler is created, instead of
+// when they are first requested. This reads the whole file system.
+func WithDigestWarmup() HandlerOption {
+	return func(h *fileHandler) {
+		h.digestWarmup = true
+	}
+}
+
+// WithAttachment serves the files whose paths match any of the patterns,
+// such as "/downloads/**" or "*.zip", as attachments to be downloaded
+// rather than displayed by the browser. The syntax of the patterns is
+// described by CacheRule. The responses have a header such as
+// `Content-Disposition: attachment; filename="report.pdf"`, with the
+// name of the file in the archive. Files with names that are not ASCII
+// are also given an encoded filename* parameter. Other files are
+// displayed inline, as usual.
+func WithAttachment(patterns ...string) HandlerOption {
+	return func(h *fileHandler) {
+		h.attachments = append(h.attachments, patterns...)
+	}
+}
+
+// WithAttachmentFunc sets a function that decides whether the file at
+// name is served as an attachment in response to the request, such as
+// when the query includes "download=1". It is passed whether the file
+// matches a WithAttachment pattern, and returns whether the file is an
+// attachment.
+func WithAttachmentFunc(fn func(r *http.Request, name string, attachment bool) bool) HandlerOption {
+	return func(h *fileHandler) {
+		h.attachmentFunc = fn
+	}
+}
+
+// WithLanguageSuffixes sets the Content-Language header for files with
+// a language suffix before their extension, such as "de" in
+// "about.de.html" or "pt-BR" in "about.pt-BR.html". A suffix is
+// recognized if it starts with a two letter ISO 639-1 language code,
+// optionally followed by a script and region separated by hyphens or
+// underscores. Other suffixes, such as "min" in "app.min.js", are left
+// alone. Use WithLanguageTags to change how suffixes are recognized.
+func WithLanguageSuffixes() HandlerOption {
+	return func(h *fileHandler) {
+		h.languageSuffixes = true
+	}
+}
+
+// WithLanguageNegotiation serves the language variants of files, as
+// recognized by WithLanguageSuffixes, according to the Accept-Language
+// header of the request. A request for "/about.html" is served with the
+// best match for the client among "/about.en.html", "/about.de.html" and
+// so on, taking quality values into account. A language range matches
+// a variant with the same tag, or a tag that is a prefix of the range or
+// vice versa, so that a client accepting "de-AT" is served "de". If no
+// variant matches then the one for defaultLang is served, if there is
+// one, and otherwise the file at the requested path. Responses include
+// "Vary: Accept-Language", and the variants remain available at their
+// own paths. Index documents are not negotiated, but an alias such as
+// {"/": "/index.html"} can be used to serve the variants of the root
+// index. WithLanguageNegotiation implies WithLanguageSuffixes.
+func WithLanguageNegotiation(defaultLang string) HandlerOption {
+	return func(h *fileHandler) {
+		h.languageSuffixes = true
+		h.defaultLanguage = defaultLang
+	}
+}
+
+// WithLanguageTags sets the language tags for file name suffixes
+// recognized by WithLanguageSuffixes, overriding the default
+// recognition. Suffixes are matched without regard to case. A suffix
+// mapped to an empty string is not a language, so for example
+// {"ie": "", "chr": "chr"} prevents "styles.ie.css" from being treated
+// as Interlingue and adds Cherokee, which has a three letter code.
+func WithLanguageTags(tags map[string]string) HandlerOption {
+	return func(h *fileHandler) {
+		if h.languageTags == nil {
+			h.languageTags = make(map[string]string)
+		}
+		for suffix, tag := range tags {
+			h.languageTags[strings.ToLower(suffix)] = tag
+		}
+	}
+}
+
+// WithDefaultCharset adds the charset parameter to the content types
+// of text files that do not already have one, such as "text/csv" and
+// "application/json", so that they are sent as "text/csv; charset=utf-8"
+// for a charset of "utf-8". Text types are those of the form "text/*",
+// "*/*+json" and "*/*+xml", along with the JSON, JavaScript and XML
+// application types. Content types that include a charset, such as those
+// set by WithContentTypes, are not changed.
+func WithDefaultCharset(charset string) HandlerOption {
+	return func(h *fileHandler) {
+		h.defaultCharset = charset
+	}
+}
+
+// WithoutCharset prevents WithDefaultCharset from adding a charset to
+// the given media types, such as "text/csv".
+func WithoutCharset(mediaTypes ...string) HandlerOption {
+	return func(h *fileHandler) {
+		if h.noCharset == nil {
+			h.noCharset = make(map[string]bool)
+		}
+		for _, mediaType := range mediaTypes {
+			h.noCharset[strings.ToLower(mediaType)] = true
+		}
+	}
+}
+
+// WithMaxServeSize prevents the handler from serving files larger than n
+// bytes when uncompressed, including parts of them in response to range
+// requests. The response is 403 Forbidden, which can be changed with
+// WithErrorHandler. The size is known without reading the file. By
+// default there is no limit.
+func WithMaxServeSize(n int64) HandlerOption {
+	return func(h *fileHandler) {
+		h.maxServeSize = n
+	}
+}
+
+// WithDebugEndpoint makes the handler respond to GET requests for the
+// path upath, such as "/_zipfs", with a page that describes each file in
+// the ZIP file: its size, compression method, CRC-32 and ETag, and
+// whether it has been extracted to a temporary file or has a seek index.
+// The page also shows totals, and the counters of ExtractStats. It is in
+// JSON if the client accepts application/json, and in HTML otherwise. The
+// page reveals every file, so the handler should only be reachable by
+// those allowed to see them. A file in the ZIP file at the same path is
+// not served.
+func WithDebugEndpoint(upath string) HandlerOption {
+	return func(h *fileHandler) {
+		h.debugPath = path.Clean("/" + upath)
+	}
+}
+
+// WithFlushInterval makes the handler flush the response periodically
+// while sending the contents of a file, if the http.ResponseWriter
+// implements http.Flusher. Without flushing, middleware that buffers
+// responses may hold back the contents of a large file until all of it
+// has been sent. The response is only flushed after some of the body has
+// been written, and at most once per interval d. By default the response
+// is never flushed.
+func WithFlushInterval(d time.Duration) HandlerOption {
+	return func(h *fileHandler) {
+		h.flushInterval = d
+	}
+}
+
+// Option configures a FileSystem returned by New.
+type Option func(fs *FileSystem)
+
+// WithSeekIndex enables random access to files compressed using deflate
+// without extracting them to a temporary file. The first time a file is
+// read from an offset other than zero, it is decompressed in full and a
+// checkpoint is recorded at intervals of approximately interval bytes.
+// Subsequent seeks and range requests restart decompression from the
+// nearest preceding checkpoint. Each checkpoint holds 32KB of memory, so
+// the interval should be large compared to that: a few megabytes is
+// a reasonable choice for files of hundreds of megabytes.
+func WithSeekIndex(interval int64) Option {
+	return func(fs *FileSystem) {
+		fs.seekInterval = interval
+	}
+}
+
+// WithMemorySeekLimit sets the uncompressed size of the largest
+// compressed file that is decompressed into memory, rather than
+// extracted to a temporary file, in order to seek within it or to serve
+// a range request. The contents are shared by every reader, and kept in
+// the cache set by WithContentCache, if it can hold them, or otherwise in
+// a cache of up to eight files of the limit's size, from which the least
+// recently used are removed. A limit of zero or less means that
+// compressed files are always extracted to temporary files. The default
+// limit is 1MB. For range requests, a limit set by WithRangeMemoryLimit
+// takes precedence.
+func WithMemorySeekLimit(n int64) Option {
+	return func(fs *FileSystem) {
+		fs.memorySeekLimit = n
+	}
+}
+
+// WithContentCache keeps the decompressed contents of the most recently
+// used files in memory, up to a total of maxBytes, so that they are not
+// decompressed again each time they are served without compression,
+// read by ReadFile, or seeked within, as described for
+// WithMemorySeekLimit. Files larger than an eighth of maxBytes are not
+// cached. See ContentCacheStats for the effectiveness of the cache.
+func WithContentCache(maxBytes int64) Option {
+	return func(fs *FileSystem) {
+		fs.contentCache = nil
+		if maxBytes > 0 {
+			fs.contentCache = newContentCache(maxBytes)
+		}
+	}
+}
+
+// WithMmap causes the temporary files that compressed files are
+// extracted to, in order to seek within them or serve range requests,
+// to be mapped into memory and read from there, rather than with a
+// system call for each read. It has no effect on platforms that do not
+// support memory mapping, including Windows.
+func WithMmap() Option {
+	return func(fs *FileSystem) {
+		fs.mmap = true
+	}
+}
+
+// WithPinned causes the files whose paths match any of the patterns,
+// such as "*.html" or "/static/**", to be decompressed into memory when
+// the FileSystem is created, and served and read from there without
+// reading the ZIP file again. The syntax of the patterns is described
+// by CacheRule. Pinned files are kept until the FileSystem is closed
+// and do not count towards the limit set by WithContentCache. Deflated
+// files are pinned both compressed and decompressed, so that either can
+// be served. See PinnedBytes for the memory used.
+func WithPinned(patterns ...string) Option {
+	return func(fs *FileSystem) {
+		fs.pinPatterns = append(fs.pinPatterns, patterns...)
+	}
+}
+
+// WithPersistentTempCache causes compressed files that are extracted in
+// order to seek within them to be kept in dir, which must exist. The files
+// are named after the CRC and size of their contents and are not removed
+// when the FileSystem is closed, so they are reused by later FileSystems,
+// including those created after the process restarts. A file in dir with
+// the wrong size is assumed to be incomplete and is extracted again.
+// Nothing is removed from dir by this package.
+func WithPersistentTempCache(dir string) Option {
+	return func(fs *FileSystem) {
+		fs.tempCacheDir = dir
+	}
+}
+
+// WithDirsFirst causes Readdir and ReadDir, and the directory listings
+// served by FileServer, to return the subdirectories of a directory
+// before its files. Walk and the other functions that visit the whole
+// file system are not affected.
+func WithDirsFirst() Option {
+	return func(fs *FileSystem) {
+		fs.dirsFirst = true
+	}
+}
+
+// WithCaseInsensitiveSort causes Readdir and ReadDir, and the directory
+// listings served by FileServer, to sort the entries of a directory by
+// name ignoring case, so that "aardvark" comes before "Makefile". Names
+// that differ only in case are sorted byte-wise. It can be combined with
+// WithDirsFirst.
+func WithCaseInsensitiveSort() Option {
+	return func(fs *FileSystem) {
+		fs.foldSort = true
+	}
+}
+
+// WithListingFilter sets a function that decides which entries of a
+// directory are returned by Readdir and ReadDir, and shown in the
+// directory listings served by FileServer. It is called with each entry
+// and the path of its directory, such as "/img", and the entry is left
+// out if it returns false. The entries left out can still be opened by
+// name, and are still visited by Walk. By default every entry is
+// returned.
+func WithListingFilter(fn func(fi os.FileInfo, dir string) bool) Option {
+	return func(fs *FileSystem) {
+		fs.listingFilter = fn
+	}
+}
+
+// WithIndexNames sets the names of the index documents served for a
+// directory. The names are tried in order, and the first file that
+// exists in the directory is served. A request for an index document
+// by name is redirected to its directory. If none of the files exist
+// then the directory is not served. The default is "index.html".
+func WithIndexNames(names ...string) HandlerOption {
+	return func(h *fileHandler) {
+		h.indexNames = append([]string(nil), names...)
+	}
+}
+
+// WithRedirectStatus sets the status code of the redirects used to
+// canonicalize paths, which add a trailing slash to directories, remove
+// it from files, and remove the name of the index document. The code
+// must be one of 301, 302, 307 or 308. The default is 301 Moved
+// Permanently, which browsers cache, so a temporary redirect can be
+// preferable while the content of the file system is being reorganized.
+func WithRedirectStatus(code int) HandlerOption {
+	switch code {
+	case http.StatusMovedPermanently, http.StatusFound,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+	default:
+		panic(fmt.Sprintf("zipfs: invalid redirect status %d", code))
+	}
+	return func(h *fileHandler) {
+		h.redirectStatus = code
+	}
+}
+
+// WithoutRedirects disables the redirects used to canonicalize paths.
+// Directories are served with or without a trailing slash, files are
+// served with a trailing slash, and index documents are served by name.
+// This is useful when requests have already been canonicalized, for
+// example by a router.
+func WithoutRedirects() HandlerOption {
+	return func(h *fileHandler) {
+		h.noRedirects = true
+	}
+}
+
+// WithForwardedPrefix makes the handler include the path prefix in the
+// X-Forwarded-Prefix request header in the locations it redirects to.
+// This is for a handler behind a proxy that removes the prefix from the
+// path before passing the request on, so that the client is redirected to
+// a path that the proxy will pass to the handler. Redirects are then to
+// absolute paths that start with the prefix. The header is ignored unless
+// the prefix starts with "/" and has no ".." segments. Without this
+// option the header is always ignored, because clients can set it too.
+func WithForwardedPrefix() HandlerOption {
+	return func(h *fileHandler) {
+		h.forwardedPrefix = true
+	}
+}
+
+// TrailingSlashPolicy determines whether the canonical path of a
+// directory ends with a slash. The canonical path of a file never does.
+type TrailingSlashPolicy int
+
+const (
+	// TrailingSlashAdd redirects requests for a directory without a
+	// trailing slash to the path with one. This is the default.
+	TrailingSlashAdd TrailingSlashPolicy = iota
+
+	// TrailingSlashStrip redirects requests for a directory with a
+	// trailing slash to the path without one, and serves the index
+	// document of the directory there. Relative links in the index
+	// document are resolved against the parent directory, so they
+	// need to include the directory name.
+	TrailingSlashStrip
+
+	// TrailingSlashNone serves files and directories with or without
+	// a trailing slash, and does not redirect.
+	TrailingSlashNone
+)
+
+// WithTrailingSlashPolicy sets the policy used to redirect requests for
+// files and directories with or without a trailing slash. The redirects
+// use relative paths, so they work when the handler is mounted under
+// a path prefix. The root directory always has a trailing slash.
+func WithTrailingSlashPolicy(policy TrailingSlashPolicy) HandlerOption {
+	return func(h *fileHandler) {
+		h.trailingSlash = policy
+	}
+}
+
+// WithDirectoryListing causes a listing of the files in a directory to
+// be served for a directory without an index document, instead of
+// a 403 Forbidden response. It is equivalent to
+// WithNoIndexBehavior(NoIndexListing). Files that are not served, such as the
+// headers file, are not listed. Listings are rendered as HTML, unless
+// the request's Accept header includes application/json, in which case
+// they are a JSON array of objects with the name, size, modTime, isDir
+// and etag of each entry.
+func WithDirectoryListing() HandlerOption {
+	return func(h *fileHandler) {
+		h.noIndex = NoIndexListing
+	}
+}
+
+// WithListingTemplate sets the template used to render directory
+// listings, and enables them as WithDirectoryListing does. The template
+// is executed with a *Listing, and its output is served as HTML.
+func WithListingTemplate(tmpl *template.Template) HandlerOption {
+	return func(h *fileHandler) {
+		h.noIndex = NoIndexListing
+		h.listingTemplate = tmpl
+	}
+}
+
+// NoIndexBehavior determines the response to a request for
+// a directory that does not have an index document.
+type NoIndexBehavior int
+
+const (
+	// NoIndexForbidden responds with 403 Forbidden. This is the default.
+	NoIndexForbidden NoIndexBehavior = iota
+
+	// NoIndexNotFound responds with 404 Not Found, so that
+	// the directory cannot be distinguished from a missing path.
+	NoIndexNotFound
+
+	// NoIndexListing serves a listing of the directory,
+	// as described for WithDirectoryListing.
+	NoIndexListing
+)
+
+// WithNoIndexBehavior sets the response to a request for a directory
+// that does not have an index document. Requests for such a directory
+// are only redirected to add or remove a trailing slash if the
+// directory is listed.
+func WithNoIndexBehavior(b NoIndexBehavior) HandlerOption {
+	return func(h *fileHandler) {
+		h.noIndex = b
+	}
+}
+
+// WithSPAFallback supports single page applications that use client-side
+// routing. A GET or HEAD request for a path that does not exist, and
+// whose last element has no file name extension, is served the file
+// at name, which is usually "/index.html", with "Cache-Control: no-cache".
+// Requests for missing paths with an extension, such as "/app.js",
+// still receive 404 Not Found, as do other methods. Use
+// WithSPAFallbackMatch to change which requests are served the file.
+func WithSPAFallback(name string) HandlerOption {
+	return func(h *fileHandler) {
+		h.spaFallback = name
+	}
+}
+
+// WithSPAFallbackMatch sets the function that determines whether a
+// request for a missing path is served the file set by WithSPAFallback.
+// The default matches paths whose last element has no extension.
+func WithSPAFallbackMatch(match func(r *http.Request) bool) HandlerOption {
+	return func(h *fileHandler) {
+		h.spaMatch = match
+	}
+}
+
+// WithoutDotfiles prevents the handler from serving files and
+// directories whose names start with a dot, such as ".env", along with
+// everything in such directories, such as ".git/config". They are not
+// found, and are left out of directory listings, but can still be opened
+// through the FileSystem. Note that this includes ".well-known".
+func WithoutDotfiles() HandlerOption {
+	return func(h *fileHandler) {
+		h.noDotfiles = true
+	}
+}
+
+// WithDeny prevents the handler from serving the files whose paths match
+// any of the patterns, such as "/internal/**" or "*.map". The syntax of
+// the patterns is described by CacheRule. The response for a denied file
+// is 404 Not Found, as if it did not exist, and denied files are left out
+// of directory listings. A pattern for the files in a directory also
+// denies the directory itself. The files can still be opened through the
+// FileSystem.
+func WithDeny(patterns ...string) HandlerOption {
+	return func(h *fileHandler) {
+		h.deny = append(h.deny, patterns...)
+	}
+}
+
+// WithAllowOnly prevents the handler from serving files whose paths do
+// not match any of the patterns, which have the syntax described by
+// CacheRule. Files that are not allowed are not found, and are left out
+// of directory listings. Directories are not restricted, but only the
+// allowed files in them are served. A file that matches a WithDeny
+// pattern is not served even if it is allowed.
+func WithAllowOnly(patterns ...string) HandlerOption {
+	return func(h *fileHandler) {
+		h.allowOnly = append(h.allowOnly, patterns...)
+	}
+}
+
+// ErrUnauthorized is returned by an access check
+// to refuse access with 401 Unauthorized.
+var ErrUnauthorized = errors.New("unauthorized")
+
+// WithAccessCheck sets a function that is called to decide whether the
+// request may be served the file or directory fi at name. It is called
+// once the file has been found, before the response is started, so a
+// refused request does not reveal the file through its headers or a
+// redirect. For a directory it is called for the directory, and then for
+// its index document if it has one. If it returns an error then the file
+// is not served, and the response depends on the error: ErrUnauthorized
+// gives 401 Unauthorized, os.ErrNotExist gives the response for a file
+// that does not exist, and any other error gives 403 Forbidden. The
+// error is passed to the function set by WithErrorHandler, which can add
+// a WWW-Authenticate header to a 401 response.
+func WithAccessCheck(fn func(r *http.Request, name string, fi os.FileInfo) error) HandlerOption {
+	return func(h *fileHandler) {
+		h.accessCheck = fn
+	}
+}
+
+// WithAliases makes the handler serve the file at the target path when
+// the alias path is requested, such as "/img/favicon.ico" for
+// "/favicon.ico". The target is served as if it had been requested, with
+// its content type, but the client is not redirected to it. An alias of
+// a file that does not exist is not found. Aliases are applied before
+// the function set by WithRewriteFunc.
+func WithAliases(aliases map[string]string) HandlerOption {
+	return func(h *fileHandler) {
+		if h.aliases == nil {
+			h.aliases = make(map[string]string)
+		}
+		for alias, target := range aliases {
+			h.aliases[path.Clean("/"+alias)] = path.Clean("/" + target)
+		}
+	}
+}
+
+// WithRewriteFunc sets a function that is passed the cleaned path of
+// each request, and returns the path of the file to serve instead. As
+// with WithAliases, the file is served without redirecting the client.
+func WithRewriteFunc(fn func(path string) string) HandlerOption {
+	return func(h *fileHandler) {
+		h.rewrite = fn
+	}
+}
+
+// WithNotFoundPage sets the file served as the body of 404 Not Found
+// responses, such as "/404.html". The response has the content type of
+// the file, and is compressed if the client accepts deflate, but it does
+// not include the file's ETag or Last-Modified headers. If the file does
+// not exist then a plain text response is sent.
+func WithNotFoundPage(name string) HandlerOption {
+	return func(h *fileHandler) {
+		h.notFoundPage = name
+	}
+}
+
+// WithErrorHandler sets the function that sends error responses, such as
+// 404 Not Found, 403 Forbidden, 412 Precondition Failed, 416 Range Not
+// Satisfiable and 500 Internal Server Error. The function is passed the
+// status code and the error that caused it, which can be logged, and it
+// must write the response. The default sends a short plain text message,
+// which does not include the error, or no body for 412 and 416. For a
+// 416 response the Content-Range header has already been set.
+func WithErrorHandler(fn func(w http.ResponseWriter, r *http.Request, code int, err error)) HandlerOption {
+	return func(h *fileHandler) {
+		h.errorHandler = fn
+	}
+}
+
+// WithNotFoundHandler causes requests for paths that are not in the file
+// system to be passed to next, instead of receiving 404 Not Found. This
+// allows the file server to be placed in front of another handler, such
+// as an API. The request is passed to next unchanged, and no headers
+// have been set on the response. A single page application fallback set
+// by WithSPAFallback takes precedence for the requests that it matches.
+func WithNotFoundHandler(next http.Handler) HandlerOption {
+	return func(h *fileHandler) {
+		h.notFoundHandler = next
+	}
+}
+
+// WithAllowedMethods sets the request methods for which files are served.
+// Requests for a file with other methods receive 405 Method Not Allowed,
+// and OPTIONS requests receive 204 No Content, both with an Allow header
+// listing the methods. The default is GET and HEAD. Other methods are
+// served in the same way as GET, except that If-None-Match and
+// If-Modified-Since do not result in 304 Not Modified.
+func WithAllowedMethods(methods ...string) HandlerOption {
+	return func(h *fileHandler) {
+		h.allowedMethods = append([]string(nil), methods...)
+	}
+}
+
+// WithErrorLog sets a function that is called with errors that occur
+// after a response has been started, and so cannot be reported to the
+// client. These errors are of type *BodyError, and those caused by the
+// client going away have their Canceled field set. Errors that occur
+// before the response is started are passed to the function set by
+// WithErrorHandler instead.
+func WithErrorLog(fn func(r *http.Request, err error)) HandlerOption {
+	return func(h *fileHandler) {
+		h.errorLog = fn
+	}
+}
+
+// WithContentTypes sets the content types of files with the given
+// extensions, such as ".wasm", ignoring case. Files with other extensions
+// have the types built into the package for a few common extensions that
+// are missing from some systems, such as ".wasm", ".mjs", ".avif" and
+// ".webmanifest", and otherwise the type given by the mime package, which
+// depends on the system.
+func WithContentTypes(types map[string]string) Option {
+	return func(fs *FileSystem) {
+		if fs.contentTypes == nil {
+			fs.contentTypes = make(map[string]string)
+		}
+		for ext, ctype := range types {
+			if !strings.HasPrefix(ext, ".") {
+				ext = "." + ext
+			}
+			fs.contentTypes[strings.ToLower(ext)] = ctype
+		}
+	}
+}
+
+// WithContentTypeFunc sets a function that returns the content type of
+// the file f at name, which is its path within the file system. If the
+// function returns an empty string then the type is based on the
+// extension of the name, as described for WithContentTypes. The function
+// is called once for each file when the FileSystem is created.
+func WithContentTypeFunc(fn func(name string, f *zip.File) string) Option {
+	return func(fs *FileSystem) {
+		fs.contentTypeFunc = fn
+	}
+}
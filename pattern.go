@@ -0,0 +1,56 @@
+package zipfs
+
+import "strings"
+
+// matchSplat matches a request path against a pattern in the style used
+// by the _headers and _redirects files of static site hosts. Each segment
+// of the pattern must equal the corresponding segment of the path, except
+// that a segment starting with a colon is a placeholder that matches any
+// single non-empty segment, and a final "*" segment matches the rest of
+// the path, including nothing at all.
+//
+// If the path matches, the values of the placeholders are returned,
+// keyed by name without the colon. The value matched by "*" has the
+// key "splat".
+func matchSplat(pattern, name string) (params map[string]string, ok bool) {
+	patternSegs := strings.Split(pattern, "/")
+	nameSegs := strings.Split(name, "/")
+	for i, seg := range patternSegs {
+		if seg == "*" && i == len(patternSegs)-1 {
+			if i > len(nameSegs) {
+				return nil, false
+			}
+			splat := ""
+			if i < len(nameSegs) {
+				splat = strings.Join(nameSegs[i:], "/")
+			}
+			params = addParam(params, "splat", splat)
+			return params, true
+		}
+		if i >= len(nameSegs) {
+			return nil, false
+		}
+		if strings.HasPrefix(seg, ":") && len(seg) > 1 {
+			if nameSegs[i] == "" {
+				return nil, false
+			}
+			params = addParam(params, seg[1:], nameSegs[i])
+			continue
+		}
+		if seg != nameSegs[i] {
+			return nil, false
+		}
+	}
+	if len(patternSegs) != len(nameSegs) {
+		return nil, false
+	}
+	return params, true
+}
+
+func addParam(params map[string]string, key, value string) map[string]string {
+	if params == nil {
+		params = make(map[string]string)
+	}
+	params[key] = value
+	return params
+}
@@ -0,0 +1,31 @@
+package zipfs
+
+import (
+	"net/http"
+	"net/url"
+)
+
+// pushAssets uses HTTP/2 server push to send the assets configured by
+// WithPush for the file at name, if the connection supports it. Pushes
+// that fail are skipped, because the client can still request the assets.
+func (h *fileHandler) pushAssets(w http.ResponseWriter, r *http.Request, name string) {
+	assets := h.push[name]
+	if len(assets) == 0 || r.Method != "GET" {
+		return
+	}
+	pusher, ok := w.(http.Pusher)
+	if !ok {
+		return
+	}
+	// The pushed responses can be compressed if this one can.
+	opts := &http.PushOptions{Header: make(http.Header)}
+	if values := r.Header.Values("Accept-Encoding"); len(values) > 0 {
+		opts.Header["Accept-Encoding"] = values
+	}
+	for _, asset := range assets {
+		target := (&url.URL{Path: h.location(r, asset)}).EscapedPath()
+		if err := pusher.Push(target, opts); err == http.ErrNotSupported {
+			return
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package zipfs
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// pushResponseWriter is a ResponseWriter that supports HTTP/2 server
+// push, and records the targets pushed.
+type pushResponseWriter struct {
+	*TestResponseWriter
+	pushed  []string
+	options []*http.PushOptions
+	written []int // length of the body when each target was pushed
+	err     error
+}
+
+func (w *pushResponseWriter) Push(target string, opts *http.PushOptions) error {
+	if w.err != nil {
+		return w.err
+	}
+	w.pushed = append(w.pushed, target)
+	w.options = append(w.options, opts)
+	w.written = append(w.written, w.buf.Len())
+	return nil
+}
+
+func TestPush(t *testing.T) {
+	assert := assert.New(t)
+
+	fs := newTestFileSystem(t, map[string]string{
+		"index.html":      "<html></html>",
+		"about.html":      "<html>about</html>",
+		"css/main.css":    "body {}",
+		"js/app.js":       "app()",
+		"img/my logo.png": "png",
+	})
+	push := map[string][]string{
+		"/index.html": {"/css/main.css", "js/app.js", "/img/my logo.png"},
+	}
+	handler := FileServer(fs, WithPush(push))
+
+	serve := func(handler http.Handler, method, target string, err error, headers ...string) *pushResponseWriter {
+		w := &pushResponseWriter{TestResponseWriter: NewTestResponseWriter(), err: err}
+		r := httptest.NewRequest(method, target, nil)
+		for i := 0; i+1 < len(headers); i += 2 {
+			r.Header.Set(headers[i], headers[i+1])
+		}
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	w := serve(handler, "GET", "/", nil, "Accept-Encoding", "deflate")
+	assert.Equal(200, w.status)
+	assert.Equal([]string{"/css/main.css", "/js/app.js", "/img/my%20logo.png"}, w.pushed)
+	assert.Equal([]int{0, 0, 0}, w.written, "pushed before the body")
+	assert.Equal("deflate", w.options[0].Header.Get("Accept-Encoding"))
+
+	// the mount prefix is added to the targets
+	w = serve(Mount("/static/", fs, WithPush(push)), "GET", "/static/", nil)
+	assert.Equal(200, w.status)
+	assert.Equal([]string{"/static/css/main.css", "/static/js/app.js", "/static/img/my%20logo.png"}, w.pushed)
+
+	// nothing is pushed for other files and methods
+	assert.Empty(serve(handler, "GET", "/about.html", nil).pushed)
+	assert.Empty(serve(handler, "HEAD", "/", nil).pushed)
+	assert.Empty(serve(handler, "GET", "/", nil, "Range", "bytes=0-1").pushed)
+
+	// a failed push is skipped
+	w = serve(handler, "GET", "/", http.ErrNotSupported)
+	assert.Equal(200, w.status)
+	assert.Equal("<html></html>", w.buf.String())
+
+	// a writer without push support
+	tw := serveTestRequest(handler, "GET", "/")
+	assert.Equal(200, tw.status)
+	assert.Equal("<html></html>", tw.buf.String())
+
+	assert.Panics(func() {
+		FileServer(fs, WithPush(map[string][]string{"/index.html": {"/missing.css"}}))
+	})
+	assert.Panics(func() {
+		FileServer(fs, WithPush(map[string][]string{"/index.html": {"/css"}}))
+	})
+}
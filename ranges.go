@@ -0,0 +1,235 @@
+package zipfs
+
+// Some of the functions in this file are adapted from private
+// functions in the standard library net/http package.
+//
+// Copyright 2009 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE.md file.
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+)
+
+var (
+	errInvalidRange = errors.New("invalid range")
+	errNoOverlap    = errors.New("invalid range: failed to overlap")
+)
+
+// httpRange specifies the byte range to be sent to the client.
+type httpRange struct {
+	start, length int64
+}
+
+func (r httpRange) contentRange(size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", r.start, r.start+r.length-1, size)
+}
+
+func (r httpRange) mimeHeader(contentType string, size int64) textproto.MIMEHeader {
+	return textproto.MIMEHeader{
+		"Content-Range": {r.contentRange(size)},
+		"Content-Type":  {contentType},
+	}
+}
+
+// parseRange parses a Range header string as per RFC 9110, section 14.2.
+// errNoOverlap is returned if none of the ranges overlap, in which case
+// the range is not satisfiable. Any other error means that the header is
+// not valid, and it should be ignored.
+func parseRange(s string, size int64) ([]httpRange, error) {
+	if s == "" {
+		return nil, nil // header not present
+	}
+	const b = "bytes="
+	if !strings.HasPrefix(s, b) {
+		return nil, errInvalidRange
+	}
+	var ranges []httpRange
+	noOverlap := false
+	for _, ra := range strings.Split(s[len(b):], ",") {
+		ra = textproto.TrimString(ra)
+		if ra == "" {
+			continue
+		}
+		i := strings.Index(ra, "-")
+		if i < 0 {
+			return nil, errInvalidRange
+		}
+		start, end := textproto.TrimString(ra[:i]), textproto.TrimString(ra[i+1:])
+		var r httpRange
+		if start == "" {
+			// If no start is specified, end specifies the
+			// range start relative to the end of the file,
+			// and we are dealing with <suffix-length>
+			// which has to be a non-negative integer.
+			if end == "" || end[0] == '-' {
+				return nil, errInvalidRange
+			}
+			i, err := strconv.ParseInt(end, 10, 64)
+			if i < 0 || err != nil {
+				return nil, errInvalidRange
+			}
+			if i == 0 || size == 0 {
+				// A suffix range of zero length, or of a file
+				// of zero length, cannot be satisfied.
+				noOverlap = true
+				continue
+			}
+			if i > size {
+				i = size
+			}
+			r.start = size - i
+			r.length = size - r.start
+		} else {
+			i, err := strconv.ParseInt(start, 10, 64)
+			if err != nil || i < 0 {
+				return nil, errInvalidRange
+			}
+			if i >= size {
+				// If the range begins after the size of the content,
+				// then it does not overlap.
+				noOverlap = true
+				continue
+			}
+			r.start = i
+			if end == "" {
+				// If no end is specified, range extends to end of the file.
+				r.length = size - r.start
+			} else {
+				i, err := strconv.ParseInt(end, 10, 64)
+				if err != nil || r.start > i {
+					return nil, errInvalidRange
+				}
+				if i >= size {
+					i = size - 1
+				}
+				r.length = i - r.start + 1
+			}
+		}
+		ranges = append(ranges, r)
+	}
+	if len(ranges) == 0 {
+		if noOverlap {
+			// The specified ranges did not overlap with the content.
+			return nil, errNoOverlap
+		}
+		// A range set must contain at least one range.
+		return nil, errInvalidRange
+	}
+	return ranges, nil
+}
+
+// countingWriter counts how many bytes have been written to it.
+type countingWriter int64
+
+func (w *countingWriter) Write(p []byte) (n int, err error) {
+	*w += countingWriter(len(p))
+	return len(p), nil
+}
+
+// rangesMIMESize returns the number of bytes it takes to encode the
+// provided ranges as a multipart response.
+func rangesMIMESize(ranges []httpRange, contentType string, contentSize int64) (encSize int64) {
+	var w countingWriter
+	mw := multipart.NewWriter(&w)
+	for _, ra := range ranges {
+		mw.CreatePart(ra.mimeHeader(contentType, contentSize))
+		encSize += ra.length
+	}
+	mw.Close()
+	encSize += int64(w)
+	return
+}
+
+func sumRangesSize(ranges []httpRange) (size int64) {
+	for _, ra := range ranges {
+		size += ra.length
+	}
+	return
+}
+
+// effectiveRanges returns the ranges specified by rangeReq for content
+// that is size bytes long. If the result is empty then the whole content
+// should be sent: either there is no Range header, or it is not valid, or
+// the ranges are larger than the content. The error is errNoOverlap if
+// the ranges cannot be satisfied.
+func effectiveRanges(rangeReq string, size int64) ([]httpRange, error) {
+	ranges, err := parseRange(rangeReq, size)
+	if err == errNoOverlap {
+		return nil, err
+	}
+	if err != nil || sumRangesSize(ranges) > size {
+		// The Range header is ignored if it is not valid, and
+		// if the ranges are larger than the whole content the
+		// client is probably attacking, so ignore it.
+		return nil, nil
+	}
+	return ranges, nil
+}
+
+// serveRanges serves the ranges of content, which must not be empty.
+// The content is size bytes long, and its type is given by the
+// Content-Type response header, which must have already been set.
+// A single range is sent as is, and multiple ranges are sent as a
+// multipart/byteranges response. The content is not read for HEAD
+// requests, and so may be nil. Failures to send the body are passed to
+// the error log, as they are when the whole file is sent.
+func (h *fileHandler) serveRanges(w http.ResponseWriter, r *http.Request, name string, content io.ReaderAt, size int64, ranges []httpRange) {
+	if len(ranges) == 1 {
+		ra := ranges[0]
+		w.Header().Set("Content-Range", ra.contentRange(size))
+		w.Header().Set("Content-Length", strconv.FormatInt(ra.length, 10))
+		w.WriteHeader(http.StatusPartialContent)
+		if r.Method == "HEAD" {
+			return
+		}
+		tw := h.bodyWriter(w, r)
+		_, err := io.Copy(tw, io.NewSectionReader(content, ra.start, ra.length))
+		if err == nil && tw.written != ra.length {
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			h.logError(r, newBodyError(r, name, tw.written, tw.err, err))
+		}
+		return
+	}
+
+	ctype := w.Header().Get("Content-Type")
+	tw := h.bodyWriter(w, r)
+	mw := multipart.NewWriter(tw)
+	w.Header().Set("Content-Type", "multipart/byteranges; boundary="+mw.Boundary())
+	w.Header().Set("Content-Length", strconv.FormatInt(rangesMIMESize(ranges, ctype, size), 10))
+	w.WriteHeader(http.StatusPartialContent)
+	if r.Method == "HEAD" {
+		return
+	}
+	if err := writeRangeParts(mw, content, ctype, size, ranges); err != nil {
+		h.logError(r, newBodyError(r, name, tw.written, tw.err, err))
+	}
+}
+
+// writeRangeParts writes the ranges of content to mw,
+// one part for each, and closes it.
+func writeRangeParts(mw *multipart.Writer, content io.ReaderAt, ctype string, size int64, ranges []httpRange) error {
+	for _, ra := range ranges {
+		part, err := mw.CreatePart(ra.mimeHeader(ctype, size))
+		if err != nil {
+			return err
+		}
+		n, err := io.Copy(part, io.NewSectionReader(content, ra.start, ra.length))
+		if err == nil && n != ra.length {
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return mw.Close()
+}
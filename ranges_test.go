@@ -0,0 +1,181 @@
+package zipfs
+
+import (
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRange(t *testing.T) {
+	assert := assert.New(t)
+	testCases := []struct {
+		Range  string
+		Size   int64
+		Ranges []httpRange
+		Error  error
+	}{
+		{"", 100, nil, nil},
+		{"bytes=0-9", 100, []httpRange{{0, 10}}, nil},
+		{"bytes=90-", 100, []httpRange{{90, 10}}, nil},
+		{"bytes=-10", 100, []httpRange{{90, 10}}, nil},
+		{"bytes=-1000", 100, []httpRange{{0, 100}}, nil},
+		{"bytes=90-1000", 100, []httpRange{{90, 10}}, nil},
+		{"bytes=0-9, 20-29", 100, []httpRange{{0, 10}, {20, 10}}, nil},
+		{"bytes=0-9,,20-29", 100, []httpRange{{0, 10}, {20, 10}}, nil},
+		{"bytes=0-9,200-299", 100, []httpRange{{0, 10}}, nil},
+		{"bytes=100-", 100, nil, errNoOverlap},
+		{"bytes=200-299,300-399", 100, nil, errNoOverlap},
+		{"bits=0-9", 100, nil, errInvalidRange},
+		{"bytes=9-0", 100, nil, errInvalidRange},
+		{"bytes=a-b", 100, nil, errInvalidRange},
+		{"bytes=10", 100, nil, errInvalidRange},
+		{"bytes=--10", 100, nil, errInvalidRange},
+		{"bytes=-", 100, nil, errInvalidRange},
+		{"bytes=", 100, nil, errInvalidRange},
+		{"bytes= , ,", 100, nil, errInvalidRange},
+		{"bytes=-0", 100, nil, errNoOverlap},
+		{"bytes=-0,0-9", 100, []httpRange{{0, 10}}, nil},
+		{"bytes=0-", 0, nil, errNoOverlap},
+		{"bytes=-10", 0, nil, errNoOverlap},
+	}
+
+	for _, tc := range testCases {
+		ranges, err := parseRange(tc.Range, tc.Size)
+		assert.Equal(tc.Error, err, tc.Range)
+		assert.Equal(tc.Ranges, ranges, tc.Range)
+	}
+}
+
+// readRandomDat returns the contents of testdata/random.dat.
+func readRandomDat(t *testing.T) []byte {
+	f, err := os.Open("testdata/random.dat")
+	require.NoError(t, err)
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	require.NoError(t, err)
+	require.Len(t, data, 10000)
+	return data
+}
+
+func TestMultipartRanges(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	random := readRandomDat(t)
+	fs := newTestFileSystem(t, map[string]string{
+		"stored.dat":   string(random),
+		"deflated.bin": string(random),
+	})
+	handler := FileServer(fs, WithRangeMemoryLimit(1<<20))
+
+	for _, name := range []string{"/stored.dat", "/deflated.bin"} {
+		count := atomic.LoadInt64(&tempFileCount)
+		w := serveTestRequest(handler, "GET", name, "Range: bytes=0-99,200-299, -50")
+		require.Equal(206, w.status, name)
+		assert.Equal(count, atomic.LoadInt64(&tempFileCount), name)
+		assert.Equal(w.Header().Get("Content-Length"), strconv.Itoa(w.buf.Len()), name)
+
+		mediaType, params, err := mime.ParseMediaType(w.Header().Get("Content-Type"))
+		require.NoError(err)
+		assert.Equal("multipart/byteranges", mediaType)
+
+		expected := []struct {
+			ContentRange string
+			Data         []byte
+		}{
+			{"bytes 0-99/10000", random[0:100]},
+			{"bytes 200-299/10000", random[200:300]},
+			{"bytes 9950-9999/10000", random[9950:]},
+		}
+		mr := multipart.NewReader(&w.buf, params["boundary"])
+		for _, e := range expected {
+			part, err := mr.NextPart()
+			require.NoError(err, name)
+			assert.Equal(e.ContentRange, part.Header.Get("Content-Range"), name)
+			assert.Equal("application/octet-stream", part.Header.Get("Content-Type"), name)
+			data, err := io.ReadAll(part)
+			require.NoError(err)
+			assert.Equal(e.Data, data, name)
+		}
+		_, err = mr.NextPart()
+		assert.Equal(io.EOF, err, name)
+	}
+
+	testCases := []struct {
+		Range        string
+		Status       int
+		ContentRange string
+		Size         int
+	}{
+		{"bytes=20000-", 416, "bytes */10000", 0},
+		{"bytes=20000-,30000-", 416, "bytes */10000", 0},
+		{"bytes=0-9,20000-", 206, "bytes 0-9/10000", 10},
+		{"bytes=a-b", 200, "", 10000},
+		{"bytes=0-9999,0-9999", 200, "", 10000},
+	}
+
+	for _, tc := range testCases {
+		w := serveTestRequest(handler, "GET", "/stored.dat", "Range: "+tc.Range)
+		assert.Equal(tc.Status, w.status, tc.Range)
+		assert.Equal(tc.ContentRange, w.Header().Get("Content-Range"), tc.Range)
+		if tc.Size > 0 {
+			assert.Equal(tc.Size, w.buf.Len(), tc.Range)
+			assert.Equal(strconv.Itoa(tc.Size), w.Header().Get("Content-Length"), tc.Range)
+		}
+	}
+}
+
+func TestRangeNotSatisfiable(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	random := readRandomDat(t)
+	fs, err := New("testdata/testdata.zip")
+	require.NoError(err)
+	defer fs.Close()
+	empty := newTestFileSystem(t, map[string]string{
+		"empty.dat": "",
+		"empty.txt": "",
+	})
+
+	testCases := []struct {
+		Handler      http.Handler
+		Path         string
+		Range        string
+		Status       int
+		ContentRange string
+		Data         []byte
+	}{
+		{FileServer(fs), "/random.dat", "bytes=999999-", 416, "bytes */10000", nil},
+		{FileServer(fs), "/random.dat", "bytes=10000-10001", 416, "bytes */10000", nil},
+		{FileServer(fs), "/random.dat", "bytes=-0", 416, "bytes */10000", nil},
+		{FileServer(fs), "/random.dat", "bytes=-500", 206, "bytes 9500-9999/10000", random[9500:]},
+		{FileServer(fs), "/random.dat", "bytes=9999-", 206, "bytes 9999-9999/10000", random[9999:]},
+		{FileServer(fs), "/random.dat", "bytes=", 200, "", random},
+		{FileServer(fs), "/random.dat", "bytes=,", 200, "", random},
+		{FileServer(empty), "/empty.dat", "bytes=0-", 416, "bytes */0", nil},
+		{FileServer(empty), "/empty.dat", "bytes=-500", 416, "bytes */0", nil},
+		{FileServer(empty), "/empty.txt", "bytes=0-0", 416, "bytes */0", nil},
+		{FileServer(empty, WithRangeMemoryLimit(100)), "/empty.txt", "bytes=0-0", 416, "bytes */0", nil},
+	}
+
+	for _, tc := range testCases {
+		w := serveTestRequest(tc.Handler, "GET", tc.Path, "Range: "+tc.Range)
+		assert.Equal(tc.Status, w.status, tc.Path, tc.Range)
+		assert.Equal(tc.ContentRange, w.Header().Get("Content-Range"), tc.Path, tc.Range)
+		if tc.Status == 416 {
+			assert.Equal(0, w.buf.Len(), tc.Path, tc.Range)
+			assert.Empty(w.Header().Get("Content-Type"), tc.Path, tc.Range)
+		} else {
+			assert.Equal(tc.Data, w.buf.Bytes(), tc.Path, tc.Range)
+		}
+	}
+}
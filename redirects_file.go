@@ -0,0 +1,132 @@
+package zipfs
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// redirectRule is a rule from a _redirects file, which redirects
+// request paths that match a pattern to another location, or serves
+// another file in their place.
+type redirectRule struct {
+	pattern string
+	to      string
+	status  int
+}
+
+// parseRedirectsFile parses the contents of a _redirects file, as used
+// by several static site hosts. Each line contains a path pattern, the
+// location to redirect to, and optionally the status code, which is 301
+// by default. A status code may be followed by "!", which is ignored
+// because rules always take precedence over files. Lines starting with
+// "#" are comments. Rules with an unsupported status code, or with
+// conditions, are skipped. See matchSplat for the pattern syntax.
+func parseRedirectsFile(r io.Reader) ([]redirectRule, error) {
+	var rules []redirectRule
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if len(fields) < 2 || len(fields) > 3 {
+			continue
+		}
+		rule := redirectRule{
+			pattern: fields[0],
+			to:      fields[1],
+			status:  http.StatusMovedPermanently,
+		}
+		if len(fields) == 3 {
+			status, err := strconv.Atoi(strings.TrimSuffix(fields[2], "!"))
+			if err != nil {
+				continue
+			}
+			rule.status = status
+		}
+		switch rule.status {
+		case http.StatusOK:
+			// A rewrite must be to a file in the archive.
+			if !strings.HasPrefix(rule.to, "/") {
+				continue
+			}
+		case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+			http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		default:
+			continue
+		}
+		rules = append(rules, rule)
+	}
+	return rules, scanner.Err()
+}
+
+// target returns the location for a request path that matches the rule,
+// with the placeholders of the pattern replaced by their values.
+func (rule *redirectRule) target(params map[string]string) string {
+	if len(params) == 0 {
+		return rule.to
+	}
+	// Replace longer names first, so that ":id" does not
+	// replace the start of ":identifier".
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return len(names[i]) > len(names[j])
+	})
+	oldnew := make([]string, 0, 2*len(names))
+	for _, name := range names {
+		oldnew = append(oldnew, ":"+name, params[name])
+	}
+	return strings.NewReplacer(oldnew...).Replace(rule.to)
+}
+
+// loadRedirectsFile reads the rules from the _redirects file at name,
+// and hides the file from clients. If the file does not exist, or
+// cannot be read, then there are no rules.
+func (h *fileHandler) loadRedirectsFile(name string) {
+	name = path.Clean("/" + name)
+	h.hide(name)
+	f, err := h.fs.Open(name)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	if rules, err := parseRedirectsFile(f); err == nil {
+		h.redirectRules = rules
+	}
+}
+
+// serveRedirectRule responds to the request for the cleaned path name
+// according to the first rule of the _redirects file that matches it,
+// if there is one. It reports whether a rule matched.
+func (h *fileHandler) serveRedirectRule(w http.ResponseWriter, r *http.Request, name string) bool {
+	for i := range h.redirectRules {
+		rule := &h.redirectRules[i]
+		params, ok := matchSplat(rule.pattern, name)
+		if !ok {
+			continue
+		}
+		to := rule.target(params)
+		if rule.status == http.StatusOK {
+			// Serve the target as if it had been requested.
+			to, _, _ = strings.Cut(to, "?")
+			h.serveFile(w, r, path.Clean(to), false)
+			return true
+		}
+		// The query is passed on, unless the rule specifies one.
+		if r.URL.RawQuery != "" && !strings.Contains(to, "?") {
+			to += "?" + r.URL.RawQuery
+		}
+		w.Header().Set("Location", h.location(r, to))
+		w.WriteHeader(rule.status)
+		return true
+	}
+	return false
+}
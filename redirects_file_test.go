@@ -0,0 +1,110 @@
+package zipfs
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRedirectsFile(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	const text = `# A comment
+/old            /new
+/blog/*         /news/:splat     302
+  /users/:id    /profile?id=:id  307!
+
+/app/*          /app/index.html  200
+/external       https://example.com/  308
+/missing-to
+/bad-status     /somewhere       abc
+/unsupported    /somewhere       500
+/relative       index.html       200
+/conditions     /somewhere       302  Country=nz
+`
+	rules, err := parseRedirectsFile(strings.NewReader(text))
+	require.NoError(err)
+	assert.Equal([]redirectRule{
+		{pattern: "/old", to: "/new", status: 301},
+		{pattern: "/blog/*", to: "/news/:splat", status: 302},
+		{pattern: "/users/:id", to: "/profile?id=:id", status: 307},
+		{pattern: "/app/*", to: "/app/index.html", status: 200},
+		{pattern: "/external", to: "https://example.com/", status: 308},
+	}, rules)
+}
+
+func TestRedirectRuleTarget(t *testing.T) {
+	assert := assert.New(t)
+
+	rule := redirectRule{to: "/:id/:identifier/:splat"}
+	assert.Equal("/1/2/a/b", rule.target(map[string]string{
+		"id":         "1",
+		"identifier": "2",
+		"splat":      "a/b",
+	}))
+	rule = redirectRule{to: "/:id"}
+	assert.Equal("/:id", rule.target(nil))
+}
+
+func TestRedirectsFile(t *testing.T) {
+	assert := assert.New(t)
+
+	fs := newTestFileSystem(t, map[string]string{
+		"_redirects": `/old.html      /new.html
+/blog/*        /news/:splat         302
+/users/:id     /profile.html?id=:id 307
+/app/*         /app/index.html      200
+/new.html      /index.html          301
+/secret        /_redirects          200
+`,
+		"index.html":     "<html>index</html>",
+		"new.html":       "<html>new</html>",
+		"profile.html":   "<html>profile</html>",
+		"app/index.html": "<html>app</html>",
+	})
+	handler := FileServer(fs, WithRedirectsFile("_redirects"))
+
+	testCases := []struct {
+		Path     string
+		Status   int
+		Location string
+		Body     string
+	}{
+		{Path: "/old.html", Status: 301, Location: "/new.html"},
+		{Path: "/old.html?a=1", Status: 301, Location: "/new.html?a=1"},
+		{Path: "/blog/2020/01/post.html", Status: 302, Location: "/news/2020/01/post.html"},
+		{Path: "/blog", Status: 302, Location: "/news/"},
+		{Path: "/users/42", Status: 307, Location: "/profile.html?id=42"},
+		{Path: "/users/42?tab=1", Status: 307, Location: "/profile.html?id=42"},
+		{Path: "/app/settings/profile", Status: 200, Body: "<html>app</html>"},
+		{Path: "/app/index.html", Status: 200, Body: "<html>app</html>"},
+		// rules take precedence over files
+		{Path: "/new.html", Status: 301, Location: "/index.html"},
+		{Path: "/profile.html", Status: 200, Body: "<html>profile</html>"},
+		// the file itself is not served, even through a rewrite
+		{Path: "/_redirects", Status: 404},
+		{Path: "/secret", Status: 404},
+	}
+
+	for _, tc := range testCases {
+		w := serveTestRequest(handler, "GET", tc.Path)
+		assert.Equal(tc.Status, w.status, tc.Path)
+		assert.Equal(tc.Location, w.Header().Get("Location"), tc.Path)
+		if tc.Body != "" {
+			assert.Equal(tc.Body, w.buf.String(), tc.Path)
+		}
+	}
+
+	// Without the option the file is served and there are no redirects.
+	w := serveTestRequest(FileServer(fs), "GET", "/_redirects")
+	assert.Equal(200, w.status)
+	w = serveTestRequest(FileServer(fs), "GET", "/old.html")
+	assert.Equal(404, w.status)
+
+	// A missing file is not an error.
+	w = serveTestRequest(FileServer(fs, WithRedirectsFile("missing")), "GET", "/new.html")
+	assert.Equal(200, w.status)
+}
@@ -0,0 +1,206 @@
+package zipfs
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"io"
+)
+
+// checkpoint is a position in a deflate stream at the start of a
+// block, from which decompression can be restarted.
+type checkpoint struct {
+	bitOffset int64  // offset in the compressed data, in bits
+	offset    int64  // offset in the uncompressed data
+	window    []byte // preceding uncompressed data, up to 32KB
+}
+
+// seekIndex is a list of checkpoints in a deflated file,
+// ordered by offset. The first checkpoint is always the
+// start of the file.
+type seekIndex struct {
+	checkpoints []checkpoint
+}
+
+// buildSeekIndex decompresses the deflate stream read from r, recording
+// a checkpoint at the start of the first block following each interval
+// bytes of uncompressed data. The size is the uncompressed size of the
+// file.
+func buildSeekIndex(r io.Reader, size int64, interval int64) (*seekIndex, error) {
+	index := &seekIndex{
+		checkpoints: []checkpoint{{}},
+	}
+	if size <= interval {
+		// There will never be another checkpoint.
+		return index, nil
+	}
+
+	f := newInflater(r)
+	var last int64
+	f.blockFunc = func() error {
+		if f.total-last >= interval {
+			index.checkpoints = append(index.checkpoints, checkpoint{
+				bitOffset: f.br.bitOffset(),
+				offset:    f.total,
+				window:    f.lastWindow(),
+			})
+			last = f.total
+		}
+		return nil
+	}
+	if err := f.run(); err != nil {
+		return nil, err
+	}
+	return index, nil
+}
+
+// find returns the last checkpoint at or before offset.
+func (index *seekIndex) find(offset int64) checkpoint {
+	cps := index.checkpoints
+	i, j := 0, len(cps)
+	for i < j {
+		h := int(uint(i+j) >> 1)
+		if cps[h].offset <= offset {
+			i = h + 1
+		} else {
+			j = h
+		}
+	}
+	return cps[i-1]
+}
+
+// indexedReader provides random access to the contents of a deflated
+// file by restarting decompression from the nearest checkpoint.
+type indexedReader struct {
+	compressed *io.SectionReader
+	size       int64
+	index      *seekIndex
+}
+
+// open returns a reader for the uncompressed contents of the
+// file, starting at offset.
+func (ir *indexedReader) open(offset int64) (io.ReadCloser, error) {
+	if offset > ir.size {
+		offset = ir.size
+	}
+	cp := ir.index.find(offset)
+	start := cp.bitOffset / 8
+	section := io.NewSectionReader(ir.compressed, start, ir.compressed.Size()-start)
+	var r io.Reader = section
+	if shift := uint(cp.bitOffset % 8); shift > 0 {
+		var first [1]byte
+		if _, err := io.ReadFull(section, first[:]); err != nil {
+			return nil, err
+		}
+		prefix := resumePrefix(shift)
+		prefix[len(prefix)-1] |= first[0] &^ (1<<shift - 1)
+		r = io.MultiReader(bytes.NewReader(prefix), section)
+	}
+	reader := flate.NewReaderDict(bufio.NewReader(r), cp.window)
+	if _, err := io.CopyN(io.Discard, reader, offset-cp.offset); err != nil {
+		reader.Close()
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return reader, nil
+}
+
+// ReadAt implements the io.ReaderAt interface.
+func (ir *indexedReader) ReadAt(p []byte, off int64) (int, error) {
+	reader, err := ir.open(off)
+	if err != nil {
+		return 0, err
+	}
+	defer reader.Close()
+	n, err := io.ReadFull(reader, p)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// resumePrefix returns the start of a deflate stream consisting of
+// empty blocks, which is used to resume decompression part way through
+// a byte. The length of the blocks in bits is equal to shift modulo 8,
+// so the final byte returned holds only the low shift bits, and the
+// remaining bits are taken from the compressed data. This keeps the
+// compressed data at its original byte alignment, which matters for
+// stored blocks.
+func resumePrefix(shift uint) []byte {
+	var w bitWriter
+	if shift%2 == 1 {
+		// 95 bits, which is 7 modulo 8
+		w.emptyDynamicBlock()
+		shift = (shift + 1) % 8
+	}
+	for ; shift > 0; shift -= 2 {
+		// 10 bits, which is 2 modulo 8
+		w.emptyFixedBlock()
+	}
+	return w.buf
+}
+
+// bitWriter writes bits, least significant first.
+type bitWriter struct {
+	buf   []byte
+	nbits uint
+}
+
+func (w *bitWriter) writeBits(v uint32, n uint) {
+	for i := uint(0); i < n; i++ {
+		if w.nbits%8 == 0 {
+			w.buf = append(w.buf, 0)
+		}
+		w.buf[len(w.buf)-1] |= byte(v>>i&1) << (w.nbits % 8)
+		w.nbits++
+	}
+}
+
+// writeCode writes a Huffman code, which is packed starting
+// with its most significant bit.
+func (w *bitWriter) writeCode(code uint32, n uint) {
+	for i := n; i > 0; i-- {
+		w.writeBits(code>>(i-1)&1, 1)
+	}
+}
+
+// emptyFixedBlock writes a block using the fixed
+// Huffman codes that contains only the end of block code.
+func (w *bitWriter) emptyFixedBlock() {
+	w.writeBits(0, 1) // not final
+	w.writeBits(1, 2) // fixed codes
+	w.writeCode(0, 7) // end of block
+}
+
+// emptyDynamicBlock writes a block using dynamic Huffman codes
+// that contains only the end of block code. The only literal/length
+// code is end of block, and there are no distance codes.
+func (w *bitWriter) emptyDynamicBlock() {
+	w.writeBits(0, 1)  // not final
+	w.writeBits(2, 2)  // dynamic codes
+	w.writeBits(0, 5)  // 257 literal/length codes
+	w.writeBits(0, 5)  // 1 distance code
+	w.writeBits(15, 4) // 19 code length codes
+
+	// The code length code has 18 -> 0, 0 -> 10 and 1 -> 11.
+	for _, sym := range codeLengthOrder {
+		switch sym {
+		case 18:
+			w.writeBits(1, 3)
+		case 0, 1:
+			w.writeBits(2, 3)
+		default:
+			w.writeBits(0, 3)
+		}
+	}
+	w.writeCode(0, 1) // 138 zero lengths
+	w.writeBits(127, 7)
+	w.writeCode(0, 1) // 118 zero lengths
+	w.writeBits(107, 7)
+	w.writeCode(3, 2) // end of block has length 1
+	w.writeCode(2, 2) // the distance code has length 0
+
+	w.writeCode(0, 1) // end of block
+}
@@ -0,0 +1,187 @@
+package zipfs
+
+import (
+	"bytes"
+	"compress/flate"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// seekTestData returns data that compresses into many deflate blocks
+// of different types: text compresses well, and random bytes are
+// likely to be written as stored blocks.
+func seekTestData(size int) []byte {
+	rnd := rand.New(rand.NewSource(1))
+	var buf bytes.Buffer
+	for buf.Len() < size {
+		if rnd.Intn(4) == 0 {
+			chunk := make([]byte, rnd.Intn(20000))
+			rnd.Read(chunk)
+			buf.Write(chunk)
+			continue
+		}
+		for i := rnd.Intn(500); i >= 0; i-- {
+			fmt.Fprintf(&buf, "line %d of chunk %d\n", i, rnd.Intn(1000))
+		}
+	}
+	return buf.Bytes()[:size]
+}
+
+func TestSeekIndex(t *testing.T) {
+	data := seekTestData(1 << 20)
+	levels := []int{
+		flate.NoCompression,
+		flate.BestSpeed,
+		flate.DefaultCompression,
+		flate.BestCompression,
+		flate.HuffmanOnly,
+	}
+	for _, level := range levels {
+		t.Run(fmt.Sprint(level), func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			var compressed bytes.Buffer
+			fw, err := flate.NewWriter(&compressed, level)
+			require.NoError(err)
+			_, err = fw.Write(data)
+			require.NoError(err)
+			require.NoError(fw.Close())
+
+			index, err := buildSeekIndex(bytes.NewReader(compressed.Bytes()), int64(len(data)), 64*1024)
+			require.NoError(err)
+			assert.Greater(len(index.checkpoints), 4)
+			for i, cp := range index.checkpoints[1:] {
+				assert.Equal(data[cp.offset-int64(len(cp.window)):cp.offset], cp.window, "checkpoint %d", i+1)
+			}
+
+			ir := &indexedReader{
+				compressed: io.NewSectionReader(bytes.NewReader(compressed.Bytes()), 0, int64(compressed.Len())),
+				size:       int64(len(data)),
+				index:      index,
+			}
+			rnd := rand.New(rand.NewSource(2))
+			for i := 0; i < 50; i++ {
+				off := rnd.Int63n(int64(len(data)))
+				p := make([]byte, rnd.Intn(100000))
+				n, err := ir.ReadAt(p, off)
+				if off+int64(len(p)) > int64(len(data)) {
+					assert.Equal(io.EOF, err)
+				} else {
+					assert.NoError(err)
+				}
+				assert.Equal(data[off:off+int64(n)], p[:n], "offset %d", off)
+			}
+		})
+	}
+}
+
+func TestSeekIndexCorrupt(t *testing.T) {
+	// block type 3 is invalid
+	_, err := buildSeekIndex(bytes.NewReader([]byte{0x07, 0x00}), 100, 10)
+	assert.Equal(t, errCorruptDeflate, err)
+
+	_, err = buildSeekIndex(bytes.NewReader(nil), 100, 10)
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+}
+
+func TestResumePrefix(t *testing.T) {
+	for shift := uint(1); shift < 8; shift++ {
+		var w bitWriter
+		w.buf = resumePrefix(shift)
+		w.nbits = uint(len(w.buf)-1)*8 + shift
+		// a final stored block containing "ok"
+		w.writeBits(1, 1)
+		w.writeBits(0, 2)
+		w.buf = append(w.buf, 2, 0, 0xfd, 0xff, 'o', 'k')
+
+		data, err := io.ReadAll(flate.NewReader(bytes.NewReader(w.buf)))
+		assert.NoError(t, err, "shift %d", shift)
+		assert.Equal(t, "ok", string(data), "shift %d", shift)
+	}
+}
+
+func TestSeekIndexFileSystem(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	data := seekTestData(1 << 20)
+	fs := newTestFileSystem(t, map[string]string{
+		"large.bin": string(data),
+	}, WithSeekIndex(64*1024))
+
+	count := atomic.LoadInt64(&tempFileCount)
+
+	f, err := fs.Open("/large.bin")
+	require.NoError(err)
+	defer f.Close()
+
+	testCases := []struct {
+		Offset int64
+		Whence int
+		Pos    int64
+	}{
+		{Offset: 500000, Whence: io.SeekStart, Pos: 500000},
+		{Offset: 1000, Whence: io.SeekCurrent, Pos: 501100},
+		{Offset: -300000, Whence: io.SeekCurrent, Pos: 201200},
+		{Offset: -100, Whence: io.SeekEnd, Pos: int64(len(data)) - 100},
+		{Offset: 12345, Whence: io.SeekStart, Pos: 12345},
+	}
+	for _, tc := range testCases {
+		pos, err := f.Seek(tc.Offset, tc.Whence)
+		require.NoError(err)
+		assert.Equal(tc.Pos, pos)
+		p := make([]byte, 100)
+		n, err := io.ReadFull(f, p)
+		require.NoError(err)
+		assert.Equal(data[pos:pos+100], p[:n])
+	}
+
+	_, err = f.Seek(-1, io.SeekStart)
+	assert.Error(err)
+
+	handler := FileServer(fs)
+	w := serveTestRequest(handler, "GET", "/large.bin", "Range: bytes=700000-700999")
+	assert.Equal(206, w.status)
+	assert.Equal(data[700000:701000], w.buf.Bytes())
+
+	assert.Equal(count, atomic.LoadInt64(&tempFileCount), "no temp files")
+}
+
+func benchmarkSeekRange(b *testing.B, opts ...Option) {
+	data := seekTestData(4 << 20)
+	fs := newTestFileSystem(b, map[string]string{"file.bin": string(data)}, opts...)
+	handler := FileServer(fs)
+
+	req := &http.Request{
+		Method: "GET",
+		URL:    &url.URL{Path: "/file.bin"},
+		Header: http.Header{"Range": {"bytes=3000000-3000999"}},
+	}
+	w := &discardResponseWriter{header: make(http.Header)}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for key := range w.header {
+			delete(w.header, key)
+		}
+		handler.ServeHTTP(w, req)
+	}
+}
+
+func BenchmarkSeekRangeTempFile(b *testing.B) {
+	benchmarkSeekRange(b)
+}
+
+func BenchmarkSeekRangeIndex(b *testing.B) {
+	benchmarkSeekRange(b, WithSeekIndex(256*1024))
+}
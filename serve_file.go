@@ -0,0 +1,85 @@
+package zipfs
+
+import (
+	"net/http"
+	"os"
+	"path"
+)
+
+// ServeFile responds to the request with the contents of the file at
+// name in fs, regardless of the path of the request. It is for routers
+// that resolve the name of the file themselves. The response is the same
+// as the one from FileServer for the file, including ETags, conditional
+// requests, deflate encoding, ranges and the response to methods other
+// than GET and HEAD, but there are no redirects and no index documents.
+// If there is no file at name, or it is a directory, then the response
+// is 404 Not Found.
+func ServeFile(w http.ResponseWriter, r *http.Request, fs *FileSystem, name string) {
+	h := FileServer(fs).(*fileHandler)
+	name = path.Clean("/" + name)
+	fi, err := fs.openFileInfo(name)
+	if err != nil {
+		if code := toHTTPStatus(err); code != http.StatusNotFound {
+			h.error(w, r, code, err)
+			return
+		}
+		h.notFound(w, r)
+		return
+	}
+	if fi.IsDir() {
+		h.notFound(w, r)
+		return
+	}
+	if h.checkMethod(w, r) {
+		return
+	}
+	h.serveContent(w, r, name, fi)
+}
+
+// FileHandler returns a handler that responds to every request with the
+// file at name in fs, regardless of the path of the request, such as
+// for serving "/sw.js" or "/favicon.ico" from a file elsewhere in the
+// file system. The options are the same as for FileServer. If there is
+// no file at name when the handler is created, then the handler responds
+// with 404 Not Found. Use NewFileHandler to detect this instead.
+func FileHandler(fs *FileSystem, name string, opts ...HandlerOption) http.Handler {
+	h, _ := NewFileHandler(fs, name, opts...)
+	return h
+}
+
+// NewFileHandler is like FileHandler, but returns an error if there is
+// no file at name.
+func NewFileHandler(fs *FileSystem, name string, opts ...HandlerOption) (http.Handler, error) {
+	name = path.Clean("/" + name)
+	h := &singleFileHandler{
+		fileHandler: FileServer(fs, opts...).(*fileHandler),
+		name:        name,
+	}
+	fi, err := fs.openFileInfo(name)
+	if err == nil && fi.IsDir() {
+		err = &os.PathError{Op: "Open", Path: name, Err: ErrIsDirectory}
+	}
+	if err != nil {
+		return h, err
+	}
+	h.fi = fi
+	return h, nil
+}
+
+// singleFileHandler is the handler returned by FileHandler.
+type singleFileHandler struct {
+	*fileHandler
+	name string
+	fi   *fileInfo // nil if there is no file
+}
+
+func (h *singleFileHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.fi == nil {
+		h.notFound(w, r)
+		return
+	}
+	if h.checkMethod(w, r) {
+		return
+	}
+	h.serveContent(w, r, h.name, h.fi)
+}
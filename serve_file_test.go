@@ -0,0 +1,201 @@
+package zipfs
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServeFile(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	fs, err := New("testdata/testdata.zip")
+	require.NoError(err)
+	defer fs.Close()
+
+	testCases := []struct {
+		Name            string
+		Headers         []string
+		Status          int
+		ContentType     string
+		ContentEncoding string
+		ContentLength   string
+		ETag            string
+	}{
+		{
+			Name:          "/img/circle.png",
+			Status:        200,
+			ContentType:   "image/png",
+			ContentLength: "5973",
+			ETag:          `"1755529fb2ff"`,
+		},
+		{
+			Name:            "img/circle.png",
+			Headers:         []string{"Accept-Encoding: deflate, gzip"},
+			Status:          200,
+			ContentType:     "image/png",
+			ContentEncoding: "deflate",
+			ContentLength:   "4758",
+			ETag:            `"1755529fb2ff"`,
+		},
+		{
+			Name:    "/img/circle.png",
+			Headers: []string{`If-None-Match: "1755529fb2ff"`},
+			Status:  304,
+			ETag:    `"1755529fb2ff"`,
+		},
+		{
+			Name:    "/img/circle.png",
+			Headers: []string{"If-Modified-Since: Fri, 12 Feb 2100 14:01:00 GMT"},
+			Status:  304,
+			ETag:    `"1755529fb2ff"`,
+		},
+		{
+			Name:    "/img/circle.png",
+			Headers: []string{`If-Match: "other"`},
+			Status:  412,
+		},
+		{
+			Name:          "/img/circle.png",
+			Headers:       []string{"Range: bytes=0-9", "Accept-Encoding: deflate"},
+			Status:        206,
+			ContentType:   "image/png",
+			ContentLength: "10",
+			ETag:          `"1755529fb2ff"`,
+		},
+		{
+			Name:          "/random.dat",
+			Status:        200,
+			ContentType:   "application/octet-stream",
+			ContentLength: "10000",
+			ETag:          `"27106c15f45b"`,
+		},
+		// the index document is not served, and there are no redirects
+		{
+			Name:        "/index.html",
+			Status:      200,
+			ContentType: "text/html; charset=utf-8",
+		},
+		{
+			Name:        "/img",
+			Status:      404,
+			ContentType: "text/plain; charset=utf-8",
+		},
+		{
+			Name:        "/missing.txt",
+			Status:      404,
+			ContentType: "text/plain; charset=utf-8",
+		},
+	}
+
+	for _, tc := range testCases {
+		// the request path is not used
+		r := httptest.NewRequest("GET", "/some/route", nil)
+		for _, header := range tc.Headers {
+			key, value, _ := strings.Cut(header, ":")
+			r.Header.Add(key, strings.TrimSpace(value))
+		}
+		w := httptest.NewRecorder()
+		ServeFile(w, r, fs, tc.Name)
+		assert.Equal(tc.Status, w.Code, tc.Name, tc.Headers)
+		assert.Equal(tc.ContentType, w.Header().Get("Content-Type"), tc.Name, tc.Headers)
+		assert.Equal(tc.ContentEncoding, w.Header().Get("Content-Encoding"), tc.Name, tc.Headers)
+		if tc.ContentLength != "" {
+			assert.Equal(tc.ContentLength, w.Header().Get("Content-Length"), tc.Name, tc.Headers)
+		}
+		if tc.ETag != "" {
+			assert.Equal(tc.ETag, w.Header().Get("Etag"), tc.Name, tc.Headers)
+		}
+	}
+
+	// a router can use the file system without FileServer
+	mux := http.NewServeMux()
+	mux.HandleFunc("/logo", func(w http.ResponseWriter, r *http.Request) {
+		ServeFile(w, r, fs, "/img/circle.png")
+	})
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", "/logo", nil))
+	assert.Equal(200, w.Code)
+	assert.Equal(5973, w.Body.Len())
+
+	// other methods are not allowed, as for FileServer
+	w = httptest.NewRecorder()
+	ServeFile(w, httptest.NewRequest("POST", "/logo", nil), fs, "/img/circle.png")
+	assert.Equal(405, w.Code)
+	assert.Equal("GET, HEAD, OPTIONS", w.Header().Get("Allow"))
+	assert.Empty(w.Header().Get("Etag"))
+	w = httptest.NewRecorder()
+	ServeFile(w, httptest.NewRequest("OPTIONS", "/logo", nil), fs, "/img/circle.png")
+	assert.Equal(204, w.Code)
+	assert.Equal("GET, HEAD, OPTIONS", w.Header().Get("Allow"))
+	w = httptest.NewRecorder()
+	ServeFile(w, httptest.NewRequest("POST", "/logo", nil), fs, "/missing.txt")
+	assert.Equal(404, w.Code)
+}
+
+func TestFileHandler(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	fs := newTestFileSystem(t, map[string]string{
+		"static/js/sw.js":    "self.addEventListener()",
+		"static/favicon.ico": "icon",
+	})
+	mux := http.NewServeMux()
+	mux.Handle("/sw.js", FileHandler(fs, "static/js/sw.js", WithCacheControl("no-cache")))
+	mux.Handle("/favicon.ico", FileHandler(fs, "/static/favicon.ico"))
+	mux.Handle("/missing.txt", FileHandler(fs, "/static/missing.txt"))
+
+	serve := func(method, target string, headers ...string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, target, nil)
+		for i := 0; i+1 < len(headers); i += 2 {
+			r.Header.Set(headers[i], headers[i+1])
+		}
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		return w
+	}
+
+	w := serve("GET", "/sw.js")
+	assert.Equal(200, w.Code)
+	assert.Equal("self.addEventListener()", w.Body.String())
+	assert.Equal("text/javascript; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Equal("no-cache", w.Header().Get("Cache-Control"))
+	etag := w.Header().Get("Etag")
+	assert.NotEmpty(etag)
+
+	w = serve("GET", "/sw.js", "If-None-Match", etag)
+	assert.Equal(304, w.Code)
+
+	w = serve("GET", "/sw.js", "Accept-Encoding", "deflate")
+	assert.Equal(200, w.Code)
+	assert.Equal("deflate", w.Header().Get("Content-Encoding"))
+
+	w = serve("GET", "/favicon.ico", "Range", "bytes=1-2")
+	assert.Equal(206, w.Code)
+	assert.Equal("co", w.Body.String())
+
+	w = serve("POST", "/favicon.ico")
+	assert.Equal(405, w.Code)
+	assert.Equal("GET, HEAD, OPTIONS", w.Header().Get("Allow"))
+
+	w = serve("GET", "/missing.txt")
+	assert.Equal(404, w.Code)
+
+	_, err := NewFileHandler(fs, "/static/missing.txt")
+	assert.True(errors.Is(err, os.ErrNotExist), err)
+	_, err = NewFileHandler(fs, "/static")
+	assert.True(errors.Is(err, ErrIsDirectory), err)
+	handler, err := NewFileHandler(fs, "/static/favicon.ico")
+	require.NoError(err)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/anything/else", nil))
+	assert.Equal("icon", w.Body.String())
+}
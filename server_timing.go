@@ -0,0 +1,75 @@
+package zipfs
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// serverTimingKey is the context key for the serverTiming of a request.
+type serverTimingKey struct{}
+
+// serverTiming collects the durations of the stages of serving a request,
+// which are sent to the client in the Server-Timing header.
+type serverTiming struct {
+	start   time.Time
+	metrics []string
+	extract time.Duration
+}
+
+// withServerTiming returns a copy of the request with a serverTiming
+// that starts now.
+func withServerTiming(r *http.Request) *http.Request {
+	t := &serverTiming{start: time.Now()}
+	return r.WithContext(context.WithValue(r.Context(), serverTimingKey{}, t))
+}
+
+// serverTimingFrom returns the serverTiming of the request,
+// or nil if WithServerTiming is not used.
+func serverTimingFrom(r *http.Request) *serverTiming {
+	t, _ := r.Context().Value(serverTimingKey{}).(*serverTiming)
+	return t
+}
+
+// formatMetric formats a Server-Timing metric with the duration d and
+// the description desc, which may be empty.
+func formatMetric(name string, d time.Duration, desc string) string {
+	metric := name + ";dur=" + strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', 3, 64)
+	if desc != "" {
+		metric += `;desc="` + desc + `"`
+	}
+	return metric
+}
+
+// add records a metric for the Server-Timing header.
+func (t *serverTiming) add(name string, d time.Duration, desc string) {
+	t.metrics = append(t.metrics, formatMetric(name, d, desc))
+}
+
+// lookupDone records the time taken to find the file to serve,
+// and sets the Server-Timing header.
+func (t *serverTiming) lookupDone(w http.ResponseWriter) {
+	t.add("zipfs-lookup", time.Since(t.start), "")
+	w.Header().Set("Server-Timing", strings.Join(t.metrics, ", "))
+}
+
+// extractDone records the time taken to extract the contents of a file
+// that began at start, and updates the Server-Timing header. The
+// description says how the file was extracted: "cold" for a new
+// temporary file, "cached" for an existing one, "memory" or "index".
+func (t *serverTiming) extractDone(w http.ResponseWriter, start time.Time, desc string) {
+	t.extract = time.Since(start)
+	t.add("zipfs-extract", t.extract, desc)
+	w.Header().Set("Server-Timing", strings.Join(t.metrics, ", "))
+}
+
+// sendDone records the time taken to send the body that began at start,
+// not counting any extraction, in a Server-Timing trailer. The trailer
+// only reaches the client over HTTP/2, because responses with a known
+// length are not chunked in HTTP/1.1.
+func (t *serverTiming) sendDone(w http.ResponseWriter, start time.Time) {
+	d := time.Since(start) - t.extract
+	w.Header().Set(http.TrailerPrefix+"Server-Timing", formatMetric("zipfs-send", d, ""))
+}
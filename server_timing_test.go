@@ -0,0 +1,83 @@
+package zipfs
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServerTiming(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	fs, err := New("testdata/testdata.zip", WithMemorySeekLimit(0))
+	require.NoError(err)
+	defer fs.Close()
+	handler := FileServer(fs, WithServerTiming())
+
+	server := httptest.NewUnstartedServer(handler)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+
+	get := func(path string, headers ...string) *http.Response {
+		req, err := http.NewRequest("GET", server.URL+path, nil)
+		require.NoError(err)
+		for i := 0; i+1 < len(headers); i += 2 {
+			req.Header.Set(headers[i], headers[i+1])
+		}
+		resp, err := server.Client().Do(req)
+		require.NoError(err)
+		_, err = io.ReadAll(resp.Body)
+		require.NoError(err)
+		resp.Body.Close()
+		return resp
+	}
+
+	metric := func(name, desc string) *regexp.Regexp {
+		pattern := `\b` + name + `;dur=\d+\.\d{3}`
+		if desc != "" {
+			pattern += `;desc="` + desc + `"`
+		}
+		return regexp.MustCompile(pattern)
+	}
+
+	// a range of a deflated file is extracted to a temporary file
+	resp := get("/img/circle.png", "Range", "bytes=0-9")
+	assert.Equal(206, resp.StatusCode)
+	assert.Equal(2, resp.ProtoMajor)
+	timing := resp.Header.Get("Server-Timing")
+	assert.Regexp(metric("zipfs-lookup", ""), timing)
+	assert.Regexp(metric("zipfs-extract", "cold"), timing)
+	assert.Regexp(metric("zipfs-send", ""), resp.Trailer.Get("Server-Timing"))
+
+	resp = get("/img/circle.png", "Range", "bytes=10-19")
+	assert.Equal(206, resp.StatusCode)
+	assert.Regexp(metric("zipfs-extract", "cached"), resp.Header.Get("Server-Timing"))
+
+	// small files are decompressed into memory by default
+	fs2, err := New("testdata/testdata.zip")
+	require.NoError(err)
+	defer fs2.Close()
+	w := serveTestRequest(FileServer(fs2, WithServerTiming()), "GET", "/img/circle.png", "Range: bytes=0-9")
+	assert.Equal(206, w.status)
+	assert.Regexp(metric("zipfs-extract", "memory"), w.Header().Get("Server-Timing"))
+
+	// no extraction for the whole file
+	resp = get("/img/circle.png")
+	assert.Equal(200, resp.StatusCode)
+	timing = resp.Header.Get("Server-Timing")
+	assert.Regexp(metric("zipfs-lookup", ""), timing)
+	assert.NotContains(timing, "zipfs-extract")
+	assert.Regexp(metric("zipfs-send", ""), resp.Trailer.Get("Server-Timing"))
+
+	// off by default
+	w = serveTestRequest(FileServer(fs), "GET", "/img/circle.png", "Range: bytes=0-9")
+	assert.Equal(206, w.status)
+	assert.Empty(w.Header().Get("Server-Timing"))
+}
@@ -0,0 +1,123 @@
+package zipfs
+
+import (
+	"archive/zip"
+	"path"
+	"sort"
+	"strings"
+)
+
+// maxLargestEntries is the number of entries in Stats.Largest.
+const maxLargestEntries = 10
+
+// Stats contains aggregate information about the entries in the ZIP
+// file of a file system.
+type Stats struct {
+	// Entries is the number of entries, including directories.
+	Entries int
+
+	// Files is the number of files, and Dirs is the
+	// number of entries for directories.
+	Files int
+	Dirs  int
+
+	// Size and CompressedSize are the total sizes of the files.
+	Size           int64
+	CompressedSize int64
+
+	// Store, Deflate and OtherMethods are the numbers of files
+	// compressed with each method.
+	Store        int
+	Deflate      int
+	OtherMethods int
+
+	// Largest contains the largest files by uncompressed size,
+	// largest first, up to ten of them.
+	Largest []EntryStats
+
+	// Extensions contains the totals for the files with each
+	// extension, in lower case and including the dot, such as
+	// ".html". Files without an extension are under "".
+	Extensions map[string]ExtensionStats
+}
+
+// EntryStats describes a file in Stats.
+type EntryStats struct {
+	Name           string
+	Size           int64
+	CompressedSize int64
+}
+
+// ExtensionStats contains the totals for an extension in Stats.
+type ExtensionStats struct {
+	Files          int
+	Size           int64
+	CompressedSize int64
+}
+
+// Stats returns aggregate information about the entries in the ZIP file,
+// calculated from its central directory without reading any files. The
+// information is calculated the first time Stats is called.
+func (fs *FileSystem) Stats() Stats {
+	fs.statsOnce.Do(func() {
+		if fs.reader != nil {
+			fs.stats = calcStats(fs.reader.File)
+		}
+	})
+	stats := fs.stats
+	stats.Largest = append([]EntryStats(nil), stats.Largest...)
+	stats.Extensions = make(map[string]ExtensionStats, len(fs.stats.Extensions))
+	for ext, extStats := range fs.stats.Extensions {
+		stats.Extensions[ext] = extStats
+	}
+	return stats
+}
+
+// calcStats returns the Stats for the entries of a ZIP file.
+func calcStats(files []*zip.File) Stats {
+	stats := Stats{
+		Entries:    len(files),
+		Extensions: make(map[string]ExtensionStats),
+	}
+	var entries []EntryStats
+	for _, zf := range files {
+		if zf.Mode().IsDir() {
+			stats.Dirs++
+			continue
+		}
+		entry := EntryStats{
+			Name:           "/" + zf.Name,
+			Size:           uncompressedSize(zf),
+			CompressedSize: compressedSize(zf),
+		}
+		entries = append(entries, entry)
+		stats.Files++
+		stats.Size += entry.Size
+		stats.CompressedSize += entry.CompressedSize
+		switch zf.Method {
+		case zip.Store:
+			stats.Store++
+		case zip.Deflate:
+			stats.Deflate++
+		default:
+			stats.OtherMethods++
+		}
+		ext := strings.ToLower(path.Ext(zf.Name))
+		extStats := stats.Extensions[ext]
+		extStats.Files++
+		extStats.Size += entry.Size
+		extStats.CompressedSize += entry.CompressedSize
+		stats.Extensions[ext] = extStats
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].Size != entries[j].Size {
+			return entries[i].Size > entries[j].Size
+		}
+		return entries[i].Name < entries[j].Name
+	})
+	if len(entries) > maxLargestEntries {
+		entries = entries[:maxLargestEntries]
+	}
+	stats.Largest = entries
+	return stats
+}
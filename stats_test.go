@@ -0,0 +1,58 @@
+package zipfs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStats(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	fs, err := New("testdata/testdata.zip")
+	require.NoError(err)
+	defer fs.Close()
+
+	stats := fs.Stats()
+	assert.Equal(31, stats.Entries)
+	assert.Equal(27, stats.Files)
+	assert.Equal(4, stats.Dirs)
+	assert.Equal(int64(22406), stats.Size)
+	assert.Equal(int64(19894), stats.CompressedSize)
+	assert.Equal(23, stats.Store)
+	assert.Equal(4, stats.Deflate)
+	assert.Equal(0, stats.OtherMethods)
+	assert.Equal([]EntryStats{
+		{Name: "/random.dat", Size: 10000, CompressedSize: 10000},
+		{Name: "/img/another-circle.png", Size: 5973, CompressedSize: 4758},
+		{Name: "/img/circle.png", Size: 5973, CompressedSize: 4758},
+		{Name: "/test.html", Size: 134, CompressedSize: 89},
+		{Name: "/index.html", Size: 122, CompressedSize: 85},
+		{Name: "/js/application-23a0..js", Size: 79, CompressedSize: 79},
+		{Name: "/not-a-zip-file.txt", Size: 25, CompressedSize: 25},
+		{Name: "/lots-of-files/file-01", Size: 5, CompressedSize: 5},
+		{Name: "/lots-of-files/file-02", Size: 5, CompressedSize: 5},
+		{Name: "/lots-of-files/file-03", Size: 5, CompressedSize: 5},
+	}, stats.Largest)
+	assert.Equal(map[string]ExtensionStats{
+		"":      {Files: 20, Size: 100, CompressedSize: 100},
+		".png":  {Files: 2, Size: 11946, CompressedSize: 9516},
+		".html": {Files: 2, Size: 256, CompressedSize: 174},
+		".js":   {Files: 1, Size: 79, CompressedSize: 79},
+		".txt":  {Files: 1, Size: 25, CompressedSize: 25},
+		".dat":  {Files: 1, Size: 10000, CompressedSize: 10000},
+	}, stats.Extensions)
+
+	// the result can be modified
+	stats.Largest[0].Name = "changed"
+	stats.Extensions[".png"] = ExtensionStats{}
+	stats = fs.Stats()
+	assert.Equal("/random.dat", stats.Largest[0].Name)
+	assert.Equal(2, stats.Extensions[".png"].Files)
+
+	// the stats are kept after the file system is closed
+	fs.Close()
+	assert.Equal(31, fs.Stats().Entries)
+}
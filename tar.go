@@ -0,0 +1,128 @@
+package zipfs
+
+import (
+	"archive/tar"
+	"io"
+	iofs "io/fs"
+	"os"
+	"strings"
+)
+
+// TarOption configures TarTo.
+type TarOption func(opts *tarOptions)
+
+type tarOptions struct {
+	prefix   string
+	uid, gid int
+}
+
+// WithTarPrefix causes TarTo to prepend prefix to the names in the
+// tar stream, so that with the prefix "srv/www/" the file "/index.html"
+// is written as "srv/www/index.html". Entries for the directories in
+// the prefix are written first.
+func WithTarPrefix(prefix string) TarOption {
+	return func(opts *tarOptions) {
+		prefix = strings.Trim(prefix, "/")
+		if prefix != "" {
+			prefix += "/"
+		}
+		opts.prefix = prefix
+	}
+}
+
+// WithTarOwner sets the numeric user and group IDs of the entries
+// written by TarTo. The default is zero for both.
+func WithTarOwner(uid, gid int) TarOption {
+	return func(opts *tarOptions) {
+		opts.uid = uid
+		opts.gid = gid
+	}
+}
+
+// TarTo writes the files and directories in the file system to w as a
+// tar stream, with the permissions and modification times recorded in
+// the ZIP file, rounded to the second. Symbolic links are written as
+// links. The files are decompressed as they are written, so nothing is
+// written to disk.
+func (fs *FileSystem) TarTo(w io.Writer, opts ...TarOption) error {
+	var o tarOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if fs.reader == nil {
+		return ErrClosed
+	}
+	tw := tar.NewWriter(w)
+	for i := range o.prefix {
+		if o.prefix[i] != '/' {
+			continue
+		}
+		hdr := &tar.Header{
+			Typeflag: tar.TypeDir,
+			Name:     o.prefix[:i+1],
+			Mode:     0755,
+			ModTime:  dirTime,
+			Uid:      o.uid,
+			Gid:      o.gid,
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+	}
+	err := fs.Walk("/", func(name string, d iofs.DirEntry, err error) error {
+		if err != nil || name == "/" {
+			return err
+		}
+		info, _ := d.Info()
+		return writeTarEntry(tw, o.prefix+strings.TrimPrefix(name, "/"), info.(*fileInfo), &o)
+	})
+	if err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// writeTarEntry writes the file or directory fi to tw with the given name.
+func writeTarEntry(tw *tar.Writer, name string, fi *fileInfo, o *tarOptions) error {
+	hdr := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Mode:     0755,
+		ModTime:  fi.ModTime(),
+		Uid:      o.uid,
+		Gid:      o.gid,
+	}
+	zf := fi.zipFile
+	if zf != nil {
+		hdr.Mode = int64(zf.Mode().Perm())
+		hdr.ModTime = zf.Modified
+	}
+	if fi.IsDir() {
+		hdr.Typeflag = tar.TypeDir
+		hdr.Name += "/"
+		return tw.WriteHeader(hdr)
+	}
+
+	r, err := zf.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	if zf.Mode()&os.ModeSymlink != 0 {
+		target, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		hdr.Typeflag = tar.TypeSymlink
+		hdr.Linkname = string(target)
+		return tw.WriteHeader(hdr)
+	}
+	hdr.Size = fi.Size()
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	buf := bufPool.Get()
+	defer bufPool.Free(buf)
+	_, err = io.CopyBuffer(tw, r, buf)
+	return err
+}
@@ -0,0 +1,102 @@
+package zipfs
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/spexp/zipfs/zipfstest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTarTo(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	fs, err := New("testdata/testdata.zip")
+	require.NoError(err)
+	defer fs.Close()
+
+	var buf bytes.Buffer
+	require.NoError(fs.TarTo(&buf, WithTarPrefix("/srv/www"), WithTarOwner(1000, 100)))
+	tr := tar.NewReader(&buf)
+
+	hdr, err := tr.Next()
+	require.NoError(err)
+	assert.Equal("srv/", hdr.Name)
+	hdr, err = tr.Next()
+	require.NoError(err)
+	assert.Equal("srv/www/", hdr.Name)
+	assert.Equal(byte(tar.TypeDir), hdr.Typeflag)
+
+	var names []string
+	source := make(map[string]*zip.File)
+	for _, zf := range fs.reader.File {
+		names = append(names, "srv/www/"+zf.Name)
+		source["srv/www/"+zf.Name] = zf
+	}
+	var tarNames []string
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(err)
+		tarNames = append(tarNames, hdr.Name)
+		assert.Equal(1000, hdr.Uid)
+		assert.Equal(100, hdr.Gid)
+
+		zf := source[hdr.Name]
+		require.NotNil(zf, hdr.Name)
+		assert.Equal(int64(zf.Mode().Perm()), hdr.Mode, hdr.Name)
+		assert.True(zf.Modified.Round(time.Second).Equal(hdr.ModTime), hdr.Name)
+		if zf.Mode().IsDir() {
+			assert.Equal(byte(tar.TypeDir), hdr.Typeflag)
+			continue
+		}
+		assert.Equal(byte(tar.TypeReg), hdr.Typeflag)
+		assert.Equal(int64(zf.UncompressedSize64), hdr.Size)
+		data, err := io.ReadAll(tr)
+		require.NoError(err)
+		want, err := readZipFile(zf)
+		require.NoError(err)
+		assert.Equal(want, data, hdr.Name)
+	}
+	assert.ElementsMatch(names, tarNames)
+}
+
+func TestTarToModes(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	fs := newBuilderFileSystem(t, zipfstest.NewBuilder().
+		AddFile("bin/run.sh", []byte("#!/bin/sh\n"), zipfstest.ModTime, 0755).
+		AddSymlink("bin/link", "../doc.txt").
+		AddFile("doc.txt", []byte("doc"), zipfstest.ModTime, 0600))
+	var buf bytes.Buffer
+	require.NoError(fs.TarTo(&buf))
+	tr := tar.NewReader(&buf)
+
+	expected := []tar.Header{
+		{Name: "bin/", Typeflag: tar.TypeDir, Mode: 0755},
+		{Name: "bin/link", Typeflag: tar.TypeSymlink, Mode: 0777, Linkname: "../doc.txt"},
+		{Name: "bin/run.sh", Typeflag: tar.TypeReg, Mode: 0755, Size: 10},
+		{Name: "doc.txt", Typeflag: tar.TypeReg, Mode: 0600, Size: 3},
+	}
+	for _, want := range expected {
+		hdr, err := tr.Next()
+		require.NoError(err)
+		assert.Equal(want.Name, hdr.Name)
+		assert.Equal(want.Typeflag, hdr.Typeflag, want.Name)
+		assert.Equal(want.Mode, hdr.Mode, want.Name)
+		assert.Equal(want.Linkname, hdr.Linkname, want.Name)
+		assert.Equal(want.Size, hdr.Size, want.Name)
+		assert.Equal(0, hdr.Uid)
+	}
+	_, err := tr.Next()
+	assert.Equal(io.EOF, err)
+}
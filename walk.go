@@ -0,0 +1,49 @@
+package zipfs
+
+import (
+	iofs "io/fs"
+	"path"
+)
+
+// Walk walks the tree rooted at root, calling fn for each file and
+// directory in the tree, including root, with the same contract as
+// fs.WalkDir: entries are visited in lexical order, directories before
+// their contents, fn may return fs.SkipDir or fs.SkipAll, and any other
+// error returned by fn stops the walk and is returned by Walk. The names
+// passed to fn are rooted, such as "/img/circle.png". Walk uses the
+// directory tree built when the file system was opened, so no files are
+// opened or read.
+func (fs *FileSystem) Walk(root string, fn iofs.WalkDirFunc) error {
+	fi, err := fs.openFileInfo(root)
+	root = path.Clean("/" + root)
+	if err != nil {
+		err = fn(root, nil, err)
+	} else {
+		err = walkDir(root, fi, fn)
+	}
+	if err == iofs.SkipDir || err == iofs.SkipAll {
+		return nil
+	}
+	return err
+}
+
+// walkDir calls fn for the file or directory fi at name and,
+// unless fn returns an error, for the contents of the directory.
+func walkDir(name string, fi *fileInfo, fn iofs.WalkDirFunc) error {
+	if err := fn(name, iofs.FileInfoToDirEntry(fi), nil); err != nil || !fi.IsDir() {
+		if err == iofs.SkipDir && fi.IsDir() {
+			// Skip the directory's contents.
+			err = nil
+		}
+		return err
+	}
+	for _, child := range fi.fileInfos {
+		if err := walkDir(path.Join(name, child.Name()), child, fn); err != nil {
+			if err == iofs.SkipDir {
+				break
+			}
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package zipfs
+
+import (
+	"errors"
+	iofs "io/fs"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWalk(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	fs, err := New("testdata/testdata.zip")
+	require.NoError(err)
+	defer fs.Close()
+
+	// walk collects the names visited, skipping the contents of
+	// lots-of-files and the rest of img after the first file.
+	walk := func(root string) ([]string, error) {
+		var names []string
+		err := fs.Walk(root, func(name string, d iofs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() && name != "/" {
+				name += "/"
+			}
+			names = append(names, name)
+			switch name {
+			case "/lots-of-files/":
+				return iofs.SkipDir
+			case "/img/another-circle.png":
+				return iofs.SkipDir
+			}
+			return nil
+		})
+		return names, err
+	}
+
+	names, err := walk("/")
+	require.NoError(err)
+	assert.Equal([]string{
+		"/",
+		"/empty/",
+		"/img/",
+		"/img/another-circle.png",
+		"/index.html",
+		"/js/",
+		"/js/application-23a0..js",
+		"/lots-of-files/",
+		"/not-a-zip-file.txt",
+		"/random.dat",
+		"/test.html",
+	}, names)
+
+	names, err = walk("js")
+	require.NoError(err)
+	assert.Equal([]string{"/js/", "/js/application-23a0..js"}, names)
+
+	names, err = walk("/index.html")
+	require.NoError(err)
+	assert.Equal([]string{"/index.html"}, names)
+
+	// SkipDir for the root ends the walk without an error
+	names, err = walk("/lots-of-files")
+	require.NoError(err)
+	assert.Equal([]string{"/lots-of-files/"}, names)
+
+	// the error for a missing root is passed to fn
+	_, err = walk("/missing")
+	assert.True(errors.Is(err, os.ErrNotExist), err)
+
+	// other errors from fn stop the walk
+	errStop := errors.New("stop")
+	count := 0
+	err = fs.Walk("/", func(name string, d iofs.DirEntry, err error) error {
+		count++
+		if name == "/img/circle.png" {
+			return errStop
+		}
+		return nil
+	})
+	assert.Equal(errStop, err)
+	assert.Equal(5, count)
+
+	count = 0
+	err = fs.Walk("/", func(name string, d iofs.DirEntry, err error) error {
+		count++
+		return iofs.SkipAll
+	})
+	assert.NoError(err)
+	assert.Equal(1, count)
+
+	// the entries describe the files
+	err = fs.Walk("/img/circle.png", func(name string, d iofs.DirEntry, err error) error {
+		require.NoError(err)
+		assert.Equal("circle.png", d.Name())
+		assert.False(d.IsDir())
+		info, err := d.Info()
+		require.NoError(err)
+		assert.Equal(int64(5973), info.Size())
+		return nil
+	})
+	assert.NoError(err)
+}
+
+func TestWalkSynthesizedDirs(t *testing.T) {
+	fs := newTestFileSystem(t, map[string]string{
+		"a/b/c.txt": "c",
+		"a/d.txt":   "d",
+		"a/":        "",
+	})
+	var names []string
+	err := fs.Walk("/", func(name string, d iofs.DirEntry, err error) error {
+		names = append(names, name)
+		return err
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"/", "/a", "/a/b", "/a/b/c.txt", "/a/d.txt"}, names)
+}
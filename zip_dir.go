@@ -0,0 +1,164 @@
+package zipfs
+
+import (
+	"archive/zip"
+	"encoding/binary"
+	"io"
+	iofs "io/fs"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+)
+
+// ZipDir writes a ZIP file to w containing the files in the directory
+// dir and its subdirectories, with names relative to dir. The files are
+// copied as they are stored in the file system's ZIP file, without
+// being decompressed and compressed again, so their compression methods,
+// modification times and CRC-32 checksums are preserved.
+func (fs *FileSystem) ZipDir(w io.Writer, dir string) error {
+	return fs.zipDir(w, dir, nil)
+}
+
+// zipDir implements ZipDir. If include is not nil, then only the files
+// and directories for which it returns true are written.
+func (fs *FileSystem) zipDir(w io.Writer, dir string, include func(name string, fi *fileInfo) bool) error {
+	d, err := fs.openFileInfo(dir)
+	if err != nil {
+		return err
+	}
+	dir = path.Clean("/" + dir)
+	if !d.IsDir() {
+		return &os.PathError{Op: "ZipDir", Path: dir, Err: ErrNotDirectory}
+	}
+	prefix := strings.TrimPrefix(dir+"/", "/")
+	if prefix == "/" {
+		prefix = ""
+	}
+
+	zw := zip.NewWriter(w)
+	err = fs.Walk(dir, func(name string, d iofs.DirEntry, err error) error {
+		if err != nil || name == dir {
+			return err
+		}
+		info, _ := d.Info()
+		fi := info.(*fileInfo)
+		if include != nil && !include(name, fi) {
+			if fi.IsDir() {
+				return iofs.SkipDir
+			}
+			return nil
+		}
+		// Directories without entries in the ZIP file are left out.
+		if fi.zipFile == nil {
+			return nil
+		}
+		return copyRaw(zw, fi.zipFile, strings.TrimPrefix(fi.zipFile.Name, prefix))
+	})
+	if err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// copyRaw copies the file zf to zw with the given name,
+// without decompressing it.
+func copyRaw(zw *zip.Writer, zf *zip.File, name string) error {
+	// Unlike CreateHeader, CreateRaw does not encode Modified, so the
+	// times are copied as they are, including the extra fields for
+	// more precise times. Nor does it detect UTF-8 names, so the flags
+	// are copied too, except for the data descriptor, which is not
+	// needed because the sizes and checksum are known.
+	fh := &zip.FileHeader{
+		Name:               name,
+		Comment:            zf.Comment,
+		Flags:              zf.Flags &^ 0x8,
+		Method:             zf.Method,
+		ModifiedTime:       zf.ModifiedTime,
+		ModifiedDate:       zf.ModifiedDate,
+		Extra:              withoutZip64Extra(zf.Extra),
+		CRC32:              zf.CRC32,
+		CompressedSize64:   zf.CompressedSize64,
+		UncompressedSize64: zf.UncompressedSize64,
+		ExternalAttrs:      zf.ExternalAttrs,
+		CreatorVersion:     zf.CreatorVersion,
+	}
+	w, err := zw.CreateRaw(fh)
+	if err != nil {
+		return err
+	}
+	if strings.HasSuffix(name, "/") {
+		return nil
+	}
+	r, err := zf.OpenRaw()
+	if err != nil {
+		return err
+	}
+	buf := bufPool.Get()
+	defer bufPool.Free(buf)
+	_, err = io.CopyBuffer(w, r, buf)
+	return err
+}
+
+// withoutZip64Extra returns the extra fields of a ZIP file header
+// without the Zip64 field, which the zip.Writer adds when it is needed.
+func withoutZip64Extra(extra []byte) []byte {
+	var fields []byte
+	for len(extra) >= 4 {
+		tag := binary.LittleEndian.Uint16(extra)
+		size := 4 + int(binary.LittleEndian.Uint16(extra[2:]))
+		if size > len(extra) {
+			break
+		}
+		if tag != zip64ExtraID {
+			fields = append(fields, extra[:size]...)
+		}
+		extra = extra[size:]
+	}
+	return fields
+}
+
+// zip64ExtraID is the header ID of the Zip64 extended information field.
+const zip64ExtraID = 0x0001
+
+// canDownload reports whether the file or directory fi at name would be
+// served, and so can be included in a directory download. The checks
+// are the same as for requesting it, but nothing is sent.
+func (h *fileHandler) canDownload(r *http.Request, name string, fi *fileInfo) bool {
+	if h.isHidden(name) {
+		return false
+	}
+	if !fi.IsDir() {
+		if !h.isAllowed(name) {
+			return false
+		}
+		if h.maxServeSize > 0 && fi.Size() > h.maxServeSize {
+			return false
+		}
+	}
+	return h.accessCheck == nil || h.accessCheck(r, name, fi) == nil
+}
+
+// serveDirZip responds to a request for the directory at name with a
+// ZIP file of the files in it that can be served. The access check for
+// the directory itself has already been made.
+func (h *fileHandler) serveDirZip(w http.ResponseWriter, r *http.Request, name string) {
+	filename := path.Base(name) + ".zip"
+	if name == "/" {
+		filename = "files.zip"
+	}
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", contentDisposition(filename))
+	// The ZIP file is written as it is created, so its length is unknown.
+	w.WriteHeader(http.StatusOK)
+	if r.Method == "HEAD" {
+		return
+	}
+	tw := h.bodyWriter(w, r)
+	err := h.fs.zipDir(tw, name, func(name string, fi *fileInfo) bool {
+		return h.canDownload(r, name, fi)
+	})
+	if err != nil {
+		h.logError(r, newBodyError(r, name, tw.written, tw.err, err))
+	}
+}
@@ -0,0 +1,213 @@
+package zipfs
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestZipDir(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	fs, err := New("testdata/testdata.zip")
+	require.NoError(err)
+	defer fs.Close()
+
+	source := make(map[string]*zip.File)
+	for _, zf := range fs.reader.File {
+		source[zf.Name] = zf
+	}
+
+	testCases := []struct {
+		Dir    string
+		Prefix string
+		Names  []string
+	}{
+		{Dir: "/img", Prefix: "img/", Names: []string{"another-circle.png", "circle.png"}},
+		{Dir: "img/", Prefix: "img/", Names: []string{"another-circle.png", "circle.png"}},
+		{Dir: "/empty", Prefix: "empty/", Names: []string{}},
+	}
+	for _, tc := range testCases {
+		var buf bytes.Buffer
+		require.NoError(fs.ZipDir(&buf, tc.Dir), tc.Dir)
+		zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		require.NoError(err, tc.Dir)
+
+		names := []string{}
+		for _, zf := range zr.File {
+			names = append(names, zf.Name)
+			src := source[tc.Prefix+zf.Name]
+			require.NotNil(src, zf.Name)
+			assert.Equal(src.CRC32, zf.CRC32, zf.Name)
+			assert.Equal(src.Method, zf.Method, zf.Name)
+			assert.Equal(src.CompressedSize64, zf.CompressedSize64, zf.Name)
+			assert.True(src.Modified.Equal(zf.Modified), zf.Name)
+
+			// the contents are intact
+			want, err := readZipFile(src)
+			require.NoError(err)
+			got, err := readZipFile(zf)
+			require.NoError(err)
+			assert.Equal(want, got, zf.Name)
+		}
+		assert.Equal(tc.Names, names, tc.Dir)
+	}
+
+	// the whole file system, including subdirectories
+	var buf bytes.Buffer
+	require.NoError(fs.ZipDir(&buf, "/"))
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(err)
+	assert.Equal(len(fs.reader.File), len(zr.File))
+
+	err = fs.ZipDir(&buf, "/index.html")
+	assert.True(errors.Is(err, ErrNotDirectory), err)
+	err = fs.ZipDir(&buf, "/missing")
+	assert.True(errors.Is(err, os.ErrNotExist), err)
+}
+
+func TestCopyRawUTF8(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	fs := newTestFileSystem(t, map[string]string{
+		"d/héllo.txt": "bonjour",
+		"d/plain.txt": "hello",
+	})
+	for _, zf := range fs.reader.File {
+		if zf.Name == "d/héllo.txt" {
+			require.NotZero(zf.Flags&0x800, "UTF-8 flag in source")
+		}
+	}
+
+	check := func(what string, data []byte, name string) {
+		t.Helper()
+		zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		require.NoError(err, what)
+		for _, zf := range zr.File {
+			if zf.Name != name {
+				continue
+			}
+			assert.NotZero(zf.Flags&0x800, what)
+			assert.Zero(zf.Flags&0x8, what)
+			assert.False(zf.NonUTF8, what)
+			got, err := readZipFile(zf)
+			require.NoError(err, what)
+			assert.Equal("bonjour", string(got), what)
+			return
+		}
+		assert.Fail("missing "+name, what)
+	}
+
+	var buf bytes.Buffer
+	require.NoError(fs.ZipDir(&buf, "/d"))
+	check("ZipDir", buf.Bytes(), "héllo.txt")
+
+	buf.Reset()
+	zw := zip.NewWriter(&buf)
+	require.NoError(fs.CopyTo(zw))
+	require.NoError(zw.Close())
+	check("CopyTo", buf.Bytes(), "d/héllo.txt")
+
+	buf.Reset()
+	cow := NewCOW(fs)
+	defer cow.Close()
+	require.NoError(cow.WriteFile("/new.txt", []byte("new")))
+	require.NoError(cow.Save(&buf))
+	check("Save", buf.Bytes(), "d/héllo.txt")
+}
+
+func TestDirectoryDownload(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	fs := newTestFileSystem(t, map[string]string{
+		"docs/":           "",
+		"docs/index.html": "<html></html>",
+		"docs/guide.txt":  "guide",
+		"docs/a/b.txt":    "b",
+		"docs/secret.key": "key",
+		"docs/.hidden":    "hidden",
+	})
+	handler := FileServer(fs, WithDirectoryDownload(), WithDeny("*.key"), WithoutDotfiles())
+
+	w := serveTestRequest(handler, "GET", "/docs/?download=zip")
+	require.Equal(200, w.status)
+	assert.Equal("application/zip", w.Header().Get("Content-Type"))
+	assert.Equal(`attachment; filename="docs.zip"`, w.Header().Get("Content-Disposition"))
+	zr, err := zip.NewReader(bytes.NewReader(w.buf.Bytes()), int64(w.buf.Len()))
+	require.NoError(err)
+	var names []string
+	for _, zf := range zr.File {
+		names = append(names, zf.Name)
+	}
+	sort.Strings(names)
+	assert.Equal([]string{"a/b.txt", "guide.txt", "index.html"}, names)
+
+	w = serveTestRequest(handler, "GET", "/?download=zip")
+	require.Equal(200, w.status)
+	assert.Equal(`attachment; filename="files.zip"`, w.Header().Get("Content-Disposition"))
+
+	// the index is served otherwise
+	w = serveTestRequest(handler, "GET", "/docs/")
+	assert.Equal("<html></html>", w.buf.String())
+
+	// files are not affected
+	w = serveTestRequest(handler, "GET", "/docs/guide.txt?download=zip")
+	assert.Equal("guide", w.buf.String())
+
+	// off by default
+	w = serveTestRequest(FileServer(fs), "GET", "/docs/?download=zip")
+	assert.Equal("<html></html>", w.buf.String())
+}
+
+func TestDirectoryDownloadChecks(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	fs := newTestFileSystem(t, map[string]string{
+		"img/a.txt":         "a",
+		"img/secret.txt":    "s",
+		"img/big.txt":       "big file",
+		"img/private/b.txt": "b",
+		"private/c.txt":     "c",
+	})
+	handler := FileServer(fs, WithDirectoryDownload(), WithMaxServeSize(5),
+		WithAccessCheck(func(r *http.Request, name string, fi os.FileInfo) error {
+			if name == "/img/secret.txt" || strings.HasPrefix(name, "/private") || name == "/img/private" {
+				return errors.New("denied")
+			}
+			return nil
+		}))
+
+	// the files cannot be requested directly
+	for _, name := range []string{"/img/secret.txt", "/img/big.txt"} {
+		w := serveTestRequest(handler, "GET", name)
+		assert.Equal(403, w.status, name)
+	}
+
+	// nor are they in the download
+	w := serveTestRequest(handler, "GET", "/img/?download=zip")
+	require.Equal(200, w.status)
+	zr, err := zip.NewReader(bytes.NewReader(w.buf.Bytes()), int64(w.buf.Len()))
+	require.NoError(err)
+	var names []string
+	for _, zf := range zr.File {
+		names = append(names, zf.Name)
+	}
+	assert.Equal([]string{"a.txt"}, names)
+
+	// a directory that cannot be accessed cannot be downloaded
+	w = serveTestRequest(handler, "GET", "/private/?download=zip")
+	assert.Equal(403, w.status)
+	assert.NotEqual("application/zip", w.Header().Get("Content-Type"))
+}
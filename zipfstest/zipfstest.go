@@ -0,0 +1,131 @@
+// Package zipfstest builds ZIP files for tests of code that uses
+// package zipfs, so that fixtures can be constructed in code rather
+// than kept as binary files in testdata.
+//
+// A Builder adds entries in the order that its methods are called, and
+// records the first error, which is returned by Bytes or WriteTo, so
+// that calls can be chained:
+//
+//	data, err := zipfstest.NewBuilder().
+//		AddDir("bin/").
+//		AddFile("bin/run.sh", []byte("#!/bin/sh\n"), zipfstest.ModTime, 0755).
+//		AddSymlink("run.sh", "bin/run.sh").
+//		Bytes()
+package zipfstest
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"strings"
+	"time"
+)
+
+// ModTime is the modification time of the entries added by the
+// methods of Builder that do not take a time.
+var ModTime = time.Date(2020, 1, 2, 3, 4, 6, 0, time.UTC)
+
+var errClosed = errors.New("zipfstest: entry added after the ZIP file was finished")
+
+// Builder builds a ZIP file in memory.
+type Builder struct {
+	buf  bytes.Buffer
+	zw   *zip.Writer
+	err  error
+	done bool
+}
+
+// NewBuilder returns a Builder for an empty ZIP file.
+func NewBuilder() *Builder {
+	b := &Builder{}
+	b.zw = zip.NewWriter(&b.buf)
+	return b
+}
+
+// AddFile adds a file compressed using deflate, with the given
+// modification time and permissions.
+func (b *Builder) AddFile(name string, data []byte, modTime time.Time, mode fs.FileMode) *Builder {
+	return b.add(name, data, modTime, mode, zip.Deflate)
+}
+
+// AddStored adds a file that is stored without compression,
+// with the permissions 0644.
+func (b *Builder) AddStored(name string, data []byte) *Builder {
+	return b.add(name, data, ModTime, 0644, zip.Store)
+}
+
+// AddDeflated adds a file compressed using deflate,
+// with the permissions 0644.
+func (b *Builder) AddDeflated(name string, data []byte) *Builder {
+	return b.add(name, data, ModTime, 0644, zip.Deflate)
+}
+
+// AddDir adds an entry for a directory. A slash is
+// appended to the name if it does not end in one.
+func (b *Builder) AddDir(name string) *Builder {
+	if !strings.HasSuffix(name, "/") {
+		name += "/"
+	}
+	return b.add(name, nil, ModTime, fs.ModeDir|0755, zip.Store)
+}
+
+// AddSymlink adds a symbolic link to target, which
+// is stored as the contents of the entry.
+func (b *Builder) AddSymlink(name, target string) *Builder {
+	return b.add(name, []byte(target), ModTime, fs.ModeSymlink|0777, zip.Store)
+}
+
+// SetComment sets the comment of the ZIP file.
+func (b *Builder) SetComment(comment string) *Builder {
+	if b.err == nil && !b.done {
+		b.err = b.zw.SetComment(comment)
+	}
+	return b
+}
+
+func (b *Builder) add(name string, data []byte, modTime time.Time, mode fs.FileMode, method uint16) *Builder {
+	if b.err != nil {
+		return b
+	}
+	if b.done {
+		b.err = errClosed
+		return b
+	}
+	fh := &zip.FileHeader{
+		Name:     name,
+		Method:   method,
+		Modified: modTime,
+	}
+	fh.SetMode(mode)
+	w, err := b.zw.CreateHeader(fh)
+	if err == nil {
+		_, err = w.Write(data)
+	}
+	b.err = err
+	return b
+}
+
+// Bytes returns the ZIP file, or the first error from building it. No
+// more entries can be added after the first call to Bytes or WriteTo.
+func (b *Builder) Bytes() ([]byte, error) {
+	if b.err == nil && !b.done {
+		b.err = b.zw.Close()
+		b.done = true
+	}
+	if b.err != nil {
+		return nil, b.err
+	}
+	return b.buf.Bytes(), nil
+}
+
+// WriteTo writes the ZIP file to w. It implements io.WriterTo.
+func (b *Builder) WriteTo(w io.Writer) (int64, error) {
+	data, err := b.Bytes()
+	if err != nil {
+		return 0, err
+	}
+	n, err := w.Write(data)
+	return int64(n), err
+}
@@ -0,0 +1,75 @@
+package zipfstest
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"io/fs"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuilder(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	modTime := time.Date(2024, 5, 6, 7, 8, 10, 0, time.UTC)
+	b := NewBuilder().
+		AddDir("bin").
+		AddFile("bin/run.sh", []byte("#!/bin/sh\n"), modTime, 0755).
+		AddSymlink("run", "bin/run.sh").
+		AddStored("data.bin", []byte{1, 2, 3}).
+		AddDeflated("index.html", []byte("<html></html>")).
+		SetComment("fixture")
+	data, err := b.Bytes()
+	require.NoError(err)
+
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	require.NoError(err)
+	assert.Equal("fixture", zr.Comment)
+
+	expected := []struct {
+		Name    string
+		Method  uint16
+		Mode    fs.FileMode
+		ModTime time.Time
+		Data    string
+	}{
+		{Name: "bin/", Method: zip.Store, Mode: fs.ModeDir | 0755, ModTime: ModTime},
+		{Name: "bin/run.sh", Method: zip.Deflate, Mode: 0755, ModTime: modTime, Data: "#!/bin/sh\n"},
+		{Name: "run", Method: zip.Store, Mode: fs.ModeSymlink | 0777, ModTime: ModTime, Data: "bin/run.sh"},
+		{Name: "data.bin", Method: zip.Store, Mode: 0644, ModTime: ModTime, Data: "\x01\x02\x03"},
+		{Name: "index.html", Method: zip.Deflate, Mode: 0644, ModTime: ModTime, Data: "<html></html>"},
+	}
+	require.Len(zr.File, len(expected))
+	for i, want := range expected {
+		zf := zr.File[i]
+		assert.Equal(want.Name, zf.Name)
+		assert.Equal(want.Method, zf.Method, want.Name)
+		assert.Equal(want.Mode, zf.Mode(), want.Name)
+		assert.True(want.ModTime.Equal(zf.Modified), want.Name)
+		r, err := zf.Open()
+		require.NoError(err)
+		got, err := io.ReadAll(r)
+		require.NoError(err)
+		assert.Equal(want.Data, string(got), want.Name)
+	}
+
+	// the ZIP file is finished
+	var buf bytes.Buffer
+	n, err := b.WriteTo(&buf)
+	require.NoError(err)
+	assert.Equal(int64(len(data)), n)
+	assert.Equal(data, buf.Bytes())
+	_, err = b.AddStored("late.txt", nil).Bytes()
+	assert.Equal(errClosed, err)
+
+	// the first error is kept
+	_, err = NewBuilder().AddStored("dir/", []byte("data")).AddStored("a", nil).Bytes()
+	assert.Error(err)
+	_, err = NewBuilder().SetComment(string(make([]byte, 1<<16))).AddStored("a", nil).WriteTo(&buf)
+	assert.Error(err)
+}